@@ -0,0 +1,82 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"os"
+	"os/user"
+)
+
+// Purger interface is implemented by daemons which are able to remove
+// everything they have created: the service, its directories and its account
+type Purger interface {
+	// Purge - remove the service, its log, state and runtime directories
+	// and the account of the service if it was created by Install
+	Purge() (string, error)
+}
+
+// Create the system account of the service if the definition asks for it
+// and the account does not exist yet
+func (properties *ServiceProperties) ensureAccount() error {
+	def := &properties.def
+	if !def.CreateUser || def.User == "" {
+		return nil
+	}
+	if offline() {
+		return properties.ensureImageAccount()
+	}
+	createGroup := false
+	if def.Group != "" {
+		if _, err := user.LookupGroup(def.Group); err != nil {
+			createGroup = true
+		}
+	}
+	if _, err := user.Lookup(def.User); err == nil && !createGroup {
+		return nil
+	}
+	if err := createAccount(def.User, def.Group, def.Description, createGroup); err != nil {
+		return err
+	}
+	properties.notice(NoticeUserCreated, "Created the system account "+def.User, def.User)
+	return nil
+}
+
+// Create the system account of the service in the offline image
+func (properties *ServiceProperties) ensureImageAccount() error {
+	def := &properties.def
+	createGroup := def.Group != "" && !imageEntry("/etc/group", def.Group)
+	if imageEntry("/etc/passwd", def.User) && !createGroup {
+		return nil
+	}
+	if err := createImageAccount(PathPrefix(), def.User, def.Group, def.Description, createGroup); err != nil {
+		return err
+	}
+	properties.notice(NoticeUserCreated, "Created the system account "+def.User+" in the image", def.User)
+	return nil
+}
+
+// Remove the directories, the configuration files and the account of the service
+func (properties *ServiceProperties) purge(kind Kind) error {
+	def := &properties.def
+	for _, dir := range serviceDirectories(kind, def) {
+		if err := os.RemoveAll(rooted(dir)); err != nil {
+			return err
+		}
+	}
+	if err := removeConfigFiles(def); err != nil {
+		return err
+	}
+	if err := os.Remove(NextBootMarker(def)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// the accounts of an offline image are kept
+	if !def.CreateUser || def.User == "" || offline() {
+		return nil
+	}
+	if _, err := user.Lookup(def.User); err != nil {
+		return nil
+	}
+	return deleteAccount(def.User, def.Group)
+}
@@ -0,0 +1,104 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// Range of the ids of system accounts which are hidden from the login window
+const (
+	firstSystemID = 200
+	lastSystemID  = 499
+)
+
+// Create a hidden system account by dscl, without a group
+// it gets its own group of the same name
+func createAccount(name, group, description string, createGroup bool) error {
+	if group == "" {
+		group, createGroup = name, true
+		if _, err := user.LookupGroup(group); err == nil {
+			createGroup = false
+		}
+	}
+	if createGroup {
+		gid, err := freeID("/Groups", "PrimaryGroupID")
+		if err != nil {
+			return err
+		}
+		if err := dscl("-create", "/Groups/"+group, "PrimaryGroupID", gid); err != nil {
+			return err
+		}
+	}
+	if _, err := user.Lookup(name); err == nil {
+		return nil
+	}
+	primary, err := user.LookupGroup(group)
+	if err != nil {
+		return err
+	}
+	uid, err := freeID("/Users", "UniqueID")
+	if err != nil {
+		return err
+	}
+	for _, property := range [][]string{
+		{"UniqueID", uid},
+		{"PrimaryGroupID", primary.Gid},
+		{"UserShell", "/usr/bin/false"},
+		{"NFSHomeDirectory", "/var/empty"},
+		{"RealName", description},
+		{"IsHidden", "1"},
+	} {
+		if err := dscl(append([]string{"-create", "/Users/" + name}, property...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete the account, a group is deleted if nobody else uses it
+func deleteAccount(name, group string) error {
+	if err := dscl("-delete", "/Users/"+name); err != nil {
+		return err
+	}
+	if group == "" {
+		group = name
+	}
+	dscl("-delete", "/Groups/"+group)
+	return nil
+}
+
+// First id of the system range which is not used by any record
+func freeID(records, property string) (string, error) {
+	output, err := exec.Command("dscl", ".", "-list", records, property).Output()
+	if err != nil {
+		return "", err
+	}
+	used := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			used[fields[1]] = true
+		}
+	}
+	for id := firstSystemID; id <= lastSystemID; id++ {
+		if !used[strconv.Itoa(id)] {
+			return strconv.Itoa(id), nil
+		}
+	}
+	return "", errors.New("No free id for a system account")
+}
+
+func dscl(args ...string) error {
+	return exec.Command("dscl", append([]string{"."}, args...)...).Run()
+}
+
+// Accounts of offline images are only created on linux
+func createImageAccount(root, name, group, description string, createGroup bool) error {
+	return ErrUnsupportedSystem
+}
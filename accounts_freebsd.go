@@ -0,0 +1,44 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"os/exec"
+	"os/user"
+)
+
+// Create a system account without a home directory and a login shell,
+// without a group pw creates its own group of the same name
+func createAccount(name, group, description string, createGroup bool) error {
+	if createGroup {
+		if err := exec.Command("pw", "groupadd", group).Run(); err != nil {
+			return err
+		}
+	}
+	if _, err := user.Lookup(name); err == nil {
+		return nil
+	}
+	args := []string{"useradd", name, "-d", "/nonexistent", "-s", "/usr/sbin/nologin", "-c", description}
+	if group != "" {
+		args = append(args, "-g", group)
+	}
+	return exec.Command("pw", args...).Run()
+}
+
+// Delete the account, a named group is deleted if nobody else uses it
+func deleteAccount(name, group string) error {
+	if err := exec.Command("pw", "userdel", name).Run(); err != nil {
+		return err
+	}
+	if group != "" {
+		exec.Command("pw", "groupdel", group).Run()
+	}
+	return nil
+}
+
+// Accounts of offline images are only created on linux
+func createImageAccount(root, name, group, description string, createGroup bool) error {
+	return ErrUnsupportedSystem
+}
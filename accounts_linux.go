@@ -0,0 +1,63 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"os/exec"
+	"os/user"
+)
+
+// Create a system account without a home directory and a login shell,
+// without a group it gets its own group of the same name
+func createAccount(name, group, description string, createGroup bool) error {
+	if createGroup {
+		if err := exec.Command("groupadd", "--system", group).Run(); err != nil {
+			return err
+		}
+	}
+	if _, err := user.Lookup(name); err == nil {
+		return nil
+	}
+	args := []string{"--system", "--no-create-home", "--home-dir", "/nonexistent",
+		"--shell", "/usr/sbin/nologin", "--comment", description}
+	if group != "" {
+		args = append(args, "--gid", group)
+	} else {
+		args = append(args, "--user-group")
+	}
+	return exec.Command("useradd", append(args, name)...).Run()
+}
+
+// Create a system account in the offline image at root
+func createImageAccount(root, name, group, description string, createGroup bool) error {
+	if createGroup {
+		if err := exec.Command("groupadd", "--root", root, "--system", group).Run(); err != nil {
+			return err
+		}
+	}
+	if imageEntry("/etc/passwd", name) {
+		return nil
+	}
+	args := []string{"--root", root, "--system", "--no-create-home", "--home-dir", "/nonexistent",
+		"--shell", "/usr/sbin/nologin", "--comment", description}
+	if group != "" {
+		args = append(args, "--gid", group)
+	} else {
+		args = append(args, "--user-group")
+	}
+	return exec.Command("useradd", append(args, name)...).Run()
+}
+
+// Delete the account, its own group is deleted with it,
+// a named group is deleted if nobody else uses it
+func deleteAccount(name, group string) error {
+	if err := exec.Command("userdel", name).Run(); err != nil {
+		return err
+	}
+	if group != "" {
+		exec.Command("groupdel", group).Run()
+	}
+	return nil
+}
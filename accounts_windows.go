@@ -0,0 +1,18 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+// Accounts of windows services are not created by the package
+func createAccount(name, group, description string, createGroup bool) error {
+	return ErrUnsupportedSystem
+}
+
+func deleteAccount(name, group string) error {
+	return ErrUnsupportedSystem
+}
+
+func createImageAccount(root, name, group, description string, createGroup bool) error {
+	return ErrUnsupportedSystem
+}
@@ -0,0 +1,141 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/takama/daemon/systemd"
+)
+
+// Interval of the polling of the watched paths on init systems without path activation
+const watchInterval = 2 * time.Second
+
+// PathActivator interface is implemented by daemons which are able to start
+// the service when files appear or change
+type PathActivator interface {
+	// InstallPathUnit - install the service, if it is not installed yet,
+	// and a path unit which starts it when one of the paths changes
+	InstallPathUnit(watch ...PathSpec) (string, error)
+}
+
+// Path unit which activates a systemd service
+func pathUnit(def *Definition) *systemd.PathUnit {
+	return systemd.NewPathUnit(def.Name)
+}
+
+// Render the path unit which activates the service
+func renderPathUnit(def *Definition) (string, error) {
+	templ, err := template.New("path").Parse(pathUnitConfig)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := templ.Execute(&buf, &struct {
+		*Definition
+		Metadata Metadata
+	}{def, NewMetadata()}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Write and enable the path unit of the service, if it watches paths
+func installPathUnit(def *Definition) error {
+	if len(def.Watch) == 0 {
+		return nil
+	}
+	content, err := renderPathUnit(def)
+	if err != nil {
+		return err
+	}
+	unit := pathUnit(def)
+	unit.Root = PathPrefix()
+	if err := ioutil.WriteFile(unit.Path(), []byte(content), 0644); err != nil {
+		return err
+	}
+	if err := reloadManager(KindSystemD); err != nil {
+		return err
+	}
+	return unit.Enable()
+}
+
+// Disable and remove the path unit of the service
+func removePathUnit(def *Definition) error {
+	unit := pathUnit(def)
+	unit.Root = PathPrefix()
+	if _, err := os.Stat(unit.Path()); os.IsNotExist(err) {
+		return nil
+	}
+	unit.Disable()
+	return os.Remove(unit.Path())
+}
+
+// State of a watched path which is compared by the polling
+type pathState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+	entries int
+}
+
+func statPath(spec PathSpec) pathState {
+	info, err := os.Stat(spec.Path)
+	if err != nil {
+		return pathState{}
+	}
+	state := pathState{exists: true, size: info.Size(), modTime: info.ModTime()}
+	if spec.Dir {
+		if names, err := ioutil.ReadDir(spec.Path); err == nil {
+			state.entries = len(names)
+		}
+	}
+	return state
+}
+
+// Wait until one of the watched paths changes, a directory is considered
+// changed while it is not empty. It is the polling fallback of the path
+// activation for the init systems which do not support it.
+func awaitPaths(watch []PathSpec) {
+	if len(watch) == 0 {
+		return
+	}
+	states := make([]pathState, len(watch))
+	for i, spec := range watch {
+		states[i] = statPath(spec)
+		if spec.Dir && states[i].entries > 0 {
+			return
+		}
+	}
+	for {
+		time.Sleep(watchInterval)
+		for i, spec := range watch {
+			state := statPath(spec)
+			if state != states[i] || (spec.Dir && state.entries > 0) {
+				return
+			}
+		}
+	}
+}
+
+// Watched paths of launchd: WatchPaths or QueueDirectories (dirs)
+// with the files or the directories of Watch
+func watchPaths(def *Definition, dirs bool) List {
+	paths := def.WatchPaths
+	if dirs {
+		paths = def.QueueDirectories
+	}
+	paths = copyStrings(paths)
+	for _, spec := range def.Watch {
+		if spec.Dir == dirs {
+			paths = append(paths, spec.Path)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,103 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Ownership marker which the default templates put into the service files
+const managedMarker = "Managed by " + generatedBy
+
+// IsManaged - check the service file of the named service of the current host
+// carries the ownership marker, i.e. it was installed or adopted by this package
+func IsManaged(name string) (bool, error) {
+	path, err := ServicePath(hostKind(), name)
+	if err != nil {
+		return false, err
+	}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, ErrNotInstalled
+	}
+	if err != nil {
+		return false, err
+	}
+	return strings.Contains(string(content), managedMarker), nil
+}
+
+// Adopt - take over an existing service of the current host which was
+// installed by hand or by an older version: its definition is inspected,
+// the ownership marker is added to its service file and a daemon is returned
+// for it. With normalize the service file is rendered again from the default
+// template of the package instead.
+func Adopt(name string, normalize bool) (Daemon, error) {
+	def, err := Inspect(name)
+	if err != nil {
+		return nil, err
+	}
+	kind := hostKind()
+	if kind != KindWindows {
+		if ok, err := checkPrivileges(); !ok {
+			return nil, err
+		}
+		if err := adoptFile(kind, def, normalize); err != nil {
+			return nil, err
+		}
+	}
+	return NewFromDefinition(def)
+}
+
+// Mark or render the service file of the adopted service
+func adoptFile(kind Kind, def *Definition, normalize bool) error {
+	path, err := definitionPath(kind, def)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	content := string(data)
+	switch {
+	case normalize:
+		if content, err = renderInstalled(kind, def); err != nil {
+			return err
+		}
+	case strings.Contains(content, managedMarker):
+		return nil
+	default:
+		content = addMarker(kind, content)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), info.Mode()); err != nil {
+		return err
+	}
+	return reloadManager(kind)
+}
+
+// Insert the ownership marker as a comment, after the shebang of scripts
+// and after the header of property lists
+func addMarker(kind Kind, content string) string {
+	if kind == KindLaunchd {
+		comment := "<!-- " + managedMarker + " -->\n"
+		if i := strings.Index(content, "<plist"); i >= 0 {
+			return content[:i] + comment + content[i:]
+		}
+		return content
+	}
+	comment := "# " + managedMarker + "\n"
+	if strings.HasPrefix(content, "#!") {
+		if i := strings.Index(content, "\n"); i >= 0 {
+			return content[:i+1] + comment + content[i+1:]
+		}
+	}
+	return comment + content
+}
@@ -0,0 +1,73 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import "errors"
+
+// NUMA memory policies of a service (linux)
+const (
+	// NUMADefault - the memory policy of the system
+	NUMADefault = "default"
+
+	// NUMAPreferred - memory is allocated on the preferred node first
+	NUMAPreferred = "preferred"
+
+	// NUMABind - memory is allocated only on the nodes
+	NUMABind = "bind"
+
+	// NUMAInterleave - memory is interleaved across the nodes
+	NUMAInterleave = "interleave"
+
+	// NUMALocal - memory is allocated on the node of the CPU
+	NUMALocal = "local"
+)
+
+// ErrUnknownNUMAPolicy appears if the definition refers to a NUMA policy which does not exist
+var ErrUnknownNUMAPolicy = errors.New("Unknown NUMA policy")
+
+// Check the NUMA policy of the definition, empty means no policy
+func checkNUMAPolicy(def *Definition) error {
+	switch def.NUMAPolicy {
+	case "", NUMADefault, NUMAPreferred, NUMABind, NUMAInterleave, NUMALocal:
+		return nil
+	}
+	return ErrUnknownNUMAPolicy
+}
+
+// NUMA nodes of the policy, all of them by default,
+// the preferred policy has a single node
+func numaNodes(def *Definition) string {
+	switch {
+	case def.NUMANodes != "":
+		return def.NUMANodes
+	case def.NUMAPolicy == NUMAPreferred:
+		return "0"
+	}
+	return "all"
+}
+
+// Commands which pin the executable to the CPUs and the NUMA nodes on the
+// init systems which have no settings for it (System V and upstart),
+// systemd and rc.d pin the service themselves
+func affinityWrapper(kind Kind, def *Definition) List {
+	if kind != KindSystemV && kind != KindUpstart {
+		return nil
+	}
+	var wrapper List
+	if def.CPUAffinity != "" {
+		wrapper = append(wrapper, "taskset", "-c", def.CPUAffinity)
+	}
+	switch def.NUMAPolicy {
+	case NUMAPreferred:
+		wrapper = append(wrapper, "numactl", "--preferred="+numaNodes(def))
+	case NUMABind:
+		wrapper = append(wrapper, "numactl", "--membind="+numaNodes(def))
+	case NUMAInterleave:
+		wrapper = append(wrapper, "numactl", "--interleave="+numaNodes(def))
+	case NUMALocal:
+		wrapper = append(wrapper, "numactl", "--localalloc")
+	}
+	return wrapper
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrAliasExists appears if an alias of the definition is the name of another service
+var ErrAliasExists = errors.New("Alias is the name of another service")
+
+// Check the init system is able to address the service by its aliases:
+// Alias= of systemd, links of the init scripts of System V and rc.d
+func checkAliases(kind Kind, def *Definition) error {
+	if len(def.Aliases) == 0 {
+		return nil
+	}
+	switch {
+	case def.PerUser:
+		return &UnsupportedOptionError{"aliases", kind}
+	case kind == KindSystemD, kind == KindSystemV, kind == KindRCD:
+		return nil
+	}
+	return &UnsupportedOptionError{"aliases", kind}
+}
+
+// ResolveAlias - name of the service the name refers to on the current host:
+// the service whose file is the target of the link of the service file of
+// the name (an alias of a systemd unit, a linked init script), otherwise
+// the name itself. The daemons resolve their names, so a service is still
+// controlled by its former name after a rename.
+func ResolveAlias(name string) string {
+	return resolveAlias(hostKind(), name)
+}
+
+// Name of the service the name refers to for the given kind of init system
+func resolveAlias(kind Kind, name string) string {
+	path, err := ServicePath(kind, name)
+	if err != nil {
+		return name
+	}
+	target, err := os.Readlink(rooted(path))
+	if err != nil {
+		return name
+	}
+	// a masked unit is a link to /dev/null
+	file := rooted(target)
+	if !filepath.IsAbs(target) {
+		file = filepath.Join(filepath.Dir(rooted(path)), target)
+	}
+	if info, err := os.Stat(file); err != nil || !info.Mode().IsRegular() {
+		return name
+	}
+	service := filepath.Base(target)
+	suffix := serviceSuffixes[kind]
+	if !strings.HasSuffix(service, suffix) || strings.Contains(service, "@") {
+		return name
+	}
+	return strings.TrimSuffix(service, suffix)
+}
+
+// Link the aliases to the init script of the service, the aliases of
+// a systemd unit are linked by systemctl enable
+func installAliases(kind Kind, def *Definition) error {
+	if kind != KindSystemV && kind != KindRCD {
+		return nil
+	}
+	for _, alias := range def.Aliases {
+		link, err := ServicePath(kind, alias)
+		if err != nil {
+			return err
+		}
+		link = rooted(link)
+		if target, err := os.Readlink(link); err == nil && target == def.Name {
+			continue
+		}
+		if fileExists(link) {
+			return ErrAliasExists
+		}
+		if err := os.Symlink(def.Name, link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove the links of the aliases which refer to the init script of the service
+func removeAliases(kind Kind, def *Definition) error {
+	if kind != KindSystemV && kind != KindRCD {
+		return nil
+	}
+	for _, alias := range def.Aliases {
+		link, err := ServicePath(kind, alias)
+		if err != nil {
+			return err
+		}
+		link = rooted(link)
+		if target, err := os.Readlink(link); err == nil && target == def.Name {
+			if err := os.Remove(link); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
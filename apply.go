@@ -0,0 +1,428 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/takama/daemon/systemd"
+)
+
+// States of the services of the definition files, the "state" key of a file
+const (
+	// StatePresent - the service is installed and runs, the default
+	StatePresent = "present"
+
+	// StateAbsent - the service is stopped and removed
+	StateAbsent = "absent"
+)
+
+// Actions of ApplyDir on the services
+const (
+	// ApplyInstalled - the missing service was installed and started
+	ApplyInstalled = "installed"
+
+	// ApplyUpdated - the service file differed from the definition and was
+	// installed again, or the configuration files were deployed, or the
+	// stopped service was started
+	ApplyUpdated = "updated"
+
+	// ApplyRemoved - the absent service was stopped and removed
+	ApplyRemoved = "removed"
+
+	// ApplyUnchanged - the service matched its definition
+	ApplyUnchanged = "unchanged"
+
+	// ApplyPruned - the service was installed by the package, but it has no
+	// definition file anymore, it was stopped and removed (ApplyPrune)
+	ApplyPruned = "pruned"
+)
+
+// ErrUnknownFormat appears if a definition file is neither JSON, YAML nor TOML
+var ErrUnknownFormat = errors.New("Unknown format of the definition file")
+
+// ErrDuplicateService appears if two definition files define the same service
+var ErrDuplicateService = errors.New("Service is defined more than once")
+
+// ApplyResult - what ApplyDir did to the service of a definition file
+type ApplyResult struct {
+	// File - path of the definition file, empty for a pruned service
+	File string
+
+	// Name - name of the service, empty if the file could not be read
+	Name string
+
+	// Action - one of the Apply* constants, empty if it failed
+	Action string
+
+	// Diff - unified diff of the service file which was (or, with
+	// ApplyDryRun, would be) written for an updated service, see Diff
+	Diff string
+}
+
+// ApplyOption - option of ApplyDir
+type ApplyOption func(*applySettings)
+
+// applySettings - options of ApplyDir
+type applySettings struct {
+	prune   bool
+	dryRun  bool
+	traceID string
+}
+
+// ApplyPrune - stop and remove the services which were installed by the
+// package (their service files carry the ownership marker, see IsManaged),
+// but have no definition file in the directory anymore
+func ApplyPrune() ApplyOption {
+	return func(settings *applySettings) {
+		settings.prune = true
+	}
+}
+
+// ApplyDryRun - report the actions which ApplyDir would take, nothing is changed
+func ApplyDryRun() ApplyOption {
+	return func(settings *applySettings) {
+		settings.dryRun = true
+	}
+}
+
+// ApplyTraceID - attach the trace ID to the results, the log messages and the
+// audit records of the operations on the services, see SetAuditRecorder
+func ApplyTraceID(id string) ApplyOption {
+	return func(settings *applySettings) {
+		settings.traceID = id
+	}
+}
+
+// LoadDefinitionFile - read a definition from a JSON (.json), YAML (.yaml,
+// .yml) or TOML (.toml) file. The file has the fields of the JSON form of the
+// definition (see DefinitionSchema) and the optional key "state", StatePresent
+// or StateAbsent; absent reports the latter. The definition is checked like by
+// UnmarshalDefinition.
+func LoadDefinitionFile(path string) (def *Definition, absent bool, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	var document interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&document)
+	case ".yaml", ".yml":
+		document, err = decodeYAML(data)
+	case ".toml":
+		document, err = decodeTOML(data)
+	default:
+		return nil, false, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, false, &DefinitionError{Problems: []string{err.Error()}}
+	}
+	fields, ok := document.(map[string]interface{})
+	if !ok {
+		return nil, false, &DefinitionError{Problems: []string{"the definition is not an object"}}
+	}
+	switch fields["state"] {
+	case nil, StatePresent:
+	case StateAbsent:
+		absent = true
+	default:
+		return nil, false, &DefinitionError{Problems: []string{"state must be present or absent"}}
+	}
+	delete(fields, "state")
+	data, err = json.Marshal(fields)
+	if err != nil {
+		return nil, false, err
+	}
+	def, err = UnmarshalDefinition(data)
+	return def, absent, err
+}
+
+// Definition files of the directory, sorted by name
+func definitionFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".json", ".yaml", ".yml", ".toml":
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// ApplyDir - reconcile the services of the current host with the definition
+// files of the directory (see LoadDefinitionFile), like a minimal GitOps
+// agent: missing services are installed and started, services whose service
+// file differs from the definition get it rewritten in place and are
+// restarted if they run, configuration files
+// are deployed as by Ensure, and services marked absent are stopped and
+// removed. Every file is applied even if others fail, the failures are
+// returned as *OperationError by the paths of the files (by the names of the
+// services which were pruned).
+func ApplyDir(dir string, options ...ApplyOption) ([]ApplyResult, error) {
+	var settings applySettings
+	for _, option := range options {
+		option(&settings)
+	}
+	files, err := definitionFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var results []ApplyResult
+	failures := make(map[string]error)
+	defined := make(map[string]bool)
+	unreadable := false
+	for _, file := range files {
+		result := ApplyResult{File: file}
+		def, absent, err := LoadDefinitionFile(file)
+		unreadable = unreadable || err != nil
+		if err == nil {
+			result.Name = def.Name
+			if defined[def.Name] {
+				err = ErrDuplicateService
+			} else {
+				defined[def.Name] = true
+				result.Action, result.Diff, err = applyDefinition(def, absent, settings)
+			}
+		}
+		if err != nil {
+			failures[file] = err
+		}
+		results = append(results, result)
+	}
+	// nothing is pruned while a file could not be read, its service
+	// would be taken for a removed one
+	if settings.prune && !unreadable {
+		pruned, pruneFailures, err := pruneServices(defined, settings)
+		if err != nil {
+			return results, err
+		}
+		for name, err := range pruneFailures {
+			failures[name] = err
+		}
+		results = append(results, pruned...)
+	}
+	if len(failures) > 0 {
+		return results, &OperationError{Failures: failures}
+	}
+	return results, nil
+}
+
+// Bring the service of the current host in line with the definition,
+// in a dry run only the action is determined
+func applyDefinition(def *Definition, absent bool, settings applySettings) (action, diff string, err error) {
+	d, err := tracedDaemon(def, settings.traceID)
+	if err != nil {
+		return "", "", err
+	}
+	dryRun := settings.dryRun
+	status, err := StatusOf(d)
+	if err != nil && err != ErrNotInstalled {
+		return "", "", err
+	}
+	installed := err != ErrNotInstalled
+	if absent {
+		if !installed {
+			return ApplyUnchanged, "", nil
+		}
+		if !dryRun {
+			if err := removeService(d); err != nil {
+				return "", "", err
+			}
+		}
+		return ApplyRemoved, "", nil
+	}
+	if !installed {
+		if !dryRun {
+			if _, err := Ensure(d); err != nil {
+				return "", "", err
+			}
+		}
+		return ApplyInstalled, "", nil
+	}
+	diff, err = Diff(d)
+	upToDate := diff == ""
+	switch {
+	case err == ErrUnsupportedSystem:
+		upToDate = true
+	case err != nil:
+		return "", "", err
+	}
+	if dryRun {
+		// Ensure would deploy the configuration files or start the service
+		reconfigured := len(verifyConfigFiles(hostKind(), def)) > 0
+		if !upToDate || reconfigured || (!status.Running() && !InMaintenance(d)) {
+			return ApplyUpdated, diff, nil
+		}
+		return ApplyUnchanged, "", nil
+	}
+	if !upToDate {
+		if err := updateServiceFile(d); err != nil {
+			return "", "", err
+		}
+	}
+	changed, err := Ensure(d)
+	if err != nil {
+		return "", "", err
+	}
+	// the running service reads the new service file after the restart,
+	// unless Ensure has restarted it already
+	if !upToDate && status.Running() && !changed && !InMaintenance(d) {
+		if err := Restart(d); err != nil {
+			return "", "", err
+		}
+	}
+	if changed || !upToDate {
+		return ApplyUpdated, diff, nil
+	}
+	return ApplyUnchanged, "", nil
+}
+
+// Daemon of the definition which traces its operations by the trace ID
+func tracedDaemon(def *Definition, id string) (Daemon, error) {
+	d, err := NewFromDefinition(def)
+	if err != nil {
+		return nil, err
+	}
+	if tracer, ok := d.(Tracer); ok && id != "" {
+		tracer.SetTraceID(id)
+	}
+	return d, nil
+}
+
+// Write the service file of the installed daemon again from its definition
+// in place, as Restore does, and make the init system reread it: the
+// enablement, the installed binary and the companion units are kept. A
+// service whose file is not where the definition puts it, e.g. the
+// definition changed its scope, is of another kind and is removed,
+// Ensure installs it again.
+func updateServiceFile(d Daemon) error {
+	renderer, ok := d.(Renderer)
+	if !ok {
+		return ErrUnsupportedSystem
+	}
+	path := renderer.ServicePath()
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return removeService(d)
+	}
+	if err != nil {
+		return err
+	}
+	content, err := renderer.Render()
+	if err != nil {
+		return err
+	}
+	if err := writeConfigFile(path, &ConfigFile{Mode: info.Mode()}, []byte(content)); err != nil {
+		return err
+	}
+	if unit, ok := SystemdUnit(d); ok && unit.User && !offline() {
+		return systemd.UserDaemonReload()
+	}
+	return ReloadManager()
+}
+
+// Stop and remove the installed service
+func removeService(d Daemon) error {
+	if _, err := d.Stop(); err != nil && err != ErrAlreadyStopped {
+		return err
+	}
+	_, err := d.Remove()
+	return err
+}
+
+// Stop and remove the managed services of the host which are not defined,
+// in a dry run they are only listed; the failures are returned by the names
+// of the services
+func pruneServices(defined map[string]bool, settings applySettings) ([]ApplyResult, map[string]error, error) {
+	names, err := ManagedServices()
+	if err != nil {
+		return nil, nil, err
+	}
+	var results []ApplyResult
+	failures := make(map[string]error)
+	for _, name := range names {
+		if defined[name] {
+			continue
+		}
+		result := ApplyResult{Name: name, Action: ApplyPruned}
+		if !settings.dryRun {
+			if err := pruneService(name, settings.traceID); err != nil {
+				result.Action = ""
+				failures[name] = err
+			}
+		}
+		results = append(results, result)
+	}
+	return results, failures, nil
+}
+
+// Stop and remove the named service by its inspected definition, so the
+// files which come with it are removed as well
+func pruneService(name, traceID string) error {
+	def, err := Inspect(name)
+	if err != nil {
+		def = &Definition{Name: name}
+	}
+	d, err := tracedDaemon(def, traceID)
+	if err != nil {
+		return err
+	}
+	return removeService(d)
+}
+
+// ManagedServices - names of the services of the current host whose service
+// files carry the ownership marker of the package (see IsManaged), i.e. which
+// were installed or adopted by it. The companion units of a service (e.g. of
+// its failure notifications) are not listed, the services of the users
+// neither. Windows services have no marker, ErrUnsupportedSystem is returned.
+func ManagedServices() ([]string, error) {
+	kind := hostKind()
+	pattern, err := ServicePath(kind, "*")
+	if err != nil {
+		return nil, ErrUnsupportedSystem
+	}
+	prefix, suffix := pattern[:strings.Index(pattern, "*")], pattern[strings.Index(pattern, "*")+1:]
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	managed := make(map[string]bool)
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil || !strings.Contains(string(content), managedMarker) {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(path, prefix), suffix)
+		// the template of the per-user services, "<name>@"
+		managed[strings.TrimSuffix(name, "@")] = true
+	}
+	var names []string
+	for name := range managed {
+		if base := strings.TrimSuffix(name, "-failure"); base != name && managed[base] {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
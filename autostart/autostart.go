@@ -0,0 +1,301 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+// Package autostart controls the XDG autostart entries of desktop sessions.
+//
+// It is used by the daemon package for the services of the desktop scope.
+// The desktop session of the user starts the entries of ~/.config/autostart
+// at login, no manager supervises the processes afterwards, so the package
+// starts and stops them itself and keeps their PID in a file.
+package autostart
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrNoExec appears if the entry has no command to start
+var ErrNoExec = errors.New("Autostart entry has no Exec key")
+
+// StopTimeout - time Stop waits for the process to exit after SIGTERM,
+// it is killed afterwards
+var StopTimeout = 10 * time.Second
+
+// Characters which have to be quoted in the arguments of the Exec key
+const reservedChars = " \t\n\"'\\><~|&;$*?#()`"
+
+// Entry - autostart entry of the current user
+type Entry struct {
+	// Name of the entry without the ".desktop" suffix
+	Name string
+}
+
+// Dir - directory of the autostart entries of the current user,
+// $XDG_CONFIG_HOME/autostart/ or ~/.config/autostart/
+func Dir() string {
+	if config := os.Getenv("XDG_CONFIG_HOME"); config != "" {
+		return config + "/autostart/"
+	}
+	home, _ := os.UserHomeDir()
+	return home + "/.config/autostart/"
+}
+
+// New - create an autostart entry with the given name
+func New(name string) *Entry {
+	return &Entry{Name: name}
+}
+
+// Path - path of the desktop file of the entry
+func (entry *Entry) Path() string {
+	return Dir() + entry.Name + ".desktop"
+}
+
+// PIDFile - file which holds the PID of the running process, in the runtime
+// directory of the user ($XDG_RUNTIME_DIR), which is emptied at logout
+func (entry *Entry) PIDFile() string {
+	if runtime := os.Getenv("XDG_RUNTIME_DIR"); runtime != "" {
+		return filepath.Join(runtime, entry.Name+".pid")
+	}
+	return filepath.Join(os.TempDir(), entry.Name+"-"+strconv.Itoa(os.Getuid())+".pid")
+}
+
+// IsInstalled - check the desktop file of the entry exists
+func (entry *Entry) IsInstalled() bool {
+	_, err := os.Stat(entry.Path())
+	return err == nil
+}
+
+// Values - keys of the [Desktop Entry] group of the desktop file
+func (entry *Entry) Values() (map[string]string, error) {
+	content, err := ioutil.ReadFile(entry.Path())
+	if err != nil {
+		return nil, err
+	}
+	return ParseEntry(string(content)), nil
+}
+
+// IsEnabled - check the session starts the entry at login: it is neither
+// hidden nor disabled by X-GNOME-Autostart-enabled
+func (entry *Entry) IsEnabled() (bool, error) {
+	values, err := entry.Values()
+	if err != nil {
+		return false, err
+	}
+	return values["Hidden"] != "true" && values["X-GNOME-Autostart-enabled"] != "false", nil
+}
+
+// Enable - let the session start the entry at login
+func (entry *Entry) Enable() error {
+	return entry.setHidden(false)
+}
+
+// Disable - keep the session from starting the entry at login,
+// the entry stays installed
+func (entry *Entry) Disable() error {
+	return entry.setHidden(true)
+}
+
+// Set the Hidden key of the entry, which the sessions honor
+func (entry *Entry) setHidden(hidden bool) error {
+	content, err := ioutil.ReadFile(entry.Path())
+	if err != nil {
+		return err
+	}
+	var lines []string
+	group := ""
+	for _, line := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			group = trimmed
+		}
+		if group == "[Desktop Entry]" && (strings.HasPrefix(trimmed, "Hidden=") ||
+			strings.HasPrefix(trimmed, "X-GNOME-Autostart-enabled=")) {
+			continue
+		}
+		lines = append(lines, line)
+		if trimmed == "[Desktop Entry]" {
+			lines = append(lines, "Hidden="+strconv.FormatBool(hidden),
+				"X-GNOME-Autostart-enabled="+strconv.FormatBool(!hidden))
+		}
+	}
+	return ioutil.WriteFile(entry.Path(), []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// Status - check the process of the entry runs and get its PID
+func (entry *Entry) Status() (running bool, pid string) {
+	content, err := ioutil.ReadFile(entry.PIDFile())
+	if err != nil {
+		return false, ""
+	}
+	pid = strings.TrimSpace(string(content))
+	if !alive(pid) {
+		return false, ""
+	}
+	return true, pid
+}
+
+// Check the process of the PID exists
+func alive(pid string) bool {
+	id, err := strconv.Atoi(pid)
+	if err != nil || id <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(id)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// WritePID - record the PID of the running process of the entry
+func (entry *Entry) WritePID(pid int) error {
+	return ioutil.WriteFile(entry.PIDFile(), []byte(strconv.Itoa(pid)+"\n"), 0644)
+}
+
+// RemovePID - forget the process of the entry
+func (entry *Entry) RemovePID() error {
+	if err := os.Remove(entry.PIDFile()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Start - start the command of the entry like the session does, detached
+// from the calling process
+func (entry *Entry) Start() error {
+	values, err := entry.Values()
+	if err != nil {
+		return err
+	}
+	args := SplitExec(values["Exec"])
+	if len(args) == 0 {
+		return ErrNoExec
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	if dir := values["Path"]; dir != "" {
+		cmd.Dir = dir
+	}
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if err := entry.WritePID(cmd.Process.Pid); err != nil {
+		return err
+	}
+	// reap the process if it exits while the caller runs
+	go cmd.Wait()
+	return nil
+}
+
+// Stop - terminate the process of the entry, it is killed if it does not
+// exit within StopTimeout
+func (entry *Entry) Stop() error {
+	running, pid := entry.Status()
+	if !running {
+		return entry.RemovePID()
+	}
+	id, _ := strconv.Atoi(pid)
+	process, err := os.FindProcess(id)
+	if err != nil {
+		return err
+	}
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		return err
+	}
+	for deadline := time.Now().Add(StopTimeout); alive(pid); {
+		if time.Now().After(deadline) {
+			if err := process.Kill(); err != nil {
+				return err
+			}
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return entry.RemovePID()
+}
+
+// ParseEntry - keys of the [Desktop Entry] group of the content of a desktop
+// file; the localized keys (Name[de]) are kept by their full names
+func ParseEntry(content string) map[string]string {
+	values := make(map[string]string)
+	group := ""
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || line[0] == '#':
+		case line[0] == '[':
+			group = line
+		case group == "[Desktop Entry]":
+			if i := strings.Index(line, "="); i > 0 {
+				values[strings.TrimSpace(line[:i])] = unescape(strings.TrimSpace(line[i+1:]))
+			}
+		}
+	}
+	return values
+}
+
+// Value of a string key without its escape sequences
+func unescape(value string) string {
+	return strings.NewReplacer(`\s`, " ", `\n`, "\n", `\t`, "\t", `\r`, "\r", `\\`, `\`).Replace(value)
+}
+
+// QuoteExec - value of the Exec key which runs the arguments, they are
+// quoted and escaped as the desktop entry specification requires
+func QuoteExec(args []string) string {
+	words := make([]string, len(args))
+	for i, arg := range args {
+		arg = strings.Replace(arg, "%", "%%", -1)
+		if arg == "" || strings.ContainsAny(arg, reservedChars) {
+			arg = `"` + strings.NewReplacer(`"`, `\"`, "`", "\\`", "$", `\$`, `\`, `\\`).Replace(arg) + `"`
+		}
+		words[i] = arg
+	}
+	// the escapes of the string value itself
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\t", `\t`).Replace(strings.Join(words, " "))
+}
+
+// SplitExec - arguments of the value of an Exec key whose escapes of the
+// string value are resolved (see ParseEntry); the field codes (%f, %u, ...)
+// are dropped, since the entry is started without files
+func SplitExec(value string) []string {
+	var args []string
+	var word strings.Builder
+	inWord, quoted := false, false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(value):
+			i++
+			word.WriteByte(value[i])
+		case c == '"':
+			quoted, inWord = !quoted, true
+		case c == '%' && i+1 < len(value):
+			i++
+			if value[i] == '%' {
+				word.WriteByte('%')
+				inWord = true
+			}
+		case !quoted && (c == ' ' || c == '\t'):
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args
+}
@@ -0,0 +1,19 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package autostart
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Run the command in its own session, so it survives the terminal
+// and the process group of the caller
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,11 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package autostart
+
+import "os/exec"
+
+// Windows has no desktop sessions of freedesktop.org, the command is
+// started as it is
+func detach(cmd *exec.Cmd) {}
@@ -0,0 +1,68 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"github.com/takama/daemon/autostart"
+	"github.com/takama/daemon/launchd"
+	"github.com/takama/daemon/rcd"
+	"github.com/takama/daemon/systemd"
+	"github.com/takama/daemon/sysv"
+	"github.com/takama/daemon/upstart"
+)
+
+// SystemdUnit - systemd unit of the daemon, if the daemon is managed by systemd
+func SystemdUnit(d Daemon) (*systemd.Unit, bool) {
+	if backend, ok := d.(interface{ Unit() *systemd.Unit }); ok {
+		return backend.Unit(), true
+	}
+	return nil, false
+}
+
+// SysVScript - init script of the daemon, if the daemon is managed by System V init
+func SysVScript(d Daemon) (*sysv.Script, bool) {
+	if backend, ok := d.(interface{ Script() *sysv.Script }); ok {
+		return backend.Script(), true
+	}
+	return nil, false
+}
+
+// UpstartJob - upstart job of the daemon, if the daemon is managed by upstart
+func UpstartJob(d Daemon) (*upstart.Job, bool) {
+	if backend, ok := d.(interface{ Job() *upstart.Job }); ok {
+		return backend.Job(), true
+	}
+	return nil, false
+}
+
+// LaunchdJob - launchd job of the daemon, if the daemon is managed by launchd
+func LaunchdJob(d Daemon) (*launchd.Job, bool) {
+	if backend, ok := d.(interface{ Job() *launchd.Job }); ok {
+		return backend.Job(), true
+	}
+	return nil, false
+}
+
+// RCDScript - rc.d script of the daemon, if the daemon is managed by FreeBSD rc.d
+func RCDScript(d Daemon) (*rcd.Script, bool) {
+	if backend, ok := d.(interface{ Script() *rcd.Script }); ok {
+		return backend.Script(), true
+	}
+	return nil, false
+}
+
+// AutostartEntry - XDG autostart entry of the daemon, if the daemon is a
+// helper of the desktop session (ScopeDesktop)
+func AutostartEntry(d Daemon) (*autostart.Entry, bool) {
+	if backend, ok := d.(interface{ Entry() *autostart.Entry }); ok {
+		return backend.Entry(), true
+	}
+	return nil, false
+}
+
+// Format the result of a status check of the init system
+func runningStatus(running bool, pid string) (string, bool) {
+	return statusOf(running, StatusRunning, pid).result()
+}
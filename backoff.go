@@ -0,0 +1,161 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Check the init system restarts the service after a failure, so the
+// restart can be delayed: systemd (RestartSec=), upstart (respawn),
+// launchd (KeepAlive), rc.d (daemon -r) and the recovery actions of
+// windows; System V and the desktop sessions never restart a service
+func checkRestartDelay(kind Kind, def *Definition) error {
+	if problems := checkRestartDelayProblems(def); len(problems) > 0 {
+		return &DefinitionError{Problems: problems}
+	}
+	if def.RestartDelay == 0 {
+		return nil
+	}
+	switch kind {
+	case KindSystemD, KindUpstart, KindLaunchd, KindRCD, KindWindows:
+		return nil
+	}
+	return &UnsupportedOptionError{"restart_delay", kind}
+}
+
+// Problems of the restart delays of the definition
+func checkRestartDelayProblems(def *Definition) []string {
+	var problems []string
+	switch {
+	case def.RestartDelay < 0:
+		problems = append(problems, "restart_delay must not be negative")
+	case def.RestartMaxDelay < 0:
+		problems = append(problems, "restart_max_delay must not be negative")
+	case def.RestartMaxDelay > 0 && def.RestartDelay == 0:
+		problems = append(problems, "restart_max_delay requires a restart_delay")
+	case def.RestartMaxDelay > 0 && def.RestartMaxDelay < def.RestartDelay:
+		problems = append(problems, "restart_max_delay must not be less than restart_delay")
+	}
+	return problems
+}
+
+// Delay of the restart after the given count of failed runs in a row:
+// the restart delay, doubled by every further failure up to the maximum
+// delay; a constant delay without the maximum
+func backoffDelay(def *Definition, failures int) time.Duration {
+	if failures < 1 || def.RestartDelay <= 0 {
+		return 0
+	}
+	delay := def.RestartDelay
+	for i := 1; i < failures && delay < def.RestartMaxDelay; i++ {
+		delay *= 2
+	}
+	if def.RestartMaxDelay > 0 && delay > def.RestartMaxDelay {
+		delay = def.RestartMaxDelay
+	}
+	return delay
+}
+
+// Count of the doublings from the restart delay to the maximum delay,
+// RestartSteps= of systemd
+func restartSteps(def *Definition) int {
+	steps := 0
+	for delay := def.RestartDelay; delay > 0 && delay < def.RestartMaxDelay; delay *= 2 {
+		steps++
+	}
+	return steps
+}
+
+// Path of the file which counts the failed runs of the service,
+// it is kept next to the instance lock
+func backoffPath(def *Definition) string {
+	return strings.TrimSuffix(InstanceLock(def), ".lock") + ".backoff"
+}
+
+// restartBackoff - count of the failed runs of a running service
+type restartBackoff struct {
+	sync.Mutex
+	path   string
+	timer  *time.Timer
+	closed bool
+}
+
+// Wait for the delay of the failed runs before the executable runs again,
+// the part of it which the init system does not wait itself: upstart
+// respawns the job at once, launchd (ThrottleInterval) and rc.d (daemon -R)
+// wait for the constant restart delay only; systemd and windows wait for
+// the whole delay. A run which does not return cleanly counts as failed,
+// the count is reset once the service ran for the maximum delay.
+func (properties *ServiceProperties) awaitBackoff(kind Kind) *restartBackoff {
+	def := &properties.def
+	if def.RestartDelay <= 0 || kind == KindSystemD || kind == KindWindows {
+		return nil
+	}
+	backoff := &restartBackoff{path: backoffPath(def)}
+	failures := 0
+	if content, err := ioutil.ReadFile(backoff.path); err == nil {
+		// the file is left by a run which did not return cleanly
+		previous, _ := strconv.Atoi(strings.TrimSpace(string(content)))
+		failures = previous + 1
+	}
+	wait := backoffDelay(def, failures)
+	if kind == KindLaunchd || kind == KindRCD {
+		wait -= def.RestartDelay
+	}
+	if wait > 0 {
+		diagnostics.Println("Restart of", def.Name, "is delayed by", wait, "after", failures, "failed runs")
+		time.Sleep(wait)
+	}
+	if !backoff.record(failures) {
+		return nil
+	}
+	stable := def.RestartMaxDelay
+	if stable == 0 {
+		stable = def.RestartDelay
+	}
+	backoff.timer = time.AfterFunc(stable, func() {
+		backoff.Lock()
+		defer backoff.Unlock()
+		if !backoff.closed {
+			backoff.record(0)
+		}
+	})
+	return backoff
+}
+
+// Record the count of the failed runs, the backoff is skipped if the
+// file can not be written, e.g. by a user agent outside of /var/run
+func (backoff *restartBackoff) record(failures int) bool {
+	if err := os.MkdirAll(filepath.Dir(backoff.path), 0755); err != nil {
+		diagnostics.Println("Restart backoff is disabled:", err)
+		return false
+	}
+	if err := ioutil.WriteFile(backoff.path, []byte(strconv.Itoa(failures)+"\n"), 0644); err != nil {
+		diagnostics.Println("Restart backoff is disabled:", err)
+		return false
+	}
+	return true
+}
+
+// Close - stop the timer, the count is removed if the run returned cleanly
+func (backoff *restartBackoff) Close(runErr error) {
+	if backoff == nil {
+		return
+	}
+	backoff.Lock()
+	defer backoff.Unlock()
+	backoff.closed = true
+	backoff.timer.Stop()
+	if runErr == nil {
+		os.Remove(backoff.path)
+	}
+}
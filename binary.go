@@ -0,0 +1,144 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// DefaultInstallPath - standard location of the installed executable of the service
+func DefaultInstallPath(name string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramFiles"), name, name+".exe")
+	}
+	return "/usr/local/bin/" + name
+}
+
+// Executable which is run by the service file: the installed copy,
+// the defined path or the executable found on the current host
+func serviceExecutable(def *Definition) (string, error) {
+	if def.InstallPath != "" {
+		return def.InstallPath, nil
+	}
+	return sourceExecutable(def)
+}
+
+// Executable which is copied to the install path
+func sourceExecutable(def *Definition) (string, error) {
+	switch {
+	case def.InstallSource != "":
+		return def.InstallSource, nil
+	case def.Path != "":
+		return def.Path, nil
+	}
+	return executablePath(def.Name)
+}
+
+// Executable of a service which has no path: the running executable, which
+// installs itself. The executable of the same name in PATH is preferred only
+// if it is the same file (e.g. a symlink which survives upgrades), so several
+// services run one executable under other names (myapp-worker, myapp-scheduler)
+// and an unrelated executable which happens to have the name is never taken.
+func executablePath(name string) (string, error) {
+	current, err := ExecPath()
+	if err != nil {
+		return lookPath(name)
+	}
+	if path, err := lookPath(name); err == nil {
+		if same, _ := sameFile(path, current); same {
+			return path, nil
+		}
+	}
+	return current, nil
+}
+
+// Copy the executable to the install path of the definition, if it is set.
+// The executable is verified by the checksum and the signature of the
+// definition first, even if it already is the target. The copy is written
+// next to the target and renamed, so a running executable is replaced
+// safely. The checksum of the copy is recorded for Verify.
+func (properties *ServiceProperties) installBinary() error {
+	def := &properties.def
+	if def.InstallPath == "" {
+		return nil
+	}
+	source, err := sourceExecutable(def)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	if err := verifyExecutable(def, source, data); err != nil {
+		return err
+	}
+	target := rooted(def.InstallPath)
+	if same, err := sameFile(source, target); err != nil || same {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), defaultDirMode); err != nil {
+		return err
+	}
+	temp := target + ".new"
+	if err := ioutil.WriteFile(temp, data, 0755); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	if err := os.Chmod(temp, 0755); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	if err := os.Rename(temp, target); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	// recorded for Verify
+	if err := ioutil.WriteFile(checksumPath(target),
+		[]byte(Checksum(data)+"  "+filepath.Base(def.InstallPath)+"\n"), 0644); err != nil {
+		return err
+	}
+	properties.notice(NoticeBinaryInstalled, "Installed the executable to "+def.InstallPath, def.InstallPath)
+	return nil
+}
+
+// Remove the installed copy of the executable
+func (properties *ServiceProperties) removeBinary() error {
+	def := &properties.def
+	if def.InstallPath == "" {
+		return nil
+	}
+	target := rooted(def.InstallPath)
+	if source, err := sourceExecutable(def); err == nil {
+		if same, _ := sameFile(source, target); same {
+			return nil
+		}
+	}
+	for _, path := range []string{target, checksumPath(target)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check both paths refer to the same existing file
+func sameFile(a, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(b)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(infoA, infoB), nil
+}
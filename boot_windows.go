@@ -0,0 +1,16 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// Time of the boot of the host, by the time since the boot
+func bootTime() (time.Time, error) {
+	return time.Now().Add(-windows.DurationSinceBoot()), nil
+}
@@ -0,0 +1,327 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/takama/daemon/launchd"
+	"github.com/takama/daemon/systemd"
+)
+
+// Exporter interface is implemented by daemons which are able to export
+// their service files as an install bundle
+type Exporter interface {
+	// ExportBundle - write the install bundle as a tar archive to w
+	ExportBundle(w io.Writer, args ...string) error
+}
+
+// bundleFile - file of an install bundle
+type bundleFile struct {
+	path    string
+	mode    int64
+	content string
+}
+
+// ExportBundle - write a tar archive with the rendered service file,
+// environment file templates, log rotation rules (macOS)
+// and install.sh/uninstall.sh scripts to w,
+// so the service can be installed on a host of the given kind without
+// running the service executable as root.
+//
+// The archive contains a single directory named after the service,
+// the files which are installed are kept under its "root" directory
+// with their absolute target paths.
+func ExportBundle(w io.Writer, kind Kind, def *Definition) error {
+	files, err := bundleFiles(kind, def)
+	if err != nil {
+		return err
+	}
+
+	archive := tar.NewWriter(w)
+	now := time.Now()
+	for _, file := range files {
+		if err := archive.WriteHeader(&tar.Header{
+			Name:    def.Name + "/" + file.path,
+			Mode:    file.mode,
+			Size:    int64(len(file.content)),
+			ModTime: now,
+		}); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(archive, file.content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// Files of the install bundle, relative to its directory
+func bundleFiles(kind Kind, def *Definition) ([]bundleFile, error) {
+	content, err := Render(kind, def)
+	if err != nil {
+		return nil, err
+	}
+	path, err := definitionPath(kind, def)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := int64(0755)
+	if kind == KindSystemD || kind == KindLaunchd {
+		mode = 0644
+	}
+	files := []bundleFile{{"root" + path, mode, content}}
+	envFiles := environmentFiles(kind, def.Name)
+	for _, envFile := range envFiles {
+		files = append(files, bundleFile{"root" + envFile, 0644, environmentTemplate(kind, def)})
+	}
+	var extraFiles []string
+	if def.InstallPath != "" {
+		source, err := sourceExecutable(def)
+		if err != nil {
+			return nil, err
+		}
+		binary, err := ioutil.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyExecutable(def, source, binary); err != nil {
+			return nil, err
+		}
+		record := Checksum(binary) + "  " + filepath.Base(def.InstallPath) + "\n"
+		extraFiles = append(extraFiles, def.InstallPath, checksumPath(def.InstallPath))
+		files = append(files,
+			bundleFile{"root" + def.InstallPath, 0755, string(binary)},
+			bundleFile{"root" + checksumPath(def.InstallPath), 0644, record},
+		)
+	}
+	if kind == KindSystemD && hasFailureHook(def) {
+		companion, err := renderFailureUnit(def)
+		if err != nil {
+			return nil, err
+		}
+		extraFiles = append(extraFiles, failureUnit(def).Path())
+		files = append(files, bundleFile{"root" + failureUnit(def).Path(), 0644, companion})
+	}
+	if kind == KindSystemD && len(def.Watch) > 0 {
+		activation, err := renderPathUnit(def)
+		if err != nil {
+			return nil, err
+		}
+		extraFiles = append(extraFiles, pathUnit(def).Path())
+		files = append(files, bundleFile{"root" + pathUnit(def).Path(), 0644, activation})
+	}
+	for _, unitType := range activationTypes(def) {
+		if kind != KindSystemD {
+			break
+		}
+		activation, err := renderActivationUnit(def, unitType)
+		if err != nil {
+			return nil, err
+		}
+		unitPath := systemd.NewActivationUnit(def.Name, unitType).Path()
+		extraFiles = append(extraFiles, unitPath)
+		files = append(files, bundleFile{"root" + unitPath, 0644, activation})
+	}
+	if entry, ok := cronEntry(kind, def); ok {
+		cronFile := cronDir + cronName(def)
+		extraFiles = append(extraFiles, cronFile)
+		files = append(files, bundleFile{"root" + cronFile, 0644, entry})
+	}
+	for _, file := range prerequisiteFiles(kind, def) {
+		extraFiles = append(extraFiles, strings.TrimPrefix(file.path, "root"))
+		files = append(files, file)
+	}
+	if dirs := runtimeDirectories(kind, def); kind == KindSystemD && len(dirs) > 0 {
+		extraFiles = append(extraFiles, TmpfilesPath(def))
+		files = append(files, bundleFile{"root" + TmpfilesPath(def), 0644, renderTmpfiles(dirs)})
+	}
+	if hasUdevRules(kind, def) {
+		extraFiles = append(extraFiles, UdevRulesPath(def))
+		files = append(files, bundleFile{"root" + UdevRulesPath(def), 0644, renderUdevRules(def)})
+	}
+	if kind == KindLaunchd {
+		rotation, err := renderNewsyslog(def)
+		if err != nil {
+			return nil, err
+		}
+		extraFiles = append(extraFiles, launchd.New(def.Name).NewsyslogPath())
+		files = append(files, bundleFile{"root" + launchd.New(def.Name).NewsyslogPath(), 0644, rotation})
+	}
+	return append(files,
+		bundleFile{"install.sh", 0755, installScript(kind, def, path, mode, envFiles, extraFiles)},
+		bundleFile{"uninstall.sh", 0755, uninstallScript(kind, def, path, extraFiles)},
+	), nil
+}
+
+// Environment files which are read by the service file of the given kind
+func environmentFiles(kind Kind, name string) []string {
+	switch kind {
+	case KindSystemV:
+		return []string{"/etc/sysconfig/" + name}
+	case KindRCD:
+		return []string{"/usr/local/etc/rc.conf.d/" + name}
+	}
+	return nil
+}
+
+// Commented template of an environment file
+func environmentTemplate(kind Kind, def *Definition) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Environment of the %s service\n", def.Name)
+	if kind == KindRCD {
+		fmt.Fprintf(&b, "# It is read by rc.subr, e.g.:\n#\n# %s_enable=\"YES\"\n", def.Name)
+		fmt.Fprintf(&b, "# %s_flags=\"%s\"\n", def.Name, List(def.Args))
+		fmt.Fprintf(&b, "# %s_user=\"%s\"\n", def.Name, def.User)
+		return b.String()
+	}
+	b.WriteString("# It is sourced by the init script, exported variables are\n")
+	b.WriteString("# passed to the service executable, e.g.:\n#\n# export LANG=C.UTF-8\n")
+	return b.String()
+}
+
+// Shell script which installs the bundled files and registers the service
+func installScript(kind Kind, def *Definition, path string, mode int64, envFiles, extraFiles []string) string {
+	name := def.Name
+	var b strings.Builder
+	b.WriteString(scriptHeader("Install", name))
+	fmt.Fprintf(&b, "mkdir -p %s\n", dirname(path))
+	fmt.Fprintf(&b, "cp root%s %s\nchmod %o %s\n", path, path, mode, path)
+	for _, extraFile := range extraFiles {
+		fmt.Fprintf(&b, "mkdir -p %s\ncp root%s %s\n", dirname(extraFile), extraFile, extraFile)
+	}
+	for _, envFile := range envFiles {
+		// keep configuration which already exists
+		fmt.Fprintf(&b, "if [ ! -e %s ]; then\n", envFile)
+		fmt.Fprintf(&b, "    mkdir -p %s\n    cp root%s %s\n", dirname(envFile), envFile, envFile)
+		b.WriteString("fi\n")
+	}
+	b.WriteString(accountScript(kind, def))
+	for _, spec := range manifest(kind, def) {
+		if spec.Dir {
+			fmt.Fprintf(&b, "mkdir -p %s\n", spec.Path)
+		} else {
+			fmt.Fprintf(&b, "mkdir -p %s\ntouch %s\n", dirname(spec.Path), spec.Path)
+		}
+		fmt.Fprintf(&b, "chmod %o %s\n", spec.mode(), spec.Path)
+		if owner := ownerArg(spec.User, spec.Group); owner != "" {
+			fmt.Fprintf(&b, "chown %s %s\n", owner, spec.Path)
+		}
+	}
+	switch kind {
+	case KindSystemD:
+		fmt.Fprintf(&b, "systemctl daemon-reload\nsystemctl enable %s\n", filepath.Base(path))
+		if len(def.Watch) > 0 {
+			fmt.Fprintf(&b, "systemctl enable --now %s.path\n", name)
+		}
+		for _, unitType := range activationTypes(def) {
+			fmt.Fprintf(&b, "systemctl enable --now %s.%s\n", name, unitType)
+		}
+	case KindSystemV:
+		for _, link := range sysvScript(def).Links() {
+			fmt.Fprintf(&b, "ln -sf %s %s || true\n", path, link)
+		}
+	}
+	if hasUdevRules(kind, def) {
+		b.WriteString("udevadm control --reload-rules\nudevadm trigger --action=add\n")
+	}
+	b.WriteString(prerequisitesScript(kind, def))
+	fmt.Fprintf(&b, "echo \"%s has been installed\"\n", name)
+	return b.String()
+}
+
+// Argument of chown, the group alone is given as ":group"
+func ownerArg(user, group string) string {
+	if group != "" {
+		return user + ":" + group
+	}
+	return user
+}
+
+// Shell commands which create the account of the service if it is missing
+func accountScript(kind Kind, def *Definition) string {
+	if !def.CreateUser || def.User == "" {
+		return ""
+	}
+	var b strings.Builder
+	switch kind {
+	case KindRCD:
+		if def.Group != "" {
+			fmt.Fprintf(&b, "pw groupshow %s >/dev/null 2>&1 || pw groupadd %s\n", def.Group, def.Group)
+		}
+		fmt.Fprintf(&b, "id %s >/dev/null 2>&1 || pw useradd %s -d /nonexistent -s /usr/sbin/nologin -c \"%s\"",
+			def.User, def.User, def.Description)
+		if def.Group != "" {
+			fmt.Fprintf(&b, " -g %s", def.Group)
+		}
+	case KindLaunchd:
+		fmt.Fprintf(&b, "id %s >/dev/null 2>&1 || { echo \"Create the account %s first\" >&2; exit 1; }",
+			def.User, def.User)
+	default:
+		if def.Group != "" {
+			fmt.Fprintf(&b, "getent group %s >/dev/null || groupadd --system %s\n", def.Group, def.Group)
+		}
+		fmt.Fprintf(&b, "id %s >/dev/null 2>&1 || useradd --system --no-create-home --home-dir /nonexistent "+
+			"--shell /usr/sbin/nologin --comment \"%s\"", def.User, def.Description)
+		if def.Group != "" {
+			fmt.Fprintf(&b, " --gid %s", def.Group)
+		} else {
+			b.WriteString(" --user-group")
+		}
+		fmt.Fprintf(&b, " %s", def.User)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// Shell script which unregisters the service and removes the installed files
+func uninstallScript(kind Kind, def *Definition, path string, extraFiles []string) string {
+	name := def.Name
+	var b strings.Builder
+	b.WriteString(scriptHeader("Remove", name))
+	switch kind {
+	case KindSystemD:
+		fmt.Fprintf(&b, "systemctl disable %s || true\n", filepath.Base(path))
+	case KindSystemV:
+		for _, link := range sysvScript(def).Links() {
+			fmt.Fprintf(&b, "rm -f %s\n", link)
+		}
+	}
+	fmt.Fprintf(&b, "rm -f %s\n", path)
+	for _, extraFile := range extraFiles {
+		fmt.Fprintf(&b, "rm -f %s\n", extraFile)
+	}
+	if kind == KindSystemD {
+		b.WriteString("systemctl daemon-reload\n")
+	}
+	if hasUdevRules(kind, def) {
+		b.WriteString("udevadm control --reload-rules\n")
+	}
+	b.WriteString(removePrerequisitesScript(kind, def))
+	fmt.Fprintf(&b, "echo \"%s has been removed\"\n", name)
+	return b.String()
+}
+
+func scriptHeader(action, name string) string {
+	return "#!/bin/sh\n" +
+		"#\n# " + action + " the " + name + " service\n#\n" +
+		"set -e\n" +
+		"cd \"$(dirname \"$0\")\"\n\n" +
+		"if [ \"$(id -u)\" -ne 0 ]; then\n" +
+		"    echo \"You must have root user privileges\" >&2\n" +
+		"    exit 1\n" +
+		"fi\n\n"
+}
+
+func dirname(path string) string {
+	return path[:strings.LastIndex(path, "/")]
+}
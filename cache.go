@@ -0,0 +1,56 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// Results of the init system detection and of the executable lookups,
+// they do not change during the life of a process
+var cache = struct {
+	sync.Mutex
+	kind  Kind
+	paths map[string]string
+}{paths: make(map[string]string)}
+
+// ResetCache - forget the detected init system and the found executables,
+// so the next daemon detects them again (e.g. in tests which change the host)
+func ResetCache() {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.kind = ""
+	cache.paths = make(map[string]string)
+}
+
+// Kind of the init system of the host, it is detected once
+func cachedKind(detect func() Kind) Kind {
+	cache.Lock()
+	defer cache.Unlock()
+	if cache.kind == "" {
+		cache.kind = detect()
+	}
+	return cache.kind
+}
+
+// Path of the executable in PATH, only found executables are remembered
+func lookPath(name string) (string, error) {
+	cache.Lock()
+	defer cache.Unlock()
+	if path, ok := cache.paths[name]; ok {
+		return path, nil
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	cache.paths[name] = path
+	return path, nil
+}
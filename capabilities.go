@@ -0,0 +1,120 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import "time"
+
+// KindCapabilities - options of the definitions which a kind of init system
+// supports, an option which is not supported fails the install with
+// ErrUnsupportedOption (see UnsupportedOptionError)
+type KindCapabilities struct {
+	Kind Kind `json:"kind"`
+
+	// ServiceFiles - the service is kept in a file, it can be rendered and
+	// diffed (Render, DefaultTemplate), e.g. not by Windows
+	ServiceFiles bool `json:"service_files"`
+
+	// UserServices - services of a user which start at the login (ScopeUserLogin)
+	UserServices bool `json:"user_services"`
+
+	// PerUserServices - an instance of the service for every user (PerUser)
+	PerUserServices bool `json:"per_user_services"`
+
+	// DesktopServices - helpers of the desktop session (ScopeDesktop)
+	DesktopServices bool `json:"desktop_services"`
+
+	// SocketActivation - the init system listens on the sockets of the socket
+	// section and starts the service on the first connection
+	SocketActivation bool `json:"socket_activation"`
+
+	// Timers - the service is started by the schedule of the timer section,
+	// cron entries stand in for the timers of the init systems without them
+	Timers bool `json:"timers"`
+
+	// PathActivation - the init system starts the service when the watched
+	// paths change (WithWatch), otherwise Run waits for them
+	PathActivation bool `json:"path_activation"`
+
+	// Aliases - the service is addressed by its aliases as well
+	Aliases bool `json:"aliases"`
+
+	// StopCommands - commands run before and after the stop of the service
+	StopCommands bool `json:"stop_commands"`
+
+	// ConditionCommands - commands skip the start of the service
+	ConditionCommands bool `json:"condition_commands"`
+
+	// PreStartCommands - commands run as root before the start of the
+	// service which runs as another user
+	PreStartCommands bool `json:"pre_start_commands"`
+
+	// RestartDelay - the restart of the failed service is delayed, with an
+	// exponential backoff up to the maximum delay
+	RestartDelay bool `json:"restart_delay"`
+
+	// StandardInput - the standard input of the service is read from
+	// a file, a FIFO or a device
+	StandardInput bool `json:"standard_input"`
+
+	// Watchdog - the init system restarts the service which is not healthy
+	Watchdog bool `json:"watchdog"`
+
+	// FirstBoot - the service runs at the first boot of the machine only and
+	// is enabled by a preset file
+	FirstBoot bool `json:"first_boot"`
+
+	// RCOrdering - the REQUIRE and KEYWORD lines of the rc.d script are set
+	// by the definition
+	RCOrdering bool `json:"rc_ordering"`
+
+	// SystemCallFilter - the system calls and the address families of the
+	// service are restricted
+	SystemCallFilter bool `json:"system_call_filter"`
+
+	// NetworkIsolation - the service runs in a private network or in
+	// a network namespace (System V and upstart by nsenter and unshare)
+	NetworkIsolation bool `json:"network_isolation"`
+}
+
+// Capabilities - options which the kind of init system supports, so a
+// definition can be adapted to the target host instead of failing at the
+// install; ErrUnsupportedKind is returned for an unknown kind. The answers
+// are those of the checks of Render and Install, with the default account
+// of the service (root).
+func Capabilities(kind Kind) (KindCapabilities, error) {
+	known := kind == KindAutostart
+	for _, supported := range Kinds() {
+		known = known || kind == supported
+	}
+	if !known {
+		return KindCapabilities{}, ErrUnsupportedKind
+	}
+	supports := func(def Definition, check func(Kind, *Definition) error) bool {
+		def.Name = "capabilities"
+		return check(kind, &def) == nil
+	}
+	_, err := DefaultTemplate(kind)
+	return KindCapabilities{
+		Kind:              kind,
+		ServiceFiles:      err == nil,
+		UserServices:      supports(Definition{Scope: ScopeUserLogin}, checkScope),
+		PerUserServices:   supports(Definition{PerUser: true}, checkPerUser),
+		DesktopServices:   supports(Definition{Scope: ScopeDesktop}, checkScope),
+		SocketActivation:  supports(Definition{Socket: &SocketSection{ListenStream: []string{"80"}}}, checkSections),
+		Timers:            supports(Definition{Timer: &TimerSection{Interval: time.Hour}}, checkSections),
+		PathActivation:    kind == KindSystemD || kind == KindLaunchd,
+		Aliases:           supports(Definition{Aliases: []string{"alias"}}, checkAliases),
+		StopCommands:      supports(Definition{StopCommands: []string{"/bin/true"}}, checkStopCommands),
+		ConditionCommands: supports(Definition{ConditionCommands: []string{"/bin/true"}}, checkConditionCommands),
+		PreStartCommands:  supports(Definition{PreStartCommands: []string{"/bin/true"}}, checkPreStartCommands),
+		RestartDelay:      supports(Definition{RestartDelay: time.Second}, checkRestartDelay),
+		StandardInput:     supports(Definition{StandardInput: "/dev/ttyS0"}, checkStandardInput),
+		Watchdog:          supports(Definition{Watchdog: time.Minute}, checkWatchdog),
+		FirstBoot:         supports(Definition{FirstBoot: true, EnableByPreset: true}, checkFirstBoot),
+		RCOrdering:        supports(Definition{RCKeywords: []string{"shutdown"}}, checkRCOrdering),
+		SystemCallFilter:  supports(Definition{SystemCallFilter: []string{SyscallDebug}}, checkIsolation),
+		NetworkIsolation:  supports(Definition{PrivateNetwork: true}, checkIsolation),
+	}, nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// ChangeReporter interface is implemented by daemons which report whether
+// their last mutating operation changed the system, e.g. for idempotent
+// configuration management modules
+type ChangeReporter interface {
+	// Changed - the last Install, Remove, Purge, Start or Stop changed
+	// the system, it is false if the operation failed or had nothing to do
+	// (ErrAlreadyInstalled, ErrNotInstalled, ErrAlreadyRunning, ErrAlreadyStopped)
+	Changed() bool
+}
+
+// Changed - the last mutating operation of the daemon changed the system
+func (properties *ServiceProperties) Changed() bool {
+	return properties.changed
+}
+
+// UpToDate - the installed service file of the daemon is identical to the one
+// which Install would write, apart from the metadata comments. It is false
+// if the service is not installed.
+func UpToDate(d Daemon) (bool, error) {
+	renderer, ok := d.(Renderer)
+	if !ok {
+		return false, ErrUnsupportedSystem
+	}
+	content, err := renderer.Render()
+	if err != nil {
+		return false, err
+	}
+	installed, err := ioutil.ReadFile(renderer.ServicePath())
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return StripMetadata(string(installed)) == StripMetadata(content), nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrChecksumMismatch appears if the SHA-256 checksum of an executable differs from the expected one
+	ErrChecksumMismatch = errors.New("Checksum of the executable does not match")
+
+	// ErrInvalidSignature appears if the detached signature of an executable is not valid
+	ErrInvalidSignature = errors.New("Signature of the executable is not valid")
+)
+
+// Checksum - SHA-256 checksum of the data as a hex string
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyChecksum - check the file has the expected SHA-256 checksum,
+// given as a hex string, optionally prefixed by "sha256:"
+func VerifyChecksum(path, checksum string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return verifyChecksum(data, checksum)
+}
+
+// VerifySignature - check the detached ed25519 signature of the file, it is read
+// from path + ".sig" (raw or base64 encoded), the public key is base64 encoded
+func VerifySignature(path, publicKey string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return verifySignature(data, path+".sig", publicKey)
+}
+
+func verifyChecksum(data []byte, checksum string) error {
+	expected := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(checksum), "sha256:"))
+	if Checksum(data) != expected {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+func verifySignature(data []byte, signaturePath, publicKey string) error {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("Public key must be a base64 encoded ed25519 key")
+	}
+	signature, err := ioutil.ReadFile(signaturePath)
+	if err != nil {
+		return err
+	}
+	if len(signature) != ed25519.SignatureSize {
+		if signature, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature))); err != nil {
+			return ErrInvalidSignature
+		}
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), data, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Check the executable which is about to be installed, by the checksum
+// and the signature of the definition if they are set
+func verifyExecutable(def *Definition, source string, data []byte) error {
+	if def.InstallChecksum != "" {
+		if err := verifyChecksum(data, def.InstallChecksum); err != nil {
+			return err
+		}
+	}
+	if def.InstallPublicKey != "" {
+		if err := verifySignature(data, source+".sig", def.InstallPublicKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Path of the recorded checksum of the installed executable,
+// the file has the format of sha256sum
+func checksumPath(path string) string {
+	return path + ".sha256"
+}
+
+// Check the installed executable still has the checksum which was
+// recorded on Install, or the one of the definition
+func verifyInstalledBinary(def *Definition) []string {
+	if def.InstallPath == "" {
+		return nil
+	}
+	expected := def.InstallChecksum
+	if expected == "" {
+		record, err := ioutil.ReadFile(checksumPath(def.InstallPath))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return []string{err.Error()}
+		}
+		if fields := strings.Fields(string(record)); len(fields) > 0 {
+			expected = fields[0]
+		}
+	}
+	if err := VerifyChecksum(def.InstallPath, expected); err != nil {
+		if os.IsNotExist(err) {
+			return []string{def.InstallPath + " does not exist"}
+		}
+		return []string{def.InstallPath + ": " + err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CloudInitDir - directory where the cloud-init user-data unpacks
+// the install bundles of the services
+const CloudInitDir = "/var/lib/daemon/"
+
+// ExportCloudInit - write a cloud-init user-data document (#cloud-config)
+// which installs and starts the service at the first boot of an instance.
+// The files of the install bundle are written by write_files to
+// CloudInitDir/<name>, runcmd runs its install.sh and starts the service,
+// so the same definition is used for live installs and launch templates.
+// The document may be merged with other user-data by the multipart format.
+func ExportCloudInit(w io.Writer, kind Kind, def *Definition) error {
+	commands, err := startCommands(kind, def.Name)
+	if err != nil {
+		return err
+	}
+	files, err := bundleFiles(kind, def)
+	if err != nil {
+		return err
+	}
+
+	dir := CloudInitDir + def.Name + "/"
+	var b strings.Builder
+	b.WriteString("#cloud-config\n")
+	fmt.Fprintf(&b, "# Managed by %s\n# %s\n", generatedBy, NewMetadata())
+	b.WriteString("write_files:\n")
+	for _, file := range files {
+		// the content is encoded, since the bundle may contain the executable
+		fmt.Fprintf(&b, "- path: %s\n  owner: root:root\n  permissions: '%04o'\n  encoding: b64\n  content: %s\n",
+			dir+file.path, file.mode, base64.StdEncoding.EncodeToString([]byte(file.content)))
+	}
+	b.WriteString("runcmd:\n")
+	fmt.Fprintf(&b, "- [sh, %sinstall.sh]\n", dir)
+	for _, command := range commands {
+		fmt.Fprintf(&b, "- [%s]\n", strings.Join(command, ", "))
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// Commands which start the installed service on the given kind of init system,
+// rc.d services are enabled in rc.conf first
+func startCommands(kind Kind, name string) ([][]string, error) {
+	switch kind {
+	case KindSystemD:
+		return [][]string{{"systemctl", "start", "--no-block", name + ".service"}}, nil
+	case KindSystemV:
+		return [][]string{{"service", name, "start"}}, nil
+	case KindUpstart:
+		return [][]string{{"initctl", "start", name}}, nil
+	case KindRCD:
+		return [][]string{{"sysrc", name + "_enable=YES"}, {"service", name, "start"}}, nil
+	}
+	return nil, ErrUnsupportedKind
+}
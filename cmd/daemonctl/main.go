@@ -0,0 +1,720 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+// Command daemonctl renders, validates, diffs, installs and removes
+// service definitions using the daemon package.
+//
+// Usage:
+//
+//	daemonctl -name myservice [-description text] [-dep unit]... [-kind kind -path executable] command [-- args...]
+//
+// The commands are:
+//
+//	render    print the service file which install would write
+//	effective print the template and the data which render uses as JSON
+//	inspect   print the definition of an installed service as JSON
+//	adopt     mark an installed service as managed, "adopt normalize" renders it again
+//	reload    make the init system reread the service files
+//	lint      list the problems of the definition and of its service file with suggestions (-kind or the current host)
+//	validate  check that the service file can be rendered, the executable exists, the ports are free and no other service conflicts
+//	diff      show the difference between the installed and the rendered service file
+//	schema    print the JSON schema of the definitions which are read by -definition
+//	template  print the default template of the service file (of -kind or of the current host)
+//	capabilities print the options which the init system supports as JSON (of -kind or of the current host)
+//	apply     install, update and remove the services of the definition files of a directory (-- dir), without -name
+//	export    write an install bundle (tar archive with install.sh) to -output
+//	cloudinit print cloud-init user-data which installs and starts the service (systemd unless -kind is set)
+//	nixos     print a NixOS module which declares the service as systemd.services.<name>
+//	install   install the service
+//	remove    remove the service
+//	purge     remove the service, its directories and its created account
+//	enable    start the installed service at boot
+//	disable   keep the installed service from starting at boot
+//	start     start the service
+//	stop      stop the service
+//	restart   stop and start the service, rate limited per service
+//	reset-failed clear the failed state and the restart counter of the service (systemd)
+//	pause     freeze the running service (SIGSTOP) without losing its state
+//	resume    let the paused service continue (SIGCONT)
+//	status    show the service status
+//	logs      show the last lines of the service logs (-- lines, default 50)
+//	show      print the raw properties of the service as the init system reports them (-- property...)
+//	diagnose  analyze why the service failed
+//	history   print the last operations of the package on the service
+//	control   send a command to the control channel of the running service (-- command [args...])
+//	maintenance stop and mark the service (-- on), or restore its previous state (-- off)
+//
+// Arguments after the command (optionally separated by "--") are passed
+// to the service executable. The executable is looked up in PATH by
+// the service name, the same way the daemon package does it.
+//
+// With -kind the render and diff commands generate the service file for the
+// given kind of init system (systemd, systemv, upstart, launchd, rcd) instead
+// of the one of the current host, -path sets the executable on the target host.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/takama/daemon"
+)
+
+const usage = `Usage: daemonctl -name myservice [-description text] [-dep unit]... [-kind kind -path executable] command [-- args...]
+
+Commands:
+  render    print the service file which install would write
+  effective print the template and the data which render uses as JSON
+  inspect   print the definition of an installed service as JSON
+  adopt     mark an installed service as managed, "adopt normalize" renders it again
+  reload    make the init system reread the service files
+  lint      list the problems of the definition and of its service file with suggestions (-kind or the current host)
+  validate  check that the service file can be rendered, the executable exists, the ports are free and no other service conflicts
+  diff      show the difference between the installed and the rendered service file
+  schema    print the JSON schema of the definitions which are read by -definition
+  template  print the default template of the service file (of -kind or of the current host)
+  capabilities print the options which the init system supports as JSON (of -kind or of the current host)
+  apply     install, update and remove the services of the definition files of a directory (-- dir), without -name
+  export    write an install bundle (tar archive with install.sh) to -output
+  cloudinit print cloud-init user-data which installs and starts the service (systemd unless -kind is set)
+  nixos     print a NixOS module which declares the service as systemd.services.<name>
+  install   install the service
+  remove    remove the service
+  purge     remove the service, its directories and its created account
+  enable    start the installed service at boot
+  disable   keep the installed service from starting at boot
+  start     start the service
+  stop      stop the service
+  restart   stop and start the service, rate limited per service
+  reset-failed clear the failed state and the restart counter of the service (systemd)
+  pause     freeze the running service (SIGSTOP) without losing its state
+  resume    let the paused service continue (SIGCONT)
+  status    show the service status
+  logs      show the last lines of the service logs (-- lines, default 50)
+  show      print the raw properties of the service as the init system reports them (-- property...)
+  diagnose  analyze why the service failed
+  history   print the last operations of the package on the service
+  control   send a command to the control channel of the running service (-- command [args...])
+  maintenance stop and mark the service (-- on), or restore its previous state (-- off)
+
+Flags:
+`
+
+var stdlog, errlog *log.Logger
+
+// list collects repeated flags
+type list []string
+
+func (l *list) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *list) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Control keeps the daemon which is managed by the command line
+type Control struct {
+	daemon.Daemon
+	definition daemon.Definition
+	kind       daemon.Kind
+	output     string
+}
+
+// Manage - execute the command and return its result
+func (control *Control) Manage(command string, args []string) (string, error) {
+	switch command {
+	case "render":
+		return control.render(args)
+	case "effective":
+		return control.effective(args)
+	case "inspect":
+		def, err := daemon.Inspect(control.definition.Name)
+		if err != nil {
+			return "Service could not be inspected", err
+		}
+		data, err := json.MarshalIndent(def, "", "  ")
+		return string(data), err
+	case "adopt":
+		if _, err := daemon.Adopt(control.definition.Name, len(args) > 0 && args[0] == "normalize"); err != nil {
+			return "Service could not be adopted", err
+		}
+		return "Service " + control.definition.Name + " adopted", nil
+	case "reload":
+		if err := daemon.ReloadManager(); err != nil {
+			return "Service manager could not be reloaded", err
+		}
+		return "Service manager reloaded", nil
+	case "diagnose":
+		return control.diagnose()
+	case "lint":
+		return control.lint(args)
+	case "validate":
+		return control.validate(args)
+	case "diff":
+		return control.diff(args)
+	case "export":
+		return control.export(args)
+	case "cloudinit":
+		return control.cloudInit(args)
+	case "nixos":
+		return control.nixos(args)
+	case "install":
+		return control.install(args)
+	case "remove":
+		return control.Remove()
+	case "purge":
+		purger, ok := control.Daemon.(daemon.Purger)
+		if !ok {
+			return "", errors.New("Purge is not supported on this system")
+		}
+		return purger.Purge()
+	case "enable":
+		if err := daemon.Enable(control.Daemon); err != nil {
+			return "Service could not be enabled", err
+		}
+		return "Service " + control.definition.Name + " enabled", nil
+	case "disable":
+		if err := daemon.Disable(control.Daemon); err != nil {
+			return "Service could not be disabled", err
+		}
+		return "Service " + control.definition.Name + " disabled", nil
+	case "start":
+		return control.Start()
+	case "stop":
+		return control.Stop()
+	case "restart":
+		if err := daemon.Restart(control.Daemon); err != nil {
+			return "Service could not be restarted", err
+		}
+		return "Service " + control.definition.Name + " restarted", nil
+	case "reset-failed":
+		if err := daemon.ResetFailed(control.Daemon); err != nil {
+			return "Failed state could not be reset", err
+		}
+		return "Failed state of " + control.definition.Name + " reset", nil
+	case "pause":
+		if err := daemon.Pause(control.Daemon); err != nil {
+			return "Service could not be paused", err
+		}
+		return "Service " + control.definition.Name + " paused", nil
+	case "resume":
+		if err := daemon.Resume(control.Daemon); err != nil {
+			return "Service could not be resumed", err
+		}
+		return "Service " + control.definition.Name + " resumed", nil
+	case "status":
+		return control.Status()
+	case "logs":
+		return control.logs(args)
+	case "show":
+		return control.show(args)
+	case "control":
+		return control.control(args)
+	case "maintenance":
+		return control.maintenance(args)
+	case "history":
+		return control.history()
+	}
+	return "", fmt.Errorf("unknown command %q", command)
+}
+
+// renderFile returns the path and the content of the service file,
+// for the requested kind of init system or for the current host
+func (control *Control) renderFile(args []string) (string, string, error) {
+	if control.kind != "" {
+		path, err := daemon.ServicePath(control.kind, control.definition.Name)
+		if err != nil {
+			return "", "", err
+		}
+		definition := control.definition
+		definition.Args = args
+		content, err := daemon.Render(control.kind, &definition)
+		return path, content, err
+	}
+	renderer, ok := control.Daemon.(daemon.Renderer)
+	if !ok {
+		return "", "", errors.New("Service files are not supported on this system")
+	}
+	content, err := renderer.Render(args...)
+	return renderer.ServicePath(), content, err
+}
+
+func (control *Control) render(args []string) (string, error) {
+	_, content, err := control.renderFile(args)
+	return strings.TrimSuffix(content, "\n"), err
+}
+
+func (control *Control) logs(args []string) (string, error) {
+	lines := 50
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return "Number of lines is expected", err
+		}
+		lines = n
+	}
+	reader, ok := control.Daemon.(daemon.LogReader)
+	if !ok {
+		return "", errors.New("Logs can not be read on this system")
+	}
+	content, err := reader.Logs(lines)
+	return strings.TrimSuffix(content, "\n"), err
+}
+
+func (control *Control) show(names []string) (string, error) {
+	values := make(map[string]string)
+	if len(names) == 0 {
+		properties, err := daemon.RawProperties(control.Daemon)
+		if err != nil {
+			return "Properties could not be read", err
+		}
+		for name, value := range properties {
+			names = append(names, name)
+			values[name] = value
+		}
+		sort.Strings(names)
+	}
+	lines := make([]string, len(names))
+	for i, name := range names {
+		value, ok := values[name]
+		if !ok {
+			var err error
+			if value, err = daemon.RawProperty(control.Daemon, name); err != nil {
+				return "Property " + name + " could not be read", err
+			}
+		}
+		lines[i] = name + "=" + value
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (control *Control) maintenance(args []string) (string, error) {
+	if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+		return "Maintenance expects on or off", errors.New("invalid argument")
+	}
+	if err := daemon.Maintenance(control.Daemon, args[0] == "on"); err != nil {
+		return "Maintenance could not be changed", err
+	}
+	if args[0] == "on" {
+		return "Service is in maintenance", nil
+	}
+	return "Service is out of maintenance", nil
+}
+
+func (control *Control) install(args []string) (string, error) {
+	status, err := control.Install(args...)
+	if noticer, ok := control.Daemon.(daemon.Noticer); ok && err == nil {
+		for _, notice := range noticer.Notices() {
+			status += "\n" + notice.Code + ": " + notice.Message
+		}
+	}
+	if warner, ok := control.Daemon.(daemon.Warner); ok && err == nil {
+		for _, warning := range warner.Warnings() {
+			status += "\nwarning: " + warning.Message
+		}
+	}
+	return status, err
+}
+
+func (control *Control) effective(args []string) (string, error) {
+	kind := control.kind
+	if kind == "" {
+		kind = daemon.HostKind()
+	}
+	definition := control.definition
+	if len(args) > 0 {
+		definition.Args = args
+	}
+	config, err := daemon.EffectiveConfig(kind, &definition)
+	if err != nil {
+		return "Configuration could not be resolved", err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return "Configuration could not be encoded", err
+	}
+	return string(data), nil
+}
+
+func (control *Control) history() (string, error) {
+	entries, err := daemon.History(control.Daemon)
+	if err != nil {
+		return "History could not be read", err
+	}
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		outcome := "FAILED"
+		if entry.OK {
+			outcome = "OK"
+		}
+		line := entry.Time.Format(time.RFC3339) + " " + entry.Action + " " + outcome
+		if entry.TraceID != "" {
+			line += " trace=" + entry.TraceID
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (control *Control) diagnose() (string, error) {
+	diagnoser, ok := control.Daemon.(daemon.Diagnoser)
+	if !ok {
+		return "", errors.New("Failures can not be diagnosed on this system")
+	}
+	diagnosis, err := diagnoser.Diagnose()
+	if err != nil {
+		return "Service could not be diagnosed", err
+	}
+	return diagnosis.String(), nil
+}
+
+func (control *Control) control(args []string) (string, error) {
+	if len(args) == 0 {
+		return "Control command is expected, e.g. status", errors.New("no control command")
+	}
+	properties, ok := daemon.Properties(control.Daemon)
+	if !ok {
+		return "", errors.New("Control channel is not supported on this system")
+	}
+	return properties.Control(args[0], args[1:]...)
+}
+
+func (control *Control) lint(args []string) (string, error) {
+	target := control.kind
+	if target == "" {
+		target = daemon.HostKind()
+	}
+	definition := control.definition
+	definition.Args = args
+	findings := daemon.Lint(target, &definition)
+	if len(findings) == 0 {
+		return "No problems found", nil
+	}
+	lines := make([]string, 0, len(findings))
+	failed := false
+	for _, finding := range findings {
+		lines = append(lines, finding.String())
+		failed = failed || finding.Severity == daemon.SeverityError
+	}
+	if failed {
+		return strings.Join(lines, "\n"), errors.New("Service definition has errors")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (control *Control) validate(args []string) (string, error) {
+	if _, err := control.render(args); err != nil {
+		return "Service file could not be rendered", err
+	}
+	if control.kind != "" {
+		// the executable lives on the target host
+		return "Service definition is valid", nil
+	}
+	if control.definition.Path == "" {
+		path, err := exec.LookPath(control.definition.Name)
+		if err != nil {
+			return "Executable could not be found", err
+		}
+		if self, err := os.Executable(); err == nil && sameFile(self, path) {
+			return "Executable could not be found",
+				fmt.Errorf("%s resolves to daemonctl itself, put the service executable in PATH", control.definition.Name)
+		}
+	}
+	if err := daemon.Preflight(&control.definition); err != nil {
+		return "Service would fail to start", err
+	}
+	conflicts, err := daemon.Conflicts(&control.definition)
+	if err != nil {
+		return "Conflicts could not be checked", err
+	}
+	if len(conflicts) > 0 {
+		return "Service conflicts with existing services", &daemon.ConflictError{Conflicts: conflicts}
+	}
+	return "Service definition is valid", nil
+}
+
+func (control *Control) diff(args []string) (string, error) {
+	path, rendered, err := control.renderFile(args)
+	if err != nil {
+		return "Service file could not be rendered", err
+	}
+	installed, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "Installed service file could not be read", err
+	}
+	// the metadata comments differ by host and time of generation
+	result := daemon.UnifiedDiff(path, daemon.StripMetadata(string(installed)), daemon.StripMetadata(rendered))
+	if result == "" {
+		return "Service file is up to date", nil
+	}
+	return strings.TrimSuffix(result, "\n"), nil
+}
+
+func (control *Control) export(args []string) (string, error) {
+	file, err := os.Create(control.output)
+	if err != nil {
+		return "Bundle could not be created", err
+	}
+	defer file.Close()
+
+	if control.kind != "" {
+		definition := control.definition
+		definition.Args = args
+		err = daemon.ExportBundle(file, control.kind, &definition)
+	} else if exporter, ok := control.Daemon.(daemon.Exporter); ok {
+		err = exporter.ExportBundle(file, args...)
+	} else {
+		err = errors.New("Service files are not supported on this system")
+	}
+	if err != nil {
+		os.Remove(control.output)
+		return "Bundle could not be exported", err
+	}
+	return "Bundle has been written to " + control.output, nil
+}
+
+func (control *Control) cloudInit(args []string) (string, error) {
+	kind := control.kind
+	if kind == "" {
+		kind = daemon.KindSystemD
+	}
+	definition := control.definition
+	definition.Args = args
+	var b strings.Builder
+	if err := daemon.ExportCloudInit(&b, kind, &definition); err != nil {
+		return "User-data could not be generated", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+func (control *Control) nixos(args []string) (string, error) {
+	definition := control.definition
+	definition.Args = args
+	var b strings.Builder
+	if err := daemon.ExportNixOS(&b, &definition); err != nil {
+		return "NixOS module could not be generated", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// sameFile reports whether both paths point to the same file
+func sameFile(a, b string) bool {
+	if resolved, err := filepath.EvalSymlinks(a); err == nil {
+		a = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(b); err == nil {
+		b = resolved
+	}
+	return a == b
+}
+
+// readDefinition reads the JSON form of a definition, see daemon.DefinitionSchema
+func readDefinition(path string) (*daemon.Definition, error) {
+	def, _, err := daemon.LoadDefinitionFile(path)
+	return def, err
+}
+
+// apply reconciles the services with the definition files of the directory
+func apply(dir string, options ...daemon.ApplyOption) (string, error) {
+	results, err := daemon.ApplyDir(dir, options...)
+	lines := make([]string, 0, len(results))
+	for _, result := range results {
+		action := result.Action
+		if action == "" {
+			action = "failed"
+		}
+		name := result.Name
+		if name == "" {
+			name = filepath.Base(result.File)
+		}
+		lines = append(lines, name+": "+action)
+		if result.Diff != "" {
+			lines = append(lines, strings.TrimSuffix(result.Diff, "\n"))
+		}
+	}
+	return strings.Join(lines, "\n"), err
+}
+
+func init() {
+	stdlog = log.New(os.Stdout, "", 0)
+	errlog = log.New(os.Stderr, "", 0)
+}
+
+func main() {
+	var deps, ports list
+	var loaded *daemon.Definition
+	name := flag.String("name", "", "name of the service")
+	description := flag.String("description", "", "description of the service (default is the name)")
+	flag.Var(&deps, "dep", "dependency of the service, may be repeated")
+	flag.Var(&ports, "port", "address the service listens on, e.g. :8080 or udp/:53, may be repeated")
+	kind := flag.String("kind", "", "render for this kind of init system instead of the current host")
+	path := flag.String("path", "", "path of the executable, by default it is looked up in PATH by the name")
+	installPath := flag.String("install-path", "", "copy the executable to this path on install and run the copy")
+	runAs := flag.String("user", "", "account the service runs as")
+	createUser := flag.Bool("create-user", false, "create the account of -user on install if it does not exist")
+	group := flag.String("group", "", "group the service runs as (default is the primary group of the user)")
+	logDir := flag.String("log-dir", "", "directory of the log files, created with the ownership of the user")
+	runtimeDir := flag.String("runtime-dir", "", "runtime directory of the service, it keeps the control socket")
+	logging := flag.String("logging", "", "where the output is written: file or journal (default is the init system's standard)")
+	scope := flag.String("scope", "", "install the variant of the definition for this scope: system, user or desktop")
+	preset := flag.String("preset", "", "template preset: "+strings.Join(daemon.Presets(), ", "))
+	definitionFile := flag.String("definition", "", "read the definition from this JSON, YAML or TOML file instead of the flags")
+	prune := flag.Bool("prune", false, "apply removes the managed services which have no definition file")
+	dryRun := flag.Bool("dry-run", false, "apply only lists what it would do")
+	output := flag.String("output", "", "file of the install bundle written by export (default is <name>.tar)")
+	trace := flag.String("trace", "", "trace ID which is attached to the results and the log messages of the operations")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.Arg(0) == "schema" {
+		schema, err := daemon.DefinitionSchema()
+		if err != nil {
+			errlog.Println("Error: ", err)
+			os.Exit(1)
+		}
+		stdlog.Println(string(schema))
+		return
+	}
+
+	if flag.Arg(0) == "template" {
+		target := daemon.Kind(*kind)
+		if target == "" {
+			target = daemon.HostKind()
+		}
+		text, err := daemon.DefaultTemplate(target)
+		if err != nil {
+			errlog.Println("Error: ", err)
+			os.Exit(1)
+		}
+		stdlog.Print(text)
+		return
+	}
+	if flag.Arg(0) == "capabilities" {
+		target := daemon.Kind(*kind)
+		if target == "" {
+			target = daemon.HostKind()
+		}
+		capabilities, err := daemon.Capabilities(target)
+		if err != nil {
+			errlog.Println("Error: ", err)
+			os.Exit(1)
+		}
+		data, _ := json.MarshalIndent(capabilities, "", "  ")
+		stdlog.Println(string(data))
+		return
+	}
+	if flag.Arg(0) == "apply" {
+		if flag.NArg() < 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		dir := flag.Arg(1)
+		if dir == "--" && flag.NArg() > 2 {
+			dir = flag.Arg(2)
+		}
+		var options []daemon.ApplyOption
+		if *prune {
+			options = append(options, daemon.ApplyPrune())
+		}
+		if *dryRun {
+			options = append(options, daemon.ApplyDryRun())
+		}
+		if *trace != "" {
+			options = append(options, daemon.ApplyTraceID(*trace))
+		}
+		status, err := apply(dir, options...)
+		if err != nil {
+			errlog.Println(status, "\nError: ", err)
+			os.Exit(1)
+		}
+		stdlog.Println(status)
+		return
+	}
+
+	if *definitionFile != "" {
+		def, err := readDefinition(*definitionFile)
+		if err != nil {
+			errlog.Println("Definition could not be read", "\nError: ", err)
+			os.Exit(1)
+		}
+		*name, loaded = def.Name, def
+	}
+	if *name == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *description == "" {
+		*description = *name
+	}
+	if *output == "" {
+		*output = *name + ".tar"
+	}
+	command, args := flag.Arg(0), flag.Args()[1:]
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+
+	definition := daemon.Definition{
+		Name:         *name,
+		Description:  *description,
+		Dependencies: deps,
+		Path:         *path,
+		InstallPath:  *installPath,
+		Ports:        ports,
+		User:         *runAs,
+		Group:        *group,
+		CreateUser:   *createUser,
+		LogDir:       *logDir,
+		Logging:      daemon.LogMode(*logging),
+		RuntimeDir:   *runtimeDir,
+		Preset:       *preset,
+	}
+	if loaded != nil {
+		definition = *loaded
+	}
+	if *scope != "" {
+		variant, err := daemon.ForScope(&definition, *scope)
+		if err != nil {
+			errlog.Println("Error: ", err)
+			os.Exit(1)
+		}
+		definition = *variant
+	}
+	srv, err := daemon.NewFromDefinition(&definition)
+	if err != nil {
+		errlog.Println("Error: ", err)
+		os.Exit(1)
+	}
+	if tracer, ok := srv.(daemon.Tracer); ok && *trace != "" {
+		tracer.SetTraceID(*trace)
+	}
+	control := &Control{
+		Daemon:     srv,
+		definition: definition,
+		kind:       daemon.Kind(*kind),
+		output:     *output,
+	}
+	status, err := control.Manage(command, args)
+	if err != nil {
+		errlog.Println(status, "\nError: ", err)
+		os.Exit(1)
+	}
+	stdlog.Println(status)
+}
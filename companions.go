@@ -0,0 +1,437 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/takama/daemon/systemd"
+	"github.com/takama/daemon/sysv"
+)
+
+// Directory of the cron entries which start the services by their timers
+const cronDir = "/etc/cron.d/"
+
+// SocketSection - sockets which start the service on the first connection,
+// the service takes them over from the init system (LISTEN_FDS of systemd,
+// launch_activate_socket of launchd)
+type SocketSection struct {
+	// ListenStream - TCP ports ("8080"), addresses ("127.0.0.1:8080",
+	// "[::1]:8080"), absolute paths of unix stream sockets or names of
+	// abstract unix sockets ("@myservice", systemd only)
+	ListenStream []string `json:"listen_stream,omitempty"`
+
+	// ListenDatagram - UDP ports, addresses or paths of unix datagram sockets
+	ListenDatagram []string `json:"listen_datagram,omitempty"`
+
+	// Name - name of the sockets which the service gets with them, see
+	// InheritedSockets (FileDescriptorName= of systemd, the name of the
+	// sockets of the launchd job for launch_activate_socket)
+	Name string `json:"name,omitempty"`
+
+	// IPv6Only - the sockets of the ports and of the IPv6 addresses accept
+	// IPv6 connections only, they are not shared with IPv4
+	// (BindIPv6Only=ipv6-only of systemd, SockFamily IPv6 of launchd)
+	IPv6Only bool `json:"ipv6_only,omitempty"`
+}
+
+// Name of the sockets of the launchd job which the service has no name for
+const defaultSocketName = "Listeners"
+
+// TimerSection - schedule which starts the service, Schedule or Interval
+type TimerSection struct {
+	// Schedule - cron expression of the start times: minute, hour, day of
+	// month, month and day of week, e.g. "30 3 * * mon-fri", or a macro
+	// like "@daily"
+	Schedule string `json:"schedule,omitempty"`
+
+	// Interval - the service is started periodically with the interval,
+	// cron supports the divisors of an hour or a day only
+	Interval time.Duration `json:"interval,omitempty"`
+
+	// Persistent - a start which was missed while the host was down is
+	// caught up at boot (systemd)
+	Persistent bool `json:"persistent,omitempty"`
+}
+
+// SocketListener - socket of the socket section as launchd declares it
+type SocketListener struct {
+	// Type - "stream" or "dgram"
+	Type string
+
+	// Node - host of a network socket, empty for any address
+	Node string
+
+	// Service - port of a network socket
+	Service string
+
+	// Path of a unix socket
+	Path string
+
+	// Family - "IPv6" if the network socket accepts IPv6 connections only
+	Family string
+}
+
+// Listener of an address of the socket section: a port, a host and
+// a port or an absolute path
+func socketListener(sockType, address string) (SocketListener, error) {
+	listener := SocketListener{Type: sockType}
+	if strings.HasPrefix(address, "/") || (strings.HasPrefix(address, "@") && len(address) > 1) {
+		listener.Path = address
+		return listener, nil
+	}
+	if strings.Contains(address, ":") {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return listener, err
+		}
+		listener.Node, address = host, port
+	}
+	if port, err := strconv.Atoi(address); err != nil || port < 1 || port > 65535 {
+		return listener, &net.AddrError{Err: "invalid port", Addr: address}
+	}
+	listener.Service = address
+	return listener, nil
+}
+
+// Listeners of the socket section of the definition
+func socketListeners(def *Definition) []SocketListener {
+	if def.Socket == nil {
+		return nil
+	}
+	var listeners []SocketListener
+	for _, sockets := range []struct {
+		sockType  string
+		addresses []string
+	}{{"stream", def.Socket.ListenStream}, {"dgram", def.Socket.ListenDatagram}} {
+		for _, address := range sockets.addresses {
+			if listener, err := socketListener(sockets.sockType, address); err == nil {
+				if def.Socket.IPv6Only && listener.Path == "" {
+					listener.Family = "IPv6"
+				}
+				listeners = append(listeners, listener)
+			}
+		}
+	}
+	return listeners
+}
+
+// Name of the sockets of the launchd job
+func socketName(def *Definition) string {
+	if def.Socket == nil || def.Socket.Name == "" {
+		return defaultSocketName
+	}
+	return def.Socket.Name
+}
+
+// Problems of the socket and timer sections of the definition
+func checkSectionProblems(def *Definition) []string {
+	var problems []string
+	if def.Socket != nil {
+		addresses := append(copyStrings(def.Socket.ListenStream), def.Socket.ListenDatagram...)
+		if len(addresses) == 0 {
+			problems = append(problems, "socket must listen on an address")
+		}
+		for _, address := range addresses {
+			if _, err := socketListener("", address); err != nil {
+				problems = append(problems, "socket address "+strconv.Quote(address)+" is invalid")
+			}
+		}
+		// the names of systemd are printable ASCII without colons, which
+		// separate them in LISTEN_FDNAMES
+		if name := def.Socket.Name; len(name) > 255 || strings.IndexFunc(name, func(r rune) bool {
+			return r <= ' ' || r > '~' || r == ':'
+		}) >= 0 {
+			problems = append(problems, "socket name "+strconv.Quote(name)+" is invalid")
+		}
+	}
+	if timer := def.Timer; timer != nil {
+		switch {
+		case timer.Schedule == "" && timer.Interval == 0:
+			problems = append(problems, "timer must have a schedule or an interval")
+		case timer.Schedule != "" && timer.Interval != 0:
+			problems = append(problems, "timer must not have both a schedule and an interval")
+		case timer.Interval < 0:
+			problems = append(problems, "timer interval must not be negative")
+		}
+		if _, err := parseSchedule(timer.Schedule); timer.Schedule != "" && err != nil {
+			problems = append(problems, "timer schedule "+strconv.Quote(timer.Schedule)+" is not a cron expression")
+		}
+	}
+	return problems
+}
+
+// Check the init system supports the socket and timer sections of the
+// definition: sockets are activated by systemd and launchd only, the
+// timers of the other init systems are cron entries
+func checkSections(kind Kind, def *Definition) error {
+	if problems := checkSectionProblems(def); len(problems) > 0 {
+		return &DefinitionError{Problems: problems}
+	}
+	if def.Socket != nil && kind != KindSystemD && kind != KindLaunchd {
+		return &UnsupportedOptionError{"socket", kind}
+	}
+	// abstract unix sockets are a feature of linux
+	if def.Socket != nil && kind == KindLaunchd {
+		for _, listener := range socketListeners(def) {
+			if strings.HasPrefix(listener.Path, "@") {
+				return &UnsupportedOptionError{"socket", kind}
+			}
+		}
+	}
+	if def.Timer == nil {
+		return nil
+	}
+	switch kind {
+	case KindSystemD, KindLaunchd:
+		return nil
+	case KindSystemV, KindUpstart, KindRCD:
+		if _, err := cronSchedule(def.Timer); err != nil {
+			return &UnsupportedOptionError{"timer", kind}
+		}
+		return nil
+	}
+	return &UnsupportedOptionError{"timer", kind}
+}
+
+// Cron expression of the timer, the interval must divide an hour or a day
+func cronSchedule(timer *TimerSection) (string, error) {
+	if timer.Schedule != "" {
+		return timer.Schedule, nil
+	}
+	minutes := int(timer.Interval / time.Minute)
+	switch {
+	case timer.Interval%time.Minute != 0 || minutes < 1:
+	case minutes < 60 && 60%minutes == 0:
+		return "*/" + strconv.Itoa(minutes) + " * * * *", nil
+	case minutes == 60:
+		return "0 * * * *", nil
+	case minutes%60 == 0 && minutes < 24*60 && 24*60%minutes == 0:
+		return "0 */" + strconv.Itoa(minutes/60) + " * * *", nil
+	case minutes == 24*60:
+		return "0 0 * * *", nil
+	}
+	return "", ErrInvalidSchedule
+}
+
+// Expressions of OnCalendar of the systemd timer of the definition
+func onCalendar(def *Definition) List {
+	if def.Timer == nil || def.Timer.Schedule == "" {
+		return nil
+	}
+	parsed, err := parseSchedule(def.Timer.Schedule)
+	if err != nil {
+		return nil
+	}
+	return parsed.onCalendar()
+}
+
+// StartCalendarInterval of launchd of the definition
+func calendarIntervals(def *Definition) []CalendarInterval {
+	if def.Timer == nil || def.Timer.Schedule == "" {
+		return nil
+	}
+	parsed, err := parseSchedule(def.Timer.Schedule)
+	if err != nil {
+		return nil
+	}
+	return parsed.calendarIntervals()
+}
+
+// StartInterval of launchd in seconds, the one of the definition
+// or the interval of the timer
+func startInterval(def *Definition) int {
+	if def.StartInterval == 0 && def.Timer != nil {
+		return int(def.Timer.Interval / time.Second)
+	}
+	return int(def.StartInterval / time.Second)
+}
+
+// Socket or timer unit which activates the systemd service
+func activationUnit(def *Definition, unitType string) *systemd.ActivationUnit {
+	unit := systemd.NewActivationUnit(def.Name, unitType)
+	unit.Root = PathPrefix()
+	unit.User = userScope(def)
+	return unit
+}
+
+// Render the socket or the timer unit of the service
+func renderActivationUnit(def *Definition, unitType string) (string, error) {
+	text := socketUnitConfig
+	if unitType == systemd.TypeTimer {
+		text = timerUnitConfig
+	}
+	templ, err := template.New(unitType).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var interval int
+	if def.Timer != nil {
+		interval = int(def.Timer.Interval / time.Second)
+	}
+	var buf bytes.Buffer
+	if err := templ.Execute(&buf, &struct {
+		*Definition
+		Calendar List
+		Interval int
+		Metadata Metadata
+	}{def, onCalendar(def), interval, NewMetadata()}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Types of the activation units of the sections of the definition
+func activationTypes(def *Definition) []string {
+	var types []string
+	if def.Socket != nil {
+		types = append(types, systemd.TypeSocket)
+	}
+	if def.Timer != nil {
+		types = append(types, systemd.TypeTimer)
+	}
+	return types
+}
+
+// Companion units which are enabled and disabled with the systemd service
+// (Also=): its socket, timer and path units
+func alsoUnits(def *Definition) List {
+	var units List
+	for _, unitType := range activationTypes(def) {
+		units = append(units, activationUnit(def, unitType).FileName())
+	}
+	if len(def.Watch) > 0 {
+		units = append(units, pathUnit(def).FileName())
+	}
+	return units
+}
+
+// Write and enable the socket and the timer units of the service together,
+// the units are removed again if one of them fails
+func installActivationUnits(def *Definition) error {
+	types := activationTypes(def)
+	if len(types) == 0 {
+		return nil
+	}
+	for _, unitType := range types {
+		content, err := renderActivationUnit(def, unitType)
+		if err == nil {
+			err = ioutil.WriteFile(activationUnit(def, unitType).Path(), []byte(content), 0644)
+		}
+		if err != nil {
+			removeActivationUnits(def)
+			return err
+		}
+	}
+	reload := func() error { return reloadManager(KindSystemD) }
+	if userScope(def) {
+		reload = systemd.UserDaemonReload
+	}
+	if err := reload(); err != nil {
+		removeActivationUnits(def)
+		return err
+	}
+	for _, unitType := range types {
+		if err := activationUnit(def, unitType).Enable(); err != nil {
+			removeActivationUnits(def)
+			return err
+		}
+	}
+	return nil
+}
+
+// Disable and remove the socket and the timer units of the service
+func removeActivationUnits(def *Definition) error {
+	for _, unitType := range []string{systemd.TypeSocket, systemd.TypeTimer} {
+		unit := activationUnit(def, unitType)
+		if _, err := os.Stat(unit.Path()); os.IsNotExist(err) {
+			continue
+		}
+		unit.Disable()
+		if err := os.Remove(unit.Path()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// File name of the cron entry of the service, the names of the files
+// in cron.d may not contain dots
+func cronName(def *Definition) string {
+	return strings.Replace(def.Name, ".", "_", -1)
+}
+
+// Path of the cron entry of the service
+func cronPath(def *Definition) string {
+	return rooted(cronDir + cronName(def))
+}
+
+// Command of the cron entry which starts the service
+func cronCommand(kind Kind, def *Definition) string {
+	switch kind {
+	case KindUpstart:
+		return "/sbin/initctl start " + def.Name
+	case KindRCD:
+		return "/usr/sbin/service " + def.Name + " start"
+	}
+	return sysv.Dir + def.Name + " start"
+}
+
+// Cron entry which starts the service by its timer, ok is false
+// if the init system has timers or the service has none
+func cronEntry(kind Kind, def *Definition) (entry string, ok bool) {
+	if def.Timer == nil || (kind != KindSystemV && kind != KindUpstart && kind != KindRCD) {
+		return "", false
+	}
+	expression, err := cronSchedule(def.Timer)
+	if err != nil {
+		return "", false
+	}
+	templ, err := template.New("cron").Parse(cronEntryConfig)
+	if err != nil {
+		return "", false
+	}
+	var buf bytes.Buffer
+	if err := templ.Execute(&buf, &struct {
+		Schedule string
+		Command  string
+		Metadata Metadata
+	}{expression, cronCommand(kind, def), NewMetadata()}); err != nil {
+		return "", false
+	}
+	return buf.String(), true
+}
+
+// Write the cron entry which starts the service by its timer
+func installCronEntry(kind Kind, def *Definition) error {
+	if def.Timer == nil {
+		return nil
+	}
+	entry, ok := cronEntry(kind, def)
+	if !ok {
+		return &UnsupportedOptionError{"timer", kind}
+	}
+	if err := os.MkdirAll(rooted(cronDir), defaultDirMode); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(cronPath(def), []byte(entry), 0644)
+}
+
+// Remove the cron entry of the service, a file of the same name
+// which was not written by the package is kept
+func removeCronEntry(def *Definition) error {
+	content, err := ioutil.ReadFile(cronPath(def))
+	if err != nil || !strings.Contains(string(content), managedMarker) {
+		return nil
+	}
+	return os.Remove(cronPath(def))
+}
@@ -0,0 +1,161 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+// Package compat mirrors the API of the upstream takama/daemon package:
+// New with the kind of the service, and the Daemon interface with
+// GetTemplate and SetTemplate. Projects which are written against the
+// upstream package switch by importing this package under the old name,
+//
+//	import daemon "github.com/takama/daemon/compat"
+//
+// and keep their call sites. The daemons which New returns are the daemons
+// of the daemon package, so its other interfaces (Enabler, Pauser, Renderer
+// and so on) are at hand by type assertions on Unwrap; new code should use
+// daemon.NewWithOptions instead.
+package compat
+
+import (
+	"runtime"
+
+	"github.com/takama/daemon"
+)
+
+// Kind - kind of the service as the upstream package declares it,
+// it matters on macOS only
+type Kind string
+
+// Kinds of the services
+const (
+	// UserAgent - agent of the current user, ~/Library/LaunchAgents
+	UserAgent Kind = "UserAgent"
+
+	// GlobalAgent - agent of every logged in user, /Library/LaunchAgents
+	GlobalAgent Kind = "GlobalAgent"
+
+	// GlobalDaemon - daemon of the system, /Library/LaunchDaemons
+	GlobalDaemon Kind = "GlobalDaemon"
+
+	// SystemDaemon - daemon of the system, the only kind on linux,
+	// FreeBSD and windows
+	SystemDaemon Kind = "SystemDaemon"
+)
+
+// Errors of the daemon package under their upstream names
+var (
+	// ErrUnsupportedSystem appears if try to use service on system which is not supported by this release
+	ErrUnsupportedSystem = daemon.ErrUnsupportedSystem
+
+	// ErrRootPrivileges appears if run installation or deleting the service without root privileges
+	ErrRootPrivileges = daemon.ErrRootPrivileges
+
+	// ErrAlreadyInstalled appears if service already installed on the system
+	ErrAlreadyInstalled = daemon.ErrAlreadyInstalled
+
+	// ErrNotInstalled appears if try to delete service which was not been installed
+	ErrNotInstalled = daemon.ErrNotInstalled
+
+	// ErrAlreadyRunning appears if try to start already running service
+	ErrAlreadyRunning = daemon.ErrAlreadyRunning
+
+	// ErrAlreadyStopped appears if try to stop already stopped service
+	ErrAlreadyStopped = daemon.ErrAlreadyStopped
+)
+
+// Daemon interface of the upstream package
+type Daemon interface {
+	// GetTemplate - gets service config template
+	GetTemplate() string
+
+	// SetTemplate - sets service config template
+	SetTemplate(string) error
+
+	// Install the service into the system
+	Install(args ...string) (string, error)
+
+	// Remove the service and all corresponding files from the system
+	Remove() (string, error)
+
+	// Start the service
+	Start() (string, error)
+
+	// Stop the service
+	Stop() (string, error)
+
+	// Status - check the service status
+	Status() (string, error)
+
+	// Run - run executable service
+	Run(e Executable) (string, error)
+}
+
+// Executable interface defines controlling methods of executable service
+type Executable interface {
+	daemon.Executable
+}
+
+// compatRecord - daemon of the daemon package with the upstream methods
+type compatRecord struct {
+	daemon.Daemon
+}
+
+// New - Create a new daemon
+//
+// name: name of the service
+//
+// description: any explanation, what is the service, its purpose
+//
+// kind: what kind of daemon to create
+func New(name, description string, kind Kind, dependencies ...string) (Daemon, error) {
+	def := &daemon.Definition{
+		Name:         name,
+		Description:  description,
+		Dependencies: dependencies,
+	}
+	if runtime.GOOS == "darwin" {
+		switch kind {
+		case UserAgent:
+			def.Scope = daemon.ScopeUserLogin
+		case GlobalAgent:
+			def.PerUser = true
+		case GlobalDaemon, SystemDaemon, "":
+		default:
+			return nil, ErrUnsupportedSystem
+		}
+	}
+	d, err := daemon.NewFromDefinition(def)
+	if err != nil {
+		return nil, err
+	}
+	return &compatRecord{d}, nil
+}
+
+// Unwrap - the daemon of the daemon package
+func Unwrap(d Daemon) daemon.Daemon {
+	if record, ok := d.(*compatRecord); ok {
+		return record.Daemon
+	}
+	return nil
+}
+
+// GetTemplate - the template of the service file, empty on windows
+func (record *compatRecord) GetTemplate() string {
+	if handler, ok := record.Daemon.(daemon.TemplateHandler); ok {
+		return handler.GetTemplate()
+	}
+	return ""
+}
+
+// SetTemplate - replace the template of the service file,
+// windows has no service file
+func (record *compatRecord) SetTemplate(text string) error {
+	if handler, ok := record.Daemon.(daemon.TemplateHandler); ok {
+		return handler.SetTemplate(text)
+	}
+	return ErrUnsupportedSystem
+}
+
+// Run - run executable service
+func (record *compatRecord) Run(e Executable) (string, error) {
+	return record.Daemon.Run(e)
+}
@@ -0,0 +1,20 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+// Check the init system is able to skip the start of the service by its
+// condition commands: systemd (ExecCondition=), the System V and the rc.d
+// scripts and the pre-start script of upstart; launchd would start the job
+// again and again, the windows service manager has no such hook
+func checkConditionCommands(kind Kind, def *Definition) error {
+	if len(def.ConditionCommands) == 0 {
+		return nil
+	}
+	switch kind {
+	case KindSystemD, KindSystemV, KindUpstart, KindRCD:
+		return nil
+	}
+	return &UnsupportedOptionError{"condition_commands", kind}
+}
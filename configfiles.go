@@ -0,0 +1,208 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/takama/daemon/systemd"
+)
+
+// ConfigFile - configuration file of the service which is written by Install,
+// checked by Verify and deployed by Ensure
+type ConfigFile struct {
+	// Path - absolute path of the file
+	Path string `json:"path"`
+
+	// Content - text/template of the content, it is executed with the
+	// TemplateData of the service, e.g. {{.Name}} or {{.StateDir}}
+	Content string `json:"content"`
+
+	// User - owner of the file, empty means the owner is not changed
+	User string `json:"user,omitempty"`
+
+	// Group of the file, empty means the group is not changed
+	Group string `json:"group,omitempty"`
+
+	// Mode - permissions, 0644 by default
+	Mode os.FileMode `json:"mode,omitempty"`
+}
+
+// ConfigDeployer interface is implemented by daemons which write
+// the configuration files of their definition
+type ConfigDeployer interface {
+	// DeployConfig - write the configuration files whose content differs
+	// from the definition, changed reports whether any file was written
+	DeployConfig() (changed bool, err error)
+}
+
+// Render the content of the configuration file for the given kind of init system
+func renderConfigFile(kind Kind, def *Definition, file *ConfigFile) ([]byte, error) {
+	path, err := serviceExecutable(def)
+	if err != nil {
+		return nil, err
+	}
+	templ, err := template.New(file.Path).Parse(file.Content)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := templ.Execute(&buf, templateData(kind, def, path)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Write the configuration files which differ from the definition,
+// the metadata comments are not compared
+func deployConfigFiles(kind Kind, def *Definition) (bool, error) {
+	changed := false
+	for i := range def.ConfigFiles {
+		file := &def.ConfigFiles[i]
+		content, err := renderConfigFile(kind, def, file)
+		if err != nil {
+			return changed, err
+		}
+		path := rooted(file.Path)
+		installed, err := ioutil.ReadFile(path)
+		if err == nil && StripMetadata(string(installed)) == StripMetadata(string(content)) {
+			continue
+		}
+		if err := writeConfigFile(path, file, content); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// Write the file next to the target and rename it,
+// so the service never reads a partially written configuration
+func writeConfigFile(path string, file *ConfigFile, content []byte) error {
+	mode := file.Mode
+	if mode == 0 {
+		mode = 0644
+	}
+	if err := os.MkdirAll(filepath.Dir(path), defaultDirMode); err != nil {
+		return err
+	}
+	temporary := path + ".new"
+	if err := ioutil.WriteFile(temporary, content, mode); err != nil {
+		return err
+	}
+	if err := os.Chmod(temporary, mode); err != nil {
+		os.Remove(temporary)
+		return err
+	}
+	// the accounts of an offline image are unknown on the host
+	if !offline() {
+		uid, gid, err := lookupOwner(file.User, file.Group)
+		if err == nil && (uid >= 0 || gid >= 0) {
+			err = os.Chown(temporary, uid, gid)
+		}
+		if err != nil {
+			os.Remove(temporary)
+			return err
+		}
+	}
+	return os.Rename(temporary, path)
+}
+
+// Checksums of the installed configuration files which differ from the definition
+func verifyConfigFiles(kind Kind, def *Definition) []string {
+	var problems []string
+	for i := range def.ConfigFiles {
+		file := &def.ConfigFiles[i]
+		content, err := renderConfigFile(kind, def, file)
+		if err != nil {
+			problems = append(problems, file.Path+" could not be rendered: "+err.Error())
+			continue
+		}
+		installed, err := ioutil.ReadFile(file.Path)
+		if err != nil {
+			problems = append(problems, file.Path+" does not exist")
+			continue
+		}
+		if Checksum([]byte(StripMetadata(string(installed)))) != Checksum([]byte(StripMetadata(string(content)))) {
+			problems = append(problems, file.Path+" differs from the definition")
+		}
+	}
+	return problems
+}
+
+// Remove the configuration files of the service
+func removeConfigFiles(def *Definition) error {
+	for _, file := range def.ConfigFiles {
+		if err := os.Remove(rooted(file.Path)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeployConfig - write the configuration files of the service which differ
+// from the definition
+func (properties *ServiceProperties) DeployConfig() (bool, error) {
+	return deployConfigFiles(hostKind(), &properties.def)
+}
+
+// Ensure - bring the service in line with its definition: it is installed
+// if it is missing, its configuration files are deployed and it is restarted
+// only if any of them changed, a stopped service is started. A systemd unit
+// which has changed since the manager loaded it (NeedDaemonReload) is loaded
+// again and the service restarted. A service in maintenance, or one which
+// is deferred to the next boot (InstallForNextBoot), is neither
+// started nor restarted. The restarts are rate limited like Restart, beyond
+// the limit the files are deployed and *RestartLimitError is returned.
+// changed reports whether anything was done.
+func Ensure(d Daemon) (changed bool, err error) {
+	_, err = d.Install()
+	switch err {
+	case nil:
+		changed = true
+	case ErrAlreadyInstalled:
+	default:
+		return false, err
+	}
+	reconfigured := false
+	if deployer, ok := d.(ConfigDeployer); ok {
+		if reconfigured, err = deployer.DeployConfig(); err != nil {
+			return changed, err
+		}
+	}
+	if unit, ok := SystemdUnit(d); ok && !offline() {
+		if reload, _ := unit.NeedDaemonReload(); reload {
+			reloadUnits := systemd.DaemonReload
+			if unit.User {
+				reloadUnits = systemd.UserDaemonReload
+			}
+			if err := reloadUnits(); err != nil {
+				return changed || reconfigured, err
+			}
+			reconfigured = true
+		}
+	}
+	if InMaintenance(d) || DeferredToBoot(d) {
+		return changed || reconfigured, nil
+	}
+	_, err = d.Start()
+	switch {
+	case err == nil:
+		return true, nil
+	case err != ErrAlreadyRunning:
+		return changed || reconfigured, err
+	case !reconfigured:
+		return changed, nil
+	}
+	// the running service reads the new configuration after the restart
+	if err := Restart(d); err != nil {
+		return true, err
+	}
+	return true, nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// ErrConfigChanged appears if Run stopped the executable, which is not
+// a ConfigReloader, since its configuration files changed. The process
+// should exit with a failure, so the init system starts it again.
+var ErrConfigChanged = errors.New("Configuration files have changed")
+
+// Time the configuration files have to settle after a change,
+// editors and deployments write them in several steps
+const configSettleTime = 500 * time.Millisecond
+
+// ConfigReloader interface may be implemented by an Executable to apply
+// the changes of its configuration files while it runs
+type ConfigReloader interface {
+	// Reload - read the configuration files again
+	Reload()
+}
+
+// configWatcher - watcher of the configuration files of a running service
+type configWatcher struct {
+	done    chan struct{}
+	wg      sync.WaitGroup
+	stopped bool
+}
+
+// Watch the configuration files of the definition while the service runs,
+// if it is enabled by WatchConfig: the executable is reloaded, if it is
+// a ConfigReloader, or stopped, so Run returns ErrConfigChanged.
+// Only changes of the content are considered, touching the files is not.
+func (properties *ServiceProperties) watchConfig(e Executable) *configWatcher {
+	def := &properties.def
+	if !def.WatchConfig || len(def.ConfigFiles) == 0 {
+		return nil
+	}
+	paths := make([]string, len(def.ConfigFiles))
+	for i, file := range def.ConfigFiles {
+		paths[i] = file.Path
+	}
+	watcher := &configWatcher{done: make(chan struct{})}
+	changes := make(chan struct{}, 1)
+	watcher.wg.Add(2)
+	go func() {
+		defer watcher.wg.Done()
+		notifyChanges(paths, changes, watcher.done)
+	}()
+	go func() {
+		defer watcher.wg.Done()
+		reloader, _ := e.(ConfigReloader)
+		sums := configChecksums(paths)
+		for {
+			select {
+			case <-watcher.done:
+				return
+			case <-changes:
+			}
+			select {
+			case <-watcher.done:
+				return
+			case <-time.After(configSettleTime):
+			}
+			current := configChecksums(paths)
+			if sameChecksums(sums, current) {
+				continue
+			}
+			sums = current
+			if reloader != nil {
+				reloader.Reload()
+				continue
+			}
+			watcher.stopped = true
+			e.Stop()
+			return
+		}
+	}()
+	return watcher
+}
+
+// Close - stop watching, it returns ErrConfigChanged
+// if the executable was stopped by the watcher
+func (watcher *configWatcher) Close() error {
+	if watcher == nil {
+		return nil
+	}
+	close(watcher.done)
+	watcher.wg.Wait()
+	if watcher.stopped {
+		return ErrConfigChanged
+	}
+	return nil
+}
+
+// Checksums of the content of the files, missing files have empty ones
+func configChecksums(paths []string) []string {
+	sums := make([]string, len(paths))
+	for i, path := range paths {
+		if data, err := ioutil.ReadFile(path); err == nil {
+			sums[i] = Checksum(data)
+		}
+	}
+	return sums
+}
+
+func sameChecksums(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Signal a possible change of the files by polling their state,
+// until done is closed
+func pollChanges(paths []string, changes chan<- struct{}, done <-chan struct{}) {
+	states := make([]pathState, len(paths))
+	for i, path := range paths {
+		states[i] = statPath(PathSpec{Path: path})
+	}
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		for i, path := range paths {
+			if state := statPath(PathSpec{Path: path}); state != states[i] {
+				states[i] = state
+				signalChange(changes)
+			}
+		}
+	}
+}
+
+// Signal a change without blocking, a pending signal covers it
+func signalChange(changes chan<- struct{}) {
+	select {
+	case changes <- struct{}{}:
+	default:
+	}
+}
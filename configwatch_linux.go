@@ -0,0 +1,60 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Events of the directories of the configuration files, the files are
+// usually replaced by a rename, so their own inodes are not watched
+const configEvents = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE | syscall.IN_DELETE
+
+// Signal a possible change of the files by inotify until done is closed,
+// the state of the files is polled if inotify is not available
+func notifyChanges(paths []string, changes chan<- struct{}, done <-chan struct{}) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		pollChanges(paths, changes, done)
+		return
+	}
+	// a non-blocking descriptor is served by the runtime poller,
+	// so the read is interrupted by Close
+	file := os.NewFile(uintptr(fd), "inotify")
+	names := make(map[string]bool)
+	for _, path := range paths {
+		if _, err := syscall.InotifyAddWatch(fd, filepath.Dir(path), configEvents); err != nil {
+			file.Close()
+			pollChanges(paths, changes, done)
+			return
+		}
+		names[filepath.Base(path)] = true
+	}
+	go func() {
+		<-done
+		file.Close()
+	}()
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := file.Read(buf)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + syscall.SizeofInotifyEvent
+			// the name is padded by zero bytes
+			name := strings.TrimRight(string(buf[start:start+int(event.Len)]), "\x00")
+			if names[name] {
+				signalChange(changes)
+			}
+			offset = start + int(event.Len)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package daemon
+
+// Signal a possible change of the files until done is closed by polling
+// their state, FSEvents of macOS is not available without cgo
+func notifyChanges(paths []string, changes chan<- struct{}, done <-chan struct{}) {
+	pollChanges(paths, changes, done)
+}
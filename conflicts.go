@@ -0,0 +1,239 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/takama/daemon/launchd"
+	"github.com/takama/daemon/rcd"
+	"github.com/takama/daemon/systemd"
+	"github.com/takama/daemon/sysv"
+	"github.com/takama/daemon/upstart"
+)
+
+// Reasons of the conflicts which are found by Conflicts
+const (
+	// ConflictBackend - a service of the same name is managed by another init system
+	ConflictBackend = "backend"
+
+	// ConflictAlias - the name is an alias of another systemd unit
+	ConflictAlias = "alias"
+
+	// ConflictExecutable - another service runs the same executable
+	ConflictExecutable = "executable"
+)
+
+// Conflict - existing service which competes with the service to be installed
+type Conflict struct {
+	Kind   Kind   `json:"kind"`
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+func (conflict Conflict) String() string {
+	switch conflict.Reason {
+	case ConflictBackend:
+		return string(conflict.Kind) + " manages a service of the same name (" + conflict.Path + ")"
+	case ConflictAlias:
+		return "the name is an alias of the systemd unit " + conflict.Name + " (" + conflict.Path + ")"
+	}
+	return string(conflict.Kind) + " service " + conflict.Name + " runs the same executable (" + conflict.Path + ")"
+}
+
+// ConflictError - conflicts which are found before the service is installed
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	conflicts := make([]string, len(e.Conflicts))
+	for i, conflict := range e.Conflicts {
+		conflicts[i] = conflict.String()
+	}
+	return "Conflicting services: " + strings.Join(conflicts, "; ")
+}
+
+// Directories of the service files which are scanned for conflicts,
+// the first one is the directory of the files which are installed
+var serviceDirs = map[Kind][]string{
+	KindSystemD: {systemd.Dir, "/lib/systemd/system/", "/usr/lib/systemd/system/"},
+	KindSystemV: {sysv.Dir},
+	KindUpstart: {upstart.Dir},
+	KindLaunchd: {launchd.Dir},
+	KindRCD:     {rcd.Dir, "/etc/rc.d/"},
+}
+
+// Suffixes of the service files, they are not part of the service names
+var serviceSuffixes = map[Kind]string{
+	KindSystemD: ".service",
+	KindUpstart: ".conf",
+	KindLaunchd: ".plist",
+}
+
+// Exists - check a service of the name is installed on the current host
+// by any of its init systems, e.g. by System V init on a systemd host
+func Exists(name string) bool {
+	kind := hostKind()
+	if kind == KindWindows {
+		_, err := inspect(name)
+		return err == nil
+	}
+	for _, k := range coexistingKinds(kind) {
+		if path, err := ServicePath(k, name); err == nil && fileExists(rooted(path)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conflicts - existing services of the current host which would compete with
+// the defined service: a service of the same name which is managed by another
+// init system (e.g. an init script which is left after the migration to
+// systemd), a systemd unit which has the name as an alias, and services which
+// run the same executable. Daemons check it before Install if the definition
+// has CheckConflicts set, the conflicts are reported by a *ConflictError.
+func Conflicts(def *Definition) ([]Conflict, error) {
+	return conflicts(hostKind(), def)
+}
+
+// Conflicts of the service which is installed for the given kind of init system
+func conflicts(kind Kind, def *Definition) ([]Conflict, error) {
+	var found []Conflict
+	for _, k := range coexistingKinds(kind) {
+		path, err := ServicePath(k, def.Name)
+		if err != nil {
+			return nil, err
+		}
+		if k != kind && fileExists(rooted(path)) {
+			found = append(found, Conflict{Kind: k, Name: def.Name, Path: path, Reason: ConflictBackend})
+		}
+	}
+	if kind == KindSystemD {
+		found = append(found, aliasConflicts(def.Name)...)
+	}
+	executable, err := serviceExecutable(def)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range coexistingKinds(kind) {
+		found = append(found, executableConflicts(k, def.Name, executable)...)
+	}
+	return found, nil
+}
+
+// Kinds of init systems whose services are found on a host of the kind,
+// systemd runs the init scripts of System V as well
+func coexistingKinds(kind Kind) []Kind {
+	switch {
+	case linuxKind(kind):
+		return []Kind{KindSystemD, KindSystemV, KindUpstart}
+	case kind == KindWindows:
+		return nil
+	}
+	return []Kind{kind}
+}
+
+// Units which have the name as an alias: a link of the unit name to another
+// unit, or a unit which declares the name by Alias=
+func aliasConflicts(name string) []Conflict {
+	var found []Conflict
+	known := make(map[string]bool)
+	unitName := systemd.New(name).FileName()
+	link := systemd.Dir + unitName
+	if info, err := os.Lstat(rooted(link)); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if target, err := os.Readlink(rooted(link)); err == nil && filepath.Base(target) != unitName {
+			unit := strings.TrimSuffix(filepath.Base(target), ".service")
+			known[unit] = true
+			found = append(found, Conflict{Kind: KindSystemD, Name: unit, Path: target, Reason: ConflictAlias})
+		}
+	}
+	eachServiceFile(KindSystemD, func(unit, path, content string) {
+		if unit == name || known[unit] {
+			return
+		}
+		scanner := bufio.NewScanner(strings.NewReader(content))
+		for scanner.Scan() {
+			key, value, ok := keyValue(scanner.Text())
+			if !ok || key != "Alias" {
+				continue
+			}
+			for _, alias := range strings.Fields(value) {
+				if alias == unitName && !known[unit] {
+					known[unit] = true
+					found = append(found, Conflict{Kind: KindSystemD, Name: unit, Path: path, Reason: ConflictAlias})
+				}
+			}
+		}
+	})
+	return found
+}
+
+// Services of the kind of init system, except the named one, which run the executable
+func executableConflicts(kind Kind, name, executable string) []Conflict {
+	var found []Conflict
+	eachServiceFile(kind, func(service, path, content string) {
+		// a quick check before the file is parsed
+		if service == name || !strings.Contains(content, filepath.Base(executable)) {
+			return
+		}
+		def, err := Parse(kind, service, content)
+		if err != nil || !sameExecutable(def.Path, executable) {
+			return
+		}
+		found = append(found, Conflict{Kind: kind, Name: service, Path: path, Reason: ConflictExecutable})
+	})
+	return found
+}
+
+// Call fn for every service file of the kind of init system, units which
+// are overridden by a file of the same name in a former directory are skipped
+func eachServiceFile(kind Kind, fn func(name, path, content string)) {
+	seen := make(map[string]bool)
+	for _, dir := range serviceDirs[kind] {
+		files, err := ioutil.ReadDir(rooted(dir))
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			name := file.Name()
+			suffix := serviceSuffixes[kind]
+			// links are aliases or units which are enabled by another name
+			if seen[name] || !file.Mode().IsRegular() || !strings.HasSuffix(name, suffix) || strings.Contains(name, "@") {
+				continue
+			}
+			seen[name] = true
+			content, err := ioutil.ReadFile(rooted(dir + name))
+			if err != nil {
+				continue
+			}
+			fn(strings.TrimSuffix(name, suffix), dir+name, string(content))
+		}
+	}
+}
+
+// Check both paths refer to the same executable, links are resolved
+func sameExecutable(path, executable string) bool {
+	if filepath.Clean(path) == filepath.Clean(executable) {
+		return true
+	}
+	first, err := filepath.EvalSymlinks(rooted(path))
+	if err != nil {
+		return false
+	}
+	second, err := filepath.EvalSymlinks(rooted(executable))
+	return err == nil && first == second
+}
+
+// Check the file exists
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrUnknownCommand appears if the control channel receives a command
+// which is neither built in nor handled by the executable
+var ErrUnknownCommand = errors.New("Unknown control command")
+
+// ControlHandler interface may be implemented by an Executable to handle
+// commands of the control channel which are not built in, e.g. "reload"
+type ControlHandler interface {
+	Control(command string, args ...string) (string, error)
+}
+
+// Request and response of the control channel, one JSON object per line
+type controlRequest struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+type controlResponse struct {
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ControlSocket - path of the unix socket of the control channel of the service,
+// it is kept in the runtime directory of the service if it is set.
+// Windows 10 and newer support unix sockets as well, so the control
+// channel works the same way on every system.
+func ControlSocket(def *Definition) string {
+	if def.RuntimeDir != "" {
+		return filepath.Join(def.RuntimeDir, "control.sock")
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), def.Name, "control.sock")
+	}
+	return "/var/run/" + def.Name + ".sock"
+}
+
+// controlServer - control channel of a running service
+type controlServer struct {
+	listener net.Listener
+	handler  ControlHandler
+	started  time.Time
+	wg       sync.WaitGroup
+}
+
+// Open the control channel of the service, if it is enabled by the definition;
+// ErrAlreadyRunning if another instance of the service serves it
+func (properties *ServiceProperties) startControl(e Executable) (*controlServer, error) {
+	if !properties.def.Control {
+		return nil, nil
+	}
+	path := ControlSocket(&properties.def)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	// the socket of a running instance is kept, a socket which does not
+	// answer is left by a crashed process
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return nil, ErrAlreadyRunning
+	}
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := applySocketOwner(&properties.def, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	server := &controlServer{listener: listener, started: time.Now()}
+	server.handler, _ = e.(ControlHandler)
+	server.wg.Add(1)
+	go server.serve()
+	return server, nil
+}
+
+// Close - close the control channel and wait for the served connections
+func (server *controlServer) Close() error {
+	if server == nil {
+		return nil
+	}
+	err := server.listener.Close()
+	server.wg.Wait()
+	return err
+}
+
+func (server *controlServer) serve() {
+	defer server.wg.Done()
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		server.wg.Add(1)
+		go func() {
+			defer server.wg.Done()
+			defer conn.Close()
+			server.handle(conn)
+		}()
+	}
+}
+
+// Answer the requests of the connection until it is closed
+func (server *controlServer) handle(conn net.Conn) {
+	decoder := json.NewDecoder(bufio.NewReader(conn))
+	encoder := json.NewEncoder(conn)
+	for {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+		var request controlRequest
+		if err := decoder.Decode(&request); err != nil {
+			return
+		}
+		var response controlResponse
+		result, err := server.execute(request.Command, request.Args)
+		response.Result = result
+		if err != nil {
+			response.Error = err.Error()
+		}
+		if err := encoder.Encode(&response); err != nil {
+			return
+		}
+	}
+}
+
+// Built in commands: status and stats, the rest is passed to the handler
+func (server *controlServer) execute(command string, args []string) (string, error) {
+	switch command {
+	case "status":
+		return message(MessageRunningSince, os.Getpid(), server.started.Format(time.RFC3339)), nil
+	case "stats":
+		var memory runtime.MemStats
+		runtime.ReadMemStats(&memory)
+		return "uptime: " + time.Since(server.started).Truncate(time.Second).String() +
+			", goroutines: " + strconv.Itoa(runtime.NumGoroutine()) +
+			", heap: " + strconv.FormatUint(memory.HeapAlloc, 10) + " bytes", nil
+	}
+	if server.handler == nil {
+		return "", ErrUnknownCommand
+	}
+	return server.handler.Control(command, args...)
+}
+
+// Control - send the command to the control channel of the running service
+// and return its result. The service must have been started with Control
+// enabled in its definition.
+func (properties *ServiceProperties) Control(command string, args ...string) (string, error) {
+	conn, err := net.DialTimeout("unix", ControlSocket(&properties.def), 5*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	if err := json.NewEncoder(conn).Encode(&controlRequest{command, args}); err != nil {
+		return "", err
+	}
+	var response controlResponse
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return "", err
+	}
+	if response.Error != "" {
+		return response.Result, errors.New(response.Error)
+	}
+	return response.Result, nil
+}
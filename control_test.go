@@ -0,0 +1,38 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestStartControlRunningInstance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	properties := &ServiceProperties{def: Definition{Name: "web", Control: true, RuntimeDir: dir}}
+
+	// a socket left by a crashed process is replaced
+	if err := ioutil.WriteFile(ControlSocket(&properties.def), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	running, err := properties.startControl(nil)
+	if err != nil {
+		t.Fatalf("startControl() over a stale socket error = %v", err)
+	}
+	defer running.Close()
+
+	// the socket of the running instance is kept
+	if _, err := properties.startControl(nil); err != ErrAlreadyRunning {
+		t.Fatalf("second startControl() error = %v, want ErrAlreadyRunning", err)
+	}
+	if result, err := properties.Control("status"); err != nil {
+		t.Errorf("Control(status) of the running instance = %q, %v", result, err)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ExitPanic - exit status of a service whose executable panicked
+// (EX_SOFTWARE of sysexits.h), the restart policy of the init system
+// may key off it, e.g. RestartForceExitStatus= of systemd
+const ExitPanic = 70
+
+// CrashReport - panic of the executable of a running service
+type CrashReport struct {
+	// Service - name of the service
+	Service string
+
+	// Value - value which was passed to panic
+	Value interface{}
+
+	// Stack - stack trace of the goroutine which panicked
+	Stack []byte
+
+	// Time of the panic
+	Time time.Time
+}
+
+// CrashReporter - receives the report of a panic before the process exits,
+// e.g. to send it to an error tracker
+type CrashReporter func(report *CrashReport)
+
+var crashes = struct {
+	sync.RWMutex
+	reporter CrashReporter
+}{}
+
+// SetCrashReporter - report the panics of the executables of all daemons,
+// nil (the default) only logs them by the logger of SetLogger
+func SetCrashReporter(reporter CrashReporter) {
+	crashes.Lock()
+	defer crashes.Unlock()
+	crashes.reporter = reporter
+}
+
+// PanicError - the executable panicked, Run returns it and the process
+// exits with ExitPanic once Run has cleaned up
+type PanicError struct {
+	Report *CrashReport
+}
+
+func (err *PanicError) Error() string {
+	return fmt.Sprintf("Service %s panicked: %v", err.Report.Service, err.Report.Value)
+}
+
+// crashGuard - recovers the panics of the executable of a running service
+type crashGuard struct {
+	service string
+	report  *CrashReport
+	// error of RunE, see ErrorRunner
+	failure error
+}
+
+// Call the function of the executable, a panic is recovered, logged with
+// its stack trace and passed to the crash reporter
+func (guard *crashGuard) call(f func()) (err error) {
+	defer func() {
+		value := recover()
+		if value == nil {
+			return
+		}
+		report := &CrashReport{
+			Service: guard.service,
+			Value:   value,
+			Stack:   debug.Stack(),
+			Time:    time.Now(),
+		}
+		if guard.report == nil {
+			guard.report = report
+		}
+		diagnostics.Printf("Service %s panicked: %v\n%s", report.Service, report.Value, report.Stack)
+		reportCrash(report)
+		err = &PanicError{Report: report}
+	}()
+	f()
+	return nil
+}
+
+// Call a function of the executable which returns an error,
+// a *PanicError if it panicked
+func (guard *crashGuard) callError(f func() error) error {
+	var err error
+	if panicErr := guard.call(func() { err = f() }); panicErr != nil {
+		return panicErr
+	}
+	return err
+}
+
+// Exit the process with ExitPanic if the executable panicked, with the
+// exit status of the error if RunE failed; Run defers it first, so it runs
+// after the other cleanup of Run
+func (guard *crashGuard) exit() {
+	if guard.report != nil {
+		os.Exit(ExitPanic)
+	}
+	if guard.failure != nil {
+		os.Exit(ExitCode(guard.failure))
+	}
+}
+
+// Pass the report to the crash reporter, a panic of the reporter itself
+// does not prevent the exit
+func reportCrash(report *CrashReport) {
+	crashes.RLock()
+	reporter := crashes.reporter
+	crashes.RUnlock()
+	if reporter == nil {
+		return
+	}
+	defer func() {
+		if value := recover(); value != nil {
+			diagnostics.Println("Crash reporter panicked:", value)
+		}
+	}()
+	reporter(report)
+}
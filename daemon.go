@@ -160,7 +160,8 @@ import "strings"
 // Daemon interface has a standard set of methods/commands
 type Daemon interface {
 
-	// Install the service into the system
+	// Install the service into the system, it is enabled at boot on every
+	// init system (see Enable); InstallOnly installs it disabled
 	Install(args ...string) (string, error)
 
 	// Remove the service and all corresponding files from the system
@@ -189,11 +190,38 @@ type Executable interface {
 	Run()
 }
 
+// Renderer interface is implemented by daemons which keep their configuration
+// in a service file (systemd unit, init script, property list), it allows to
+// preview the file before the service is installed
+type Renderer interface {
+	// ServicePath - path of the service file
+	ServicePath() string
+
+	// Render - content of the service file as Install would write it
+	Render(args ...string) (string, error)
+}
+
 // New - Create a new daemon
 //
 // name: name of the service
 //
 // description: any explanation, what is the service, its purpose
 func New(name, description string, dependencies ...string) (Daemon, error) {
-	return newDaemon(strings.Join(strings.Fields(name), "_"), description, dependencies)
+	return NewFromDefinition(&Definition{
+		Name:         name,
+		Description:  description,
+		Dependencies: dependencies,
+	})
+}
+
+// NewFromDefinition - Create a new daemon for the current host from the definition,
+// the definition is copied, so it may be reused by the caller
+func NewFromDefinition(def *Definition) (Daemon, error) {
+	normalized := *def
+	normalized.Name = strings.Join(strings.Fields(def.Name), "_")
+	if err := validateInput(hostKind(), &normalized); err != nil {
+		return nil, err
+	}
+	normalized.Description = NormalizeDescription(def.Description, normalized.Name)
+	return newDaemon(&normalized)
 }
@@ -0,0 +1,284 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//go:build linux || freebsd
+// +build linux freebsd
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/takama/daemon/autostart"
+)
+
+// autostartRecord - record (struct) of the helpers of the desktop sessions,
+// XDG autostart entries of the current user
+type autostartRecord struct {
+	ServiceProperties
+}
+
+// Entry - autostart entry which starts the service
+func (desktop *autostartRecord) Entry() *autostart.Entry {
+	return autostart.New(desktop.def.Name)
+}
+
+// ServicePath - path of the desktop file of the entry
+func (desktop *autostartRecord) ServicePath() string {
+	return desktop.Entry().Path()
+}
+
+// Is a service installed
+func (desktop *autostartRecord) isInstalled() bool {
+	return desktop.Entry().IsInstalled()
+}
+
+// IsEnabled - check the session starts the service at login
+func (desktop *autostartRecord) IsEnabled() (bool, error) {
+	if !desktop.isInstalled() {
+		return false, ErrNotInstalled
+	}
+	return desktop.Entry().IsEnabled()
+}
+
+// Enable - start the installed service at boot
+func (desktop *autostartRecord) Enable() error {
+	if ok, err := desktop.checkScopePrivileges(); !ok {
+		return err
+	}
+	if !desktop.isInstalled() {
+		return ErrNotInstalled
+	}
+	return desktop.Entry().Enable()
+}
+
+// Disable - keep the installed service from starting at boot
+func (desktop *autostartRecord) Disable() error {
+	if ok, err := desktop.checkScopePrivileges(); !ok {
+		return err
+	}
+	if !desktop.isInstalled() {
+		return ErrNotInstalled
+	}
+	return desktop.Entry().Disable()
+}
+
+// Pause - stop the process group of the running service by SIGSTOP
+func (desktop *autostartRecord) Pause() error {
+	text, err := checkPause(desktop.isInstalled(), desktop.checkRunning, true)
+	if err != nil {
+		return err
+	}
+	return signalService(text, pauseSignal(true))
+}
+
+// Resume - let the process group of the paused service continue
+func (desktop *autostartRecord) Resume() error {
+	text, err := checkPause(desktop.isInstalled(), desktop.checkRunning, false)
+	if err != nil {
+		return err
+	}
+	return signalService(text, pauseSignal(false))
+}
+
+// Check service is running
+func (desktop *autostartRecord) checkRunning() (string, bool) {
+	return desktop.livenessStatus(desktop.Entry().Status())
+}
+
+// Render - render the desktop file as Install would write it
+func (desktop *autostartRecord) Render(args ...string) (string, error) {
+	return renderInstalled(KindAutostart, desktop.definition(args))
+}
+
+// GetTemplate - the template of the desktop file
+func (desktop *autostartRecord) GetTemplate() string {
+	return desktop.template(KindAutostart)
+}
+
+// SetTemplate - replace the template of the desktop file
+func (desktop *autostartRecord) SetTemplate(text string) error {
+	return desktop.setTemplate(text)
+}
+
+// Install the service
+func (desktop *autostartRecord) Install(args ...string) (string, error) {
+	installAction := message(MessageInstall, desktop.def.Description)
+	desktop.changed = false
+	desktop.resetNotices()
+
+	if desktop.isInstalled() {
+		return desktop.failed(installAction), ErrAlreadyInstalled
+	}
+
+	desktop.progress(PhaseRendering)
+	content, err := desktop.Render(args...)
+	if err != nil {
+		return desktop.failed(installAction), err
+	}
+
+	desktop.progress(PhaseWriting)
+	if err := os.MkdirAll(autostart.Dir(), 0755); err != nil {
+		return desktop.failed(installAction), err
+	}
+
+	if err := ioutil.WriteFile(desktop.ServicePath(), []byte(content), 0644); err != nil {
+		return desktop.failed(installAction), err
+	}
+
+	if err := desktop.applyManifest(KindAutostart); err != nil {
+		return desktop.failed(installAction), err
+	}
+
+	desktop.installNotices()
+	desktop.changed = true
+	return desktop.succeeded(installAction), nil
+}
+
+// Remove the service
+func (desktop *autostartRecord) Remove() (string, error) {
+	removeAction := message(MessageRemove, desktop.def.Description)
+	desktop.changed = false
+
+	if !desktop.isInstalled() {
+		return desktop.failed(removeAction), ErrNotInstalled
+	}
+
+	if err := os.Remove(desktop.ServicePath()); err != nil {
+		return desktop.failed(removeAction), err
+	}
+
+	desktop.changed = true
+	return desktop.succeeded(removeAction), nil
+}
+
+// Start the service, like the session does at login
+func (desktop *autostartRecord) Start() (string, error) {
+	startAction := message(MessageStart, desktop.def.Description)
+	desktop.changed = false
+
+	if offline() {
+		return desktop.failed(startAction), ErrOfflineImage
+	}
+
+	if !desktop.isInstalled() {
+		return desktop.failed(startAction), ErrNotInstalled
+	}
+
+	if _, ok := desktop.checkRunning(); ok {
+		return desktop.failed(startAction), ErrAlreadyRunning
+	}
+
+	if err := desktop.preflight(); err != nil {
+		return desktop.failed(startAction), err
+	}
+
+	if err := desktop.applyManifest(KindAutostart); err != nil {
+		return desktop.failed(startAction), err
+	}
+
+	desktop.progress(PhaseStarting)
+	if err := desktop.Entry().Start(); err != nil {
+		return desktop.failed(startAction), err
+	}
+
+	desktop.changed = true
+	return desktop.succeeded(startAction), nil
+}
+
+// Stop the service
+func (desktop *autostartRecord) Stop() (string, error) {
+	stopAction := message(MessageStop, desktop.def.Description)
+	desktop.changed = false
+
+	if offline() {
+		return desktop.failed(stopAction), ErrOfflineImage
+	}
+
+	if !desktop.isInstalled() {
+		return desktop.failed(stopAction), ErrNotInstalled
+	}
+
+	state, ok := desktop.checkRunning()
+	if !ok {
+		return desktop.failed(stopAction), ErrAlreadyStopped
+	}
+	resumePaused(state)
+
+	if err := desktop.Entry().Stop(); err != nil {
+		return desktop.failed(stopAction), err
+	}
+
+	desktop.changed = true
+	return desktop.succeeded(stopAction), nil
+}
+
+// Status - Get service status
+func (desktop *autostartRecord) Status() (string, error) {
+
+	if offline() {
+		return message(MessageStatusUndefined), ErrOfflineImage
+	}
+
+	if !desktop.isInstalled() {
+		return message(MessageStatusUndefined), ErrNotInstalled
+	}
+
+	statusAction, _ := desktop.checkRunning()
+
+	return statusAction, nil
+}
+
+// Run - Run service, its PID is recorded, so Status and Stop find the
+// process which the session started
+func (desktop *autostartRecord) Run(e Executable) (string, error) {
+	runAction := message(MessageRun, desktop.def.Description)
+	guard := &crashGuard{service: desktop.def.Name}
+	defer guard.exit()
+
+	lock, err := desktop.lockInstance()
+	if err != nil {
+		return desktop.failed(runAction), err
+	}
+	if lock != nil {
+		defer lock.Close()
+	}
+
+	entry := desktop.Entry()
+	if err := entry.WritePID(os.Getpid()); err != nil {
+		return desktop.failed(runAction), err
+	}
+	defer entry.RemovePID()
+
+	control, err := desktop.startControl(e)
+	if err != nil {
+		return desktop.failed(runAction), err
+	}
+	defer control.Close()
+	awaitPaths(desktop.def.Watch)
+	liveness := desktop.startLiveness(e)
+	defer liveness.Close()
+	sleep := desktop.watchSleep(e)
+	defer sleep.Close()
+	registration, err := desktop.register()
+	if err != nil {
+		return desktop.failed(runAction), err
+	}
+	defer registration.Close()
+	config := desktop.watchConfig(e)
+	limit := desktop.limitRuntime(e)
+	runErr := guard.run(e)
+	limitErr := limit.Close()
+	if err := config.Close(); err != nil {
+		return desktop.failed(runAction), err
+	}
+	if runErr != nil {
+		return desktop.failed(runAction), runErr
+	}
+	if limitErr != nil {
+		return desktop.failed(runAction), limitErr
+	}
+	return message(MessageCompleted, runAction), nil
+}
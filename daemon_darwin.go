@@ -6,179 +6,416 @@
 package daemon
 
 import (
+	"io"
+	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
-	"text/template"
+	"strconv"
+
+	"github.com/takama/daemon/launchd"
 )
 
 // darwinRecord - standard record (struct) for darwin version of daemon package
 type darwinRecord struct {
-	name         string
-	description  string
-	dependencies []string
+	ServiceProperties
 }
 
-func newDaemon(name, description string, dependencies []string) (Daemon, error) {
+func newDaemon(def *Definition) (Daemon, error) {
+
+	return &darwinRecord{newProperties(def)}, nil
+}
 
-	return &darwinRecord{name, description, dependencies}, nil
+// Job - launchd job which controls the service
+func (darwin *darwinRecord) Job() *launchd.Job {
+	job := launchd.New(darwin.def.Name)
+	switch {
+	case userScope(&darwin.def):
+		job.Agent, job.User, job.Domain = true, true, userDomain()
+	case darwin.def.PerUser:
+		job.Agent, job.Domain = true, guiDomain()
+	}
+	return job
+}
+
+// Domain of the session of the user who is logged in at the console,
+// empty if nobody is logged in
+func guiDomain() string {
+	info, err := os.Stat("/dev/console")
+	if err != nil {
+		return ""
+	}
+	if uid, _, ok := fileOwner(info); ok && uid > 0 {
+		return "gui/" + strconv.Itoa(uid)
+	}
+	return ""
 }
 
-// Standard service path for system daemons
-func (darwin *darwinRecord) servicePath() string {
-	return "/Library/LaunchDaemons/" + darwin.name + ".plist"
+// ServicePath - standard service path for system daemons
+func (darwin *darwinRecord) ServicePath() string {
+	return darwin.Job().Path()
 }
 
 // Is a service installed
 func (darwin *darwinRecord) isInstalled() bool {
+	return darwin.Job().IsInstalled()
+}
+
+// IsEnabled - check the service is started at boot
+func (darwin *darwinRecord) IsEnabled() (bool, error) {
+	if !darwin.isInstalled() {
+		return false, ErrNotInstalled
+	}
+	return darwin.Job().IsEnabled()
+}
 
-	if _, err := os.Stat(darwin.servicePath()); err == nil {
-		return true
+// Property - raw value of the named property of the job (launchctl print)
+func (darwin *darwinRecord) Property(name string) (string, error) {
+	values, err := darwin.Properties()
+	if err != nil {
+		return "", err
 	}
+	return propertyValue(values, name)
+}
+
+// Properties - the raw properties of the job (launchctl print)
+func (darwin *darwinRecord) Properties() (map[string]string, error) {
+	if !darwin.isInstalled() {
+		return nil, ErrNotInstalled
+	}
+	return darwin.Job().Print()
+}
 
-	return false
+// Kind of the init system of the host
+func hostKind() Kind {
+	return KindLaunchd
+}
+
+// Inspect the service file of the named service
+func inspect(name string) (*Definition, error) {
+	return inspectFile(hostKind(), name)
 }
 
 // Get executable path
 func execPath() (string, error) {
-	return filepath.Abs(os.Args[0])
+	name, err := processName()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(name)
+}
+
+// Enable - start the installed service at boot
+func (darwin *darwinRecord) Enable() error {
+	if ok, err := darwin.checkScopePrivileges(); !ok {
+		return err
+	}
+	if !darwin.isInstalled() {
+		return ErrNotInstalled
+	}
+	return darwin.Job().Enable()
+}
+
+// Disable - keep the installed service from starting at boot
+func (darwin *darwinRecord) Disable() error {
+	if ok, err := darwin.checkScopePrivileges(); !ok {
+		return err
+	}
+	if !darwin.isInstalled() {
+		return ErrNotInstalled
+	}
+	return darwin.Job().Disable()
+}
+
+// Pause - stop the running job by SIGSTOP
+func (darwin *darwinRecord) Pause() error {
+	if ok, err := darwin.checkScopePrivileges(); !ok {
+		return err
+	}
+	if _, err := checkPause(darwin.isInstalled(), darwin.checkRunning, true); err != nil {
+		return err
+	}
+	return darwin.Job().Kill(pauseSignal(true))
+}
+
+// Resume - let the paused job continue
+func (darwin *darwinRecord) Resume() error {
+	if ok, err := darwin.checkScopePrivileges(); !ok {
+		return err
+	}
+	if _, err := checkPause(darwin.isInstalled(), darwin.checkRunning, false); err != nil {
+		return err
+	}
+	return darwin.Job().Kill(pauseSignal(false))
 }
 
 // Check service is running
 func (darwin *darwinRecord) checkRunning() (string, bool) {
-	output, err := exec.Command("launchctl", "list", darwin.name).Output()
-	if err == nil {
-		if matched, err := regexp.MatchString(darwin.name, string(output)); err == nil && matched {
-			reg := regexp.MustCompile("PID\" = ([0-9]+);")
-			data := reg.FindStringSubmatch(string(output))
-			if len(data) > 1 {
-				return "Service (pid  " + data[1] + ") is running...", true
-			}
-			return "Service is running...", true
+	state := darwin.Job().State()
+	if state.Running && state.Failed() {
+		// the failed job is still loaded, so it is stopped by Stop
+		return ServiceStatus{State: StatusFailed}.String(), true
+	}
+	return darwin.livenessStatus(state.Running, state.PID)
+}
+
+// Statuses of the named services queried at once
+func (darwin *darwinRecord) queryStatuses(names []string) (map[string]string, error) {
+	states, err := launchd.States(names...)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[string]string, len(states))
+	for name, state := range states {
+		if state.Running && state.Failed() {
+			statuses[name] = ServiceStatus{State: StatusFailed}.String()
+			continue
 		}
+		statuses[name], _ = runningStatus(state.Running, state.PID)
 	}
+	return statuses, nil
+}
+
+// Render - render the service file content as Install would write it
+func (darwin *darwinRecord) Render(args ...string) (string, error) {
+	return renderInstalled(KindLaunchd, darwin.definition(args))
+}
+
+// GetTemplate - the template of the service file
+func (darwin *darwinRecord) GetTemplate() string {
+	return darwin.template(KindLaunchd)
+}
+
+// SetTemplate - replace the template of the service file
+func (darwin *darwinRecord) SetTemplate(text string) error {
+	return darwin.setTemplate(text)
+}
 
-	return "Service is stopped", false
+// ExportBundle - write the install bundle of the service to w
+func (darwin *darwinRecord) ExportBundle(w io.Writer, args ...string) error {
+	return ExportBundle(w, KindLaunchd, darwin.definition(args))
+}
+
+// Logs - the last lines of the log files of the service
+func (darwin *darwinRecord) Logs(lines int) (string, error) {
+	return readLogs(KindLaunchd, &darwin.def, lines)
+}
+
+// Diagnose - analysis of the last failure of the service by its state,
+// its logs, its executable and its ports
+func (darwin *darwinRecord) Diagnose() (*Diagnosis, error) {
+	state, running := darwin.checkRunning()
+	return darwin.diagnose(state, running, darwin.recentLogs(KindLaunchd)), nil
+}
+
+// Verify - check the files and directories of the service
+func (darwin *darwinRecord) Verify() error {
+	return Verify(KindLaunchd, &darwin.def)
 }
 
 // Install the service
 func (darwin *darwinRecord) Install(args ...string) (string, error) {
-	installAction := "Install " + darwin.description + ":"
+	installAction := message(MessageInstall, darwin.def.Description)
+	darwin.changed = false
+	darwin.resetNotices()
 
-	if ok, err := checkPrivileges(); !ok {
-		return installAction + failed, err
+	if ok, err := darwin.checkScopePrivileges(); !ok {
+		return darwin.failed(installAction), err
 	}
 
-	srvPath := darwin.servicePath()
+	srvPath := darwin.ServicePath()
 
 	if darwin.isInstalled() {
-		return installAction + failed, ErrAlreadyInstalled
+		return darwin.failed(installAction), ErrAlreadyInstalled
+	}
+
+	if err := darwin.checkConflicts(KindLaunchd); err != nil {
+		return darwin.failed(installAction), err
+	}
+
+	darwin.progress(PhaseRendering)
+	content, err := darwin.Render(args...)
+	if err != nil {
+		return darwin.failed(installAction), err
 	}
 
+	if err := darwin.installBinary(); err != nil {
+		return darwin.failed(installAction), err
+	}
+
+	darwin.progress(PhaseWriting)
+	if err := os.MkdirAll(filepath.Dir(srvPath), defaultDirMode); err != nil {
+		return darwin.failed(installAction), err
+	}
 	file, err := os.Create(srvPath)
 	if err != nil {
-		return installAction + failed, err
+		return darwin.failed(installAction), err
 	}
 	defer file.Close()
 
-	execPatch, err := executablePath(darwin.name)
-	if err != nil {
-		return installAction + failed, err
+	if _, err := file.WriteString(content); err != nil {
+		return darwin.failed(installAction), err
 	}
 
-	templ, err := template.New("propertyList").Parse(propertyList)
-	if err != nil {
-		return installAction + failed, err
+	if err := darwin.ensureAccount(); err != nil {
+		return darwin.failed(installAction), err
+	}
+
+	if err := darwin.applyManifest(KindLaunchd); err != nil {
+		return darwin.failed(installAction), err
+	}
+
+	if _, err := deployConfigFiles(KindLaunchd, &darwin.def); err != nil {
+		return darwin.failed(installAction), err
+	}
+
+	// the rotation rules of newsyslog belong to the system
+	if !userScope(&darwin.def) {
+		rotation, err := renderNewsyslog(&darwin.def)
+		if err != nil {
+			return darwin.failed(installAction), err
+		}
+		if err := ioutil.WriteFile(darwin.Job().NewsyslogPath(), []byte(rotation), 0644); err != nil {
+			return darwin.failed(installAction), err
+		}
 	}
 
-	if err := templ.Execute(
-		file,
-		&struct {
-			Name, Path string
-			Args       []string
-		}{darwin.name, execPatch, args},
-	); err != nil {
-		return installAction + failed, err
+	// a disabled override outlives the job, it is dropped like the
+	// other init systems enable the installed service
+	if enabled, err := darwin.Job().IsEnabled(); err == nil && !enabled {
+		if err := darwin.Job().Enable(); err != nil {
+			return darwin.failed(installAction), err
+		}
 	}
 
-	return installAction + success, nil
+	darwin.installNotices()
+	darwin.changed = true
+	return darwin.succeeded(installAction), nil
 }
 
 // Remove the service
 func (darwin *darwinRecord) Remove() (string, error) {
-	removeAction := "Removing " + darwin.description + ":"
+	removeAction := message(MessageRemove, darwin.def.Description)
+	darwin.changed = false
 
-	if ok, err := checkPrivileges(); !ok {
-		return removeAction + failed, err
+	if ok, err := darwin.checkScopePrivileges(); !ok {
+		return darwin.failed(removeAction), err
 	}
 
 	if !darwin.isInstalled() {
-		return removeAction + failed, ErrNotInstalled
+		return darwin.failed(removeAction), ErrNotInstalled
+	}
+
+	if err := os.Remove(darwin.ServicePath()); err != nil {
+		return darwin.failed(removeAction), err
+	}
+
+	if err := darwin.removeBinary(); err != nil {
+		return darwin.failed(removeAction), err
+	}
+
+	if err := os.Remove(darwin.Job().NewsyslogPath()); err != nil && !os.IsNotExist(err) {
+		return darwin.failed(removeAction), err
+	}
+
+	darwin.changed = true
+	return darwin.succeeded(removeAction), nil
+}
+
+// Purge - remove the service, its directories and its created account
+func (darwin *darwinRecord) Purge() (string, error) {
+	purgeAction := message(MessagePurge, darwin.def.Description)
+	darwin.changed = false
+
+	if _, err := darwin.Remove(); err != nil && err != ErrNotInstalled {
+		return darwin.failed(purgeAction), err
 	}
 
-	if err := os.Remove(darwin.servicePath()); err != nil {
-		return removeAction + failed, err
+	if err := darwin.purge(KindLaunchd); err != nil {
+		return darwin.failed(purgeAction), err
 	}
 
-	return removeAction + success, nil
+	darwin.changed = true
+	return darwin.succeeded(purgeAction), nil
 }
 
 // Start the service
 func (darwin *darwinRecord) Start() (string, error) {
-	startAction := "Starting " + darwin.description + ":"
+	startAction := message(MessageStart, darwin.def.Description)
+	darwin.changed = false
 
-	if ok, err := checkPrivileges(); !ok {
-		return startAction + failed, err
+	if ok, err := darwin.checkScopePrivileges(); !ok {
+		return darwin.failed(startAction), err
 	}
 
 	if !darwin.isInstalled() {
-		return startAction + failed, ErrNotInstalled
+		return darwin.failed(startAction), ErrNotInstalled
+	}
+
+	// launchd does not load a disabled job, it is not reported as started
+	if enabled, err := darwin.IsEnabled(); err == nil && !enabled {
+		return darwin.failed(startAction), ErrDisabled
+	}
+
+	// a failed job is still loaded, it is loaded again to run it
+	if state := darwin.Job().State(); state.Running && state.Failed() {
+		if err := darwin.Job().Unload(); err != nil {
+			return darwin.failed(startAction), err
+		}
+	} else if _, ok := darwin.checkRunning(); ok {
+		return darwin.failed(startAction), ErrAlreadyRunning
+	}
+
+	if err := darwin.preflight(); err != nil {
+		return darwin.failed(startAction), err
 	}
 
-	if _, ok := darwin.checkRunning(); ok {
-		return startAction + failed, ErrAlreadyRunning
+	if err := darwin.applyManifest(KindLaunchd); err != nil {
+		return darwin.failed(startAction), err
 	}
 
-	if err := exec.Command("launchctl", "load", darwin.servicePath()).Run(); err != nil {
-		return startAction + failed, err
+	darwin.progress(PhaseStarting)
+	if err := darwin.Job().Load(); err != nil {
+		return darwin.failed(startAction), err
 	}
 
-	return startAction + success, nil
+	darwin.changed = true
+	return darwin.succeeded(startAction), nil
 }
 
 // Stop the service
 func (darwin *darwinRecord) Stop() (string, error) {
-	stopAction := "Stopping " + darwin.description + ":"
+	stopAction := message(MessageStop, darwin.def.Description)
+	darwin.changed = false
 
-	if ok, err := checkPrivileges(); !ok {
-		return stopAction + failed, err
+	if ok, err := darwin.checkScopePrivileges(); !ok {
+		return darwin.failed(stopAction), err
 	}
 
 	if !darwin.isInstalled() {
-		return stopAction + failed, ErrNotInstalled
+		return darwin.failed(stopAction), ErrNotInstalled
 	}
 
 	if _, ok := darwin.checkRunning(); !ok {
-		return stopAction + failed, ErrAlreadyStopped
+		return darwin.failed(stopAction), ErrAlreadyStopped
 	}
 
-	if err := exec.Command("launchctl", "unload", darwin.servicePath()).Run(); err != nil {
-		return stopAction + failed, err
+	if err := darwin.Job().Unload(); err != nil {
+		return darwin.failed(stopAction), err
 	}
 
-	return stopAction + success, nil
+	darwin.changed = true
+	return darwin.succeeded(stopAction), nil
 }
 
 // Status - Get service status
 func (darwin *darwinRecord) Status() (string, error) {
 
-	if ok, err := checkPrivileges(); !ok {
+	if ok, err := darwin.checkScopePrivileges(); !ok {
 		return "", err
 	}
 
 	if !darwin.isInstalled() {
-		return "Status could not defined", ErrNotInstalled
+		return message(MessageStatusUndefined), ErrNotInstalled
 	}
 
 	statusAction, _ := darwin.checkRunning()
@@ -188,33 +425,46 @@ func (darwin *darwinRecord) Status() (string, error) {
 
 // Run - Run service
 func (darwin *darwinRecord) Run(e Executable) (string, error) {
-	runAction := "Running " + darwin.description + ":"
-	e.Run()
-	return runAction + " completed.", nil
-}
-
-var propertyList = `<?xml version="1.0" encoding="UTF-8"?>
-<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
-<plist version="1.0">
-<dict>
-	<key>KeepAlive</key>
-	<true/>
-	<key>Label</key>
-	<string>{{.Name}}</string>
-	<key>ProgramArguments</key>
-	<array>
-	    <string>{{.Path}}</string>
-		{{range .Args}}<string>{{.}}</string>
-		{{end}}
-	</array>
-	<key>RunAtLoad</key>
-	<true/>
-    <key>WorkingDirectory</key>
-    <string>/usr/local/var</string>
-    <key>StandardErrorPath</key>
-    <string>/usr/local/var/log/{{.Name}}.err</string>
-    <key>StandardOutPath</key>
-    <string>/usr/local/var/log/{{.Name}}.log</string>
-</dict>
-</plist>
-`
+	runAction := message(MessageRun, darwin.def.Description)
+	guard := &crashGuard{service: darwin.def.Name}
+	defer guard.exit()
+
+	lock, err := darwin.lockInstance()
+	if err != nil {
+		return darwin.failed(runAction), err
+	}
+	if lock != nil {
+		defer lock.Close()
+	}
+	backoff := darwin.awaitBackoff(KindLaunchd)
+
+	control, err := darwin.startControl(e)
+	if err != nil {
+		return darwin.failed(runAction), err
+	}
+	defer control.Close()
+	liveness := darwin.startLiveness(e)
+	defer liveness.Close()
+	sleep := darwin.watchSleep(e)
+	defer sleep.Close()
+	registration, err := darwin.register()
+	if err != nil {
+		return darwin.failed(runAction), err
+	}
+	defer registration.Close()
+	config := darwin.watchConfig(e)
+	limit := darwin.limitRuntime(e)
+	runErr := guard.run(e)
+	backoff.Close(runErr)
+	limitErr := limit.Close()
+	if err := config.Close(); err != nil {
+		return darwin.failed(runAction), err
+	}
+	if runErr != nil {
+		return darwin.failed(runAction), runErr
+	}
+	if limitErr != nil {
+		return darwin.failed(runAction), limitErr
+	}
+	return message(MessageCompleted, runAction), nil
+}
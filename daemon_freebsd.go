@@ -1,77 +1,64 @@
 package daemon
 
 import (
-	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
-	"strings"
-	"text/template"
+
+	"github.com/takama/daemon/rcd"
 )
 
 // systemVRecord - standard record (struct) for linux systemV version of daemon package
 type bsdRecord struct {
-	name         string
-	description  string
-	dependencies []string
+	ServiceProperties
+}
+
+// Script - rc.d script which controls the service
+func (bsd *bsdRecord) Script() *rcd.Script {
+	return rcd.New(resolveAlias(KindRCD, bsd.def.Name))
 }
 
-// Standard service path for systemV daemons
-func (bsd *bsdRecord) servicePath() string {
-	return "/usr/local/etc/rc.d/" + bsd.name
+// ServicePath - standard service path for systemV daemons
+func (bsd *bsdRecord) ServicePath() string {
+	return bsd.Script().Path()
 }
 
 // Is a service installed
 func (bsd *bsdRecord) isInstalled() bool {
+	return bsd.Script().IsInstalled()
+}
 
-	if _, err := os.Stat(bsd.servicePath()); err == nil {
-		return true
+// IsEnabled - check the service is started at boot
+func (bsd *bsdRecord) IsEnabled() (bool, error) {
+	if !bsd.isInstalled() {
+		return false, ErrNotInstalled
 	}
-
-	return false
+	return bsd.Script().IsEnabled()
 }
 
-// Is a service is enabled
-func (bsd *bsdRecord) isEnabled() (bool, error) {
-	rcConf, err := os.Open("/etc/rc.conf")
-	if err != nil {
-		fmt.Println("Error opening file:", err)
-		return false, err
-	}
-	defer rcConf.Close()
-	rcData, _ := ioutil.ReadAll(rcConf)
-	r, _ := regexp.Compile(`.*` + bsd.name + `_enable="YES".*`)
-	v := string(r.Find(rcData))
-	var chrFound, sharpFound bool
-	for _, c := range v {
-		if c == '#' && !chrFound {
-			sharpFound = true
-			break
-		} else if !sharpFound && c != ' ' {
-			chrFound = true
-			break
-		}
+// Get the daemon properly
+func newDaemon(def *Definition) (Daemon, error) {
+	if def.Scope == ScopeDesktop {
+		return &autostartRecord{newProperties(def)}, nil
 	}
-	return chrFound, nil
+	return &bsdRecord{newProperties(def)}, nil
 }
 
-func (bsd *bsdRecord) getCmd(cmd string) string {
-	if ok, err := bsd.isEnabled(); !ok || err != nil {
-		fmt.Println("Service is not enabled, using one" + cmd + " instead")
-		cmd = "one" + cmd
-	}
-	return cmd
+// Kind of the init system of the host
+func hostKind() Kind {
+	return KindRCD
 }
 
-// Get the daemon properly
-func newDaemon(name, description string, dependencies []string) (Daemon, error) {
-	return &bsdRecord{name, description, dependencies}, nil
+// Inspect the service file of the named service
+func inspect(name string) (*Definition, error) {
+	return inspectFile(hostKind(), name)
 }
 
 func execPath() (name string, err error) {
-	name = os.Args[0]
+	if name, err = processName(); err != nil {
+		return "", err
+	}
 	if name[0] == '.' {
 		name, err = filepath.Abs(name)
 		if err == nil {
@@ -83,132 +70,306 @@ func execPath() (name string, err error) {
 	return name, err
 }
 
+// Enable - start the installed service at boot
+func (bsd *bsdRecord) Enable() error {
+	if ok, err := checkPrivileges(); !ok {
+		return err
+	}
+	if !bsd.isInstalled() {
+		return ErrNotInstalled
+	}
+	if offline() {
+		return ErrOfflineImage
+	}
+	if err := bsd.Script().Enable(); err != nil {
+		return err
+	}
+	return installCronEntry(KindRCD, &bsd.def)
+}
+
+// Disable - keep the installed service from starting at boot
+func (bsd *bsdRecord) Disable() error {
+	if ok, err := checkPrivileges(); !ok {
+		return err
+	}
+	if !bsd.isInstalled() {
+		return ErrNotInstalled
+	}
+	if offline() {
+		return ErrOfflineImage
+	}
+	if err := bsd.Script().Disable(); err != nil {
+		return err
+	}
+	return removeCronEntry(&bsd.def)
+}
+
+// Pause - stop the process group of the running service by SIGSTOP
+func (bsd *bsdRecord) Pause() error {
+	if ok, err := checkPrivileges(); !ok {
+		return err
+	}
+	text, err := checkPause(bsd.isInstalled(), bsd.checkRunning, true)
+	if err != nil {
+		return err
+	}
+	return signalService(text, pauseSignal(true))
+}
+
+// Resume - let the process group of the paused service continue
+func (bsd *bsdRecord) Resume() error {
+	if ok, err := checkPrivileges(); !ok {
+		return err
+	}
+	text, err := checkPause(bsd.isInstalled(), bsd.checkRunning, false)
+	if err != nil {
+		return err
+	}
+	return signalService(text, pauseSignal(false))
+}
+
 // Check service is running
 func (bsd *bsdRecord) checkRunning() (string, bool) {
-	output, err := exec.Command("service", bsd.name, bsd.getCmd("status")).Output()
-	if err == nil {
-		if matched, err := regexp.MatchString(bsd.name, string(output)); err == nil && matched {
-			reg := regexp.MustCompile("pid  ([0-9]+)")
-			data := reg.FindStringSubmatch(string(output))
-			if len(data) > 1 {
-				return "Service (pid  " + data[1] + ") is running...", true
-			}
-			return "Service is running...", true
-		}
-	}
+	return bsd.livenessStatus(bsd.Script().Status())
+}
+
+// Render - render the service file content as Install would write it
+func (bsd *bsdRecord) Render(args ...string) (string, error) {
+	return renderInstalled(KindRCD, bsd.definition(args))
+}
+
+// GetTemplate - the template of the service file
+func (bsd *bsdRecord) GetTemplate() string {
+	return bsd.template(KindRCD)
+}
+
+// SetTemplate - replace the template of the service file
+func (bsd *bsdRecord) SetTemplate(text string) error {
+	return bsd.setTemplate(text)
+}
 
-	return "Service is stopped", false
+// ExportBundle - write the install bundle of the service to w
+func (bsd *bsdRecord) ExportBundle(w io.Writer, args ...string) error {
+	return ExportBundle(w, KindRCD, bsd.definition(args))
+}
+
+// Logs - the last lines of the log files of the service
+func (bsd *bsdRecord) Logs(lines int) (string, error) {
+	return readLogs(KindRCD, &bsd.def, lines)
+}
+
+// Diagnose - analysis of the last failure of the service by its state,
+// its logs, its executable and its ports
+func (bsd *bsdRecord) Diagnose() (*Diagnosis, error) {
+	state, running := bsd.checkRunning()
+	return bsd.diagnose(state, running, bsd.recentLogs(KindRCD)), nil
+}
+
+// Verify - check the files and directories of the service
+func (bsd *bsdRecord) Verify() error {
+	return Verify(KindRCD, &bsd.def)
 }
 
 // Install the service
 func (bsd *bsdRecord) Install(args ...string) (string, error) {
-	installAction := "Install " + bsd.description + ":"
+	installAction := message(MessageInstall, bsd.def.Description)
+	bsd.changed = false
+	bsd.resetNotices()
 
 	if ok, err := checkPrivileges(); !ok {
-		return installAction + failed, err
+		return bsd.failed(installAction), err
 	}
 
-	srvPath := bsd.servicePath()
+	srvPath := bsd.ServicePath()
 
 	if bsd.isInstalled() {
-		return installAction + failed, ErrAlreadyInstalled
+		return bsd.failed(installAction), ErrAlreadyInstalled
+	}
+
+	if err := bsd.checkConflicts(KindRCD); err != nil {
+		return bsd.failed(installAction), err
+	}
+
+	bsd.progress(PhaseRendering)
+	content, err := bsd.Render(args...)
+	if err != nil {
+		return bsd.failed(installAction), err
 	}
 
+	if err := bsd.installBinary(); err != nil {
+		return bsd.failed(installAction), err
+	}
+
+	bsd.progress(PhaseWriting)
 	file, err := os.Create(srvPath)
 	if err != nil {
-		return installAction + failed, err
+		return bsd.failed(installAction), err
 	}
 	defer file.Close()
 
-	execPatch, err := executablePath(bsd.name)
-	if err != nil {
-		return installAction + failed, err
+	if _, err := file.WriteString(content); err != nil {
+		return bsd.failed(installAction), err
 	}
 
-	templ, err := template.New("bsdConfig").Parse(bsdConfig)
-	if err != nil {
-		return installAction + failed, err
+	if err := bsd.ensureAccount(); err != nil {
+		return bsd.failed(installAction), err
 	}
 
-	if err := templ.Execute(
-		file,
-		&struct {
-			Name, Description, Path, Args string
-		}{bsd.name, bsd.description, execPatch, strings.Join(args, " ")},
-	); err != nil {
-		return installAction + failed, err
+	if err := installPrerequisites(&bsd.def); err != nil {
+		return bsd.failed(installAction), err
+	}
+
+	if err := bsd.applyManifest(KindRCD); err != nil {
+		return bsd.failed(installAction), err
+	}
+
+	if _, err := deployConfigFiles(KindRCD, &bsd.def); err != nil {
+		return bsd.failed(installAction), err
 	}
 
 	if err := os.Chmod(srvPath, 0755); err != nil {
-		return installAction + failed, err
+		return bsd.failed(installAction), err
 	}
 
-	return installAction + success, nil
+	if err := installAliases(KindRCD, &bsd.def); err != nil {
+		return bsd.failed(installAction), err
+	}
+
+	// rc.conf of an offline image is not changed
+	if !offline() {
+		if err := bsd.Script().Enable(); err != nil {
+			return bsd.failed(installAction), err
+		}
+	}
+
+	if err := installCronEntry(KindRCD, &bsd.def); err != nil {
+		return bsd.failed(installAction), err
+	}
+
+	bsd.installNotices()
+	bsd.changed = true
+	return bsd.succeeded(installAction), nil
 }
 
 // Remove the service
 func (bsd *bsdRecord) Remove() (string, error) {
-	removeAction := "Removing " + bsd.description + ":"
+	removeAction := message(MessageRemove, bsd.def.Description)
+	bsd.changed = false
 
 	if ok, err := checkPrivileges(); !ok {
-		return removeAction + failed, err
+		return bsd.failed(removeAction), err
 	}
 
 	if !bsd.isInstalled() {
-		return removeAction + failed, ErrNotInstalled
+		return bsd.failed(removeAction), ErrNotInstalled
+	}
+
+	if err := removeAliases(KindRCD, &bsd.def); err != nil {
+		return bsd.failed(removeAction), err
+	}
+
+	if err := removeCronEntry(&bsd.def); err != nil {
+		return bsd.failed(removeAction), err
+	}
+
+	if enabled, _ := bsd.Script().IsEnabled(); enabled && !offline() {
+		if err := bsd.Script().Disable(); err != nil {
+			return bsd.failed(removeAction), err
+		}
 	}
 
-	if err := os.Remove(bsd.servicePath()); err != nil {
-		return removeAction + failed, err
+	if err := os.Remove(bsd.ServicePath()); err != nil {
+		return bsd.failed(removeAction), err
 	}
 
-	return removeAction + success, nil
+	if err := bsd.removeBinary(); err != nil {
+		return bsd.failed(removeAction), err
+	}
+
+	if err := removePrerequisites(&bsd.def); err != nil {
+		return bsd.failed(removeAction), err
+	}
+
+	bsd.changed = true
+	return bsd.succeeded(removeAction), nil
+}
+
+// Purge - remove the service, its directories and its created account
+func (bsd *bsdRecord) Purge() (string, error) {
+	purgeAction := message(MessagePurge, bsd.def.Description)
+	bsd.changed = false
+
+	if _, err := bsd.Remove(); err != nil && err != ErrNotInstalled {
+		return bsd.failed(purgeAction), err
+	}
+
+	if err := bsd.purge(KindRCD); err != nil {
+		return bsd.failed(purgeAction), err
+	}
+
+	bsd.changed = true
+	return bsd.succeeded(purgeAction), nil
 }
 
 // Start the service
 func (bsd *bsdRecord) Start() (string, error) {
-	startAction := "Starting " + bsd.description + ":"
+	startAction := message(MessageStart, bsd.def.Description)
+	bsd.changed = false
 
 	if ok, err := checkPrivileges(); !ok {
-		return startAction + failed, err
+		return bsd.failed(startAction), err
 	}
 
 	if !bsd.isInstalled() {
-		return startAction + failed, ErrNotInstalled
+		return bsd.failed(startAction), ErrNotInstalled
 	}
 
 	if _, ok := bsd.checkRunning(); ok {
-		return startAction + failed, ErrAlreadyRunning
+		return bsd.failed(startAction), ErrAlreadyRunning
+	}
+
+	if err := bsd.preflight(); err != nil {
+		return bsd.failed(startAction), err
 	}
 
-	if err := exec.Command("service", bsd.name, bsd.getCmd("start")).Run(); err != nil {
-		return startAction + failed, err
+	if err := bsd.applyManifest(KindRCD); err != nil {
+		return bsd.failed(startAction), err
 	}
 
-	return startAction + success, nil
+	bsd.progress(PhaseStarting)
+	if err := bsd.Script().Start(); err != nil {
+		return bsd.failed(startAction), err
+	}
+
+	bsd.changed = true
+	return bsd.succeeded(startAction), nil
 }
 
 // Stop the service
 func (bsd *bsdRecord) Stop() (string, error) {
-	stopAction := "Stopping " + bsd.description + ":"
+	stopAction := message(MessageStop, bsd.def.Description)
+	bsd.changed = false
 
 	if ok, err := checkPrivileges(); !ok {
-		return stopAction + failed, err
+		return bsd.failed(stopAction), err
 	}
 
 	if !bsd.isInstalled() {
-		return stopAction + failed, ErrNotInstalled
+		return bsd.failed(stopAction), ErrNotInstalled
 	}
 
-	if _, ok := bsd.checkRunning(); !ok {
-		return stopAction + failed, ErrAlreadyStopped
+	state, ok := bsd.checkRunning()
+	if !ok {
+		return bsd.failed(stopAction), ErrAlreadyStopped
 	}
+	resumePaused(state)
 
-	if err := exec.Command("service", bsd.name, bsd.getCmd("stop")).Run(); err != nil {
-		return stopAction + failed, err
+	if err := bsd.Script().Stop(); err != nil {
+		return bsd.failed(stopAction), err
 	}
 
-	return stopAction + success, nil
+	bsd.changed = true
+	return bsd.succeeded(stopAction), nil
 }
 
 // Status - Get service status
@@ -219,7 +380,7 @@ func (bsd *bsdRecord) Status() (string, error) {
 	}
 
 	if !bsd.isInstalled() {
-		return "Status could not defined", ErrNotInstalled
+		return message(MessageStatusUndefined), ErrNotInstalled
 	}
 
 	statusAction, _ := bsd.checkRunning()
@@ -229,31 +390,48 @@ func (bsd *bsdRecord) Status() (string, error) {
 
 // Run - Run service
 func (bsd *bsdRecord) Run(e Executable) (string, error) {
-	runAction := "Running " + bsd.description + ":"
-	e.Run()
-	return runAction + " completed.", nil
-}
-
-var bsdConfig = `#!/bin/sh
-#
-# PROVIDE: {{.Name}}
-# REQUIRE: networking syslog
-# KEYWORD:
+	runAction := message(MessageRun, bsd.def.Description)
+	guard := &crashGuard{service: bsd.def.Name}
+	defer guard.exit()
 
-# Add the following lines to /etc/rc.conf to enable the {{.Name}}:
-#
-# {{.Name}}_enable="YES"
-#
-
-
-. /etc/rc.subr
-
-name="{{.Name}}"
-rcvar="{{.Name}}_enable"
-command="{{.Path}}"
-pidfile="/var/run/$name.pid"
+	lock, err := bsd.lockInstance()
+	if err != nil {
+		return bsd.failed(runAction), err
+	}
+	if lock != nil {
+		defer lock.Close()
+	}
+	backoff := bsd.awaitBackoff(KindRCD)
 
-start_cmd="/usr/sbin/daemon -p $pidfile -f $command {{.Args}}"
-load_rc_config $name
-run_rc_command "$1"
-`
+	control, err := bsd.startControl(e)
+	if err != nil {
+		return bsd.failed(runAction), err
+	}
+	defer control.Close()
+	// no path activation by the init system
+	awaitPaths(bsd.def.Watch)
+	liveness := bsd.startLiveness(e)
+	defer liveness.Close()
+	sleep := bsd.watchSleep(e)
+	defer sleep.Close()
+	registration, err := bsd.register()
+	if err != nil {
+		return bsd.failed(runAction), err
+	}
+	defer registration.Close()
+	config := bsd.watchConfig(e)
+	limit := bsd.limitRuntime(e)
+	runErr := guard.run(e)
+	backoff.Close(runErr)
+	limitErr := limit.Close()
+	if err := config.Close(); err != nil {
+		return bsd.failed(runAction), err
+	}
+	if runErr != nil {
+		return bsd.failed(runAction), runErr
+	}
+	if limitErr != nil {
+		return bsd.failed(runAction), limitErr
+	}
+	return message(MessageCompleted, runAction), nil
+}
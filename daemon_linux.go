@@ -7,18 +7,78 @@ package daemon
 
 import (
 	"os"
+
+	"github.com/takama/daemon/systemd"
 )
 
 // Get the daemon properly
-func newDaemon(name, description string, dependencies []string) (Daemon, error) {
+func newDaemon(def *Definition) (Daemon, error) {
+	if def.Scope == ScopeDesktop {
+		return &autostartRecord{newProperties(def)}, nil
+	}
+	switch hostKind() {
+	case KindSystemD:
+		return &systemDRecord{newProperties(def)}, nil
+	case KindUpstart:
+		return &upstartRecord{newProperties(def)}, nil
+	}
+	return &systemVRecord{newProperties(def)}, nil
+}
+
+// Detect the init system of the host
+func detectKind() Kind {
 	// newer subsystem must be checked first
 	if _, err := os.Stat("/run/systemd/system"); err == nil {
-		return &systemDRecord{name, description, dependencies}, nil
+		return KindSystemD
+	}
+	// image builds and chroots without a running manager ask for systemd
+	// by $SYSTEMD_OFFLINE or systemd.Offline
+	if systemd.OfflineRequested() && systemdInstalled("") {
+		return KindSystemD
+	}
+	// tests and image builds control the manager of another instance
+	if systemd.Remote() {
+		return KindSystemD
 	}
 	if _, err := os.Stat("/sbin/initctl"); err == nil {
-		return &upstartRecord{name, description, dependencies}, nil
+		return KindUpstart
+	}
+	return KindSystemV
+}
+
+// Kind of the init system of the host, or of the offline image
+func hostKind() Kind {
+	if offline() {
+		return detectImageKind()
 	}
-	return &systemVRecord{name, description, dependencies}, nil
+	return cachedKind(detectKind)
+}
+
+// Detect the init system of the offline image by its files,
+// it is not running in the image
+func detectImageKind() Kind {
+	if systemdInstalled(PathPrefix()) {
+		return KindSystemD
+	}
+	if _, err := os.Stat(rooted("/sbin/initctl")); err == nil {
+		return KindUpstart
+	}
+	return KindSystemV
+}
+
+// Check the systemd binary exists under the root directory
+func systemdInstalled(root string) bool {
+	for _, path := range []string{"/lib/systemd/systemd", "/usr/lib/systemd/systemd"} {
+		if _, err := os.Stat(root + path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Inspect the service file of the named service
+func inspect(name string) (*Definition, error) {
+	return inspectFile(hostKind(), name)
 }
 
 // Get executable path
@@ -5,186 +5,624 @@
 package daemon
 
 import (
+	"io"
 	"os"
-	"os/exec"
-	"regexp"
-	"strings"
-	"text/template"
+	"path/filepath"
+
+	"github.com/takama/daemon/systemd"
 )
 
+// ErrInitUnavailable appears if the systemd manager could not carry out an
+// operation: no manager runs, it is not reachable over D-Bus, or the system
+// is degraded; systemd.UnavailableError tells the reason
+var ErrInitUnavailable = systemd.ErrInitUnavailable
+
 // systemDRecord - standard record (struct) for linux systemD version of daemon package
 type systemDRecord struct {
-	name         string
-	description  string
-	dependencies []string
+	ServiceProperties
+}
+
+// Unit - systemd unit which controls the service
+func (linux *systemDRecord) Unit() *systemd.Unit {
+	unit := systemd.New(linux.def.Name)
+	unit.Root = PathPrefix()
+	unit.Template = linux.def.PerUser
+	unit.User = userScope(&linux.def)
+	if !unit.Template && !unit.User {
+		unit.Name = resolveAlias(KindSystemD, linux.def.Name)
+	}
+	return unit
+}
+
+// Reload the manager of the unit, the one of the user for the user scope
+func (linux *systemDRecord) reloadUnits() error {
+	if userScope(&linux.def) {
+		return systemd.UserDaemonReload()
+	}
+	return reloadManager(KindSystemD)
+}
+
+// Check the process may start, stop or query the service: the privileges
+// of its scope, or the authorization by polkit (SetEscalation)
+func (linux *systemDRecord) checkControlPrivileges() (bool, error) {
+	if escalated() && !userScope(&linux.def) {
+		return true, nil
+	}
+	return linux.checkScopePrivileges()
+}
+
+// Start the unit, the instances of a per-user service are started for
+// the users which are logged in, the others start theirs at login
+func (linux *systemDRecord) startUnit() error {
+	unit := linux.Unit()
+	if !unit.Template {
+		return unit.Start()
+	}
+	for _, uid := range sessionUsers() {
+		if err := unit.Instance(uid).Start(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// Standard service path for systemD daemons
-func (linux *systemDRecord) servicePath() string {
-	return "/etc/systemd/system/" + linux.name + ".service"
+// Stop the unit or all instances of a per-user service
+func (linux *systemDRecord) stopUnit() error {
+	unit := linux.Unit()
+	if !unit.Template {
+		return unit.Stop()
+	}
+	instances, err := unit.Instances()
+	if err != nil {
+		return err
+	}
+	for _, instance := range instances {
+		if err := unit.Instance(instance).Stop(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Running instances of the per-user service, RollingRestart restarts
+// them one by one
+func (linux *systemDRecord) rollingInstances() ([]rollingUnit, error) {
+	if ok, err := linux.checkControlPrivileges(); !ok {
+		return nil, err
+	}
+	unit := linux.Unit()
+	instances, err := unit.Instances()
+	if err != nil {
+		return nil, err
+	}
+	var units []rollingUnit
+	for _, name := range instances {
+		instance := unit.Instance(name)
+		units = append(units, rollingUnit{
+			name:        instance.Name,
+			description: linux.def.Description,
+			restart: func() error {
+				if err := allowRestart(instance.Name); err != nil {
+					return err
+				}
+				return instance.Restart()
+			},
+			status: func() (ServiceStatus, error) { return unitStatus(instance.State()), nil },
+		})
+	}
+	return units, nil
+}
+
+// ResetFailed - clear the failed state and the restart counter of the unit,
+// of all instances of a per-user service
+func (linux *systemDRecord) ResetFailed() error {
+	if ok, err := linux.checkControlPrivileges(); !ok {
+		return err
+	}
+	if offline() {
+		return ErrOfflineImage
+	}
+	unit := linux.Unit()
+	if !linux.isInstalled() && !unit.IsLoaded() {
+		return ErrNotInstalled
+	}
+	if unit.Template {
+		return unit.ResetFailed()
+	}
+	return resetUnit(unit)
+}
+
+// Reset the unit if it has failed, systemctl refuses units which are not loaded
+func resetUnit(unit *systemd.Unit) error {
+	if unit.DetailedState().ActiveState != "failed" {
+		return nil
+	}
+	return unit.ResetFailed()
+}
+
+// Stop the unit whose file was deleted while it was loaded and clear its
+// failed state, so the manager does not keep it
+func (linux *systemDRecord) clearOrphan() error {
+	unit := linux.Unit()
+	if _, ok := linux.checkRunning(); ok {
+		if err := unit.Stop(); err != nil {
+			return err
+		}
+	}
+	return resetUnit(unit)
+}
+
+// ServicePath - standard service path for systemD daemons
+func (linux *systemDRecord) ServicePath() string {
+	return linux.Unit().Path()
 }
 
 // Is a service installed
 func (linux *systemDRecord) isInstalled() bool {
+	return linux.Unit().IsInstalled()
+}
 
-	if _, err := os.Stat(linux.servicePath()); err == nil {
-		return true
+// IsEnabled - check the service is started at boot
+func (linux *systemDRecord) IsEnabled() (bool, error) {
+	if !linux.isInstalled() {
+		return false, ErrNotInstalled
 	}
+	return linux.Unit().IsEnabled()
+}
 
-	return false
+// Property - raw value of the named property of the unit (systemctl show)
+func (linux *systemDRecord) Property(name string) (string, error) {
+	if !linux.isInstalled() {
+		return "", ErrNotInstalled
+	}
+	values, err := linux.Unit().Show(name)
+	if err != nil {
+		return "", err
+	}
+	return propertyValue(values, name)
+}
+
+// Properties - the raw properties of the unit (systemctl show)
+func (linux *systemDRecord) Properties() (map[string]string, error) {
+	if !linux.isInstalled() {
+		return nil, ErrNotInstalled
+	}
+	return linux.Unit().Show()
+}
+
+// Enable - start the installed service at boot
+func (linux *systemDRecord) Enable() error {
+	if ok, err := linux.checkScopePrivileges(); !ok {
+		return err
+	}
+	if !linux.isInstalled() {
+		return ErrNotInstalled
+	}
+	return linux.Unit().Enable()
+}
+
+// Disable - keep the installed service from starting at boot
+func (linux *systemDRecord) Disable() error {
+	if ok, err := linux.checkScopePrivileges(); !ok {
+		return err
+	}
+	if !linux.isInstalled() {
+		return ErrNotInstalled
+	}
+	return linux.Unit().Disable()
+}
+
+// Pause - stop all processes of the running service by SIGSTOP
+func (linux *systemDRecord) Pause() error {
+	if ok, err := linux.checkControlPrivileges(); !ok {
+		return err
+	}
+	if _, err := checkPause(linux.isInstalled(), linux.checkRunning, true); err != nil {
+		return err
+	}
+	return linux.Unit().Kill(pauseSignal(true))
+}
+
+// Resume - let the processes of the paused service continue
+func (linux *systemDRecord) Resume() error {
+	if ok, err := linux.checkControlPrivileges(); !ok {
+		return err
+	}
+	if _, err := checkPause(linux.isInstalled(), linux.checkRunning, false); err != nil {
+		return err
+	}
+	return linux.Unit().Kill(pauseSignal(false))
 }
 
 // Check service is running
 func (linux *systemDRecord) checkRunning() (string, bool) {
-	output, err := exec.Command("systemctl", "status", linux.name+".service").Output()
-	if err == nil {
-		if matched, err := regexp.MatchString("Active: active", string(output)); err == nil && matched {
-			reg := regexp.MustCompile("Main PID: ([0-9]+)")
-			data := reg.FindStringSubmatch(string(output))
-			if len(data) > 1 {
-				return "Service (pid  " + data[1] + ") is running...", true
-			}
-			return "Service is running...", true
+	if unit := linux.Unit(); unit.Template {
+		instances, _ := unit.Instances()
+		return runningStatus(len(instances) > 0, "")
+	}
+	return unitStatus(linux.Unit().State()).result()
+}
+
+// Status of a unit by its active state, the transitional and the failed
+// states of systemd are reported as such
+func unitStatus(state systemd.State) ServiceStatus {
+	switch state.ActiveState {
+	case "reloading":
+		return statusOf(true, StatusReloading, state.PID)
+	case "activating":
+		// the unit waits for its automatic restart after a failure
+		if !state.Running {
+			return ServiceStatus{State: StatusFailed}
 		}
+		return statusOf(true, StatusStarting, state.PID)
+	case "deactivating":
+		return statusOf(true, StatusStopping, state.PID)
+	case "failed":
+		return ServiceStatus{State: StatusFailed}
 	}
+	return statusOf(state.Running, StatusRunning, state.PID)
+}
+
+// Statuses of the named services queried at once
+func (linux *systemDRecord) queryStatuses(names []string) (map[string]string, error) {
+	states, err := systemd.States(names...)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[string]string, len(states))
+	for name, state := range states {
+		statuses[name], _ = unitStatus(state).result()
+	}
+	return statuses, nil
+}
+
+// Render - render the service file content as Install would write it
+func (linux *systemDRecord) Render(args ...string) (string, error) {
+	return renderInstalled(KindSystemD, linux.definition(args))
+}
+
+// GetTemplate - the template of the service file
+func (linux *systemDRecord) GetTemplate() string {
+	return linux.template(KindSystemD)
+}
+
+// SetTemplate - replace the template of the service file
+func (linux *systemDRecord) SetTemplate(text string) error {
+	return linux.setTemplate(text)
+}
+
+// ExportBundle - write the install bundle of the service to w
+func (linux *systemDRecord) ExportBundle(w io.Writer, args ...string) error {
+	return ExportBundle(w, KindSystemD, linux.definition(args))
+}
+
+// Logs - the last lines of the logs of the service, they are read from the journal
+// unless the service writes its output to files
+func (linux *systemDRecord) Logs(lines int) (string, error) {
+	if linux.def.Logging == LogFile {
+		return readLogs(KindSystemD, &linux.def, lines)
+	}
+	return linux.Unit().Journal(lines)
+}
 
-	return "Service is stopped", false
+// Diagnose - analysis of the last failure of the service by its state,
+// its journal, its executable and its ports
+func (linux *systemDRecord) Diagnose() (*Diagnosis, error) {
+	return linux.diagnoseUnit(linux.Unit())
+}
+
+// Verify - check the files and directories of the service
+func (linux *systemDRecord) Verify() error {
+	return Verify(KindSystemD, &linux.def)
 }
 
 // Install the service
 func (linux *systemDRecord) Install(args ...string) (string, error) {
-	installAction := "Install " + linux.description + ":"
+	installAction := message(MessageInstall, linux.def.Description)
+	linux.changed = false
+	linux.resetNotices()
 
-	if ok, err := checkPrivileges(); !ok {
-		return installAction + failed, err
+	if ok, err := linux.checkScopePrivileges(); !ok {
+		return linux.failed(installAction), err
 	}
 
-	srvPath := linux.servicePath()
+	srvPath := linux.ServicePath()
 
 	if linux.isInstalled() {
-		return installAction + failed, ErrAlreadyInstalled
+		return linux.failed(installAction), ErrAlreadyInstalled
+	}
+
+	if err := linux.checkConflicts(KindSystemD); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	linux.progress(PhaseRendering)
+	content, err := linux.Render(args...)
+	if err != nil {
+		return linux.failed(installAction), err
+	}
+
+	if err := linux.installBinary(); err != nil {
+		return linux.failed(installAction), err
 	}
 
+	linux.progress(PhaseWriting)
+	if err := os.MkdirAll(filepath.Dir(srvPath), defaultDirMode); err != nil {
+		return linux.failed(installAction), err
+	}
 	file, err := os.Create(srvPath)
 	if err != nil {
-		return installAction + failed, err
+		return linux.failed(installAction), err
 	}
 	defer file.Close()
 
-	execPatch, err := executablePath(linux.name)
-	if err != nil {
-		return installAction + failed, err
+	if _, err := file.WriteString(content); err != nil {
+		return linux.failed(installAction), err
 	}
 
-	templ, err := template.New("systemDConfig").Parse(systemDConfig)
-	if err != nil {
-		return installAction + failed, err
+	if err := installFailureUnit(&linux.def); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	if err := linux.ensureAccount(); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	if err := installUdevRules(&linux.def); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	if err := installPrerequisites(&linux.def); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	if err := installTmpfiles(KindSystemD, &linux.def); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	if err := linux.applyManifest(KindSystemD); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	if _, err := deployConfigFiles(KindSystemD, &linux.def); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	linux.progress(PhaseReloading)
+	if err := linux.reloadUnits(); err != nil {
+		return linux.failed(installAction), err
 	}
 
-	if err := templ.Execute(
-		file,
-		&struct {
-			Name, Description, Dependencies, Path, Args string
-		}{
-			linux.name,
-			linux.description,
-			strings.Join(linux.dependencies, " "),
-			execPatch,
-			strings.Join(args, " "),
-		},
-	); err != nil {
-		return installAction + failed, err
+	// the companion units exist before the service is enabled, which
+	// enables them as well (Also=)
+	if err := installPathUnit(&linux.def); err != nil {
+		return linux.failed(installAction), err
 	}
 
-	if err := exec.Command("systemctl", "daemon-reload").Run(); err != nil {
-		return installAction + failed, err
+	if err := installActivationUnits(&linux.def); err != nil {
+		return linux.failed(installAction), err
 	}
 
-	if err := exec.Command("systemctl", "enable", linux.name+".service").Run(); err != nil {
-		return installAction + failed, err
+	linux.progress(PhaseEnabling)
+	enable := linux.Unit().Enable
+	if linux.def.EnableByPreset {
+		// the service is enabled when systemd applies the presets
+		enable = func() error { return installPreset(&linux.def) }
+	}
+	if err := enable(); err != nil {
+		return linux.failed(installAction), err
 	}
 
-	return installAction + success, nil
+	linux.installNotices()
+	linux.changed = true
+	return linux.succeeded(installAction), nil
+}
+
+// InstallPathUnit - install the service, if it is not installed yet, and
+// a path unit which starts it when one of the paths changes
+func (linux *systemDRecord) InstallPathUnit(watch ...PathSpec) (string, error) {
+	installAction := message(MessageInstallPathActivation, linux.def.Description)
+	linux.changed = false
+
+	if ok, err := linux.checkScopePrivileges(); !ok {
+		return linux.failed(installAction), err
+	}
+
+	linux.def.Watch = append(linux.def.Watch, watch...)
+	if !linux.isInstalled() {
+		return linux.Install()
+	}
+
+	if err := installPathUnit(&linux.def); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	linux.changed = true
+	return linux.succeeded(installAction), nil
 }
 
 // Remove the service
 func (linux *systemDRecord) Remove() (string, error) {
-	removeAction := "Removing " + linux.description + ":"
+	removeAction := message(MessageRemove, linux.def.Description)
+	linux.changed = false
 
-	if ok, err := checkPrivileges(); !ok {
-		return removeAction + failed, err
+	if ok, err := linux.checkScopePrivileges(); !ok {
+		return linux.failed(removeAction), err
 	}
 
 	if !linux.isInstalled() {
-		return removeAction + failed, ErrNotInstalled
+		if !linux.Unit().IsLoaded() {
+			return linux.failed(removeAction), ErrNotInstalled
+		}
+		// the unit file was deleted, the manager is made to forget the unit
+		if err := linux.clearOrphan(); err != nil {
+			return linux.failed(removeAction), err
+		}
+		if err := linux.reloadUnits(); err != nil {
+			return linux.failed(removeAction), err
+		}
+		linux.changed = true
+		return linux.succeeded(removeAction), nil
+	}
+
+	if err := removePathUnit(&linux.def); err != nil {
+		return linux.failed(removeAction), err
+	}
+
+	if err := removeActivationUnits(&linux.def); err != nil {
+		return linux.failed(removeAction), err
+	}
+
+	if err := linux.Unit().Disable(); err != nil {
+		return linux.failed(removeAction), err
 	}
 
-	if err := exec.Command("systemctl", "disable", linux.name+".service").Run(); err != nil {
-		return removeAction + failed, err
+	if err := os.Remove(linux.ServicePath()); err != nil {
+		return linux.failed(removeAction), err
 	}
 
-	if err := os.Remove(linux.servicePath()); err != nil {
-		return removeAction + failed, err
+	if err := linux.removeBinary(); err != nil {
+		return linux.failed(removeAction), err
 	}
 
-	return removeAction + success, nil
+	if err := removeUdevRules(&linux.def); err != nil {
+		return linux.failed(removeAction), err
+	}
+
+	if err := removePrerequisites(&linux.def); err != nil {
+		return linux.failed(removeAction), err
+	}
+
+	if err := removeTmpfiles(&linux.def); err != nil {
+		return linux.failed(removeAction), err
+	}
+
+	if err := removePreset(&linux.def); err != nil {
+		return linux.failed(removeAction), err
+	}
+
+	if err := removeFailureUnit(&linux.def); err != nil {
+		return linux.failed(removeAction), err
+	}
+
+	if err := linux.reloadUnits(); err != nil {
+		return linux.failed(removeAction), err
+	}
+
+	linux.changed = true
+	return linux.succeeded(removeAction), nil
+}
+
+// Purge - remove the service, its directories and its created account
+func (linux *systemDRecord) Purge() (string, error) {
+	purgeAction := message(MessagePurge, linux.def.Description)
+	linux.changed = false
+
+	if _, err := linux.Remove(); err != nil && err != ErrNotInstalled {
+		return linux.failed(purgeAction), err
+	}
+
+	if err := linux.purge(KindSystemD); err != nil {
+		return linux.failed(purgeAction), err
+	}
+
+	linux.changed = true
+	return linux.succeeded(purgeAction), nil
 }
 
 // Start the service
 func (linux *systemDRecord) Start() (string, error) {
-	startAction := "Starting " + linux.description + ":"
+	startAction := message(MessageStart, linux.def.Description)
+	linux.changed = false
+
+	if ok, err := linux.checkControlPrivileges(); !ok {
+		return linux.failed(startAction), err
+	}
 
-	if ok, err := checkPrivileges(); !ok {
-		return startAction + failed, err
+	if offline() {
+		return linux.failed(startAction), ErrOfflineImage
 	}
 
 	if !linux.isInstalled() {
-		return startAction + failed, ErrNotInstalled
+		return linux.failed(startAction), ErrNotInstalled
 	}
 
 	if _, ok := linux.checkRunning(); ok {
-		return startAction + failed, ErrAlreadyRunning
+		return linux.failed(startAction), ErrAlreadyRunning
+	}
+
+	if err := linux.preflight(); err != nil {
+		return linux.failed(startAction), err
 	}
 
-	if err := exec.Command("systemctl", "start", linux.name+".service").Run(); err != nil {
-		return startAction + failed, err
+	if !escalated() {
+		if err := linux.applyManifest(KindSystemD); err != nil {
+			return linux.failed(startAction), err
+		}
+	}
+
+	linux.progress(PhaseStarting)
+	if waitsReady(&linux.def) {
+		linux.progress(PhaseWaitingReady)
+	}
+	if err := linux.startUnit(); err != nil {
+		return linux.failed(startAction), err
 	}
 
-	return startAction + success, nil
+	linux.changed = true
+	return linux.succeeded(startAction), nil
 }
 
 // Stop the service
 func (linux *systemDRecord) Stop() (string, error) {
-	stopAction := "Stopping " + linux.description + ":"
+	stopAction := message(MessageStop, linux.def.Description)
+	linux.changed = false
+
+	if ok, err := linux.checkControlPrivileges(); !ok {
+		return linux.failed(stopAction), err
+	}
 
-	if ok, err := checkPrivileges(); !ok {
-		return stopAction + failed, err
+	if offline() {
+		return linux.failed(stopAction), ErrOfflineImage
 	}
 
 	if !linux.isInstalled() {
-		return stopAction + failed, ErrNotInstalled
+		if !linux.Unit().IsLoaded() {
+			return linux.failed(stopAction), ErrNotInstalled
+		}
+		// the unit file was deleted, the unit still runs or has failed
+		if err := linux.clearOrphan(); err != nil {
+			return linux.failed(stopAction), err
+		}
+		linux.changed = true
+		return linux.succeeded(stopAction), nil
 	}
 
 	if _, ok := linux.checkRunning(); !ok {
-		return stopAction + failed, ErrAlreadyStopped
+		return linux.failed(stopAction), ErrAlreadyStopped
 	}
 
-	if err := exec.Command("systemctl", "stop", linux.name+".service").Run(); err != nil {
-		return stopAction + failed, err
+	if err := linux.stopUnit(); err != nil {
+		return linux.failed(stopAction), err
 	}
 
-	return stopAction + success, nil
+	linux.changed = true
+	return linux.succeeded(stopAction), nil
 }
 
 // Status - Get service status
 func (linux *systemDRecord) Status() (string, error) {
 
-	if ok, err := checkPrivileges(); !ok {
+	if ok, err := linux.checkControlPrivileges(); !ok {
 		return "", err
 	}
 
+	if offline() {
+		return message(MessageStatusUndefined), ErrOfflineImage
+	}
+
 	if !linux.isInstalled() {
-		return "Status could not defined", ErrNotInstalled
+		return message(MessageStatusUndefined), ErrNotInstalled
 	}
 
 	statusAction, _ := linux.checkRunning()
@@ -192,24 +630,47 @@ func (linux *systemDRecord) Status() (string, error) {
 	return statusAction, nil
 }
 
-// Run - Run service
+// Run - Run service, the PID file which the unit declares is written
+// while the executable runs
 func (linux *systemDRecord) Run(e Executable) (string, error) {
-	runAction := "Running " + linux.description + ":"
-	e.Run()
-	return runAction + " completed.", nil
-}
-
-var systemDConfig = `[Unit]
-Description={{.Description}}
-Requires={{.Dependencies}}
-After={{.Dependencies}}
+	runAction := message(MessageRun, linux.def.Description)
+	guard := &crashGuard{service: linux.def.Name}
+	defer guard.exit()
 
-[Service]
-PIDFile=/var/run/{{.Name}}.pid
-ExecStartPre=/bin/rm -f /var/run/{{.Name}}.pid
-ExecStart={{.Path}} {{.Args}}
-Restart=on-failure
+	lock, err := linux.lockInstance()
+	if err != nil {
+		return linux.failed(runAction), err
+	}
+	if lock != nil {
+		defer lock.Close()
+	}
 
-[Install]
-WantedBy=multi-user.target
-`
+	control, err := linux.startControl(e)
+	if err != nil {
+		return linux.failed(runAction), err
+	}
+	defer control.Close()
+	// the executable of a forking service writes the PID file itself
+	if !linux.def.Forking && !userScope(&linux.def) {
+		pidFile := writePIDFile(linux.ServicePath())
+		defer pidFile.Close()
+	}
+	watchdog := linux.feedWatchdog(e)
+	defer watchdog.Close()
+	sleep := linux.watchSleep(e)
+	defer sleep.Close()
+	registration, err := linux.register()
+	if err != nil {
+		return linux.failed(runAction), err
+	}
+	defer registration.Close()
+	config := linux.watchConfig(e)
+	runErr := guard.run(e)
+	if err := config.Close(); err != nil {
+		return linux.failed(runAction), err
+	}
+	if runErr != nil {
+		return linux.failed(runAction), runErr
+	}
+	return message(MessageCompleted, runAction), nil
+}
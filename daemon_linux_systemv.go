@@ -5,183 +5,350 @@
 package daemon
 
 import (
+	"io"
 	"os"
-	"os/exec"
-	"regexp"
-	"strings"
-	"text/template"
+
+	"github.com/takama/daemon/sysv"
 )
 
 // systemVRecord - standard record (struct) for linux systemV version of daemon package
 type systemVRecord struct {
-	name         string
-	description  string
-	dependencies []string
+	ServiceProperties
+}
+
+// Script - init script which controls the service
+func (linux *systemVRecord) Script() *sysv.Script {
+	script := sysvScript(&linux.def)
+	script.Name = resolveAlias(KindSystemV, linux.def.Name)
+	script.Root = PathPrefix()
+	// the process of the pidfile is su for another user
+	if linux.def.User == "" {
+		script.Executable, _ = serviceExecutable(&linux.def)
+	}
+	return script
 }
 
-// Standard service path for systemV daemons
-func (linux *systemVRecord) servicePath() string {
-	return "/etc/init.d/" + linux.name
+// ServicePath - standard service path for systemV daemons
+func (linux *systemVRecord) ServicePath() string {
+	return linux.Script().Path()
 }
 
 // Is a service installed
 func (linux *systemVRecord) isInstalled() bool {
+	return linux.Script().IsInstalled()
+}
+
+// IsEnabled - check the service is started at boot
+func (linux *systemVRecord) IsEnabled() (bool, error) {
+	if !linux.isInstalled() {
+		return false, ErrNotInstalled
+	}
+	return linux.Script().IsEnabled()
+}
+
+// Enable - start the installed service at boot
+func (linux *systemVRecord) Enable() error {
+	if ok, err := checkPrivileges(); !ok {
+		return err
+	}
+	if !linux.isInstalled() {
+		return ErrNotInstalled
+	}
+	linux.resetWarnings()
+	linux.warn(linux.Script().Link()...)
+	return installCronEntry(KindSystemV, &linux.def)
+}
 
-	if _, err := os.Stat(linux.servicePath()); err == nil {
-		return true
+// Disable - keep the installed service from starting at boot
+func (linux *systemVRecord) Disable() error {
+	if ok, err := checkPrivileges(); !ok {
+		return err
 	}
+	if !linux.isInstalled() {
+		return ErrNotInstalled
+	}
+	linux.resetWarnings()
+	linux.warn(linux.Script().Unlink()...)
+	return removeCronEntry(&linux.def)
+}
 
-	return false
+// Pause - stop the process group of the running service by SIGSTOP
+func (linux *systemVRecord) Pause() error {
+	if ok, err := checkPrivileges(); !ok {
+		return err
+	}
+	text, err := checkPause(linux.isInstalled(), linux.checkRunning, true)
+	if err != nil {
+		return err
+	}
+	return signalService(text, pauseSignal(true))
+}
+
+// Resume - let the process group of the paused service continue
+func (linux *systemVRecord) Resume() error {
+	if ok, err := checkPrivileges(); !ok {
+		return err
+	}
+	text, err := checkPause(linux.isInstalled(), linux.checkRunning, false)
+	if err != nil {
+		return err
+	}
+	return signalService(text, pauseSignal(false))
 }
 
 // Check service is running
 func (linux *systemVRecord) checkRunning() (string, bool) {
-	output, err := exec.Command("service", linux.name, "status").Output()
-	if err == nil {
-		if matched, err := regexp.MatchString(linux.name, string(output)); err == nil && matched {
-			reg := regexp.MustCompile("pid  ([0-9]+)")
-			data := reg.FindStringSubmatch(string(output))
-			if len(data) > 1 {
-				return "Service (pid  " + data[1] + ") is running...", true
-			}
-			return "Service is running...", true
-		}
-	}
-
-	return "Service is stopped", false
+	return linux.livenessStatus(linux.Script().Status())
+}
+
+// Render - render the service file content as Install would write it
+func (linux *systemVRecord) Render(args ...string) (string, error) {
+	return renderInstalled(KindSystemV, linux.definition(args))
+}
+
+// GetTemplate - the template of the service file
+func (linux *systemVRecord) GetTemplate() string {
+	return linux.template(KindSystemV)
+}
+
+// SetTemplate - replace the template of the service file
+func (linux *systemVRecord) SetTemplate(text string) error {
+	return linux.setTemplate(text)
+}
+
+// ExportBundle - write the install bundle of the service to w
+func (linux *systemVRecord) ExportBundle(w io.Writer, args ...string) error {
+	return ExportBundle(w, KindSystemV, linux.definition(args))
+}
+
+// Logs - the last lines of the log files of the service
+func (linux *systemVRecord) Logs(lines int) (string, error) {
+	return readLogs(KindSystemV, &linux.def, lines)
+}
+
+// Diagnose - analysis of the last failure of the service by its state,
+// its logs, its executable and its ports
+func (linux *systemVRecord) Diagnose() (*Diagnosis, error) {
+	state, running := linux.checkRunning()
+	return linux.diagnose(state, running, linux.recentLogs(KindSystemV)), nil
+}
+
+// Verify - check the files and directories of the service
+func (linux *systemVRecord) Verify() error {
+	return Verify(KindSystemV, &linux.def)
 }
 
 // Install the service
 func (linux *systemVRecord) Install(args ...string) (string, error) {
-	installAction := "Install " + linux.description + ":"
+	installAction := message(MessageInstall, linux.def.Description)
+	linux.changed = false
+	linux.resetNotices()
+	linux.resetWarnings()
 
 	if ok, err := checkPrivileges(); !ok {
-		return installAction + failed, err
+		return linux.failed(installAction), err
 	}
 
-	srvPath := linux.servicePath()
+	srvPath := linux.ServicePath()
 
 	if linux.isInstalled() {
-		return installAction + failed, ErrAlreadyInstalled
+		return linux.failed(installAction), ErrAlreadyInstalled
 	}
 
+	if err := linux.checkConflicts(KindSystemV); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	linux.progress(PhaseRendering)
+	content, err := linux.Render(args...)
+	if err != nil {
+		return linux.failed(installAction), err
+	}
+
+	if err := linux.installBinary(); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	linux.progress(PhaseWriting)
 	file, err := os.Create(srvPath)
 	if err != nil {
-		return installAction + failed, err
+		return linux.failed(installAction), err
 	}
 	defer file.Close()
 
-	execPatch, err := executablePath(linux.name)
-	if err != nil {
-		return installAction + failed, err
+	if _, err := file.WriteString(content); err != nil {
+		return linux.failed(installAction), err
 	}
 
-	templ, err := template.New("systemVConfig").Parse(systemVConfig)
-	if err != nil {
-		return installAction + failed, err
+	if err := linux.ensureAccount(); err != nil {
+		return linux.failed(installAction), err
 	}
 
-	if err := templ.Execute(
-		file,
-		&struct {
-			Name, Description, Path, Args string
-		}{linux.name, linux.description, execPatch, strings.Join(args, " ")},
-	); err != nil {
-		return installAction + failed, err
+	if err := installUdevRules(&linux.def); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	if err := installPrerequisites(&linux.def); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	if err := linux.applyManifest(KindSystemV); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	if _, err := deployConfigFiles(KindSystemV, &linux.def); err != nil {
+		return linux.failed(installAction), err
 	}
 
 	if err := os.Chmod(srvPath, 0755); err != nil {
-		return installAction + failed, err
+		return linux.failed(installAction), err
 	}
 
-	for _, i := range [...]string{"2", "3", "4", "5"} {
-		if err := os.Symlink(srvPath, "/etc/rc"+i+".d/S87"+linux.name); err != nil {
-			continue
-		}
+	if err := installAliases(KindSystemV, &linux.def); err != nil {
+		return linux.failed(installAction), err
 	}
-	for _, i := range [...]string{"0", "1", "6"} {
-		if err := os.Symlink(srvPath, "/etc/rc"+i+".d/K17"+linux.name); err != nil {
-			continue
-		}
+
+	linux.progress(PhaseEnabling)
+	linux.warn(linux.Script().Link()...)
+
+	if err := installCronEntry(KindSystemV, &linux.def); err != nil {
+		return linux.failed(installAction), err
 	}
 
-	return installAction + success, nil
+	linux.installNotices()
+	linux.changed = true
+	return linux.succeeded(installAction), nil
 }
 
 // Remove the service
 func (linux *systemVRecord) Remove() (string, error) {
-	removeAction := "Removing " + linux.description + ":"
+	removeAction := message(MessageRemove, linux.def.Description)
+	linux.changed = false
+	linux.resetWarnings()
 
 	if ok, err := checkPrivileges(); !ok {
-		return removeAction + failed, err
+		return linux.failed(removeAction), err
 	}
 
 	if !linux.isInstalled() {
-		return removeAction + failed, ErrNotInstalled
+		return linux.failed(removeAction), ErrNotInstalled
+	}
+
+	if err := removeAliases(KindSystemV, &linux.def); err != nil {
+		return linux.failed(removeAction), err
+	}
+
+	if err := removeCronEntry(&linux.def); err != nil {
+		return linux.failed(removeAction), err
+	}
+
+	if err := os.Remove(linux.ServicePath()); err != nil {
+		return linux.failed(removeAction), err
 	}
 
-	if err := os.Remove(linux.servicePath()); err != nil {
-		return removeAction + failed, err
+	if err := linux.removeBinary(); err != nil {
+		return linux.failed(removeAction), err
 	}
 
-	for _, i := range [...]string{"2", "3", "4", "5"} {
-		if err := os.Remove("/etc/rc" + i + ".d/S87" + linux.name); err != nil {
-			continue
-		}
+	if err := removeUdevRules(&linux.def); err != nil {
+		return linux.failed(removeAction), err
 	}
-	for _, i := range [...]string{"0", "1", "6"} {
-		if err := os.Remove("/etc/rc" + i + ".d/K17" + linux.name); err != nil {
-			continue
-		}
+
+	if err := removePrerequisites(&linux.def); err != nil {
+		return linux.failed(removeAction), err
 	}
 
-	return removeAction + success, nil
+	linux.warn(linux.Script().Unlink()...)
+
+	linux.changed = true
+	return linux.succeeded(removeAction), nil
+}
+
+// Purge - remove the service, its directories and its created account
+func (linux *systemVRecord) Purge() (string, error) {
+	purgeAction := message(MessagePurge, linux.def.Description)
+	linux.changed = false
+
+	if _, err := linux.Remove(); err != nil && err != ErrNotInstalled {
+		return linux.failed(purgeAction), err
+	}
+
+	if err := linux.purge(KindSystemV); err != nil {
+		return linux.failed(purgeAction), err
+	}
+
+	linux.changed = true
+	return linux.succeeded(purgeAction), nil
 }
 
 // Start the service
 func (linux *systemVRecord) Start() (string, error) {
-	startAction := "Starting " + linux.description + ":"
+	startAction := message(MessageStart, linux.def.Description)
+	linux.changed = false
 
 	if ok, err := checkPrivileges(); !ok {
-		return startAction + failed, err
+		return linux.failed(startAction), err
+	}
+
+	if offline() {
+		return linux.failed(startAction), ErrOfflineImage
 	}
 
 	if !linux.isInstalled() {
-		return startAction + failed, ErrNotInstalled
+		return linux.failed(startAction), ErrNotInstalled
 	}
 
+	linux.Script().RemoveStalePIDFile()
 	if _, ok := linux.checkRunning(); ok {
-		return startAction + failed, ErrAlreadyRunning
+		return linux.failed(startAction), ErrAlreadyRunning
+	}
+
+	if err := linux.preflight(); err != nil {
+		return linux.failed(startAction), err
+	}
+
+	if err := linux.applyManifest(KindSystemV); err != nil {
+		return linux.failed(startAction), err
 	}
 
-	if err := exec.Command("service", linux.name, "start").Run(); err != nil {
-		return startAction + failed, err
+	linux.progress(PhaseStarting)
+	if err := linux.Script().Start(); err != nil {
+		return linux.failed(startAction), err
 	}
 
-	return startAction + success, nil
+	linux.changed = true
+	return linux.succeeded(startAction), nil
 }
 
 // Stop the service
 func (linux *systemVRecord) Stop() (string, error) {
-	stopAction := "Stopping " + linux.description + ":"
+	stopAction := message(MessageStop, linux.def.Description)
+	linux.changed = false
 
 	if ok, err := checkPrivileges(); !ok {
-		return stopAction + failed, err
+		return linux.failed(stopAction), err
+	}
+
+	if offline() {
+		return linux.failed(stopAction), ErrOfflineImage
 	}
 
 	if !linux.isInstalled() {
-		return stopAction + failed, ErrNotInstalled
+		return linux.failed(stopAction), ErrNotInstalled
 	}
 
-	if _, ok := linux.checkRunning(); !ok {
-		return stopAction + failed, ErrAlreadyStopped
+	state, ok := linux.checkRunning()
+	if !ok {
+		return linux.failed(stopAction), ErrAlreadyStopped
 	}
+	resumePaused(state)
 
-	if err := exec.Command("service", linux.name, "stop").Run(); err != nil {
-		return stopAction + failed, err
+	if err := linux.Script().Stop(); err != nil {
+		return linux.failed(stopAction), err
 	}
 
-	return stopAction + success, nil
+	linux.changed = true
+	return linux.succeeded(stopAction), nil
 }
 
 // Status - Get service status
@@ -191,10 +358,15 @@ func (linux *systemVRecord) Status() (string, error) {
 		return "", err
 	}
 
+	if offline() {
+		return message(MessageStatusUndefined), ErrOfflineImage
+	}
+
 	if !linux.isInstalled() {
-		return "Status could not defined", ErrNotInstalled
+		return message(MessageStatusUndefined), ErrNotInstalled
 	}
 
+	linux.Script().RemoveStalePIDFile()
 	statusAction, _ := linux.checkRunning()
 
 	return statusAction, nil
@@ -202,119 +374,46 @@ func (linux *systemVRecord) Status() (string, error) {
 
 // Run - Run service
 func (linux *systemVRecord) Run(e Executable) (string, error) {
-	runAction := "Running " + linux.description + ":"
-	e.Run()
-	return runAction + " completed.", nil
-}
-
-var systemVConfig = `#! /bin/sh
-#
-#       /etc/rc.d/init.d/{{.Name}}
-#
-#       Starts {{.Name}} as a daemon
-#
-# chkconfig: 2345 87 17
-# description: Starts and stops a single {{.Name}} instance on this system
-
-### BEGIN INIT INFO
-# Provides: {{.Name}} 
-# Required-Start: $network $named
-# Required-Stop: $network $named
-# Default-Start: 2 3 4 5
-# Default-Stop: 0 1 6
-# Short-Description: This service manages the {{.Description}}.
-# Description: {{.Description}}
-### END INIT INFO
-
-#
-# Source function library.
-#
-if [ -f /etc/rc.d/init.d/functions ]; then
-    . /etc/rc.d/init.d/functions
-fi
-
-exec="{{.Path}}"
-servname="{{.Description}}"
-
-proc="{{.Name}}"
-pidfile="/var/run/$proc.pid"
-lockfile="/var/lock/subsys/$proc"
-stdoutlog="/var/log/$proc.log"
-stderrlog="/var/log/$proc.err"
-
-[ -d $(dirname $lockfile) ] || mkdir -p $(dirname $lockfile)
-
-[ -e /etc/sysconfig/$proc ] && . /etc/sysconfig/$proc
-
-start() {
-    [ -x $exec ] || exit 5
-
-    if [ -f $pidfile ]; then
-        if ! [ -d "/proc/$(cat $pidfile)" ]; then
-            rm $pidfile
-            if [ -f $lockfile ]; then
-                rm $lockfile
-            fi
-        fi
-    fi
-
-    if ! [ -f $pidfile ]; then
-        printf "Starting $servname:\t"
-        echo "$(date)" >> $stdoutlog
-        $exec {{.Args}} >> $stdoutlog 2>> $stderrlog &
-        echo $! > $pidfile
-        touch $lockfile
-        success
-        echo
-    else
-        # failure
-        echo
-        printf "$pidfile still exists...\n"
-        exit 7
-    fi
-}
-
-stop() {
-    echo -n $"Stopping $servname: "
-    killproc -p $pidfile $proc
-    retval=$?
-    echo
-    [ $retval -eq 0 ] && rm -f $lockfile
-    return $retval
-}
-
-restart() {
-    stop
-    start
-}
+	runAction := message(MessageRun, linux.def.Description)
+	guard := &crashGuard{service: linux.def.Name}
+	defer guard.exit()
 
-rh_status() {
-    status -p $pidfile $proc
-}
+	lock, err := linux.lockInstance()
+	if err != nil {
+		return linux.failed(runAction), err
+	}
+	if lock != nil {
+		defer lock.Close()
+	}
 
-rh_status_q() {
-    rh_status >/dev/null 2>&1
+	control, err := linux.startControl(e)
+	if err != nil {
+		return linux.failed(runAction), err
+	}
+	defer control.Close()
+	// no path activation by the init system
+	awaitPaths(linux.def.Watch)
+	liveness := linux.startLiveness(e)
+	defer liveness.Close()
+	sleep := linux.watchSleep(e)
+	defer sleep.Close()
+	registration, err := linux.register()
+	if err != nil {
+		return linux.failed(runAction), err
+	}
+	defer registration.Close()
+	config := linux.watchConfig(e)
+	limit := linux.limitRuntime(e)
+	runErr := guard.run(e)
+	limitErr := limit.Close()
+	if err := config.Close(); err != nil {
+		return linux.failed(runAction), err
+	}
+	if runErr != nil {
+		return linux.failed(runAction), runErr
+	}
+	if limitErr != nil {
+		return linux.failed(runAction), limitErr
+	}
+	return message(MessageCompleted, runAction), nil
 }
-
-case "$1" in
-    start)
-        rh_status_q && exit 0
-        $1
-        ;;
-    stop)
-        rh_status_q || exit 0
-        $1
-        ;;
-    restart)
-        $1
-        ;;
-    status)
-        rh_status
-        ;;
-    *)
-        echo $"Usage: $0 {start|stop|status|restart}"
-        exit 2
-esac
-
-exit $?
-`
@@ -5,161 +5,349 @@
 package daemon
 
 import (
+	"io"
 	"os"
-	"os/exec"
-	"regexp"
-	"strings"
-	"text/template"
+
+	"github.com/takama/daemon/upstart"
 )
 
 // upstartRecord - standard record (struct) for linux upstart version of daemon package
 type upstartRecord struct {
-	name         string
-	description  string
-	dependencies []string
+	ServiceProperties
+}
+
+// Job - upstart job which controls the service
+func (linux *upstartRecord) Job() *upstart.Job {
+	job := upstart.New(linux.def.Name)
+	job.Root = PathPrefix()
+	return job
 }
 
-// Standard service path for systemV daemons
-func (linux *upstartRecord) servicePath() string {
-	return "/etc/init/" + linux.name + ".conf"
+// ServicePath - standard service path for systemV daemons
+func (linux *upstartRecord) ServicePath() string {
+	return linux.Job().Path()
 }
 
 // Is a service installed
 func (linux *upstartRecord) isInstalled() bool {
+	return linux.Job().IsInstalled()
+}
+
+// IsEnabled - check the service is started at boot
+func (linux *upstartRecord) IsEnabled() (bool, error) {
+	if !linux.isInstalled() {
+		return false, ErrNotInstalled
+	}
+	return linux.Job().IsEnabled()
+}
+
+// Enable - start the installed service at boot
+func (linux *upstartRecord) Enable() error {
+	if ok, err := checkPrivileges(); !ok {
+		return err
+	}
+	if !linux.isInstalled() {
+		return ErrNotInstalled
+	}
+	if err := linux.Job().Enable(); err != nil {
+		return err
+	}
+	return installCronEntry(KindUpstart, &linux.def)
+}
 
-	if _, err := os.Stat(linux.servicePath()); err == nil {
-		return true
+// Disable - keep the installed service from starting at boot
+func (linux *upstartRecord) Disable() error {
+	if ok, err := checkPrivileges(); !ok {
+		return err
+	}
+	if !linux.isInstalled() {
+		return ErrNotInstalled
 	}
+	if err := linux.Job().Disable(); err != nil {
+		return err
+	}
+	return removeCronEntry(&linux.def)
+}
 
-	return false
+// Pause - stop the process group of the running service by SIGSTOP
+func (linux *upstartRecord) Pause() error {
+	if ok, err := checkPrivileges(); !ok {
+		return err
+	}
+	text, err := checkPause(linux.isInstalled(), linux.checkRunning, true)
+	if err != nil {
+		return err
+	}
+	return signalService(text, pauseSignal(true))
+}
+
+// Resume - let the process group of the paused service continue
+func (linux *upstartRecord) Resume() error {
+	if ok, err := checkPrivileges(); !ok {
+		return err
+	}
+	text, err := checkPause(linux.isInstalled(), linux.checkRunning, false)
+	if err != nil {
+		return err
+	}
+	return signalService(text, pauseSignal(false))
 }
 
 // Check service is running
 func (linux *upstartRecord) checkRunning() (string, bool) {
-	output, err := exec.Command("status", linux.name).Output()
-	if err == nil {
-		if matched, err := regexp.MatchString(linux.name+" start/running", string(output)); err == nil && matched {
-			reg := regexp.MustCompile("process ([0-9]+)")
-			data := reg.FindStringSubmatch(string(output))
-			if len(data) > 1 {
-				return "Service (pid  " + data[1] + ") is running...", true
-			}
-			return "Service is running...", true
-		}
-	}
+	return linux.livenessStatus(linux.Job().Status())
+}
+
+// Render - render the service file content as Install would write it
+func (linux *upstartRecord) Render(args ...string) (string, error) {
+	return renderInstalled(KindUpstart, linux.definition(args))
+}
+
+// GetTemplate - the template of the service file
+func (linux *upstartRecord) GetTemplate() string {
+	return linux.template(KindUpstart)
+}
+
+// SetTemplate - replace the template of the service file
+func (linux *upstartRecord) SetTemplate(text string) error {
+	return linux.setTemplate(text)
+}
+
+// ExportBundle - write the install bundle of the service to w
+func (linux *upstartRecord) ExportBundle(w io.Writer, args ...string) error {
+	return ExportBundle(w, KindUpstart, linux.definition(args))
+}
+
+// Logs - the last lines of the log files of the service
+func (linux *upstartRecord) Logs(lines int) (string, error) {
+	return readLogs(KindUpstart, &linux.def, lines)
+}
 
-	return "Service is stopped", false
+// Diagnose - analysis of the last failure of the service by its state,
+// its logs, its executable and its ports
+func (linux *upstartRecord) Diagnose() (*Diagnosis, error) {
+	state, running := linux.checkRunning()
+	return linux.diagnose(state, running, linux.recentLogs(KindUpstart)), nil
+}
+
+// Verify - check the files and directories of the service
+func (linux *upstartRecord) Verify() error {
+	return Verify(KindUpstart, &linux.def)
 }
 
 // Install the service
 func (linux *upstartRecord) Install(args ...string) (string, error) {
-	installAction := "Install " + linux.description + ":"
+	installAction := message(MessageInstall, linux.def.Description)
+	linux.changed = false
+	linux.resetNotices()
 
 	if ok, err := checkPrivileges(); !ok {
-		return installAction + failed, err
+		return linux.failed(installAction), err
 	}
 
-	srvPath := linux.servicePath()
+	srvPath := linux.ServicePath()
 
 	if linux.isInstalled() {
-		return installAction + failed, ErrAlreadyInstalled
+		return linux.failed(installAction), ErrAlreadyInstalled
+	}
+
+	if err := linux.checkConflicts(KindUpstart); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	linux.progress(PhaseRendering)
+	content, err := linux.Render(args...)
+	if err != nil {
+		return linux.failed(installAction), err
 	}
 
+	if err := linux.installBinary(); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	linux.progress(PhaseWriting)
 	file, err := os.Create(srvPath)
 	if err != nil {
-		return installAction + failed, err
+		return linux.failed(installAction), err
 	}
 	defer file.Close()
 
-	execPatch, err := executablePath(linux.name)
-	if err != nil {
-		return installAction + failed, err
+	if _, err := file.WriteString(content); err != nil {
+		return linux.failed(installAction), err
 	}
 
-	templ, err := template.New("upstatConfig").Parse(upstatConfig)
-	if err != nil {
-		return installAction + failed, err
+	if err := linux.ensureAccount(); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	if err := installUdevRules(&linux.def); err != nil {
+		return linux.failed(installAction), err
 	}
 
-	if err := templ.Execute(
-		file,
-		&struct {
-			Name, Description, Path, Args string
-		}{linux.name, linux.description, execPatch, strings.Join(args, " ")},
-	); err != nil {
-		return installAction + failed, err
+	if err := installPrerequisites(&linux.def); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	if err := linux.applyManifest(KindUpstart); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	if _, err := deployConfigFiles(KindUpstart, &linux.def); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	linux.progress(PhaseReloading)
+	if err := reloadManager(KindUpstart); err != nil {
+		return linux.failed(installAction), err
 	}
 
 	if err := os.Chmod(srvPath, 0755); err != nil {
-		return installAction + failed, err
+		return linux.failed(installAction), err
+	}
+
+	// the "manual" stanza of an override file which was left behind
+	if err := linux.Job().Enable(); err != nil {
+		return linux.failed(installAction), err
+	}
+
+	if err := installCronEntry(KindUpstart, &linux.def); err != nil {
+		return linux.failed(installAction), err
 	}
 
-	return installAction + success, nil
+	linux.installNotices()
+	linux.changed = true
+	return linux.succeeded(installAction), nil
 }
 
 // Remove the service
 func (linux *upstartRecord) Remove() (string, error) {
-	removeAction := "Removing " + linux.description + ":"
+	removeAction := message(MessageRemove, linux.def.Description)
+	linux.changed = false
 
 	if ok, err := checkPrivileges(); !ok {
-		return removeAction + failed, err
+		return linux.failed(removeAction), err
 	}
 
 	if !linux.isInstalled() {
-		return removeAction + failed, ErrNotInstalled
+		return linux.failed(removeAction), ErrNotInstalled
+	}
+
+	if err := removeCronEntry(&linux.def); err != nil {
+		return linux.failed(removeAction), err
+	}
+
+	if err := os.Remove(linux.ServicePath()); err != nil {
+		return linux.failed(removeAction), err
+	}
+
+	if err := os.Remove(linux.Job().OverridePath()); err != nil && !os.IsNotExist(err) {
+		return linux.failed(removeAction), err
+	}
+
+	if err := linux.removeBinary(); err != nil {
+		return linux.failed(removeAction), err
+	}
+
+	if err := removeUdevRules(&linux.def); err != nil {
+		return linux.failed(removeAction), err
+	}
+
+	if err := removePrerequisites(&linux.def); err != nil {
+		return linux.failed(removeAction), err
+	}
+
+	if err := reloadManager(KindUpstart); err != nil {
+		return linux.failed(removeAction), err
+	}
+
+	linux.changed = true
+	return linux.succeeded(removeAction), nil
+}
+
+// Purge - remove the service, its directories and its created account
+func (linux *upstartRecord) Purge() (string, error) {
+	purgeAction := message(MessagePurge, linux.def.Description)
+	linux.changed = false
+
+	if _, err := linux.Remove(); err != nil && err != ErrNotInstalled {
+		return linux.failed(purgeAction), err
 	}
 
-	if err := os.Remove(linux.servicePath()); err != nil {
-		return removeAction + failed, err
+	if err := linux.purge(KindUpstart); err != nil {
+		return linux.failed(purgeAction), err
 	}
 
-	return removeAction + success, nil
+	linux.changed = true
+	return linux.succeeded(purgeAction), nil
 }
 
 // Start the service
 func (linux *upstartRecord) Start() (string, error) {
-	startAction := "Starting " + linux.description + ":"
+	startAction := message(MessageStart, linux.def.Description)
+	linux.changed = false
 
 	if ok, err := checkPrivileges(); !ok {
-		return startAction + failed, err
+		return linux.failed(startAction), err
+	}
+
+	if offline() {
+		return linux.failed(startAction), ErrOfflineImage
 	}
 
 	if !linux.isInstalled() {
-		return startAction + failed, ErrNotInstalled
+		return linux.failed(startAction), ErrNotInstalled
 	}
 
 	if _, ok := linux.checkRunning(); ok {
-		return startAction + failed, ErrAlreadyRunning
+		return linux.failed(startAction), ErrAlreadyRunning
+	}
+
+	if err := linux.preflight(); err != nil {
+		return linux.failed(startAction), err
+	}
+
+	if err := linux.applyManifest(KindUpstart); err != nil {
+		return linux.failed(startAction), err
 	}
 
-	if err := exec.Command("start", linux.name).Run(); err != nil {
-		return startAction + failed, err
+	linux.progress(PhaseStarting)
+	if err := linux.Job().Start(); err != nil {
+		return linux.failed(startAction), err
 	}
 
-	return startAction + success, nil
+	linux.changed = true
+	return linux.succeeded(startAction), nil
 }
 
 // Stop the service
 func (linux *upstartRecord) Stop() (string, error) {
-	stopAction := "Stopping " + linux.description + ":"
+	stopAction := message(MessageStop, linux.def.Description)
+	linux.changed = false
 
 	if ok, err := checkPrivileges(); !ok {
-		return stopAction + failed, err
+		return linux.failed(stopAction), err
+	}
+
+	if offline() {
+		return linux.failed(stopAction), ErrOfflineImage
 	}
 
 	if !linux.isInstalled() {
-		return stopAction + failed, ErrNotInstalled
+		return linux.failed(stopAction), ErrNotInstalled
 	}
 
-	if _, ok := linux.checkRunning(); !ok {
-		return stopAction + failed, ErrAlreadyStopped
+	state, ok := linux.checkRunning()
+	if !ok {
+		return linux.failed(stopAction), ErrAlreadyStopped
 	}
+	resumePaused(state)
 
-	if err := exec.Command("stop", linux.name).Run(); err != nil {
-		return stopAction + failed, err
+	if err := linux.Job().Stop(); err != nil {
+		return linux.failed(stopAction), err
 	}
 
-	return stopAction + success, nil
+	linux.changed = true
+	return linux.succeeded(stopAction), nil
 }
 
 // Status - Get service status
@@ -169,8 +357,12 @@ func (linux *upstartRecord) Status() (string, error) {
 		return "", err
 	}
 
+	if offline() {
+		return message(MessageStatusUndefined), ErrOfflineImage
+	}
+
 	if !linux.isInstalled() {
-		return "Status could not defined", ErrNotInstalled
+		return message(MessageStatusUndefined), ErrNotInstalled
 	}
 
 	statusAction, _ := linux.checkRunning()
@@ -180,21 +372,48 @@ func (linux *upstartRecord) Status() (string, error) {
 
 // Run - Run service
 func (linux *upstartRecord) Run(e Executable) (string, error) {
-	runAction := "Running " + linux.description + ":"
-	e.Run()
-	return runAction + " completed.", nil
-}
-
-var upstatConfig = `# {{.Name}} {{.Description}}
+	runAction := message(MessageRun, linux.def.Description)
+	guard := &crashGuard{service: linux.def.Name}
+	defer guard.exit()
 
-description     "{{.Description}}"
-author          "Pichu Chen <pichu@tih.tw>"
-
-start on runlevel [2345]
-stop on runlevel [016]
-
-respawn
-#kill timeout 5
+	lock, err := linux.lockInstance()
+	if err != nil {
+		return linux.failed(runAction), err
+	}
+	if lock != nil {
+		defer lock.Close()
+	}
+	backoff := linux.awaitBackoff(KindUpstart)
 
-exec {{.Path}} {{.Args}} >> /var/log/{{.Name}}.log 2>> /var/log/{{.Name}}.err
-`
+	control, err := linux.startControl(e)
+	if err != nil {
+		return linux.failed(runAction), err
+	}
+	defer control.Close()
+	// no path activation by the init system
+	awaitPaths(linux.def.Watch)
+	liveness := linux.startLiveness(e)
+	defer liveness.Close()
+	sleep := linux.watchSleep(e)
+	defer sleep.Close()
+	registration, err := linux.register()
+	if err != nil {
+		return linux.failed(runAction), err
+	}
+	defer registration.Close()
+	config := linux.watchConfig(e)
+	limit := linux.limitRuntime(e)
+	runErr := guard.run(e)
+	backoff.Close(runErr)
+	limitErr := limit.Close()
+	if err := config.Close(); err != nil {
+		return linux.failed(runAction), err
+	}
+	if runErr != nil {
+		return linux.failed(runAction), runErr
+	}
+	if limitErr != nil {
+		return linux.failed(runAction), limitErr
+	}
+	return message(MessageCompleted, runAction), nil
+}
@@ -22,114 +22,203 @@ import (
 
 // windowsRecord - standard record (struct) for windows version of daemon package
 type windowsRecord struct {
-	name         string
-	description  string
-	dependencies []string
+	ServiceProperties
 }
 
-func newDaemon(name, description string, dependencies []string) (Daemon, error) {
+func newDaemon(def *Definition) (Daemon, error) {
 
-	return &windowsRecord{name, description, dependencies}, nil
+	return &windowsRecord{newProperties(def)}, nil
 }
 
 // Install the service
 func (windows *windowsRecord) Install(args ...string) (string, error) {
-	installAction := "Install " + windows.description + ":"
+	installAction := message(MessageInstall, windows.def.Description)
+	windows.changed = false
+	windows.resetNotices()
 
-	execp, err := execPath()
+	if err := checkIsolation(KindWindows, &windows.def); err != nil {
+		return windows.failed(installAction), err
+	}
 
-	if err != nil {
-		return installAction + failed, err
+	if err := checkPerUser(KindWindows, &windows.def); err != nil {
+		return windows.failed(installAction), err
+	}
+
+	if err := checkSections(KindWindows, &windows.def); err != nil {
+		return windows.failed(installAction), err
+	}
+
+	if err := checkConditionCommands(KindWindows, &windows.def); err != nil {
+		return windows.failed(installAction), err
+	}
+
+	if err := checkPreStartCommands(KindWindows, &windows.def); err != nil {
+		return windows.failed(installAction), err
+	}
+
+	if err := checkStopCommands(KindWindows, &windows.def); err != nil {
+		return windows.failed(installAction), err
+	}
+
+	if err := checkRestartDelay(KindWindows, &windows.def); err != nil {
+		return windows.failed(installAction), err
+	}
+
+	if err := checkStandardInput(KindWindows, &windows.def); err != nil {
+		return windows.failed(installAction), err
+	}
+
+	if err := checkFirstBoot(KindWindows, &windows.def); err != nil {
+		return windows.failed(installAction), err
+	}
+
+	if err := checkRCOrdering(KindWindows, &windows.def); err != nil {
+		return windows.failed(installAction), err
+	}
+
+	if err := checkWatchdog(KindWindows, &windows.def); err != nil {
+		return windows.failed(installAction), err
+	}
+
+	execp := windows.def.Path
+	if windows.def.InstallPath != "" {
+		if err := windows.installBinary(); err != nil {
+			return windows.failed(installAction), err
+		}
+		execp = windows.def.InstallPath
+	}
+	if execp == "" {
+		var err error
+		if execp, err = execPath(); err != nil {
+			return windows.failed(installAction), err
+		}
+	}
+	if err := validatePath("path", execp); err != nil {
+		return windows.failed(installAction), err
 	}
 
 	m, err := mgr.Connect()
 	if err != nil {
-		return installAction + failed, err
+		return windows.failed(installAction), err
 	}
 	defer m.Disconnect()
 
-	s, err := m.OpenService(windows.name)
+	s, err := m.OpenService(windows.def.Name)
 	if err == nil {
 		s.Close()
-		return installAction + failed, err
+		return windows.failed(installAction), err
+	}
+
+	def, err := expandHostVariables(KindWindows, windows.definition(args))
+	if err != nil {
+		return windows.failed(installAction), err
 	}
 
-	s, err = m.CreateService(windows.name, execp, mgr.Config{
-		DisplayName:  windows.name,
-		Description:  windows.description,
+	windows.progress(PhaseWriting)
+	s, err = m.CreateService(windows.def.Name, execp, mgr.Config{
+		DisplayName:  windows.def.Name,
+		Description:  windows.def.Description,
 		StartType:    mgr.StartAutomatic,
-		Dependencies: windows.dependencies,
-	}, args...)
+		Dependencies: requiredUnits(KindWindows, &windows.def),
+	}, def.Args...)
 	if err != nil {
-		return installAction + failed, err
+		return windows.failed(installAction), err
 	}
 	defer s.Close()
 
-	return installAction + " completed.", nil
+	if err := setRecoveryActions(s, &windows.def); err != nil {
+		return windows.failed(installAction), err
+	}
+
+	if err := setServiceEnvironment(def); err != nil {
+		return windows.failed(installAction), err
+	}
+
+	if _, err := deployConfigFiles(KindWindows, &windows.def); err != nil {
+		return windows.failed(installAction), err
+	}
+
+	windows.installNotices()
+	windows.changed = true
+	return message(MessageCompleted, installAction), nil
 }
 
 // Remove the service
 func (windows *windowsRecord) Remove() (string, error) {
-	removeAction := "Removing " + windows.description + ":"
+	removeAction := message(MessageRemove, windows.def.Description)
+	windows.changed = false
 
 	m, err := mgr.Connect()
 	if err != nil {
-		return removeAction + failed, getWindowsError(err)
+		return windows.failed(removeAction), getWindowsError(err)
 	}
 	defer m.Disconnect()
-	s, err := m.OpenService(windows.name)
+	s, err := m.OpenService(windows.def.Name)
 	if err != nil {
-		return removeAction + failed, getWindowsError(err)
+		return windows.failed(removeAction), getWindowsError(err)
 	}
 	defer s.Close()
 	err = s.Delete()
 	if err != nil {
-		return removeAction + failed, getWindowsError(err)
+		return windows.failed(removeAction), getWindowsError(err)
+	}
+	if err := windows.removeBinary(); err != nil {
+		return windows.failed(removeAction), err
 	}
 
-	return removeAction + " completed.", nil
+	windows.changed = true
+	return message(MessageCompleted, removeAction), nil
 }
 
 // Start the service
 func (windows *windowsRecord) Start() (string, error) {
-	startAction := "Starting " + windows.description + ":"
+	startAction := message(MessageStart, windows.def.Description)
+	windows.changed = false
+
+	if err := windows.preflight(); err != nil {
+		return windows.failed(startAction), err
+	}
 
 	m, err := mgr.Connect()
 	if err != nil {
-		return startAction + failed, getWindowsError(err)
+		return windows.failed(startAction), getWindowsError(err)
 	}
 	defer m.Disconnect()
-	s, err := m.OpenService(windows.name)
+	s, err := m.OpenService(windows.def.Name)
 	if err != nil {
-		return startAction + failed, getWindowsError(err)
+		return windows.failed(startAction), getWindowsError(err)
 	}
 	defer s.Close()
+	windows.progress(PhaseStarting)
 	if err = s.Start(); err != nil {
-		return startAction + failed, getWindowsError(err)
+		return windows.failed(startAction), getWindowsError(err)
 	}
 
-	return startAction + " completed.", nil
+	windows.changed = true
+	return message(MessageCompleted, startAction), nil
 }
 
 // Stop the service
 func (windows *windowsRecord) Stop() (string, error) {
-	stopAction := "Stopping " + windows.description + ":"
+	stopAction := message(MessageStop, windows.def.Description)
+	windows.changed = false
 
 	m, err := mgr.Connect()
 	if err != nil {
-		return stopAction + failed, getWindowsError(err)
+		return windows.failed(stopAction), getWindowsError(err)
 	}
 	defer m.Disconnect()
-	s, err := m.OpenService(windows.name)
+	s, err := m.OpenService(windows.def.Name)
 	if err != nil {
-		return stopAction + failed, getWindowsError(err)
+		return windows.failed(stopAction), getWindowsError(err)
 	}
 	defer s.Close()
 	if err := stopAndWait(s); err != nil {
-		return stopAction + failed, getWindowsError(err)
+		return windows.failed(stopAction), getWindowsError(err)
 	}
 
-	return stopAction + " completed.", nil
+	windows.changed = true
+	return message(MessageCompleted, stopAction), nil
 }
 
 func stopAndWait(s *mgr.Service) error {
@@ -178,24 +267,183 @@ func getStopTimeout() time.Duration {
 	return time.Millisecond * time.Duration(v)
 }
 
+// Restart the failed service by the recovery actions of the service control
+// manager, after the restart delay of the definition which doubles for the
+// second and the third failure up to the maximum delay; the failures are
+// counted for a day
+func setRecoveryActions(s *mgr.Service, def *Definition) error {
+	if def.RestartDelay <= 0 {
+		return nil
+	}
+	var actions []mgr.RecoveryAction
+	for failures := 1; failures <= 3; failures++ {
+		actions = append(actions, mgr.RecoveryAction{Type: mgr.ServiceRestart, Delay: backoffDelay(def, failures)})
+	}
+	return s.SetRecoveryActions(actions, 24*60*60)
+}
+
+// The service control manager passes the multi-string value Environment
+// of the service key to the service process
+func setServiceEnvironment(def *Definition) error {
+	if len(def.Environment) == 0 {
+		return nil
+	}
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\`+def.Name, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+	return key.SetStringsValue("Environment", environmentList(def))
+}
+
 // Status - Get service status
 func (windows *windowsRecord) Status() (string, error) {
 	m, err := mgr.Connect()
 	if err != nil {
-		return "Getting status:" + failed, getWindowsError(err)
+		return windows.failed(message(MessageGettingStatus)), getWindowsError(err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(windows.def.Name)
+	if err != nil {
+		return windows.failed(message(MessageGettingStatus)), getWindowsError(err)
+	}
+	defer s.Close()
+	status, err := s.Query()
+	if err != nil {
+		return windows.failed(message(MessageGettingStatus)), getWindowsError(err)
+	}
+
+	return message(MessageStatus, getWindowsServiceStateFromUint32(status.State)), nil
+}
+
+// IsEnabled - check the service is started automatically at boot
+func (windows *windowsRecord) IsEnabled() (bool, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return false, getWindowsError(err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(windows.def.Name)
+	if err != nil {
+		return false, ErrNotInstalled
+	}
+	defer s.Close()
+	config, err := s.Config()
+	if err != nil {
+		return false, getWindowsError(err)
+	}
+	return config.StartType == mgr.StartAutomatic, nil
+}
+
+// Enable - start the service automatically at boot
+func (windows *windowsRecord) Enable() error {
+	return windows.setStartType(mgr.StartAutomatic)
+}
+
+// Disable - start the service by hand only
+func (windows *windowsRecord) Disable() error {
+	return windows.setStartType(mgr.StartManual)
+}
+
+// Pause - pause the running service by the service manager, the handler
+// of Run reports it as paused
+func (windows *windowsRecord) Pause() error {
+	return windows.control(svc.Pause, svc.Paused, ErrAlreadyPaused)
+}
+
+// Resume - let the paused service continue
+func (windows *windowsRecord) Resume() error {
+	return windows.control(svc.Continue, svc.Running, ErrNotPaused)
+}
+
+// Send the control request to the running service, done is returned
+// if the service is in the requested state already
+func (windows *windowsRecord) control(request svc.Cmd, state svc.State, done error) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return getWindowsError(err)
 	}
 	defer m.Disconnect()
-	s, err := m.OpenService(windows.name)
+	s, err := m.OpenService(windows.def.Name)
 	if err != nil {
-		return "Getting status:" + failed, getWindowsError(err)
+		return ErrNotInstalled
 	}
 	defer s.Close()
 	status, err := s.Query()
 	if err != nil {
-		return "Getting status:" + failed, getWindowsError(err)
+		return getWindowsError(err)
+	}
+	switch status.State {
+	case svc.Stopped, svc.StopPending:
+		return ErrAlreadyStopped
+	case state:
+		return done
 	}
+	if _, err := s.Control(request); err != nil {
+		return getWindowsError(err)
+	}
+	return nil
+}
 
-	return "Status: " + getWindowsServiceStateFromUint32(status.State), nil
+// Change the start type of the installed service
+func (windows *windowsRecord) setStartType(startType uint32) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return getWindowsError(err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(windows.def.Name)
+	if err != nil {
+		return ErrNotInstalled
+	}
+	defer s.Close()
+	config, err := s.Config()
+	if err != nil {
+		return getWindowsError(err)
+	}
+	config.StartType = startType
+	if err := s.UpdateConfig(config); err != nil {
+		return getWindowsError(err)
+	}
+	return nil
+}
+
+// Kind of the init system of the host
+func hostKind() Kind {
+	return KindWindows
+}
+
+// Inspect the configuration of the named service
+func inspect(name string) (*Definition, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return nil, ErrNotInstalled
+	}
+	defer s.Close()
+	config, err := s.Config()
+	if err != nil {
+		return nil, getWindowsError(err)
+	}
+	def := &Definition{
+		Name:         name,
+		Description:  config.Description,
+		Dependencies: config.Dependencies,
+	}
+	if command := splitWords(config.BinaryPathName, false); len(command) > 0 {
+		def.Path, def.Args = command[0], command[1:]
+	}
+	if config.ServiceStartName != "" && config.ServiceStartName != "LocalSystem" {
+		def.User = config.ServiceStartName
+	}
+	if def.Description == "" {
+		def.Description = config.DisplayName
+	}
+	return def, nil
 }
 
 // Get executable path
@@ -252,6 +500,8 @@ func getWindowsServiceStateFromUint32(state svc.State) string {
 
 type serviceHandler struct {
 	executable Executable
+	guard      *crashGuard
+	limit      *runtimeLimit
 }
 
 func (sh *serviceHandler) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (ssec bool, errno uint32) {
@@ -262,7 +512,10 @@ func (sh *serviceHandler) Execute(args []string, r <-chan svc.ChangeRequest, cha
 	slowtick := time.Tick(2 * time.Second)
 	tick := fasttick
 
-	sh.executable.Start()
+	// the service manager sees the exit code of a panic as the one of the service
+	if err := sh.guard.call(sh.executable.Start); err != nil {
+		return false, ExitPanic
+	}
 	changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
 
 loop:
@@ -270,6 +523,11 @@ loop:
 		select {
 		case <-tick:
 			break
+		case <-sh.limit.Expired():
+			// the executable is stopped by the limit, the failure exit code
+			// makes the recovery actions of the service manager restart it
+			changes <- svc.Status{State: svc.StopPending}
+			return true, 1
 		case c := <-r:
 			switch c.Cmd {
 			case svc.Interrogate:
@@ -279,7 +537,9 @@ loop:
 				changes <- c.CurrentStatus
 			case svc.Stop, svc.Shutdown:
 				changes <- svc.Status{State: svc.StopPending}
-				sh.executable.Stop()
+				if err := sh.guard.call(sh.executable.Stop); err != nil {
+					return false, ExitPanic
+				}
 				break loop
 			case svc.Pause:
 				changes <- svc.Status{State: svc.Paused, Accepts: cmdsAccepted}
@@ -296,25 +556,59 @@ loop:
 }
 
 func (windows *windowsRecord) Run(e Executable) (string, error) {
-	runAction := "Running " + windows.description + ":"
+	runAction := message(MessageRun, windows.def.Description)
+	guard := &crashGuard{service: windows.def.Name}
+	defer guard.exit()
+
+	lock, err := windows.lockInstance()
+	if err != nil {
+		return windows.failed(runAction), err
+	}
+	if lock != nil {
+		defer lock.Close()
+	}
+
+	control, err := windows.startControl(e)
+	if err != nil {
+		return windows.failed(runAction), err
+	}
+	defer control.Close()
+
+	registration, err := windows.register()
+	if err != nil {
+		return windows.failed(runAction), err
+	}
+	defer registration.Close()
 
 	interactive, err := svc.IsAnInteractiveSession()
 	if err != nil {
-		return runAction + failed, getWindowsError(err)
+		return windows.failed(runAction), getWindowsError(err)
 	}
+	limit := windows.limitRuntime(e)
+	defer limit.Close()
 	if !interactive {
 		// service called from windows service manager
 		// use API provided by golang.org/x/sys/windows
-		err = svc.Run(windows.name, &serviceHandler{
+		err = svc.Run(windows.def.Name, &serviceHandler{
 			executable: e,
+			guard:      guard,
+			limit:      limit,
 		})
 		if err != nil {
-			return runAction + failed, getWindowsError(err)
+			return windows.failed(runAction), getWindowsError(err)
+		}
+		if guard.report != nil {
+			return windows.failed(runAction), &PanicError{Report: guard.report}
 		}
 	} else {
 		// otherwise, service should be called from terminal session
-		e.Run()
+		if err := guard.run(e); err != nil {
+			return windows.failed(runAction), err
+		}
+	}
+	if err := limit.Close(); err != nil {
+		return windows.failed(runAction), err
 	}
 
-	return runAction + " completed.", nil
+	return message(MessageCompleted, runAction), nil
 }
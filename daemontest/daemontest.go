@@ -0,0 +1,270 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//go:build integration
+// +build integration
+
+package daemontest
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/takama/daemon"
+)
+
+// ErrNoDocker appears if the docker command is not available
+var ErrNoDocker = errors.New("Docker is not available")
+
+// ReadyTimeout - time the init system of a container has to become ready
+var ReadyTimeout = time.Minute
+
+// Image - container image which runs an init system
+type Image struct {
+	// Name of the image in the results, e.g. "systemd"
+	Name string
+
+	// Ref - reference of the docker image
+	Ref string
+
+	// Kind - init system which the daemon package detects in the container
+	Kind daemon.Kind
+
+	// Command - command of the container, the init system or a placeholder
+	// process if the init system does not run as PID 1
+	Command []string
+
+	// Options - additional options of "docker run", e.g. for the cgroups
+	Options []string
+
+	// Setup - shell commands which prepare the container
+	Setup []string
+
+	// Ready - command which succeeds when the init system is ready
+	Ready []string
+}
+
+// Images - the images of the supported init systems
+var Images = []Image{
+	{
+		Name:    "systemd",
+		Ref:     "jrei/systemd-ubuntu:22.04",
+		Kind:    daemon.KindSystemD,
+		Options: []string{"--privileged", "--cgroupns=host", "-v", "/sys/fs/cgroup:/sys/fs/cgroup:rw", "--tmpfs", "/run", "--tmpfs", "/run/lock"},
+		Ready:   []string{"sh", "-c", "systemctl is-system-running --wait; systemctl is-system-running | grep -qv starting"},
+	},
+	{
+		Name:    "sysv",
+		Ref:     "debian:bookworm-slim",
+		Kind:    daemon.KindSystemV,
+		Command: []string{"sleep", "infinity"},
+	},
+	{
+		// OpenRC runs the LSB init scripts of System V
+		Name:    "openrc",
+		Ref:     "alpine:3.19",
+		Kind:    daemon.KindSystemV,
+		Command: []string{"sleep", "infinity"},
+		Setup:   []string{"apk add --no-cache openrc", "mkdir -p /run/openrc", "touch /run/openrc/softlevel"},
+	},
+	{
+		Name:    "upstart",
+		Ref:     "ubuntu:14.04",
+		Kind:    daemon.KindUpstart,
+		Command: []string{"/sbin/init"},
+		Options: []string{"--privileged"},
+		Ready:   []string{"initctl", "list"},
+	},
+}
+
+// Available - check docker is installed and its daemon answers
+func Available() bool {
+	return exec.Command("docker", "info").Run() == nil
+}
+
+// Container - running container of an image
+type Container struct {
+	ID    string
+	Image Image
+}
+
+// Start - start a container of the image and wait until its init system
+// is ready, the container is removed by Close
+func Start(image Image) (*Container, error) {
+	if !Available() {
+		return nil, ErrNoDocker
+	}
+	args := append([]string{"run", "-d"}, image.Options...)
+	args = append(append(args, image.Ref), image.Command...)
+	output, err := docker(args...)
+	if err != nil {
+		return nil, err
+	}
+	container := &Container{ID: strings.TrimSpace(output), Image: image}
+	for _, command := range image.Setup {
+		if _, err := container.Exec("sh", "-c", command); err != nil {
+			container.Close()
+			return nil, err
+		}
+	}
+	if err := container.ready(); err != nil {
+		container.Close()
+		return nil, err
+	}
+	return container, nil
+}
+
+// Wait until the ready command of the image succeeds
+func (container *Container) ready() error {
+	if len(container.Image.Ready) == 0 {
+		return nil
+	}
+	deadline := time.Now().Add(ReadyTimeout)
+	for {
+		_, err := container.Exec(container.Image.Ready...)
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// Exec - run the command in the container and return its combined output
+func (container *Container) Exec(args ...string) (string, error) {
+	return docker(append([]string{"exec", container.ID}, args...)...)
+}
+
+// Copy - copy the file of the host into the container
+func (container *Container) Copy(source, target string) error {
+	_, err := docker("cp", source, container.ID+":"+target)
+	return err
+}
+
+// Close - remove the container
+func (container *Container) Close() error {
+	_, err := docker("rm", "-f", container.ID)
+	return err
+}
+
+// Run docker, the error of a failed command contains its output
+func docker(args ...string) (string, error) {
+	var output bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return output.String(), errors.New("docker " + args[0] + " failed: " + err.Error() + ": " + strings.TrimSpace(output.String()))
+	}
+	return output.String(), nil
+}
+
+// Build - build the main package for linux containers into the output file,
+// with the "integration" build tag, as the harness
+func Build(pkg, output string) error {
+	cmd := exec.Command("go", "build", "-tags", "integration", "-o", output, pkg)
+	cmd.Env = append(os.Environ(), "GOOS=linux", "CGO_ENABLED=0")
+	if result, err := cmd.CombinedOutput(); err != nil {
+		return errors.New("go build " + pkg + " failed: " + strings.TrimSpace(string(result)))
+	}
+	return nil
+}
+
+// CycleError - step of the cycle which failed
+type CycleError struct {
+	Image  string
+	Step   string
+	Output string
+	Err    error
+}
+
+func (err *CycleError) Error() string {
+	message := err.Image + ": " + err.Step + " failed"
+	if err.Err != nil {
+		message += ": " + err.Err.Error()
+	}
+	if err.Output != "" {
+		message += "\n" + strings.TrimSpace(err.Output)
+	}
+	return message
+}
+
+// Steps of the cycle: the command of the executable, and whether the
+// status reports a running service after it
+var cycle = []struct {
+	command string
+	running bool
+}{
+	{"install", false},
+	{"start", true},
+	{"stop", false},
+	{"remove", false},
+}
+
+// Cycle - install, start, stop and remove the service by the commands of
+// the executable in the container, the status is checked after start and
+// after stop; it returns a *CycleError for the first step which failed
+func Cycle(container *Container, executable string) error {
+	name := container.Image.Name
+	for _, step := range cycle {
+		if output, err := container.Exec(executable, step.command); err != nil {
+			return &CycleError{Image: name, Step: step.command, Output: output, Err: err}
+		}
+		if step.command != "start" && step.command != "stop" {
+			continue
+		}
+		output, err := container.Exec(executable, "status")
+		if err != nil {
+			return &CycleError{Image: name, Step: "status after " + step.command, Output: output, Err: err}
+		}
+		if running := strings.Contains(output, "running"); running != step.running {
+			return &CycleError{Image: name, Step: "status after " + step.command, Output: output}
+		}
+	}
+	return nil
+}
+
+// Run - build the main package and run its cycle in a container of every
+// image, Images by default, as subtests; the test is skipped without Docker
+func Run(t *testing.T, pkg string, images ...Image) {
+	t.Helper()
+	if !Available() {
+		t.Skip(ErrNoDocker)
+	}
+	if len(images) == 0 {
+		images = Images
+	}
+	executable := filepath.Join(t.TempDir(), filepath.Base(pkg))
+	if err := Build(pkg, executable); err != nil {
+		t.Fatal(err)
+	}
+	for _, image := range images {
+		image := image
+		t.Run(image.Name, func(t *testing.T) {
+			if err := RunImage(image, executable); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// RunImage - run the cycle of the built executable in a container of the
+// image, the container is removed afterwards
+func RunImage(image Image, executable string) error {
+	container, err := Start(image)
+	if err != nil {
+		return err
+	}
+	defer container.Close()
+	target := "/usr/local/bin/" + filepath.Base(executable)
+	if err := container.Copy(executable, target); err != nil {
+		return err
+	}
+	return Cycle(container, target)
+}
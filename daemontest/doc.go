@@ -0,0 +1,28 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+// Package daemontest runs the Install/Start/Status/Stop/Remove cycle of a
+// service executable in Docker containers with real init systems (systemd,
+// System V, OpenRC, upstart), so services are tested end-to-end without
+// sacrificing a machine.
+//
+// The package is built with the "integration" build tag only, it needs
+// Docker and Go on the host:
+//
+//	//go:build integration
+//
+//	func TestService(t *testing.T) {
+//		daemontest.Run(t, "./cmd/myservice")
+//	}
+//
+//	go test -tags integration ./...
+//
+// The executable accepts the commands "install", "remove", "start", "stop"
+// and "status" as its first argument and exits with a failure if they fail,
+// like the example service of the daemon package. The cycle of the daemon
+// package itself is run by
+//
+//	go run -tags integration ./daemontest/probe -cycle
+
+package daemontest
@@ -0,0 +1,98 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//go:build integration
+// +build integration
+
+// Command probe is the service of the integration test of the daemon
+// package: in a container it installs, starts, stops and removes itself
+// by its commands, on the host "-cycle" runs the cycle in the containers
+// of all images of daemontest.
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/takama/daemon"
+	"github.com/takama/daemon/daemontest"
+)
+
+const (
+	name        = "daemonprobe"
+	description = "Daemon integration probe"
+	pkg         = "github.com/takama/daemon/daemontest/probe"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "-cycle" {
+		os.Exit(runCycle())
+	}
+	service, err := daemon.New(name, description)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	status, err := manage(service)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, status, "\nError:", err)
+		os.Exit(1)
+	}
+	fmt.Println(status)
+}
+
+// Run the command of the arguments, or run the service until it is stopped
+func manage(service daemon.Daemon) (string, error) {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "install":
+			return service.Install()
+		case "remove":
+			return service.Remove()
+		case "start":
+			return service.Start()
+		case "stop":
+			return service.Stop()
+		case "status":
+			return service.Status()
+		}
+		return "Usage: " + name + " install | remove | start | stop | status", nil
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	return fmt.Sprint("Stopped by ", <-interrupt), nil
+}
+
+// Build the probe and run its cycle in every image, the exit code is
+// the number of failed images
+func runCycle() int {
+	if !daemontest.Available() {
+		fmt.Fprintln(os.Stderr, daemontest.ErrNoDocker)
+		return 1
+	}
+	dir, err := os.MkdirTemp("", name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	executable := filepath.Join(dir, name)
+	if err := daemontest.Build(pkg, executable); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	failures := 0
+	for _, image := range daemontest.Images {
+		if err := daemontest.RunImage(image, executable); err != nil {
+			fmt.Println("FAIL", image.Name+":", err)
+			failures++
+			continue
+		}
+		fmt.Println("ok  ", image.Name)
+	}
+	return failures
+}
@@ -0,0 +1,955 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"os"
+	"time"
+)
+
+// Definition - description of a service which does not depend on the host,
+// it is used to render service files for any kind of init system
+type Definition struct {
+	// Name of the service
+	Name string `json:"name"`
+
+	// Description - any explanation, what is the service, its purpose
+	Description string `json:"description"`
+
+	// Dependencies of the service
+	Dependencies []string `json:"dependencies,omitempty"`
+
+	// Needs - common dependencies, e.g. DependencyNetworkOnline, which are
+	// translated into the names of every init system
+	Needs []Dependency `json:"needs,omitempty"`
+
+	// Aliases - additional names of the service, e.g. its names before
+	// a rename: Alias= of systemd, links of the init script on System V
+	// and rc.d, see ResolveAlias
+	Aliases []string `json:"aliases,omitempty"`
+
+	// Path of the executable on the target host,
+	// if it is empty the executable is looked up on the current host
+	Path string `json:"path,omitempty"`
+
+	// InstallPath - Install copies the executable to this path, e.g.
+	// DefaultInstallPath, and the service runs the copy; empty means
+	// the service runs the executable where it is
+	InstallPath string `json:"install_path,omitempty"`
+
+	// InstallSource - file which is copied to InstallPath, by default
+	// Path or the executable found on the current host
+	InstallSource string `json:"install_source,omitempty"`
+
+	// InstallChecksum - expected SHA-256 checksum (hex) of the file which is
+	// copied to InstallPath, Install fails if it does not match
+	InstallChecksum string `json:"install_checksum,omitempty"`
+
+	// InstallPublicKey - base64 encoded ed25519 key, the file which is copied
+	// to InstallPath must have a valid detached signature in "<file>.sig"
+	InstallPublicKey string `json:"install_public_key,omitempty"`
+
+	// Args - arguments of the executable
+	Args []string `json:"args,omitempty"`
+
+	// Environment - variables which are set for the service process on every
+	// init system, instead of ones inherited from the installing shell,
+	// see WithLocale and WithTimezone
+	Environment map[string]string `json:"environment,omitempty"`
+
+	// After - names of services which must be started before this one,
+	// unlike dependencies they are only ordered and not required
+	After []string `json:"after,omitempty"`
+
+	// Before - names of services which must be started after this one
+	Before []string `json:"before,omitempty"`
+
+	// Ports - addresses the service listens on as "[network/]address",
+	// e.g. ":8080" or "udp/:53"
+	Ports []string `json:"ports,omitempty"`
+
+	// Preflight - check the executable and the ports before Start,
+	// see the Preflight function
+	Preflight bool `json:"preflight,omitempty"`
+
+	// CheckConflicts - look for competing services before Install,
+	// see the Conflicts function
+	CheckConflicts bool `json:"check_conflicts,omitempty"`
+
+	// Control - open the control channel (unix socket) while the service runs,
+	// see ControlSocket and ControlHandler
+	Control bool `json:"control,omitempty"`
+
+	// SingleInstance - only one instance of the service may run on the host,
+	// Run of a second instance fails with ErrAlreadyRunning, see InstanceLock
+	SingleInstance bool `json:"single_instance,omitempty"`
+
+	// Upgrade - the service replaces itself with a new process by Upgrade,
+	// so systemd must accept the new main process
+	Upgrade bool `json:"upgrade,omitempty"`
+
+	// OnFailure - names of systemd units which are activated when the service
+	// enters the failed state
+	OnFailure []string `json:"on_failure,omitempty"`
+
+	// FailureWebhook - URL which receives a POST when the service fails,
+	// see NotifyFailure
+	FailureWebhook string `json:"failure_webhook,omitempty"`
+
+	// FailureMail - address which receives a mail when the service fails
+	FailureMail string `json:"failure_mail,omitempty"`
+
+	// Registration - entry of the service in Consul or etcd while Run runs it
+	Registration *Registration `json:"registration,omitempty"`
+
+	// Target - umbrella group of related services the service is part of,
+	// on systemd "<Target>.target" starts and stops it, see Manager.SetTarget
+	Target string `json:"target,omitempty"`
+
+	// Preset - name of a built-in template preset, e.g. PresetHardened,
+	// it is used unless Template is set
+	Preset string `json:"preset,omitempty"`
+
+	// StartInterval - launchd starts the service periodically with this interval
+	// (StartInterval), the service is not kept alive then
+	StartInterval time.Duration `json:"start_interval,omitempty"`
+
+	// WatchPaths - launchd starts the service when one of the paths is changed
+	WatchPaths []string `json:"watch_paths,omitempty"`
+
+	// QueueDirectories - launchd keeps the service running while one of
+	// the directories is not empty
+	QueueDirectories []string `json:"queue_directories,omitempty"`
+
+	// Watch - the service is started when one of the paths changes (a systemd
+	// path unit, launchd WatchPaths and QueueDirectories, polling by Run on
+	// the other init systems)
+	Watch []PathSpec `json:"watch,omitempty"`
+
+	// Socket - sockets which start the service on the first connection, a
+	// systemd socket unit or launchd Sockets; they are installed and removed
+	// with the service
+	Socket *SocketSection `json:"socket,omitempty"`
+
+	// Timer - schedule which starts the service, a systemd timer unit,
+	// launchd StartCalendarInterval or a cron entry on the other init
+	// systems; it is installed and removed with the service
+	Timer *TimerSection `json:"timer,omitempty"`
+
+	// UdevRules - lines of the udev rules file of the service (linux),
+	// e.g. to start it when a device is plugged in, see UdevRulesPath
+	UdevRules []string `json:"udev_rules,omitempty"`
+
+	// Sysctls - kernel parameters which the service requires, e.g.
+	// "net.core.rmem_max": "26214400", they are applied by Install and kept
+	// in a sysctl.d drop-in (linux) or in sysctl.conf.local (FreeBSD)
+	Sysctls map[string]string `json:"sysctls,omitempty"`
+
+	// KernelModules - kernel modules which the service requires, they are
+	// loaded by Install and kept in a modules-load.d drop-in (linux)
+	// or in kld_list of rc.conf (FreeBSD)
+	KernelModules []string `json:"kernel_modules,omitempty"`
+
+	// PrivateNetwork - the service runs in its own network namespace with
+	// a loopback device only (systemd PrivateNetwork=, unshare elsewhere)
+	PrivateNetwork bool `json:"private_network,omitempty"`
+
+	// NetworkNamespace - path of an existing network namespace the service
+	// joins, e.g. "/run/netns/measure" (systemd NetworkNamespacePath=, nsenter elsewhere)
+	NetworkNamespace string `json:"network_namespace,omitempty"`
+
+	// RestrictAddressFamilies - socket address families the service may use,
+	// e.g. "AF_INET" and "AF_UNIX" (systemd only)
+	RestrictAddressFamilies []string `json:"restrict_address_families,omitempty"`
+
+	// SystemCallFilter - seccomp filter of the service (systemd SystemCallFilter=),
+	// system calls or groups like SyscallSystemService which are allowed,
+	// the ones with the "~" prefix are denied; the other init systems fail
+	// with ErrUnsupportedOption
+	SystemCallFilter []string `json:"system_call_filter,omitempty"`
+
+	// SystemCallErrorNumber - error which the filtered calls return instead
+	// of killing the service, e.g. "EPERM" (systemd only)
+	SystemCallErrorNumber string `json:"system_call_error_number,omitempty"`
+
+	// Delegate - the service manages the cgroup subtree of its unit itself,
+	// e.g. it runs containers by podman (systemd Delegate=), the other init
+	// systems do not manage cgroups of services
+	Delegate bool `json:"delegate,omitempty"`
+
+	// DelegateControllers - cgroup controllers which are delegated,
+	// e.g. "cpu", "memory" and "pids", by default all of them
+	DelegateControllers []string `json:"delegate_controllers,omitempty"`
+
+	// CPUAffinity - CPUs the service runs on, e.g. "0-3,8" (systemd CPUAffinity=,
+	// taskset on System V and upstart, <name>_cpuset of rc.d),
+	// launchd and Windows do not pin services
+	CPUAffinity string `json:"cpu_affinity,omitempty"`
+
+	// NUMAPolicy - NUMA memory policy of the service on linux, e.g. NUMAInterleave
+	// (systemd NUMAPolicy=, numactl on System V and upstart)
+	NUMAPolicy string `json:"numa_policy,omitempty"`
+
+	// NUMANodes - NUMA nodes of the policy, e.g. "0-1", by default all nodes
+	// (the first one for NUMAPreferred)
+	NUMANodes string `json:"numa_nodes,omitempty"`
+
+	// TimeSync - the service is started at boot after the clock was
+	// synchronized (time-sync.target, $time, ntpdate), upstart and launchd
+	// have no such event
+	TimeSync bool `json:"time_sync,omitempty"`
+
+	// Forking - the executable puts itself in the background and writes
+	// the pid file /var/run/<name>.pid, the init system waits for it
+	Forking bool `json:"forking,omitempty"`
+
+	// StopAfter - names of services which are stopped before this one at
+	// shutdown, e.g. the dependents of a database; the init systems which order
+	// the stop by the start order start the service before them
+	StopAfter []string `json:"stop_after,omitempty"`
+
+	// StopPriority - priority of the System V stop links (1-99, by default 17),
+	// services with higher priorities are stopped later
+	StopPriority int `json:"stop_priority,omitempty"`
+
+	// RCRequire - REQUIRE of the rc.d script instead of "networking syslog",
+	// e.g. "FILESYSTEMS" for a service which starts before the network; the
+	// dependencies and After of the definition are required as well
+	RCRequire []string `json:"rc_require,omitempty"`
+
+	// RCKeywords - KEYWORD of the rc.d script, e.g. "shutdown" to stop the
+	// service by rc.shutdown(8) or "nojail" to skip it in jails
+	RCKeywords []string `json:"rc_keywords,omitempty"`
+
+	// KillSignal - signal which makes the service stop gracefully,
+	// SignalTerm by default (launchd always sends SIGTERM)
+	KillSignal string `json:"kill_signal,omitempty"`
+
+	// NoFinalKill - do not kill the service by SIGKILL if it is still running
+	// after the stop timeout (systemd, System V, rc.d never kills it)
+	NoFinalKill bool `json:"no_final_kill,omitempty"`
+
+	// KillMode - which processes of the service are stopped, KillControlGroup
+	// by default, so the children of the service do not outlive it
+	KillMode string `json:"kill_mode,omitempty"`
+
+	// StopTimeout - time the service has to stop before it is killed,
+	// the default of the init system if it is not set
+	StopTimeout time.Duration `json:"stop_timeout,omitempty"`
+
+	// MaxRuntime - the service is stopped and started again after it ran
+	// for this time, e.g. to recycle a leaky service, see ErrMaxRuntime
+	MaxRuntime time.Duration `json:"max_runtime,omitempty"`
+
+	// RestartDelay - time the init system waits before it restarts the
+	// failed service, so a crash loop does not hammer its dependencies
+	RestartDelay time.Duration `json:"restart_delay,omitempty"`
+
+	// RestartMaxDelay - the restart delay doubles with every failure in
+	// a row up to this delay (exponential backoff), a constant delay if it
+	// is not set
+	RestartMaxDelay time.Duration `json:"restart_max_delay,omitempty"`
+
+	// Watchdog - systemd restarts the service if Run does not feed its
+	// watchdog within this time, which it does while the executable is
+	// healthy (see HealthChecker)
+	Watchdog time.Duration `json:"watchdog,omitempty"`
+
+	// FirstBoot - the service runs at the first boot of the machine only
+	// (ConditionFirstBoot= of systemd), e.g. the provisioning agent of
+	// a VM template, see IsFirstBoot
+	FirstBoot bool `json:"first_boot,omitempty"`
+
+	// EnableByPreset - Install writes a preset file instead of enabling
+	// the service, so systemd enables it when the presets are applied: at
+	// the first boot of a golden image or by "systemctl preset"
+	EnableByPreset bool `json:"enable_by_preset,omitempty"`
+
+	// StopCommands - commands which ask the service to stop before the stop
+	// signal is sent, e.g. a shutdown request or the deregistration from
+	// a load balancer, absolute executable paths and their arguments
+	StopCommands []string `json:"stop_commands,omitempty"`
+
+	// PostStopCommands - commands which clean up after the service has stopped
+	PostStopCommands []string `json:"post_stop_commands,omitempty"`
+
+	// PreStartCommands - commands which run as root before the service is
+	// started, even if it runs as another user, e.g. to fix the permissions
+	// of its directories in /var (ExecStartPre=+ of systemd, formerly
+	// PermissionsStartOnly=); a failure fails the start
+	PreStartCommands []string `json:"pre_start_commands,omitempty"`
+
+	// ConditionCommands - commands which run before the service is started,
+	// if one of them exits with a failure the start is skipped and the service
+	// is not marked failed, e.g. on a host where it is not applicable
+	ConditionCommands []string `json:"condition_commands,omitempty"`
+
+	// RequiredFiles - files which must exist before the service is started,
+	// e.g. its configuration (rc.d required_files, the executable is always required)
+	RequiredFiles []string `json:"required_files,omitempty"`
+
+	// Template - custom template of the service file, the default template
+	// of the init system is used if it is empty, see TemplateData
+	Template string `json:"template,omitempty"`
+
+	// PerUser - an instance of the service runs for every logged in user
+	// as that user, by a systemd template unit "<name>@.service" which is
+	// pulled in by user@<uid>.service or by a launchd agent; User and Group
+	// are ignored, the other init systems fail with ErrUnsupportedOption
+	PerUser bool `json:"per_user,omitempty"`
+
+	// Scope - ScopeSystemBoot (the default), ScopeUserLogin, the service of
+	// the current user which starts at login and is installed without root,
+	// or ScopeDesktop, the helper which the desktop session starts
+	Scope string `json:"scope,omitempty"`
+
+	// User - account the service runs as, by default root
+	User string `json:"user,omitempty"`
+
+	// Group the service runs as, by default the primary group of the user
+	Group string `json:"group,omitempty"`
+
+	// CreateUser - create the system account (and the group) of the service
+	// on Install if it does not exist, Purge deletes it
+	CreateUser bool `json:"create_user,omitempty"`
+
+	// LogDir - directory of the log files,
+	// by default the standard log directory of the init system
+	LogDir string `json:"log_dir,omitempty"`
+
+	// Logging - where the output of the service is written, see LogMode
+	Logging LogMode `json:"logging,omitempty"`
+
+	// StandardInput - absolute path of a file, a FIFO or a device which is
+	// the standard input of the service, or StandardInputSocket; the null
+	// device if it is not set
+	StandardInput string `json:"standard_input,omitempty"`
+
+	// StateDir - directory of the persistent state of the service
+	StateDir string `json:"state_dir,omitempty"`
+
+	// RuntimeDir - directory of the runtime files of the service (sockets, locks)
+	RuntimeDir string `json:"runtime_dir,omitempty"`
+
+	// Paths - additional files and directories (configuration, data, sockets)
+	// which Install creates or fixes and Verify checks
+	Paths []PathSpec `json:"paths,omitempty"`
+
+	// ConfigFiles - configuration files which Install writes, Verify checks
+	// and Ensure deploys, restarting the service if they changed
+	ConfigFiles []ConfigFile `json:"config_files,omitempty"`
+
+	// WatchConfig - reload the executable (see ConfigReloader) when the
+	// configuration files change while Run runs the service
+	WatchConfig bool `json:"watch_config,omitempty"`
+
+	// DirMode - permissions of the created directories, by default 0755
+	DirMode os.FileMode `json:"dir_mode,omitempty"`
+
+	// SocketUser - owner of the sockets and FIFOs which the service creates
+	// in its runtime directory, empty means the owner is not changed
+	SocketUser string `json:"socket_user,omitempty"`
+
+	// SocketGroup - group of the sockets and FIFOs, e.g. the group whose
+	// members may use the control socket
+	SocketGroup string `json:"socket_group,omitempty"`
+
+	// SocketMode - permissions of the sockets and FIFOs, by default 0660
+	SocketMode os.FileMode `json:"socket_mode,omitempty"`
+}
+
+// Option - optional setting of the definition of a service
+type Option func(*Definition)
+
+// NewWithOptions - Create a new daemon with optional settings
+//
+// name: name of the service
+//
+// description: any explanation, what is the service, its purpose
+func NewWithOptions(name, description string, options ...Option) (Daemon, error) {
+	def := &Definition{Name: name, Description: description}
+	for _, option := range options {
+		option(def)
+	}
+	return NewFromDefinition(def)
+}
+
+// WithDependencies - services which are required by the service
+func WithDependencies(dependencies ...string) Option {
+	return func(def *Definition) {
+		def.Dependencies = append(def.Dependencies, dependencies...)
+	}
+}
+
+// WithNeeds - common dependencies of the service, which work on every init system
+func WithNeeds(dependencies ...Dependency) Option {
+	return func(def *Definition) {
+		def.Needs = append(def.Needs, dependencies...)
+	}
+}
+
+// WithAliases - additional names the service is addressed by
+func WithAliases(aliases ...string) Option {
+	return func(def *Definition) {
+		def.Aliases = append(def.Aliases, aliases...)
+	}
+}
+
+// WithPath - path of the executable of the service
+func WithPath(path string) Option {
+	return func(def *Definition) {
+		def.Path = path
+	}
+}
+
+// WithInstallPath - copy the executable to the path on Install and run the copy,
+// an empty path means DefaultInstallPath
+func WithInstallPath(path string) Option {
+	return func(def *Definition) {
+		if path == "" {
+			path = DefaultInstallPath(def.Name)
+		}
+		def.InstallPath = path
+	}
+}
+
+// WithInstallSource - file which is copied to the install path instead of the executable
+func WithInstallSource(path string) Option {
+	return func(def *Definition) {
+		def.InstallSource = path
+	}
+}
+
+// WithInstallChecksum - expected SHA-256 checksum of the installed executable
+func WithInstallChecksum(checksum string) Option {
+	return func(def *Definition) {
+		def.InstallChecksum = checksum
+	}
+}
+
+// WithInstallPublicKey - verify the detached ed25519 signature of the installed executable
+func WithInstallPublicKey(publicKey string) Option {
+	return func(def *Definition) {
+		def.InstallPublicKey = publicKey
+	}
+}
+
+// WithArgs - default arguments of the executable, arguments given to Install override them
+func WithArgs(args ...string) Option {
+	return func(def *Definition) {
+		def.Args = args
+	}
+}
+
+// WithEnvironment - set the environment variable of the service process
+func WithEnvironment(name, value string) Option {
+	return func(def *Definition) {
+		if def.Environment == nil {
+			def.Environment = make(map[string]string)
+		}
+		def.Environment[name] = value
+	}
+}
+
+// WithLocale - locale of the service process (LANG and LC_ALL), e.g. "C.UTF-8"
+func WithLocale(locale string) Option {
+	return func(def *Definition) {
+		WithEnvironment("LANG", locale)(def)
+		WithEnvironment("LC_ALL", locale)(def)
+	}
+}
+
+// WithTimezone - timezone of the service process (TZ), e.g. "UTC" or "Europe/Berlin"
+func WithTimezone(zone string) Option {
+	return func(def *Definition) {
+		WithEnvironment("TZ", zone)(def)
+	}
+}
+
+// WithPrivateNetwork - run the service in its own network namespace
+func WithPrivateNetwork() Option {
+	return func(def *Definition) {
+		def.PrivateNetwork = true
+	}
+}
+
+// WithNetworkNamespace - run the service in the existing network namespace,
+// e.g. "/run/netns/measure" which is created by "ip netns add measure"
+func WithNetworkNamespace(path string) Option {
+	return func(def *Definition) {
+		def.NetworkNamespace = path
+	}
+}
+
+// WithRestrictAddressFamilies - socket address families the service may use
+func WithRestrictAddressFamilies(families ...string) Option {
+	return func(def *Definition) {
+		def.RestrictAddressFamilies = append(def.RestrictAddressFamilies, families...)
+	}
+}
+
+// WithSystemCallFilter - allow only the system calls and groups, e.g.
+// WithSystemCallFilter(SyscallSystemService)
+func WithSystemCallFilter(calls ...string) Option {
+	return func(def *Definition) {
+		def.SystemCallFilter = append(def.SystemCallFilter, calls...)
+	}
+}
+
+// WithSystemCallDeny - deny the system calls and groups, e.g.
+// WithSystemCallDeny(SyscallPrivileged, SyscallResources)
+func WithSystemCallDeny(calls ...string) Option {
+	return func(def *Definition) {
+		for _, call := range calls {
+			def.SystemCallFilter = append(def.SystemCallFilter, "~"+call)
+		}
+	}
+}
+
+// WithSystemCallErrorNumber - the filtered calls fail with the error,
+// e.g. "EPERM", instead of killing the service
+func WithSystemCallErrorNumber(errno string) Option {
+	return func(def *Definition) {
+		def.SystemCallErrorNumber = errno
+	}
+}
+
+// WithDelegate - delegate the cgroup subtree of the unit to the service,
+// so it is able to run containers, without controllers all of them are delegated
+func WithDelegate(controllers ...string) Option {
+	return func(def *Definition) {
+		def.Delegate = true
+		def.DelegateControllers = append(def.DelegateControllers, controllers...)
+	}
+}
+
+// WithPerUser - run an instance of the service for every logged in user
+func WithPerUser() Option {
+	return func(def *Definition) {
+		def.PerUser = true
+	}
+}
+
+// WithScope - start the service at boot (ScopeSystemBoot), at the login
+// of the current user (ScopeUserLogin) or with the desktop session of the
+// user (ScopeDesktop)
+func WithScope(scope string) Option {
+	return func(def *Definition) {
+		def.Scope = scope
+	}
+}
+
+// WithCPUAffinity - pin the service to the CPUs, e.g. "0-3,8"
+func WithCPUAffinity(cpus string) Option {
+	return func(def *Definition) {
+		def.CPUAffinity = cpus
+	}
+}
+
+// WithNUMAPolicy - NUMA memory policy of the service and its nodes, e.g.
+// WithNUMAPolicy(NUMABind, "0"), empty nodes mean all of them
+func WithNUMAPolicy(policy, nodes string) Option {
+	return func(def *Definition) {
+		def.NUMAPolicy, def.NUMANodes = policy, nodes
+	}
+}
+
+// WithPorts - addresses the service listens on, checked by the pre-flight check
+func WithPorts(ports ...string) Option {
+	return func(def *Definition) {
+		def.Ports = append(def.Ports, ports...)
+	}
+}
+
+// WithPreflight - run the pre-flight check before the service is started
+func WithPreflight() Option {
+	return func(def *Definition) {
+		def.Preflight = true
+	}
+}
+
+// WithConflictCheck - refuse to install the service if another service
+// of the same name or with the same executable exists, see Conflicts
+func WithConflictCheck() Option {
+	return func(def *Definition) {
+		def.CheckConflicts = true
+	}
+}
+
+// WithControl - open the control channel while the service runs
+func WithControl() Option {
+	return func(def *Definition) {
+		def.Control = true
+	}
+}
+
+// WithSingleInstance - allow only one running instance of the service on the host
+func WithSingleInstance() Option {
+	return func(def *Definition) {
+		def.SingleInstance = true
+	}
+}
+
+// WithUpgrade - allow the service to replace itself by Upgrade
+func WithUpgrade() Option {
+	return func(def *Definition) {
+		def.Upgrade = true
+	}
+}
+
+// WithOnFailure - systemd units which are activated when the service fails
+func WithOnFailure(units ...string) Option {
+	return func(def *Definition) {
+		def.OnFailure = append(def.OnFailure, units...)
+	}
+}
+
+// WithFailureWebhook - URL which receives a POST when the service fails
+func WithFailureWebhook(url string) Option {
+	return func(def *Definition) {
+		def.FailureWebhook = url
+	}
+}
+
+// WithFailureMail - address which receives a mail when the service fails
+func WithFailureMail(address string) Option {
+	return func(def *Definition) {
+		def.FailureMail = address
+	}
+}
+
+// WithRegistration - register the service in Consul or etcd while Run runs it
+func WithRegistration(registration Registration) Option {
+	return func(def *Definition) {
+		def.Registration = &registration
+	}
+}
+
+// WithPreset - render the service file from a built-in template preset,
+// see Presets
+func WithPreset(name string) Option {
+	return func(def *Definition) {
+		def.Preset = name
+	}
+}
+
+// WithStartInterval - start the service periodically (launchd)
+func WithStartInterval(interval time.Duration) Option {
+	return func(def *Definition) {
+		def.StartInterval = interval
+	}
+}
+
+// WithWatchPaths - start the service when one of the paths is changed (launchd)
+func WithWatchPaths(paths ...string) Option {
+	return func(def *Definition) {
+		def.WatchPaths = append(def.WatchPaths, paths...)
+	}
+}
+
+// WithQueueDirectories - run the service while one of the directories is not empty (launchd)
+func WithQueueDirectories(dirs ...string) Option {
+	return func(def *Definition) {
+		def.QueueDirectories = append(def.QueueDirectories, dirs...)
+	}
+}
+
+// WithWatch - start the service when one of the paths changes
+func WithWatch(paths ...PathSpec) Option {
+	return func(def *Definition) {
+		def.Watch = append(def.Watch, paths...)
+	}
+}
+
+// WithSocket - start the service on the first connection to the sockets
+func WithSocket(socket SocketSection) Option {
+	return func(def *Definition) {
+		def.Socket = &socket
+	}
+}
+
+// WithTimer - start the service by the schedule of the timer
+func WithTimer(timer TimerSection) Option {
+	return func(def *Definition) {
+		def.Timer = &timer
+	}
+}
+
+// WithUdevRules - install the udev rules with the service (linux)
+func WithUdevRules(rules ...string) Option {
+	return func(def *Definition) {
+		def.UdevRules = append(def.UdevRules, rules...)
+	}
+}
+
+// WithSysctl - kernel parameter which the service requires (linux, FreeBSD)
+func WithSysctl(key, value string) Option {
+	return func(def *Definition) {
+		if def.Sysctls == nil {
+			def.Sysctls = make(map[string]string)
+		}
+		def.Sysctls[key] = value
+	}
+}
+
+// WithKernelModules - kernel modules which the service requires (linux, FreeBSD)
+func WithKernelModules(modules ...string) Option {
+	return func(def *Definition) {
+		def.KernelModules = append(def.KernelModules, modules...)
+	}
+}
+
+// WithTimeSync - start the service at boot after the clock was synchronized
+func WithTimeSync() Option {
+	return func(def *Definition) {
+		def.TimeSync = true
+	}
+}
+
+// WithForking - the executable puts itself in the background and writes its pid file
+func WithForking() Option {
+	return func(def *Definition) {
+		def.Forking = true
+	}
+}
+
+// WithStopAfter - stop the service after the named services at shutdown
+func WithStopAfter(names ...string) Option {
+	return func(def *Definition) {
+		def.StopAfter = append(def.StopAfter, names...)
+	}
+}
+
+// WithStopPriority - priority of the System V stop links, higher priorities are stopped later
+func WithStopPriority(priority int) Option {
+	return func(def *Definition) {
+		def.StopPriority = priority
+	}
+}
+
+// WithRCRequire - REQUIRE of the rc.d script instead of the default "networking syslog"
+func WithRCRequire(names ...string) Option {
+	return func(def *Definition) {
+		def.RCRequire = append(def.RCRequire, names...)
+	}
+}
+
+// WithRCKeywords - KEYWORD of the rc.d script, e.g. "shutdown" or "nojail"
+func WithRCKeywords(keywords ...string) Option {
+	return func(def *Definition) {
+		def.RCKeywords = append(def.RCKeywords, keywords...)
+	}
+}
+
+// WithKillSignal - signal which makes the service stop gracefully, e.g. SignalQuit
+func WithKillSignal(signal string) Option {
+	return func(def *Definition) {
+		def.KillSignal = signal
+	}
+}
+
+// WithoutFinalKill - leave the service running if it does not stop in time
+// instead of killing it by SIGKILL
+func WithoutFinalKill() Option {
+	return func(def *Definition) {
+		def.NoFinalKill = true
+	}
+}
+
+// WithKillMode - which processes of the service are stopped, e.g. KillProcess
+func WithKillMode(mode string) Option {
+	return func(def *Definition) {
+		def.KillMode = mode
+	}
+}
+
+// WithStopTimeout - time the service has to stop before it is killed
+func WithStopTimeout(timeout time.Duration) Option {
+	return func(def *Definition) {
+		def.StopTimeout = timeout
+	}
+}
+
+// WithMaxRuntime - restart the service after it ran for the given time
+func WithMaxRuntime(runtime time.Duration) Option {
+	return func(def *Definition) {
+		def.MaxRuntime = runtime
+	}
+}
+
+// WithRestartBackoff - wait for the delay before a failed service is
+// restarted, the delay doubles with every failure in a row up to the
+// maximum delay; a maximum of 0 keeps the delay constant
+func WithRestartBackoff(delay, max time.Duration) Option {
+	return func(def *Definition) {
+		def.RestartDelay = delay
+		def.RestartMaxDelay = max
+	}
+}
+
+// WithWatchdog - restart the service if it is not healthy for the given time
+func WithWatchdog(timeout time.Duration) Option {
+	return func(def *Definition) {
+		def.Watchdog = timeout
+	}
+}
+
+// WithFirstBoot - run the service at the first boot of the machine only
+func WithFirstBoot() Option {
+	return func(def *Definition) {
+		def.FirstBoot = true
+	}
+}
+
+// WithEnableByPreset - enable the service by a preset file, when systemd
+// applies the presets at the first boot of the image
+func WithEnableByPreset() Option {
+	return func(def *Definition) {
+		def.EnableByPreset = true
+	}
+}
+
+// WithStopCommands - commands which ask the service to stop before the stop signal
+func WithStopCommands(commands ...string) Option {
+	return func(def *Definition) {
+		def.StopCommands = append(def.StopCommands, commands...)
+	}
+}
+
+// WithPostStopCommands - commands which clean up after the service has stopped
+func WithPostStopCommands(commands ...string) Option {
+	return func(def *Definition) {
+		def.PostStopCommands = append(def.PostStopCommands, commands...)
+	}
+}
+
+// WithPreStartCommands - commands which run as root before the service is started
+func WithPreStartCommands(commands ...string) Option {
+	return func(def *Definition) {
+		def.PreStartCommands = append(def.PreStartCommands, commands...)
+	}
+}
+
+// WithConditionCommands - commands which decide whether the service is
+// started, the start is skipped without a failure if one of them fails
+func WithConditionCommands(commands ...string) Option {
+	return func(def *Definition) {
+		def.ConditionCommands = append(def.ConditionCommands, commands...)
+	}
+}
+
+// WithRequiredFiles - files which must exist before the service is started
+func WithRequiredFiles(paths ...string) Option {
+	return func(def *Definition) {
+		def.RequiredFiles = append(def.RequiredFiles, paths...)
+	}
+}
+
+// WithTemplate - custom template of the service file, see TemplateData
+func WithTemplate(text string) Option {
+	return func(def *Definition) {
+		def.Template = text
+	}
+}
+
+// WithUser - run the service as the user and group, an empty group means
+// the primary group of the user
+func WithUser(user, group string) Option {
+	return func(def *Definition) {
+		def.User = user
+		def.Group = group
+	}
+}
+
+// WithCreatedUser - run the service as the user and group like WithUser,
+// the account is created on Install if it does not exist
+func WithCreatedUser(user, group string) Option {
+	return func(def *Definition) {
+		def.User = user
+		def.Group = group
+		def.CreateUser = true
+	}
+}
+
+// WithLogDir - directory of the log files, it is created with the ownership of the service user
+func WithLogDir(dir string) Option {
+	return func(def *Definition) {
+		def.LogDir = dir
+	}
+}
+
+// WithLogging - where the output of the service is written, e.g. LogJournal
+// to keep the output of a systemd service in the journal only
+func WithLogging(mode LogMode) Option {
+	return func(def *Definition) {
+		def.Logging = mode
+	}
+}
+
+// WithStandardInput - read the standard input of the service from the file,
+// FIFO or device, or from the activating socket by StandardInputSocket
+func WithStandardInput(input string) Option {
+	return func(def *Definition) {
+		def.StandardInput = input
+	}
+}
+
+// WithStateDir - directory of the persistent state, it is created with the ownership of the service user
+func WithStateDir(dir string) Option {
+	return func(def *Definition) {
+		def.StateDir = dir
+	}
+}
+
+// WithRuntimeDir - directory of the runtime files, it is created with the ownership of the service user
+func WithRuntimeDir(dir string) Option {
+	return func(def *Definition) {
+		def.RuntimeDir = dir
+	}
+}
+
+// WithDirMode - permissions of the created directories
+func WithDirMode(mode os.FileMode) Option {
+	return func(def *Definition) {
+		def.DirMode = mode
+	}
+}
+
+// WithSocketOwner - owner and group of the sockets and FIFOs in the runtime directory
+func WithSocketOwner(user, group string) Option {
+	return func(def *Definition) {
+		def.SocketUser = user
+		def.SocketGroup = group
+	}
+}
+
+// WithSocketMode - permissions of the sockets and FIFOs in the runtime directory
+func WithSocketMode(mode os.FileMode) Option {
+	return func(def *Definition) {
+		def.SocketMode = mode
+	}
+}
+
+// WithPaths - additional files and directories which Install creates or fixes
+func WithPaths(paths ...PathSpec) Option {
+	return func(def *Definition) {
+		def.Paths = append(def.Paths, paths...)
+	}
+}
+
+// WithConfigWatch - reload the executable when its configuration files change,
+// it is stopped if it is not a ConfigReloader
+func WithConfigWatch() Option {
+	return func(def *Definition) {
+		def.WatchConfig = true
+	}
+}
+
+// WithConfigFiles - configuration files which are written by Install, see ConfigFile
+func WithConfigFiles(files ...ConfigFile) Option {
+	return func(def *Definition) {
+		def.ConfigFiles = append(def.ConfigFiles, files...)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import "errors"
+
+// Dependency - common facility which a service needs, it is translated into
+// the name of the unit, facility or script of every init system
+type Dependency string
+
+// Common dependencies of services
+const (
+	// DependencyNetworkOnline - the network is configured and up
+	// (network-online.target, NETWORKING on rc.d)
+	DependencyNetworkOnline Dependency = "network-online"
+
+	// DependencyTimeSync - the clock is synchronized, like WithTimeSync
+	DependencyTimeSync Dependency = "time-sync"
+
+	// DependencySyslog - the system logger accepts messages
+	DependencySyslog Dependency = "syslog"
+
+	// DependencyLocalFS - the local file systems are mounted
+	DependencyLocalFS Dependency = "local-fs"
+
+	// DependencyPostgreSQL - the PostgreSQL server runs
+	DependencyPostgreSQL Dependency = "postgresql"
+
+	// DependencyDocker - the Docker daemon runs
+	DependencyDocker Dependency = "docker"
+
+	// DependencyPodman - the API socket of Podman accepts requests
+	DependencyPodman Dependency = "podman"
+)
+
+// ErrUnknownDependency appears if the definition needs a dependency which is not known
+var ErrUnknownDependency = errors.New("Unknown dependency")
+
+// Names of the dependencies by kind of init system, an empty name means the
+// default template already depends on it or the init system has no equivalent;
+// launchd has no dependencies at all
+var dependencyNames = map[Dependency]map[Kind]string{
+	DependencyNetworkOnline: {
+		KindSystemD: "network-online.target", KindRCD: "NETWORKING",
+	},
+	DependencyTimeSync: {},
+	DependencySyslog: {
+		KindSystemD: "systemd-journald.socket", KindSystemV: "$syslog",
+		KindUpstart: "rsyslog",
+	},
+	DependencyLocalFS: {
+		KindSystemD: "local-fs.target", KindSystemV: "$local_fs", KindRCD: "FILESYSTEMS",
+	},
+	DependencyPostgreSQL: {
+		KindSystemD: "postgresql.service", KindSystemV: "postgresql",
+		KindUpstart: "postgresql", KindRCD: "postgresql",
+	},
+	DependencyDocker: {
+		KindSystemD: "docker.service", KindSystemV: "docker", KindUpstart: "docker",
+		KindWindows: "docker",
+	},
+	DependencyPodman: {KindSystemD: "podman.socket"},
+}
+
+// CommonDependencies - all common dependencies
+func CommonDependencies() []Dependency {
+	return []Dependency{DependencyNetworkOnline, DependencyTimeSync, DependencySyslog,
+		DependencyLocalFS, DependencyPostgreSQL, DependencyDocker, DependencyPodman}
+}
+
+// DependencyName - name of the dependency for the given kind of init system,
+// ok is false if the init system needs nothing for it
+func DependencyName(kind Kind, dependency Dependency) (name string, ok bool) {
+	name = dependencyNames[dependency][kind]
+	return name, name != ""
+}
+
+// Check the dependencies of the definition are known
+func checkNeeds(def *Definition) error {
+	for _, dependency := range def.Needs {
+		if _, ok := dependencyNames[dependency]; !ok {
+			return ErrUnknownDependency
+		}
+	}
+	return nil
+}
+
+// Units which the systemd unit or the Windows service requires, the
+// dependencies of the definition followed by the names of its needs
+func requiredUnits(kind Kind, def *Definition) []string {
+	units := copyStrings(def.Dependencies)
+	if kind != KindSystemD && kind != KindWindows {
+		return units
+	}
+	for _, dependency := range needs(def) {
+		if name, ok := DependencyName(kind, dependency); ok {
+			units = append(units, name)
+		}
+	}
+	return units
+}
+
+// Services and facilities which the service is started after on System V,
+// upstart and rc.d, the After of the definition followed by its needs
+func startAfter(kind Kind, def *Definition) []string {
+	after := copyStrings(def.After)
+	if kind == KindSystemD || kind == KindWindows {
+		return after
+	}
+	for _, dependency := range needs(def) {
+		if name, ok := DependencyName(kind, dependency); ok {
+			after = append(after, name)
+		}
+	}
+	return after
+}
+
+// Common dependencies of the definition, the preset of the services which
+// use containers needs the container engine
+func needs(def *Definition) []Dependency {
+	if def.Preset != PresetContainerClient {
+		return def.Needs
+	}
+	engine := containerEngine(def)
+	for _, dependency := range def.Needs {
+		if dependency == engine {
+			return def.Needs
+		}
+	}
+	return append(append([]Dependency(nil), def.Needs...), engine)
+}
+
+// Container engine of the service: Podman if the definition needs it,
+// Docker otherwise
+func containerEngine(def *Definition) Dependency {
+	for _, dependency := range def.Needs {
+		if dependency == DependencyPodman {
+			return DependencyPodman
+		}
+	}
+	return DependencyDocker
+}
+
+// Unit of the container daemon which the service of PresetContainerClient is
+// bound to, so it stops and starts with the daemon; Podman has no daemon, its
+// API service exits when it is idle
+func bindsTo(def *Definition) string {
+	if def.Preset != PresetContainerClient || containerEngine(def) != DependencyDocker {
+		return ""
+	}
+	return dependencyNames[DependencyDocker][KindSystemD]
+}
+
+// Check the service waits for the synchronized clock
+func needsTimeSync(def *Definition) bool {
+	if def.TimeSync {
+		return true
+	}
+	for _, dependency := range needs(def) {
+		if dependency == DependencyTimeSync {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import "github.com/takama/daemon/autostart"
+
+// Exec key of the autostart entry: the executable with its arguments,
+// the environment is set by env(1), since desktop entries have none
+func desktopExec(kind Kind, def *Definition, path string) string {
+	if kind != KindAutostart {
+		return ""
+	}
+	var args []string
+	if variables := environment(def); len(variables) > 0 {
+		args = append(args, "env")
+		for _, variable := range variables {
+			args = append(args, variable.String())
+		}
+	}
+	args = append(args, path)
+	return autostart.QuoteExec(append(args, def.Args...))
+}
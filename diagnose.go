@@ -0,0 +1,204 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/takama/daemon/systemd"
+)
+
+// Number of the recent log lines or journal entries which are analyzed by Diagnose
+const diagnoseEntries = 100
+
+// Diagnoser interface is implemented by daemons which are able to analyze
+// why the service failed
+type Diagnoser interface {
+	// Diagnose - analysis of the last failure of the service
+	Diagnose() (*Diagnosis, error)
+}
+
+// Diagnosis - analysis of the last failure of a service
+type Diagnosis struct {
+	// Name of the service
+	Name string `json:"name"`
+
+	// State - status of the service as reported by Status
+	State string `json:"state"`
+
+	// Result of the last run reported by systemd, e.g. "exit-code"
+	Result string `json:"result,omitempty"`
+
+	// ExitStatus - exit status of the last main process reported by systemd
+	ExitStatus int `json:"exit_status,omitempty"`
+
+	// Cause - most likely cause of the last failure, empty if none was found
+	Cause string `json:"cause,omitempty"`
+
+	// Findings - problems found by the checks of the service
+	Findings []Finding `json:"findings,omitempty"`
+
+	// Messages - recent warnings and errors of the service
+	Messages []string `json:"messages,omitempty"`
+
+	// Metadata - host and time of the diagnosis
+	Metadata Metadata `json:"metadata"`
+}
+
+// Finding - problem found by a check of Diagnose
+type Finding struct {
+	// Check which found the problem: "state", "executable", "port", "selinux"
+	Check string `json:"check"`
+
+	// Problem - description of the problem
+	Problem string `json:"problem"`
+}
+
+// String - report of the diagnosis
+func (diagnosis *Diagnosis) String() string {
+	cause := diagnosis.Cause
+	if cause == "" {
+		cause = "No failure found"
+	}
+	lines := []string{diagnosis.Name + ": " + cause, diagnosis.Metadata.String(), "State: " + diagnosis.State}
+	if diagnosis.Result != "" {
+		lines = append(lines, "Result: "+diagnosis.Result+", exit status "+strconv.Itoa(diagnosis.ExitStatus))
+	}
+	for _, finding := range diagnosis.Findings {
+		lines = append(lines, "- "+finding.Check+": "+finding.Problem)
+	}
+	if len(diagnosis.Messages) > 0 {
+		lines = append(lines, "Recent messages:")
+		lines = append(lines, diagnosis.Messages...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Known causes of failures by the messages which report them,
+// the first matching pattern wins
+var failureCauses = []struct {
+	pattern *regexp.Regexp
+	cause   string
+}{
+	{regexp.MustCompile(`oom-kill|OOM killer|Out of memory`), "The service was killed by the OOM killer"},
+	{regexp.MustCompile(`status=217/USER|Failed to determine user credentials`), "The user of the service does not exist"},
+	{regexp.MustCompile(`[Pp]ermission denied|status=126|status=203/EXEC: Permission`), "Permission denied, check the permissions of the executable and its files"},
+	{regexp.MustCompile(`status=203/EXEC|Failed to execute|Failed to locate executable|No such file or directory`),
+		"The executable could not be started, check the path in ExecStart"},
+	{regexp.MustCompile(`start-limit-hit|Start request repeated too quickly`), "The service was restarted too often and hit the start rate limit"},
+	{regexp.MustCompile(`[Aa]ddress already in use`), "A port of the service is used by another process"},
+	{regexp.MustCompile(`Main process exited, code=killed, status=(\S+)`), "The service was killed by signal $1"},
+	{regexp.MustCompile(`Main process exited, code=exited, status=(\S+)`), "The service exited with status $1"},
+}
+
+// Most likely cause of a failure reported by the messages,
+// the most recent messages are checked first
+func failureCause(messages []string) string {
+	for _, known := range failureCauses {
+		for i := len(messages) - 1; i >= 0; i-- {
+			if match := known.pattern.FindStringSubmatchIndex(messages[i]); match != nil {
+				return string(known.pattern.ExpandString(nil, known.cause, messages[i], match))
+			}
+		}
+	}
+	return ""
+}
+
+// Correlate the state of the service, its executable, its ports,
+// SELinux denials and its recent messages into a diagnosis
+func (properties *ServiceProperties) diagnose(state string, running bool, messages []string) *Diagnosis {
+	def := &properties.def
+	diagnosis := &Diagnosis{Name: def.Name, State: state, Messages: messages, Metadata: NewMetadata()}
+	if !running {
+		diagnosis.Findings = append(diagnosis.Findings, Finding{"state", state})
+	}
+	path, err := serviceExecutable(def)
+	if err != nil {
+		diagnosis.Findings = append(diagnosis.Findings, Finding{"executable", "executable could not be found: " + err.Error()})
+	} else if problem := checkExecutable(path); problem != "" {
+		diagnosis.Findings = append(diagnosis.Findings, Finding{"executable", problem})
+	}
+	// the ports of a running service are in use by the service itself
+	if !running {
+		for _, port := range def.Ports {
+			if problem := checkPort(port); problem != "" {
+				diagnosis.Findings = append(diagnosis.Findings, Finding{"port", problem})
+			}
+		}
+	}
+	if path != "" {
+		for _, denial := range selinuxDenials(path) {
+			diagnosis.Findings = append(diagnosis.Findings, Finding{"selinux", denial})
+		}
+	}
+	diagnosis.Cause = failureCause(messages)
+	for _, finding := range diagnosis.Findings {
+		if diagnosis.Cause == "" && finding.Check != "state" {
+			diagnosis.Cause = finding.Problem
+		}
+	}
+	return diagnosis
+}
+
+// Recent SELinux denials of the executable found by ausearch,
+// nothing if SELinux auditing is not available
+func selinuxDenials(path string) []string {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+	ausearch, err := lookPath("ausearch")
+	if err != nil {
+		return nil
+	}
+	// ausearch fails if nothing matches
+	output, _ := exec.Command(ausearch, "--message", "AVC,USER_AVC", "--start", "recent",
+		"--executable", path, "--interpret").Output()
+	var denials []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.Contains(line, "denied") {
+			denials = append(denials, strings.TrimSpace(line))
+		}
+	}
+	return denials
+}
+
+// Recent lines of the log files of the service, nothing if it has none
+func (properties *ServiceProperties) recentLogs(kind Kind) []string {
+	logs, err := readLogs(kind, &properties.def, diagnoseEntries)
+	if err != nil || logs == "" {
+		return nil
+	}
+	return strings.Split(logs, "\n")
+}
+
+// Diagnose the systemd unit of the service by its state and its recent journal entries
+func (properties *ServiceProperties) diagnoseUnit(unit *systemd.Unit) (*Diagnosis, error) {
+	values, err := unit.Show("ActiveState", "SubState", "Result", "ExecMainStatus")
+	if err != nil {
+		return nil, err
+	}
+	entries, err := unit.Entries(diagnoseEntries, systemd.PriorityNotice)
+	if err != nil {
+		return nil, err
+	}
+	var messages []string
+	for _, entry := range entries {
+		messages = append(messages, entry.Time.Format("Jan 02 15:04:05")+" "+entry.Message)
+	}
+	state := values["ActiveState"] + " (" + values["SubState"] + ")"
+	diagnosis := properties.diagnose(state, values["ActiveState"] == "active", messages)
+	if result := values["Result"]; result != "" && result != "success" {
+		diagnosis.Result = result
+		diagnosis.ExitStatus, _ = strconv.Atoi(values["ExecMainStatus"])
+		if diagnosis.Cause == "" {
+			diagnosis.Cause = "The service failed with result " + result
+		}
+	}
+	return diagnosis, nil
+}
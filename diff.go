@@ -0,0 +1,164 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Number of unchanged lines shown around every change
+const diffContext = 3
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// Diff - unified diff between the installed service file of the daemon and
+// the one which Install would write with the given arguments, apart from
+// the metadata comments, so the change of an update can be reviewed before
+// it is applied. It is empty if the file is up to date, a service which is
+// not installed shows the whole file as added.
+func Diff(d Daemon, args ...string) (string, error) {
+	renderer, ok := d.(Renderer)
+	if !ok {
+		return "", ErrUnsupportedSystem
+	}
+	content, err := renderer.Render(args...)
+	if err != nil {
+		return "", err
+	}
+	installed, err := ioutil.ReadFile(renderer.ServicePath())
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return UnifiedDiff(renderer.ServicePath(), StripMetadata(string(installed)), StripMetadata(content)), nil
+}
+
+// UnifiedDiff - unified diff between the installed (old) and the rendered
+// (new) content of the named file, or an empty string if both are equal
+func UnifiedDiff(name, old, new string) string {
+	if old == new {
+		return ""
+	}
+	ops := diffLines(splitLines(old), splitLines(new))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s (installed)\n+++ %s (rendered)\n", name, name)
+	for start := 0; start < len(ops); {
+		// find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		// extend the hunk while changes are close to each other
+		end := start
+		for i := start; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				end = i + 1
+			} else if i-end >= 2*diffContext {
+				break
+			}
+		}
+		from, to := start-diffContext, end+diffContext
+		if from < 0 {
+			from = 0
+		}
+		if to > len(ops) {
+			to = len(ops)
+		}
+		writeHunk(&out, ops, from, to)
+		start = to
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, ops []diffOp, from, to int) {
+	oldStart, newStart := 1, 1
+	for _, op := range ops[:from] {
+		if op.kind != '+' {
+			oldStart++
+		}
+		if op.kind != '-' {
+			newStart++
+		}
+	}
+	oldLen, newLen := 0, 0
+	for _, op := range ops[from:to] {
+		if op.kind != '+' {
+			oldLen++
+		}
+		if op.kind != '-' {
+			newLen++
+		}
+	}
+	// an empty range starts at the line before it
+	if oldLen == 0 {
+		oldStart--
+	}
+	if newLen == 0 {
+		newStart--
+	}
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldLen, newStart, newLen)
+	for _, op := range ops[from:to] {
+		fmt.Fprintf(out, "%c%s\n", op.kind, op.line)
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes the edit script between a and b using the longest
+// common subsequence, service files are small enough for a quadratic table
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
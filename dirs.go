@@ -0,0 +1,250 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Default permissions of the created directories
+const defaultDirMode os.FileMode = 0755
+
+// Standard directory of the log files
+const sharedLogDir = "/var/log"
+
+// Directory of the log files of the service for the given kind of init system.
+// The shared log directory is used unless the service runs as another user,
+// such service gets its own directory which it is able to write.
+// On macOS every service has its own directory.
+func logDir(kind Kind, def *Definition) string {
+	switch {
+	case def.LogDir != "":
+		return def.LogDir
+	case userScope(def):
+		return userLogDir(kind, def)
+	case kind == KindLaunchd:
+		return "/usr/local/var/log/" + def.Name
+	case def.User != "":
+		return sharedLogDir + "/" + def.Name
+	}
+	return sharedLogDir
+}
+
+// Directories which are owned by the service, the shared log directory
+// of the system is never included, so its ownership is not changed,
+// the log directory is skipped as well if the service has no log files
+func serviceDirectories(kind Kind, def *Definition) []string {
+	var dirs []string
+	if dir := logDir(kind, def); dir != sharedLogDir && len(logFiles(kind, def)) > 0 {
+		dirs = append(dirs, dir)
+	}
+	if def.StateDir != "" {
+		dirs = append(dirs, def.StateDir)
+	}
+	if def.RuntimeDir != "" {
+		dirs = append(dirs, def.RuntimeDir)
+	}
+	return dirs
+}
+
+// PathSpec - file or directory which is created or fixed by Install
+// and checked by Verify
+type PathSpec struct {
+	// Path - absolute path of the file or the directory
+	Path string `json:"path"`
+
+	// Dir - the path is a directory, it is created with its parents
+	Dir bool `json:"dir,omitempty"`
+
+	// User - owner of the path, empty means the owner is not changed
+	User string `json:"user,omitempty"`
+
+	// Group of the path, empty means the group is not changed
+	Group string `json:"group,omitempty"`
+
+	// Mode - permissions, by default 0755 for directories and 0644 for files
+	Mode os.FileMode `json:"mode,omitempty"`
+}
+
+// VerifyError - differences between the paths of the definition and the host
+type VerifyError struct {
+	Problems []string
+}
+
+func (e *VerifyError) Error() string {
+	return "Verification failed: " + strings.Join(e.Problems, "; ")
+}
+
+// Verifier interface is implemented by daemons which are able to check
+// the files and directories of the service
+type Verifier interface {
+	// Verify - check the paths of the service still have the configured
+	// type, ownership and permissions
+	Verify() error
+}
+
+// Paths of the service: the log, state and runtime directories owned by
+// the service user followed by the paths listed in the definition
+func manifest(kind Kind, def *Definition) []PathSpec {
+	var specs []PathSpec
+	for _, dir := range serviceDirectories(kind, def) {
+		specs = append(specs, PathSpec{Path: dir, Dir: true, User: def.User, Group: def.Group, Mode: def.DirMode})
+	}
+	return append(specs, def.Paths...)
+}
+
+// Permissions of the path, the default ones if they are not set
+func (spec *PathSpec) mode() os.FileMode {
+	switch {
+	case spec.Mode != 0:
+		return spec.Mode
+	case spec.Dir:
+		return defaultDirMode
+	}
+	return 0644
+}
+
+// Create the directories and the files of the service with the configured
+// mode and ownership, existing ones are fixed. It is done on Install and
+// again on Start, since runtime directories usually do not survive a reboot.
+func (properties *ServiceProperties) applyManifest(kind Kind) error {
+	for _, spec := range manifest(kind, &properties.def) {
+		if offline() {
+			// the accounts of the image are unknown on the host,
+			// the ownership is applied by Start on the booted image
+			spec.Path, spec.User, spec.Group = rooted(spec.Path), "", ""
+		}
+		if err := spec.apply(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (spec *PathSpec) apply() error {
+	mode := spec.mode()
+	if spec.Dir {
+		if err := os.MkdirAll(spec.Path, mode); err != nil {
+			return err
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(spec.Path), defaultDirMode); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(spec.Path, os.O_WRONLY|os.O_CREATE, mode)
+		if err != nil {
+			return err
+		}
+		file.Close()
+	}
+	if err := os.Chmod(spec.Path, mode); err != nil {
+		return err
+	}
+	uid, gid, err := lookupOwner(spec.User, spec.Group)
+	if err != nil {
+		return err
+	}
+	if uid >= 0 || gid >= 0 {
+		return os.Chown(spec.Path, uid, gid)
+	}
+	return nil
+}
+
+// Verify - check the paths of the definition for the given kind of init system
+// exist with the configured type, ownership and permissions, the installed
+// executable has the checksum which was recorded by Install and the
+// configuration files have the content of the definition.
+// It returns a *VerifyError which lists all found problems.
+func Verify(kind Kind, def *Definition) error {
+	var problems []string
+	for _, spec := range manifest(kind, def) {
+		problems = append(problems, spec.verify()...)
+	}
+	problems = append(problems, verifyInstalledBinary(def)...)
+	problems = append(problems, verifyConfigFiles(kind, def)...)
+	if len(problems) > 0 {
+		return &VerifyError{Problems: problems}
+	}
+	return nil
+}
+
+func (spec *PathSpec) verify() []string {
+	info, err := os.Stat(spec.Path)
+	if err != nil {
+		return []string{spec.Path + " does not exist"}
+	}
+	var problems []string
+	if spec.Dir != info.IsDir() {
+		if spec.Dir {
+			problems = append(problems, spec.Path+" is not a directory")
+		} else {
+			problems = append(problems, spec.Path+" is a directory")
+		}
+	}
+	if mode := spec.mode(); info.Mode().Perm() != mode.Perm() {
+		problems = append(problems, spec.Path+" has mode "+info.Mode().Perm().String()+
+			" instead of "+mode.Perm().String())
+	}
+	uid, gid, err := lookupOwner(spec.User, spec.Group)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+	if owner, group, ok := fileOwner(info); ok {
+		if uid >= 0 && uid != owner {
+			problems = append(problems, spec.Path+" is not owned by "+spec.User)
+		}
+		if gid >= 0 && gid != group {
+			problems = append(problems, spec.Path+" does not belong to "+groupOf(spec))
+		}
+	}
+	return problems
+}
+
+// Name of the expected group of the path, the primary group of the user if it is not set
+func groupOf(spec *PathSpec) string {
+	if spec.Group != "" {
+		return "group " + spec.Group
+	}
+	return "the primary group of " + spec.User
+}
+
+// Numeric ids of the user and the group, -1 means the id is not changed.
+// Names and numeric ids are accepted, an empty group means the primary
+// group of the user.
+func lookupOwner(userName, groupName string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	if userName != "" {
+		if uid, err = strconv.Atoi(userName); err != nil {
+			account, err := user.Lookup(userName)
+			if err != nil {
+				return -1, -1, err
+			}
+			if uid, err = strconv.Atoi(account.Uid); err != nil {
+				return -1, -1, err
+			}
+			if groupName == "" {
+				if gid, err = strconv.Atoi(account.Gid); err != nil {
+					return -1, -1, err
+				}
+			}
+		}
+	}
+	if groupName != "" {
+		if gid, err = strconv.Atoi(groupName); err != nil {
+			group, err := user.LookupGroup(groupName)
+			if err != nil {
+				return -1, -1, err
+			}
+			if gid, err = strconv.Atoi(group.Gid); err != nil {
+				return -1, -1, err
+			}
+		}
+	}
+	return uid, gid, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+// EnableChecker interface is implemented by daemons which are able to tell
+// whether the installed service is started at boot
+type EnableChecker interface {
+	// IsEnabled - check the service is started at boot (at the login of
+	// the users for a user service), ErrNotInstalled if it is not installed
+	IsEnabled() (bool, error)
+}
+
+// IsEnabled - check the service of the daemon is started at boot, a service
+// which is installed but not enabled has to be started by hand
+func IsEnabled(d Daemon) (bool, error) {
+	if checker, ok := d.(EnableChecker); ok {
+		return checker.IsEnabled()
+	}
+	return false, ErrUnsupportedSystem
+}
+
+// FailureResetter interface is implemented by daemons whose init system
+// keeps the failed state of a service (systemd)
+type FailureResetter interface {
+	// ResetFailed - clear the failed state and the restart counter of the
+	// service, ErrNotInstalled if it is not installed
+	ResetFailed() error
+}
+
+// ResetFailed - clear the failed state and the restart counter of the service
+// of the daemon (systemctl reset-failed), so a start is not refused by the
+// start limit of the unit after it failed too often; a service which has not
+// failed is left as it is
+func ResetFailed(d Daemon) error {
+	if resetter, ok := d.(FailureResetter); ok {
+		return resetter.ResetFailed()
+	}
+	return ErrUnsupportedSystem
+}
+
+// Enabler interface is implemented by daemons which are able to enable and
+// disable the installed service at boot
+type Enabler interface {
+	// Enable - start the installed service at boot (at the login of the
+	// users for a user service), ErrNotInstalled if it is not installed
+	Enable() error
+
+	// Disable - keep the installed service from starting at boot, it
+	// stays installed; ErrNotInstalled if it is not installed
+	Disable() error
+}
+
+// Enable - start the installed service of the daemon at boot: the systemd
+// unit is enabled, the runlevel links of the System V script are created,
+// the "manual" override of the upstart job and the disabled override of the
+// launchd job are removed, <name>_enable is set in rc.conf, the Windows
+// service starts automatically and the autostart entry is not hidden. The
+// companion units of systemd (Also=) and the cron entry of the timer on
+// the other init systems are enabled with the service.
+func Enable(d Daemon) error {
+	if enabler, ok := d.(Enabler); ok {
+		return enabler.Enable()
+	}
+	return ErrUnsupportedSystem
+}
+
+// Disable - keep the installed service of the daemon from starting at boot,
+// it is started by hand (Start) only, neither by its sockets nor by its timer;
+// on macOS launchd does not load a disabled job at all, Start fails with
+// ErrDisabled until it is enabled again
+func Disable(d Daemon) error {
+	if enabler, ok := d.(Enabler); ok {
+		return enabler.Disable()
+	}
+	return ErrUnsupportedSystem
+}
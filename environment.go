@@ -0,0 +1,42 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import "sort"
+
+// EnvironmentVariable - variable of the environment of the service process
+type EnvironmentVariable struct {
+	Name  string
+	Value string
+}
+
+// String - the variable as "NAME=value"
+func (variable EnvironmentVariable) String() string {
+	return variable.Name + "=" + variable.Value
+}
+
+// Environment of the service sorted by the names, so rendered
+// service files do not change between the runs
+func environment(def *Definition) []EnvironmentVariable {
+	names := make([]string, 0, len(def.Environment))
+	for name := range def.Environment {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	variables := make([]EnvironmentVariable, len(names))
+	for i, name := range names {
+		variables[i] = EnvironmentVariable{name, def.Environment[name]}
+	}
+	return variables
+}
+
+// Environment as "NAME=value" strings
+func environmentList(def *Definition) []string {
+	var list []string
+	for _, variable := range environment(def) {
+		list = append(list, variable.String())
+	}
+	return list
+}
@@ -0,0 +1,77 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/takama/daemon/internal/tools"
+	"github.com/takama/daemon/systemd"
+)
+
+// ErrNotAuthorized appears if polkit refused an operation or the user
+// dismissed the authentication dialog
+var ErrNotAuthorized = systemd.ErrNotAuthorized
+
+// Escalation - how the operations on the system services of systemd are
+// authorized when the process is not root, e.g. a desktop application
+// which manages its helper daemon
+type Escalation int
+
+const (
+	// EscalateNone - the operations need root privileges, the default
+	EscalateNone Escalation = iota
+
+	// EscalatePolkit - Start, Stop and Status run as the user, the manager
+	// authorizes them by polkit over D-Bus (org.freedesktop.systemd1.manage-units)
+	// and the agent of the desktop session shows the authentication dialog
+	EscalatePolkit
+
+	// EscalatePkexec - like EscalatePolkit, but the systemctl commands which
+	// change the manager run as root by pkexec (org.freedesktop.policykit.exec),
+	// for hosts whose polkit rules only allow administrators to run programs
+	EscalatePkexec
+)
+
+// escalation - the configured escalation of the process
+var escalation = EscalateNone
+
+// SetEscalation - authorize the operations on the system services by polkit
+// when the process is not root (linux hosts with systemd). Install and Remove
+// write the files of the service and still need root, RunElevated runs them.
+// Directories of the service which Start would create (see PathSpec) are left
+// to Install then, runtime directories below /run are declared by the unit.
+func SetEscalation(e Escalation) {
+	escalation = e
+	systemd.Pkexec = e == EscalatePkexec
+}
+
+// Check the operations are authorized by polkit instead of root privileges
+func escalated() bool {
+	return escalation != EscalateNone && !offline() && os.Geteuid() != 0
+}
+
+// RunElevated - run the executable of the process again as root by pkexec
+// with the arguments and wait for it, e.g. RunElevated("install") by a desktop
+// application whose helper daemon handles the install command like the examples.
+// Polkit shows the authentication dialog; ErrNotAuthorized is returned if it was
+// dismissed or refused. pkexec clears the environment of the command.
+func RunElevated(args ...string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := tools.Command("pkexec", append([]string{executable}, args...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if code := exitErr.ExitCode(); code == 126 || code == 127 {
+			return ErrNotAuthorized
+		}
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ExitFailure - exit status of a service whose run failed with an error
+// which carries no exit status (EXIT_FAILURE)
+const ExitFailure = 1
+
+// ErrorRunner interface may be implemented by an Executable whose run can
+// fail: Run calls RunE instead of Run and, if it returns an error, the
+// process exits with the exit status of the error (see ExitCode) once Run
+// has cleaned up, so Restart=on-failure and the monitoring of the init
+// system tell a failure from a clean exit
+type ErrorRunner interface {
+	RunE() error
+}
+
+// ExitCoder interface may be implemented by the errors of RunE to choose
+// the exit status of the process, e.g. *exec.ExitError of a child process
+type ExitCoder interface {
+	ExitCode() int
+}
+
+// ExitError - error of RunE with the exit status of the process,
+// e.g. 78 (EX_CONFIG of sysexits.h) for a broken configuration
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return "Service exited with status " + strconv.Itoa(e.Code)
+	}
+	return e.Err.Error()
+}
+
+// ExitCode - the exit status of the process
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// Unwrap - the error of the run
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode - exit status of the process for the error of a run: 0 if it
+// succeeded, ExitPanic if the executable panicked, the status of an
+// ExitCoder in the chain of the error, ExitFailure otherwise
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		switch e := e.(type) {
+		case *PanicError:
+			return ExitPanic
+		case ExitCoder:
+			if code := e.ExitCode(); code > 0 {
+				return code
+			}
+		}
+	}
+	return ExitFailure
+}
+
+// Run the executable, by RunE if it implements ErrorRunner; the failure
+// is reported to systemd (STATUS= and ERRNO=) and the process exits with
+// its exit status by exit
+func (guard *crashGuard) run(e Executable) error {
+	runner, ok := e.(ErrorRunner)
+	if !ok {
+		return guard.call(e.Run)
+	}
+	err := guard.callError(runner.RunE)
+	if _, panicked := err.(*PanicError); err == nil || panicked {
+		return err
+	}
+	guard.failure = err
+	diagnostics.Println("Service", guard.service, "failed:", err)
+	state := "STATUS=Failed: " + strings.Replace(err.Error(), "\n", " ", -1)
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if errno, ok := e.(syscall.Errno); ok {
+			state += "\nERRNO=" + strconv.Itoa(int(errno))
+			break
+		}
+	}
+	notifySystemd(state)
+	return err
+}
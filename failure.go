@@ -0,0 +1,147 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/takama/daemon/systemd"
+)
+
+// Check the definition has a failure notification (webhook or mail)
+func hasFailureHook(def *Definition) bool {
+	return def.FailureWebhook != "" || def.FailureMail != ""
+}
+
+// Check the failure notifications can be sent: the mail is a single
+// address on one line, it is written into the headers of the mail, and
+// the webhook is an http or https URL
+func checkFailureHooks(def *Definition) error {
+	if def.FailureMail != "" {
+		if strings.ContainsAny(def.FailureMail, "\x00\n\r") {
+			return &InputError{Input: "failure_mail", Reason: strconv.Quote(def.FailureMail) + " contains a line break or a NUL"}
+		}
+		if _, err := mail.ParseAddress(def.FailureMail); err != nil {
+			return &InputError{Input: "failure_mail", Reason: err.Error()}
+		}
+	}
+	if def.FailureWebhook != "" {
+		webhook, err := url.Parse(def.FailureWebhook)
+		if err != nil {
+			return &InputError{Input: "failure_webhook", Reason: err.Error()}
+		}
+		if webhook.Scheme != "http" && webhook.Scheme != "https" || webhook.Host == "" {
+			return &InputError{Input: "failure_webhook", Reason: strconv.Quote(def.FailureWebhook) + " is not an http or https URL"}
+		}
+	}
+	return nil
+}
+
+// Companion unit which sends the failure notifications of a systemd service
+func failureUnit(def *Definition) *systemd.Unit {
+	return systemd.New(def.Name + "-failure")
+}
+
+// Units which are activated when the service enters the failed state,
+// the companion unit of the failure notifications included
+func onFailureUnits(def *Definition) List {
+	units := List(copyStrings(def.OnFailure))
+	if hasFailureHook(def) {
+		units = append(units, failureUnit(def).Name)
+	}
+	return units
+}
+
+// Render the companion unit of the failure notifications
+func renderFailureUnit(def *Definition) (string, error) {
+	if err := checkFailureHooks(def); err != nil {
+		return "", err
+	}
+	templ, err := template.New("failure").Funcs(templateFuncs).Parse(failureUnitConfig)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := templ.Execute(&buf, &struct {
+		*Definition
+		Metadata Metadata
+	}{def, NewMetadata()}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Write the companion unit of the failure notifications, if it is needed
+func installFailureUnit(def *Definition) error {
+	if !hasFailureHook(def) {
+		return nil
+	}
+	content, err := renderFailureUnit(def)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(rooted(failureUnit(def).Path()))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(content)
+	return err
+}
+
+// Remove the companion unit of the failure notifications
+func removeFailureUnit(def *Definition) error {
+	if err := os.Remove(rooted(failureUnit(def).Path())); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// NotifyFailure - send the failure notifications of the definition:
+// the webhook receives a form POST with the service, host and message fields,
+// the mail is sent by sendmail. On systemd the notifications are sent by
+// the init system itself, on the other systems the executable may call it
+// when it fails.
+func NotifyFailure(def *Definition, message string) error {
+	if err := checkFailureHooks(def); err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	var firstErr error
+	if def.FailureWebhook != "" {
+		client := &http.Client{Timeout: 30 * time.Second}
+		response, err := client.PostForm(def.FailureWebhook, url.Values{
+			"service": {def.Name},
+			"host":    {host},
+			"message": {message},
+		})
+		if err == nil {
+			response.Body.Close()
+			if response.StatusCode >= 300 {
+				err = errors.New("Failure webhook returned " + response.Status)
+			}
+		}
+		firstErr = err
+	}
+	if def.FailureMail != "" {
+		cmd := exec.Command("sendmail", "-t")
+		cmd.Stdin = strings.NewReader("To: " + def.FailureMail + "\n" +
+			"Subject: " + def.Name + " failed on " + host + "\n\n" + message + "\n")
+		if err := cmd.Run(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,18 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package daemon
+
+import (
+	"os"
+	"syscall"
+)
+
+// Create a FIFO with the permissions, the umask applies
+func mkfifo(path string, mode os.FileMode) error {
+	return syscall.Mkfifo(path, uint32(mode.Perm()))
+}
@@ -0,0 +1,12 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import "os"
+
+// Windows has no FIFOs, the control channel uses a unix socket
+func mkfifo(path string, mode os.FileMode) error {
+	return ErrUnsupportedSystem
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Directories of the local preset files of systemd, of the system
+// and of the user services
+const (
+	PresetDir     = "/etc/systemd/system-preset/"
+	UserPresetDir = "/etc/systemd/user-preset/"
+)
+
+// Machine ID which identifies the host, a golden image has none yet
+const machineIDPath = "/etc/machine-id"
+
+// PresetPath - path of the preset file of the service, see EnableByPreset
+func PresetPath(def *Definition) string {
+	dir := PresetDir
+	if userScope(def) {
+		dir = UserPresetDir
+	}
+	return dir + "50-" + def.Name + ".preset"
+}
+
+// IsFirstBoot - the machine has not booted yet: its machine ID (of the
+// offline image under PathPrefix) is missing, empty or "uninitialized", as
+// in a golden image. systemd applies the presets at such a boot, and the
+// services with FirstBoot run once.
+func IsFirstBoot() bool {
+	content, err := ioutil.ReadFile(rooted(machineIDPath))
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	id := strings.TrimSpace(string(content))
+	return id == "" || id == "uninitialized"
+}
+
+// Check the init system knows the first boot of the machine and enables
+// the services by presets: systemd only
+func checkFirstBoot(kind Kind, def *Definition) error {
+	if kind == KindSystemD {
+		return nil
+	}
+	if def.FirstBoot {
+		return &UnsupportedOptionError{"first_boot", kind}
+	}
+	if def.EnableByPreset {
+		return &UnsupportedOptionError{"enable_by_preset", kind}
+	}
+	return nil
+}
+
+// Write the preset file which enables the service when systemd applies
+// the presets, instead of the links of the enabled unit
+func installPreset(def *Definition) error {
+	path := rooted(PresetPath(def))
+	if err := os.MkdirAll(filepath.Dir(path), defaultDirMode); err != nil {
+		return err
+	}
+	content := "# " + managedMarker + "\n# " + NewMetadata().String() + "\nenable " + def.Name + ".service\n"
+	return ioutil.WriteFile(path, []byte(content), 0644)
+}
+
+// Remove the preset file of the service, a file of the same name
+// which was not written by the package is kept
+func removePreset(def *Definition) error {
+	content, err := ioutil.ReadFile(rooted(PresetPath(def)))
+	if err != nil || !strings.Contains(string(content), managedMarker) {
+		return nil
+	}
+	return os.Remove(rooted(PresetPath(def)))
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import "strings"
+
+// Steps of the install flows which follow the installation
+const (
+	StepInstall = "install"
+	StepEnable  = "enable"
+	StepDisable = "disable"
+	StepStart   = "start"
+)
+
+// RollbackError - a step of an install flow failed after the service was
+// installed, or Install failed after it wrote a part of the service, so the
+// service was stopped and removed again; errors.Is matches the error of the step
+type RollbackError struct {
+	// Step - the step which failed, StepInstall, StepEnable, StepDisable or StepStart
+	Step string
+
+	// Err - error of the step
+	Err error
+
+	// Rollback - error of the rollback, nil if the service was removed
+	Rollback error
+}
+
+func (e *RollbackError) Error() string {
+	text := "Install was rolled back, " + e.Step + " failed: " + e.Err.Error()
+	if e.Rollback != nil {
+		text += "; the rollback failed: " + e.Rollback.Error()
+	}
+	return text
+}
+
+// Unwrap - the error of the step
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// InstallOnly - install the service without enabling it at boot and without
+// starting it, whatever the init system does on Install; it is started by hand
+func InstallOnly(d Daemon, args ...string) (string, error) {
+	return installFlow(d, args, false, false)
+}
+
+// InstallAndEnable - install the service and enable it at boot, it is
+// not started before the next boot or a Start
+func InstallAndEnable(d Daemon, args ...string) (string, error) {
+	return installFlow(d, args, true, false)
+}
+
+// InstallEnableStart - install the service, enable it at boot and start it
+func InstallEnableStart(d Daemon, args ...string) (string, error) {
+	return installFlow(d, args, true, true)
+}
+
+// Install the service, enable or disable it and start it; if Install fails
+// after it wrote the service file or a step after the installation fails,
+// the service is stopped and removed again and *RollbackError is returned.
+// The results of the steps are returned by lines.
+func installFlow(d Daemon, args []string, enable, start bool) (string, error) {
+	status, err := d.Install(args...)
+	if err != nil {
+		if err == ErrAlreadyInstalled {
+			return status, err
+		}
+		// the service file and the files which were written before the
+		// failure are removed, so the next Install starts over
+		if _, statusErr := StatusOf(d); statusErr != ErrNotInstalled {
+			return status, rollback(d, StepInstall, err)
+		}
+		return status, err
+	}
+	results := []string{status}
+
+	description := ""
+	if properties, ok := Properties(d); ok {
+		description = properties.Description()
+	}
+	step, action, change := StepDisable, message(MessageDisable, description), Disable
+	if enable {
+		step, action, change = StepEnable, message(MessageEnable, description), Enable
+	}
+	if err := change(d); err != nil {
+		results = append(results, failed(action))
+		return strings.Join(results, "\n"), rollback(d, step, err)
+	}
+	results = append(results, succeeded(action))
+
+	if start {
+		status, err := d.Start()
+		results = append(results, status)
+		if err != nil && err != ErrAlreadyRunning {
+			return strings.Join(results, "\n"), rollback(d, StepStart, err)
+		}
+	}
+	return strings.Join(results, "\n"), nil
+}
+
+// Stop and remove the service which was installed by a failed install flow
+func rollback(d Daemon, step string, err error) error {
+	return &RollbackError{Step: step, Err: err, Rollback: removeService(d)}
+}
@@ -0,0 +1,79 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"testing"
+)
+
+// Daemon whose Install fails after the service file was written,
+// unless it fails at rendering
+type failingInstall struct {
+	installed bool
+	render    bool
+	removed   int
+}
+
+var errReload = errors.New("reload failed")
+
+func (d *failingInstall) Install(args ...string) (string, error) {
+	if d.installed {
+		return failed("Install"), ErrAlreadyInstalled
+	}
+	if d.render {
+		return failed("Install"), errors.New("render failed")
+	}
+	d.installed = true
+	return failed("Install"), errReload
+}
+
+func (d *failingInstall) Remove() (string, error) {
+	if !d.installed {
+		return failed("Remove"), ErrNotInstalled
+	}
+	d.installed = false
+	d.removed++
+	return succeeded("Remove"), nil
+}
+
+func (d *failingInstall) Start() (string, error) { return succeeded("Start"), nil }
+
+func (d *failingInstall) Stop() (string, error) { return failed("Stop"), ErrAlreadyStopped }
+
+func (d *failingInstall) Status() (string, error) {
+	if !d.installed {
+		return "", ErrNotInstalled
+	}
+	return "Service is stopped", nil
+}
+
+func (d *failingInstall) Run(e Executable) (string, error) { return "", nil }
+
+func TestInstallFlowRollback(t *testing.T) {
+	d := &failingInstall{}
+	_, err := InstallEnableStart(d)
+	var rollback *RollbackError
+	if !errors.As(err, &rollback) || rollback.Step != StepInstall || !errors.Is(err, errReload) {
+		t.Fatalf("InstallEnableStart() error = %v, want the rollback of the install", err)
+	}
+	if d.installed || d.removed != 1 || rollback.Rollback != nil {
+		t.Errorf("the partly installed service was not removed: %v", rollback.Rollback)
+	}
+	// the next attempt installs the service again
+	if _, err := InstallEnableStart(d); errors.Is(err, ErrAlreadyInstalled) {
+		t.Errorf("second InstallEnableStart() error = %v", err)
+	}
+
+	// nothing is removed if Install failed before it wrote the service
+	d = &failingInstall{render: true}
+	if _, err := InstallEnableStart(d); err == nil || errors.As(err, &rollback) || d.removed != 0 {
+		t.Errorf("InstallEnableStart() error = %v, removed %d times, want the render error", err, d.removed)
+	}
+	d = &failingInstall{installed: true}
+	if _, err := InstallEnableStart(d); err != ErrAlreadyInstalled || !d.installed {
+		t.Errorf("InstallEnableStart() of an installed service error = %v, want ErrAlreadyInstalled", err)
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment of a process which gets listeners from its predecessor
+// and of a process which is started by systemd socket activation
+const (
+	envListenFDs        = "DAEMON_LISTEN_FDS"
+	envReadyFD          = "DAEMON_READY_FD"
+	envSystemdListenFDs = "LISTEN_FDS"
+	envSystemdListenPID = "LISTEN_PID"
+	envSystemdFDNames   = "LISTEN_FDNAMES"
+	envNotifySocket     = "NOTIFY_SOCKET"
+
+	// first file descriptor which is passed to a child process
+	firstFD = 3
+)
+
+var (
+	// ErrUpgradeFailed appears if the new process exits before it is ready
+	ErrUpgradeFailed = errors.New("New process has exited before it was ready")
+
+	// ErrUpgradeTimeout appears if the new process is not ready in time, it is killed
+	ErrUpgradeTimeout = errors.New("New process was not ready in time")
+)
+
+// InheritedSocket - socket which is inherited from systemd socket
+// activation or from the previous process, a listener of a stream socket
+// or the connection of a datagram socket
+type InheritedSocket struct {
+	// Name - name of the socket section of the socket (FileDescriptorName=
+	// of systemd, passed by LISTEN_FDNAMES), empty if it has none
+	Name string
+
+	// Listener - listener of a stream socket, nil for a datagram socket
+	Listener net.Listener
+
+	// PacketConn - connection of a datagram socket, nil for a stream socket
+	PacketConn net.PacketConn
+}
+
+// Close the socket
+func (socket *InheritedSocket) Close() error {
+	if socket.Listener != nil {
+		return socket.Listener.Close()
+	}
+	return socket.PacketConn.Close()
+}
+
+// Listeners - listeners which are inherited from the previous process
+// (see Upgrade) or from systemd socket activation, in the order they were
+// passed. It returns no listeners if the process has not inherited any.
+func Listeners() ([]net.Listener, error) {
+	files, _, err := inheritedFiles()
+	if err != nil {
+		return nil, err
+	}
+	defer closeFiles(files)
+	listeners := make([]net.Listener, 0, len(files))
+	for _, file := range files {
+		listener, err := net.FileListener(file)
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// InheritedSockets - sockets which are inherited from systemd socket
+// activation or from the previous process (see Upgrade), in the order they
+// were passed, labeled by the names of their socket sections, so a service
+// with several sockets tells them apart; the datagram sockets are returned
+// as well. It returns no sockets if the process has not inherited any.
+func InheritedSockets() ([]InheritedSocket, error) {
+	files, names, err := inheritedFiles()
+	if err != nil {
+		return nil, err
+	}
+	defer closeFiles(files)
+	sockets := make([]InheritedSocket, 0, len(files))
+	for i, file := range files {
+		socket := InheritedSocket{Name: names[i]}
+		if socket.Listener, err = net.FileListener(file); err != nil {
+			socket.PacketConn, err = net.FilePacketConn(file)
+		}
+		if err != nil {
+			for i := range sockets {
+				sockets[i].Close()
+			}
+			return nil, err
+		}
+		sockets = append(sockets, socket)
+	}
+	return sockets, nil
+}
+
+// Files of the inherited sockets and their names, the environment which
+// passed them is cleared, so child processes do not take them again
+func inheritedFiles() ([]*os.File, []string, error) {
+	count := os.Getenv(envListenFDs)
+	var fdNames string
+	if count != "" {
+		os.Unsetenv(envListenFDs)
+	} else if os.Getenv(envSystemdListenPID) == strconv.Itoa(os.Getpid()) {
+		count = os.Getenv(envSystemdListenFDs)
+		fdNames = os.Getenv(envSystemdFDNames)
+		os.Unsetenv(envSystemdListenFDs)
+		os.Unsetenv(envSystemdListenPID)
+		os.Unsetenv(envSystemdFDNames)
+	}
+	if count == "" {
+		return nil, nil, nil
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return nil, nil, err
+	}
+	names := make([]string, n)
+	if labels := strings.Split(fdNames, ":"); fdNames != "" && len(labels) == n {
+		for i, label := range labels {
+			// systemd names the sockets without a name by their unit
+			if label != "unknown" && !strings.HasSuffix(label, ".socket") {
+				names[i] = label
+			}
+		}
+	}
+	files := make([]*os.File, 0, n)
+	for fd := firstFD; fd < firstFD+n; fd++ {
+		files = append(files, os.NewFile(uintptr(fd), "listener"+strconv.Itoa(fd)))
+	}
+	return files, names, nil
+}
+
+// Close the files of the inherited sockets, the listeners and connections
+// have their own duplicates
+func closeFiles(files []*os.File) {
+	for _, file := range files {
+		file.Close()
+	}
+}
+
+// Upgrade - start a new copy of the executable (usually just replaced by
+// a new version) with the same arguments, pass the listeners to it and
+// wait until it calls Ready. After that the caller should stop accepting
+// connections, drain the open ones and exit.
+//
+// The new process gets the listeners by Listeners. A systemd service must
+// have Upgrade set in its definition, so systemd accepts the new main
+// process. Passing listeners is not supported on windows.
+func Upgrade(timeout time.Duration, listeners ...net.Listener) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	var files []*os.File
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for _, listener := range listeners {
+		filer, ok := listener.(interface {
+			File() (*os.File, error)
+		})
+		if !ok {
+			return errors.New("Listener " + listener.Addr().String() + " can not be passed")
+		}
+		file, err := filer.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+	}
+	ready, notify, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(files, notify)
+	cmd.Env = append(handoffEnviron(),
+		envListenFDs+"="+strconv.Itoa(len(files)),
+		envReadyFD+"="+strconv.Itoa(firstFD+len(files)),
+	)
+	err = cmd.Start()
+	notify.Close()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		if _, err := ready.Read(buf); err != nil {
+			done <- ErrUpgradeFailed
+			return
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			cmd.Wait()
+			return err
+		}
+		return cmd.Process.Release()
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return ErrUpgradeTimeout
+	}
+}
+
+// Ready - report the process is ready to serve: to the previous process
+// which waits in Upgrade, to systemd (READY=1 and MAINPID), if the
+// service is run by systemd, and by the ready file (see ReadyFile),
+// if the service is run by Run on another init system
+func Ready() error {
+	if path := os.Getenv(envReadyFile); path != "" {
+		if err := touch(path); err != nil {
+			return err
+		}
+	}
+	if fd := os.Getenv(envReadyFD); fd != "" {
+		os.Unsetenv(envReadyFD)
+		n, err := strconv.Atoi(fd)
+		if err != nil {
+			return err
+		}
+		file := os.NewFile(uintptr(n), "ready")
+		_, err = file.Write([]byte{1})
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return notifySystemd("READY=1\nMAINPID=" + strconv.Itoa(os.Getpid()))
+}
+
+// Send the state to the notification socket of systemd (sd_notify),
+// nothing is sent if the service is not run by systemd
+func notifySystemd(state string) error {
+	socket := os.Getenv(envNotifySocket)
+	if socket == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// Environment of the current process without the variables of the handoff
+func handoffEnviron() []string {
+	var env []string
+	for _, variable := range os.Environ() {
+		switch {
+		case strings.HasPrefix(variable, envListenFDs+"="),
+			strings.HasPrefix(variable, envReadyFD+"="),
+			strings.HasPrefix(variable, envSystemdListenFDs+"="),
+			strings.HasPrefix(variable, envSystemdListenPID+"="),
+			strings.HasPrefix(variable, envSystemdFDNames+"="):
+			continue
+		}
+		env = append(env, variable)
+	}
+	return env
+}
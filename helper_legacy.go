@@ -14,12 +14,6 @@ import (
 	"strings"
 )
 
-// Service constants
-const (
-	success = "\t\t\t\t\t[  \033[32mOK\033[0m  ]" // Show colored "OK"
-	failed  = "\t\t\t\t\t[\033[31mFAILED\033[0m]" // Show colored "FAILED"
-)
-
 var (
 	// ErrUnsupportedSystem appears if try to use service on system which is not supported by this release
 	ErrUnsupportedSystem = errors.New("Unsupported system")
@@ -38,6 +32,9 @@ var (
 
 	// ErrAlreadyStopped appears if try to stop already stopped service
 	ErrAlreadyStopped = errors.New("Service has already been stopped")
+
+	// ErrDisabled appears if try to start service which is disabled, e.g. by a configuration profile
+	ErrDisabled = errors.New("Service is disabled")
 )
 
 // ExecPath tries to get executable path
@@ -45,16 +42,6 @@ func ExecPath() (string, error) {
 	return execPath()
 }
 
-// Lookup path for executable file
-func executablePath(name string) (string, error) {
-	if path, err := exec.LookPath(name); err == nil {
-		if _, err := os.Stat(path); err == nil {
-			return path, nil
-		}
-	}
-	return execPath()
-}
-
 // Check root rights to use system service
 func checkPrivileges() (bool, error) {
 
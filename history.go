@@ -0,0 +1,108 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// HistoryLimit - count of the last operations which the history of
+// a service keeps, 0 keeps no history
+var HistoryLimit = 50
+
+// HistoryEntry - operation of the package on a service
+type HistoryEntry struct {
+	// Time when the operation finished
+	Time time.Time `json:"time"`
+
+	// Action - translated message of the operation, e.g. "Starting My Service:"
+	Action string `json:"action"`
+
+	// OK - the operation succeeded
+	OK bool `json:"ok"`
+
+	// TraceID - correlation ID of the operation, empty if it was not traced
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// HistoryPath - path of the history of the operations on the service
+func HistoryPath(def *Definition) string {
+	if userScope(def) {
+		dir, _ := os.UserConfigDir()
+		return filepath.Join(dir, "daemon", def.Name, "history.json")
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), def.Name, "history.json")
+	}
+	return rooted("/var/lib/daemon/" + def.Name + "/history.json")
+}
+
+// History - the last operations of the package on the service of the daemon
+// (installs, removals, starts, stops, runs and their failures), the oldest
+// first, so support can reconstruct what an installer did on a host; it is
+// empty if the package has not operated on the service yet
+func History(d Daemon) ([]HistoryEntry, error) {
+	properties, ok := Properties(d)
+	if !ok {
+		return nil, ErrUnsupportedSystem
+	}
+	return readHistory(HistoryPath(&properties.def))
+}
+
+// Entries of the history file, none if it does not exist
+func readHistory(path string) ([]HistoryEntry, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []HistoryEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Append the operation to the history of the service, the oldest entries
+// beyond HistoryLimit are dropped. The history is best effort: a process
+// which may not write it, e.g. the service running as its own user, keeps
+// no history.
+func (properties *ServiceProperties) record(action string, ok bool) {
+	if HistoryLimit <= 0 {
+		return
+	}
+	path := HistoryPath(&properties.def)
+	entries, err := readHistory(path)
+	if err != nil {
+		// a damaged history is started again
+		entries = nil
+	}
+	entries = append(entries, HistoryEntry{Time: time.Now(), Action: action, OK: ok, TraceID: properties.traceID})
+	if len(entries) > HistoryLimit {
+		entries = entries[len(entries)-HistoryLimit:]
+	}
+	content, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	temporary := path + ".tmp"
+	if err := ioutil.WriteFile(temporary, content, 0644); err != nil {
+		os.Remove(temporary)
+		return
+	}
+	if err := os.Rename(temporary, path); err != nil {
+		os.Remove(temporary)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Host variables which the arguments and the environment of the service
+// may reference as %{name}, they are resolved when the service is installed,
+// so one definition fits hosts of different sizes and addresses
+const (
+	// HostVariableHostname - name of the host
+	HostVariableHostname = "hostname"
+
+	// HostVariableIP - primary IP address of the host, the first global
+	// IPv4 address of its interfaces, an IPv6 address if it has none
+	HostVariableIP = "ip"
+
+	// HostVariableCPUs - count of the logical CPUs of the host
+	HostVariableCPUs = "cpus"
+)
+
+// Reference of a host variable, "%%{" stands for a literal "%{"
+var hostVariableRegexp = regexp.MustCompile(`%%\{|%\{([^}]*)\}`)
+
+// Resolvers of the host variables, the offline image (PathPrefix) knows its
+// host name only
+var hostVariables = map[string]func() (string, error){
+	HostVariableHostname: hostname,
+	HostVariableIP:       primaryIP,
+	HostVariableCPUs: func() (string, error) {
+		if offline() {
+			return "", &InputError{Input: "host variable", Reason: "%{cpus} is not known for an offline image"}
+		}
+		return strconv.Itoa(runtime.NumCPU()), nil
+	},
+}
+
+// Problems of the host variables which the arguments and the environment
+// of the definition reference
+func checkHostVariableProblems(def *Definition) []string {
+	var problems []string
+	check := func(input, value string) {
+		for _, match := range hostVariableRegexp.FindAllStringSubmatch(value, -1) {
+			if match[0] != "%%{" && hostVariables[match[1]] == nil {
+				problems = append(problems, input+" references the unknown host variable "+match[0])
+			}
+		}
+	}
+	for _, arg := range def.Args {
+		check("args", arg)
+	}
+	for _, variable := range environment(def) {
+		check("environment "+variable.Name, variable.Value)
+	}
+	return problems
+}
+
+// Definition whose arguments and environment reference the host variables
+// by their values, the definition itself if it references none. "%%{" of
+// the arguments is kept for systemd, which reads it as "%{" (a specifier
+// is escaped as "%%"), the environment is escaped by the template.
+func expandHostVariables(kind Kind, def *Definition) (*Definition, error) {
+	if problems := checkHostVariableProblems(def); len(problems) > 0 {
+		return nil, &DefinitionError{Problems: problems}
+	}
+	values := make(map[string]string)
+	var resolveErr error
+	expand := func(value, literal string) string {
+		return hostVariableRegexp.ReplaceAllStringFunc(value, func(reference string) string {
+			if reference == "%%{" {
+				return literal
+			}
+			name := reference[2 : len(reference)-1]
+			if _, ok := values[name]; !ok && resolveErr == nil {
+				values[name], resolveErr = hostVariables[name]()
+			}
+			return values[name]
+		})
+	}
+	literal := "%{"
+	if kind == KindSystemD {
+		literal = "%%{"
+	}
+	expanded := newProperties(def).def
+	changed := false
+	for i, arg := range expanded.Args {
+		expanded.Args[i] = expand(arg, literal)
+		changed = changed || expanded.Args[i] != arg
+	}
+	if len(def.Environment) > 0 {
+		names := make([]string, 0, len(def.Environment))
+		for name := range def.Environment {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		expanded.Environment = make(map[string]string, len(def.Environment))
+		for _, name := range names {
+			expanded.Environment[name] = expand(def.Environment[name], "%{")
+			changed = changed || expanded.Environment[name] != def.Environment[name]
+		}
+	}
+	if resolveErr != nil {
+		return nil, resolveErr
+	}
+	if !changed {
+		return def, nil
+	}
+	return &expanded, nil
+}
+
+// Name of the host, of the offline image by its /etc/hostname
+func hostname() (string, error) {
+	if !offline() {
+		return os.Hostname()
+	}
+	content, err := ioutil.ReadFile(rooted("/etc/hostname"))
+	if err != nil || strings.TrimSpace(string(content)) == "" {
+		return "", &InputError{Input: "host variable", Reason: "%{hostname} is not known for the offline image, /etc/hostname is missing"}
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// Primary IP address of the host: the first global unicast IPv4 address of
+// its interfaces, the first IPv6 one if it has none
+func primaryIP() (string, error) {
+	if offline() {
+		return "", &InputError{Input: "host variable", Reason: "%{ip} is not known for an offline image"}
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+	var ipv6 net.IP
+	for _, addr := range addrs {
+		network, ok := addr.(*net.IPNet)
+		if !ok || !network.IP.IsGlobalUnicast() {
+			continue
+		}
+		if network.IP.To4() != nil {
+			return network.IP.String(), nil
+		}
+		if ipv6 == nil {
+			ipv6 = network.IP
+		}
+	}
+	if ipv6 == nil {
+		return "", &InputError{Input: "host variable", Reason: "%{ip}: the host has no global address"}
+	}
+	return ipv6.String(), nil
+}
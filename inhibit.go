@@ -0,0 +1,286 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/takama/daemon/internal/tools"
+)
+
+// Events of logind which are reported by Inhibitor.Events
+const (
+	// EventShutdown - the system is about to shut down or reboot
+	EventShutdown = "shutdown"
+
+	// EventSleep - the system is about to suspend or hibernate
+	EventSleep = "sleep"
+
+	// EventResume - the system has resumed from the sleep
+	EventResume = "resume"
+)
+
+// Inhibitor - delay lock of logind which makes the system wait before
+// it shuts down or sleeps, so the service is able to flush its state.
+// logind waits for the release of the lock at most InhibitDelayMaxSec
+// (5 seconds by default, see logind.conf).
+//
+// The lock is held by systemd-inhibit and the announcements of logind
+// are read from busctl monitor, so no D-Bus library is needed. If the
+// monitor loses the bus, e.g. after a soft-reboot, it is started again
+// and the lock is taken on the new bus.
+type Inhibitor struct {
+	name    string
+	why     string
+	what    string
+	events  chan string
+	done    chan struct{}
+	stopped chan struct{}
+
+	mutex   sync.Mutex
+	lock    *exec.Cmd
+	monitor *exec.Cmd
+	closed  bool
+}
+
+// Delay of the restart of the monitor, it is given up after
+// monitorRetries restarts which did not last monitorUptime
+const (
+	monitorDelay   = time.Second
+	monitorUptime  = 30 * time.Second
+	monitorRetries = 5
+)
+
+// Inhibit - take the delay lock of shutdown and sleep for the named
+// service, why is shown by systemd-inhibit --list. It fails with
+// ErrUnsupportedSystem on hosts without logind.
+func Inhibit(name, why string) (*Inhibitor, error) {
+	return inhibit(name, why, "shutdown:sleep")
+}
+
+// Take the delay lock of the given operations, e.g. "sleep"
+func inhibit(name, why, what string) (*Inhibitor, error) {
+	for _, command := range []string{"systemd-inhibit", "busctl"} {
+		if !tools.Available(command) {
+			return nil, ErrUnsupportedSystem
+		}
+	}
+	inhibitor := &Inhibitor{name: name, why: why, what: what, events: make(chan string, 4),
+		done: make(chan struct{}), stopped: make(chan struct{})}
+	if err := inhibitor.acquire(); err != nil {
+		return nil, err
+	}
+	monitor, output, err := inhibitor.startMonitor()
+	if err != nil {
+		close(inhibitor.stopped)
+		inhibitor.Close()
+		return nil, err
+	}
+	go inhibitor.watch(monitor, output)
+	return inhibitor, nil
+}
+
+// Start busctl monitor which prints the signals of logind
+func (inhibitor *Inhibitor) startMonitor() (*exec.Cmd, io.Reader, error) {
+	monitor := tools.Command("busctl", "monitor", "--system", "--json=short",
+		"--match=type='signal',sender='org.freedesktop.login1',interface='org.freedesktop.login1.Manager'")
+	output, err := monitor.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	inhibitor.mutex.Lock()
+	defer inhibitor.mutex.Unlock()
+	if inhibitor.closed {
+		return nil, nil, ErrUnsupportedSystem
+	}
+	if err := monitor.Start(); err != nil {
+		return nil, nil, err
+	}
+	inhibitor.monitor = monitor
+	return monitor, output, nil
+}
+
+// Events - the announcements of logind: EventShutdown, EventSleep and
+// EventResume. Release the lock when the state has been flushed.
+func (inhibitor *Inhibitor) Events() <-chan string {
+	return inhibitor.events
+}
+
+// Take the lock by systemd-inhibit which runs until it is killed
+func (inhibitor *Inhibitor) acquire() error {
+	inhibitor.mutex.Lock()
+	defer inhibitor.mutex.Unlock()
+	if inhibitor.lock != nil || inhibitor.closed {
+		return nil
+	}
+	lock := tools.Command("systemd-inhibit", "--what="+inhibitor.what, "--who="+inhibitor.name,
+		"--why="+inhibitor.why, "--mode=delay", "sleep", "infinity")
+	if err := lock.Start(); err != nil {
+		return err
+	}
+	inhibitor.lock = lock
+	return nil
+}
+
+// Release - release the lock, so the shutdown or the sleep proceeds,
+// the lock is taken again after the system has resumed
+func (inhibitor *Inhibitor) Release() error {
+	inhibitor.mutex.Lock()
+	defer inhibitor.mutex.Unlock()
+	if inhibitor.lock == nil {
+		return nil
+	}
+	err := inhibitor.lock.Process.Kill()
+	inhibitor.lock.Wait()
+	inhibitor.lock = nil
+	return err
+}
+
+// Close - release the lock and stop watching logind
+func (inhibitor *Inhibitor) Close() error {
+	if inhibitor == nil {
+		return nil
+	}
+	inhibitor.mutex.Lock()
+	if inhibitor.closed {
+		inhibitor.mutex.Unlock()
+		return nil
+	}
+	inhibitor.closed = true
+	close(inhibitor.done)
+	if inhibitor.monitor != nil {
+		inhibitor.monitor.Process.Kill()
+	}
+	inhibitor.mutex.Unlock()
+	<-inhibitor.stopped
+	return inhibitor.Release()
+}
+
+// Signal of logind as it is printed by busctl monitor --json=short
+type logindSignal struct {
+	Member  string `json:"member"`
+	Payload struct {
+		Data []interface{} `json:"data"`
+	} `json:"payload"`
+}
+
+// Read the monitor until the inhibitor is closed, the monitor is started
+// again if it has lost the bus, e.g. after a soft-reboot or a restart of
+// the bus, the events are closed if it fails repeatedly
+func (inhibitor *Inhibitor) watch(monitor *exec.Cmd, output io.Reader) {
+	defer close(inhibitor.events)
+	defer close(inhibitor.stopped)
+	failures := 0
+	for {
+		started := time.Now()
+		inhibitor.read(output)
+		monitor.Wait()
+		if time.Since(started) > monitorUptime {
+			failures = 0
+		}
+		for {
+			if failures++; failures > monitorRetries {
+				return
+			}
+			select {
+			case <-inhibitor.done:
+				return
+			case <-time.After(monitorDelay):
+			}
+			var err error
+			if monitor, output, err = inhibitor.startMonitor(); err == nil {
+				break
+			}
+		}
+		// the lock of the former bus has gone with it
+		inhibitor.Release()
+		inhibitor.acquire()
+	}
+}
+
+// Send the event unless the inhibitor is closed
+func (inhibitor *Inhibitor) send(event string) {
+	select {
+	case inhibitor.events <- event:
+	case <-inhibitor.done:
+	}
+}
+
+// Translate the signals PrepareForShutdown and PrepareForSleep into events
+func (inhibitor *Inhibitor) read(output io.Reader) {
+	scanner := bufio.NewScanner(output)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var message logindSignal
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil || len(message.Payload.Data) == 0 {
+			continue
+		}
+		active, _ := message.Payload.Data[0].(bool)
+		switch {
+		case message.Member == "PrepareForShutdown" && active:
+			inhibitor.send(EventShutdown)
+		case message.Member == "PrepareForSleep" && active:
+			inhibitor.send(EventSleep)
+		case message.Member == "PrepareForSleep":
+			inhibitor.acquire()
+			inhibitor.send(EventResume)
+		}
+	}
+}
+
+// Serve - block until the service is asked to stop by SIGINT or SIGTERM
+// or the system is about to shut down, then call stop and return its error.
+// On systemd hosts the service holds a delay inhibitor while it runs, so
+// the shutdown waits for stop, and flush (if it is not nil) is called
+// before the system sleeps. Without logind only the signals are handled.
+// A panic of stop or flush is handled as one of the executable of Run.
+func Serve(name string, stop func() error, flush func() error) error {
+	guard := &crashGuard{service: name}
+	defer guard.exit()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	// without logind the inhibitor is nil, only the signals are handled
+	inhibitor, _ := Inhibit(name, "Flushing the state of "+name)
+	defer inhibitor.Close()
+	var events <-chan string
+	if inhibitor != nil {
+		events = inhibitor.Events()
+	}
+
+	for {
+		select {
+		case <-interrupt:
+			return guard.callError(stop)
+		case event, ok := <-events:
+			switch {
+			case !ok:
+				events = nil
+			case event == EventShutdown:
+				return guard.callError(stop)
+			case event == EventSleep:
+				if flush != nil {
+					if err := guard.callError(flush); err != nil {
+						if _, ok := err.(*PanicError); ok {
+							return err
+						}
+						diagnostics.Println("Flush before sleep failed:", err)
+					}
+				}
+				inhibitor.Release()
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// ErrInvalidInput appears if a path, an argument or a template which is
+// passed to the package can not be used, see InputError
+var ErrInvalidInput = errors.New("Input is not valid")
+
+// InputError - the input can not be used in the service files, it is
+// rejected when the daemon is created or the template is set instead of
+// producing a broken service file or a panic.
+// errors.Is(err, ErrInvalidInput) reports such errors.
+type InputError struct {
+	// Input - JSON name of the field of the definition, e.g. "path"
+	Input  string
+	Reason string
+}
+
+func (e *InputError) Error() string {
+	return "Input " + e.Input + " is not valid: " + e.Reason
+}
+
+// Is - the error matches ErrInvalidInput
+func (e *InputError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
+
+// Check the definition can be used by every backend: the name (see
+// ValidateName), the paths, the arguments, the environment and the failure
+// notifications which are written into the service files and the custom
+// template. An empty path or template stands for the default one, a blank
+// one is rejected.
+func validateInput(kind Kind, def *Definition) error {
+	if err := checkName(kind, def); err != nil {
+		return err
+	}
+	for _, path := range []struct {
+		input, value string
+	}{{"path", def.Path}, {"install_path", def.InstallPath}, {"install_source", def.InstallSource}} {
+		if path.value == "" {
+			continue
+		}
+		if err := validatePath(path.input, path.value); err != nil {
+			return err
+		}
+	}
+	for _, arg := range def.Args {
+		if strings.ContainsAny(arg, "\x00\n\r") {
+			return &InputError{Input: "args", Reason: "argument " + strconv.Quote(arg) + " contains a line break or a NUL"}
+		}
+	}
+	for _, variable := range environment(def) {
+		if !variableName(variable.Name) {
+			return &InputError{Input: "environment", Reason: strconv.Quote(variable.Name) + " is not a name of a variable"}
+		}
+		if strings.ContainsAny(variable.Value, "\x00\n\r") {
+			return &InputError{Input: "environment", Reason: "the value of " + variable.Name + " contains a line break or a NUL"}
+		}
+	}
+	if err := checkFailureHooks(def); err != nil {
+		return err
+	}
+	if def.Template != "" {
+		return validateTemplate(def.Template)
+	}
+	return nil
+}
+
+// Check the name of a variable of the environment can be exported by the
+// shell: ASCII letters, digits and '_', not starting with a digit
+func variableName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for _, r := range name {
+		if !alphanumeric(r) && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// Check the path of an executable is not blank and fits on a line
+func validatePath(input, path string) error {
+	switch {
+	case strings.TrimSpace(path) == "":
+		return &InputError{Input: input, Reason: "it is empty"}
+	case strings.ContainsAny(path, "\x00\n\r"):
+		return &InputError{Input: input, Reason: strconv.Quote(path) + " contains a line break or a NUL"}
+	}
+	return nil
+}
+
+// Name of the executable by which the process was started, os.Args[0],
+// it may be empty if the process was started by execve without arguments
+func processName() (string, error) {
+	if len(os.Args) == 0 {
+		return "", &InputError{Input: "executable", Reason: "the process has no arguments"}
+	}
+	if err := validatePath("executable", os.Args[0]); err != nil {
+		return "", err
+	}
+	return os.Args[0], nil
+}
+
+// Check the template of the service file is not blank and can be parsed
+func validateTemplate(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return &InputError{Input: "template", Reason: "it is blank"}
+	}
+	if _, err := template.New("service").Funcs(templateFuncs).Parse(text); err != nil {
+		return &InputError{Input: "template", Reason: err.Error()}
+	}
+	return nil
+}
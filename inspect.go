@@ -0,0 +1,668 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/takama/daemon/sysv"
+)
+
+// ErrUnparsable appears if a service file could not be parsed
+var ErrUnparsable = errors.New("Service file could not be parsed")
+
+// Inspect - definition of an existing service of the current host, which was
+// not necessarily installed by this package, e.g. to re-manage legacy services.
+// Settings which are not represented by Definition are ignored.
+func Inspect(name string) (*Definition, error) {
+	return inspect(name)
+}
+
+// Inspect the service file of the named service for the given kind of init system
+func inspectFile(kind Kind, name string) (*Definition, error) {
+	path, err := ServicePath(kind, name)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotInstalled
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(kind, name, string(content))
+}
+
+// Parse - definition of the service from the content of its service file
+// for the given kind of init system
+func Parse(kind Kind, name, content string) (*Definition, error) {
+	def := &Definition{Name: name}
+	var err error
+	switch kind {
+	case KindSystemD:
+		err = parseSystemD(def, content)
+	case KindSystemV:
+		err = parseSystemV(def, content)
+	case KindUpstart:
+		err = parseUpstart(def, content)
+	case KindLaunchd:
+		err = parsePropertyList(def, content)
+	case KindRCD:
+		err = parseRCD(def, content)
+	default:
+		return nil, ErrUnsupportedKind
+	}
+	if err != nil {
+		return nil, err
+	}
+	if def.Description == "" {
+		def.Description = name
+	}
+	return def, nil
+}
+
+// Units which are always required by the default templates, they are not dependencies
+var implicitDependencies = map[string]bool{
+	"$network": true, "$named": true, "$local_fs": true, "$remote_fs": true, "$syslog": true,
+	"networking": true, "syslog": true,
+}
+
+func parseSystemD(def *Definition, content string) error {
+	var after []string
+	for _, line := range strings.Split(content, "\n") {
+		key, value, ok := keyValue(line)
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Description":
+			def.Description = value
+		case "Requires":
+			def.Dependencies = append(def.Dependencies, strings.Fields(value)...)
+		case "After":
+			after = append(after, strings.Fields(value)...)
+		case "Before":
+			def.Before = append(def.Before, trimUnits(strings.Fields(value))...)
+		case "Alias":
+			def.Aliases = append(def.Aliases, trimUnits(strings.Fields(value))...)
+		case "PartOf":
+			for _, unit := range strings.Fields(value) {
+				if strings.HasSuffix(unit, ".target") {
+					def.Target = strings.TrimSuffix(unit, ".target")
+				}
+			}
+		case "OnFailure":
+			for _, unit := range trimUnits(strings.Fields(value)) {
+				if unit != failureUnit(def).Name {
+					def.OnFailure = append(def.OnFailure, unit)
+				}
+			}
+		case "ExecStart":
+			command := splitCommand(strings.TrimLeft(value, "-@+!:"))
+			if len(command) > 0 {
+				def.Path, def.Args = command[0], command[1:]
+			}
+		case "User":
+			def.User = value
+		case "Group":
+			def.Group = value
+		case "Environment":
+			// the specifiers of the values are escaped as "%%"
+			for _, variable := range splitCommand(value) {
+				parseVariable(def, strings.Replace(variable, "%%", "%", -1))
+			}
+		case "PrivateNetwork":
+			def.PrivateNetwork = value == "yes" || value == "true"
+		case "NetworkNamespacePath":
+			def.NetworkNamespace = value
+		case "SystemCallFilter":
+			prefix := ""
+			if strings.HasPrefix(value, "~") {
+				prefix, value = "~", value[1:]
+			}
+			for _, call := range strings.Fields(value) {
+				def.SystemCallFilter = append(def.SystemCallFilter, prefix+call)
+			}
+		case "Delegate":
+			switch value {
+			case "yes", "true", "on", "1":
+				def.Delegate = true
+			case "no", "false", "off", "0", "":
+			default:
+				def.Delegate, def.DelegateControllers = true, strings.Fields(value)
+			}
+		case "SystemCallErrorNumber":
+			def.SystemCallErrorNumber = value
+		case "RestrictAddressFamilies":
+			def.RestrictAddressFamilies = append(def.RestrictAddressFamilies, strings.Fields(value)...)
+		case "CPUAffinity":
+			def.CPUAffinity = value
+		case "KillSignal":
+			if signal := parseSignal(value); signal != SignalTerm {
+				def.KillSignal = signal
+			}
+		case "ExecStop":
+			def.StopCommands = append(def.StopCommands, value)
+		case "ExecStopPost":
+			def.PostStopCommands = append(def.PostStopCommands, value)
+		case "ConditionFirstBoot":
+			def.FirstBoot = value == "yes" || value == "true"
+		case "ExecCondition":
+			def.ConditionCommands = append(def.ConditionCommands, value)
+		case "ExecStartPre":
+			// the commands which run with full privileges, the default
+			// template removes the pid file unprivileged
+			if strings.HasPrefix(value, "+") {
+				def.PreStartCommands = append(def.PreStartCommands, value[1:])
+			}
+		case "KillMode":
+			if value != KillControlGroup {
+				def.KillMode = value
+			}
+		case "TimeoutStopSec":
+			def.StopTimeout = parseTimeSpan(value)
+		case "RuntimeMaxSec":
+			def.MaxRuntime = parseTimeSpan(value)
+		case "WatchdogSec":
+			def.Watchdog = parseTimeSpan(value)
+		case "RestartSec":
+			def.RestartDelay = parseTimeSpan(value)
+		case "RestartMaxDelaySec":
+			def.RestartMaxDelay = parseTimeSpan(value)
+		case "SendSIGKILL":
+			def.NoFinalKill = value == "no" || value == "false"
+		case "NUMAPolicy":
+			def.NUMAPolicy = value
+		case "NUMAMask":
+			if value != "all" {
+				def.NUMANodes = value
+			}
+		case "StandardInput":
+			if value == StandardInputSocket {
+				def.StandardInput = value
+			} else if strings.HasPrefix(value, "file:") {
+				def.StandardInput = strings.TrimPrefix(value, "file:")
+			}
+		case "StandardOutput":
+			switch {
+			case value == "journal":
+				def.Logging = LogJournal
+			case strings.HasPrefix(value, "append:"), strings.HasPrefix(value, "file:"):
+				def.Logging = LogFile
+				def.LogDir = filepath.Dir(value[strings.Index(value, ":")+1:])
+			}
+		case "Type":
+			def.Forking = value == "forking"
+		case "NotifyAccess":
+			def.Upgrade = value == "all"
+		}
+	}
+	// the dependencies are ordered After= as well
+	required := make(map[string]bool)
+	for _, dependency := range def.Dependencies {
+		required[dependency] = true
+	}
+	// the instances of a per-user template run as their users
+	if def.User == "%i" {
+		def.PerUser, def.User = true, ""
+	}
+	for _, unit := range after {
+		if unit == "user@%i.service" {
+			continue
+		}
+		if unit == "time-sync.target" {
+			def.TimeSync = true
+		} else if !required[unit] {
+			def.After = append(def.After, strings.TrimSuffix(unit, ".service"))
+		}
+	}
+	if def.Path == "" {
+		return ErrUnparsable
+	}
+	return nil
+}
+
+var (
+	lsbRegexp        = regexp.MustCompile(`^#\s*([A-Za-z-]+):\s*(.*)$`)
+	shellVarRegexp   = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+	execArgsRegexp   = regexp.MustCompile(`\$exec\s+(.*?)\s*>>`)
+	namespaceRegexp  = regexp.MustCompile(`(nsenter --net=\S+|unshare --net) `)
+	wrapperRegexp    = regexp.MustCompile(`((?:taskset|numactl) [^"$]*)\$exec`)
+	suExecRegexp     = regexp.MustCompile(`su -s \S+ (?:-g (\S+) )?-c "exec [^"$]*\$exec\s*([^"]*)" (\S+)`)
+	stopSignalRegexp = regexp.MustCompile(`! kill -([A-Z0-9]+) \$(pid|group)`)
+	startedRegexp    = regexp.MustCompile(`started\s+([^\s()]+)`)
+	stoppedRegexp    = regexp.MustCompile(`stopped\s+([^\s()]+)`)
+	rcDefaultRegexp  = regexp.MustCompile(`^\[ -z "\$\w+" \] && (\w+)=(.*)$`)
+)
+
+func parseSystemV(def *Definition, content string) error {
+	vars := shellVariables(content)
+	for _, line := range strings.Split(content, "\n") {
+		match := lsbRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		value := strings.TrimSpace(match[2])
+		switch match[1] {
+		case "chkconfig":
+			if fields := strings.Fields(value); len(fields) == 3 && fields[2] != sysv.StopPriority {
+				def.StopPriority, _ = strconv.Atoi(fields[2])
+			}
+		case "Description", "description":
+			def.Description = value
+		case "Required-Start":
+			for _, name := range strings.Fields(value) {
+				if name == "$time" {
+					def.TimeSync = true
+				} else if !implicitDependencies[name] {
+					def.After = append(def.After, name)
+				}
+			}
+		case "X-Start-Before":
+			def.Before = strings.Fields(value)
+		}
+	}
+	for _, name := range []string{"exec", "DAEMON", "command"} {
+		if path := vars[name]; path != "" {
+			def.Path = path
+			break
+		}
+	}
+	if def.Path == "" {
+		return ErrUnparsable
+	}
+	// arguments of the default template: $exec args >> $stdoutlog,
+	// or su ... -c "exec $exec args" user >> $stdoutlog
+	if match := suExecRegexp.FindStringSubmatch(content); match != nil {
+		def.Group, def.Args, def.User = match[1], splitCommand(match[2]), match[3]
+	} else if match := execArgsRegexp.FindStringSubmatch(content); match != nil {
+		def.Args = splitCommand(match[1])
+	}
+	if match := wrapperRegexp.FindStringSubmatch(content); match != nil {
+		parseWrapper(def, splitCommand(match[1]))
+	}
+	if match := namespaceRegexp.FindStringSubmatch(content); match != nil {
+		parseWrapper(def, splitCommand(match[1]))
+	}
+	if match := stopSignalRegexp.FindStringSubmatch(content); match != nil {
+		if signal := parseSignal(match[1]); signal != SignalTerm {
+			def.KillSignal = signal
+		}
+		def.NoFinalKill = !strings.Contains(content, "kill -KILL $group")
+		switch {
+		case !strings.Contains(content, "group=-$pid"):
+			def.KillMode = KillProcess
+		case match[2] == "pid":
+			def.KillMode = KillMixed
+		}
+	}
+	if dir := filepath.Dir(vars["stdoutlog"]); dir != "." && !strings.Contains(dir, "$") {
+		def.LogDir = dir
+	}
+	return nil
+}
+
+func parseUpstart(def *Definition, content string) error {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		value := strings.TrimSpace(line[strings.Index(line, fields[0])+len(fields[0]):])
+		switch fields[0] {
+		case "description":
+			def.Description = strings.Trim(value, `"`)
+		case "start":
+			for _, match := range startedRegexp.FindAllStringSubmatch(value, -1) {
+				def.After = append(def.After, match[1])
+			}
+		case "stop":
+			for _, match := range stoppedRegexp.FindAllStringSubmatch(value, -1) {
+				def.StopAfter = append(def.StopAfter, match[1])
+			}
+		case "setuid":
+			def.User = value
+		case "expect":
+			def.Forking = value == "daemon" || value == "fork"
+		case "kill":
+			if fields := strings.Fields(value); len(fields) == 2 && fields[0] == "signal" {
+				if signal := parseSignal(fields[1]); signal != SignalTerm {
+					def.KillSignal = signal
+				}
+			}
+			if fields := strings.Fields(value); len(fields) == 2 && fields[0] == "timeout" {
+				def.StopTimeout = parseTimeSpan(fields[1])
+			}
+		case "setgid":
+			def.Group = value
+		case "env":
+			for _, variable := range splitCommand(value) {
+				parseVariable(def, variable)
+			}
+		case "exec":
+			command := splitCommand(value)
+			for i, word := range command {
+				if strings.HasPrefix(word, ">") || strings.HasPrefix(word, "2>") {
+					if i+1 < len(command) && def.LogDir == "" {
+						def.LogDir = filepath.Dir(command[i+1])
+					}
+					command = command[:i]
+					break
+				}
+			}
+			command = parseWrapper(def, command)
+			if len(command) > 0 {
+				def.Path, def.Args = command[0], command[1:]
+			}
+		}
+	}
+	if def.Path == "" {
+		return ErrUnparsable
+	}
+	return nil
+}
+
+// Element of a property list, only strings and arrays of strings are kept
+type plistValue struct {
+	XMLName xml.Name
+	Text    string       `xml:",chardata"`
+	Items   []plistValue `xml:",any"`
+}
+
+func parsePropertyList(def *Definition, content string) error {
+	var plist struct {
+		Dict plistValue `xml:"dict"`
+	}
+	if err := xml.Unmarshal([]byte(content), &plist); err != nil {
+		return ErrUnparsable
+	}
+	items := plist.Dict.Items
+	for i := 0; i+1 < len(items); i++ {
+		if items[i].XMLName.Local != "key" {
+			continue
+		}
+		value := items[i+1]
+		switch strings.TrimSpace(items[i].Text) {
+		case "ProgramArguments":
+			for _, item := range value.Items {
+				if def.Path == "" {
+					def.Path = strings.TrimSpace(item.Text)
+				} else {
+					def.Args = append(def.Args, strings.TrimSpace(item.Text))
+				}
+			}
+		case "Program":
+			def.Path = strings.TrimSpace(value.Text)
+		case "StartInterval":
+			if seconds, err := strconv.Atoi(strings.TrimSpace(value.Text)); err == nil {
+				def.StartInterval = time.Duration(seconds) * time.Second
+			}
+		case "ExitTimeOut":
+			def.StopTimeout = parseTimeSpan(value.Text)
+		case "ThrottleInterval":
+			def.RestartDelay = parseTimeSpan(value.Text)
+		case "WatchPaths":
+			for _, item := range value.Items {
+				def.WatchPaths = append(def.WatchPaths, strings.TrimSpace(item.Text))
+			}
+		case "QueueDirectories":
+			for _, item := range value.Items {
+				def.QueueDirectories = append(def.QueueDirectories, strings.TrimSpace(item.Text))
+			}
+		case "AbandonProcessGroup":
+			def.Forking = value.XMLName.Local == "true"
+		case "UserName":
+			def.User = strings.TrimSpace(value.Text)
+		case "GroupName":
+			def.Group = strings.TrimSpace(value.Text)
+		case "StandardInPath":
+			def.StandardInput = strings.TrimSpace(value.Text)
+		case "StandardOutPath":
+			def.LogDir = filepath.Dir(strings.TrimSpace(value.Text))
+		}
+	}
+	if def.Path == "" {
+		return ErrUnparsable
+	}
+	return nil
+}
+
+func parseRCD(def *Definition, content string) error {
+	vars := shellVariables(content)
+	for _, line := range strings.Split(content, "\n") {
+		match := lsbRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		switch match[1] {
+		case "REQUIRE":
+			var base []string
+			for _, name := range strings.Fields(match[2]) {
+				switch {
+				case name == "ntpdate":
+					def.TimeSync = true
+				case implicitDependencies[name] || name == strings.ToUpper(name):
+					// the default requirements and the placeholders of rcorder, e.g. FILESYSTEMS
+					base = append(base, name)
+				default:
+					def.After = append(def.After, name)
+				}
+			}
+			if strings.Join(base, " ") != strings.Join(defaultRCRequire, " ") {
+				def.RCRequire = base
+			}
+		case "BEFORE":
+			def.Before = strings.Fields(match[2])
+		case "KEYWORD":
+			def.RCKeywords = strings.Fields(match[2])
+		}
+	}
+	// the rc.conf defaults of the template: [ -z "$name_flags" ] && name_flags="..."
+	for _, line := range strings.Split(content, "\n") {
+		if match := rcDefaultRegexp.FindStringSubmatch(line); match != nil {
+			vars[match[1]] = shellValue(match[2])
+		}
+	}
+	// a service which does not fork is started by daemon(8) as procname
+	def.Path = vars["procname"]
+	if def.Path == "/usr/sbin/daemon" {
+		// daemon(8) restarts the service, which is the word before the flags
+		words := splitCommand(rcCommandArgs(content))
+		for i, word := range words {
+			if word == "$"+def.Name+"_flags" && i > 0 {
+				def.Path = words[i-1]
+			}
+		}
+	}
+	def.Forking = def.Path == "" && vars["start_cmd"] == ""
+	if def.Path == "" {
+		def.Path = vars["command"]
+	}
+	if def.Path == "" {
+		return ErrUnparsable
+	}
+	if description := vars["desc"]; description != "" {
+		def.Description = description
+	}
+	for _, file := range strings.Fields(vars["required_files"]) {
+		if file != def.Path {
+			def.RequiredFiles = append(def.RequiredFiles, file)
+		}
+	}
+	def.User = vars[def.Name+"_user"]
+	def.CPUAffinity = vars[def.Name+"_cpuset"]
+	if signal := parseSignal(vars["sig_stop"]); signal != SignalTerm {
+		def.KillSignal = signal
+	}
+	for _, variable := range splitCommand(vars[def.Name+"_env"]) {
+		parseVariable(def, variable)
+	}
+	if flags, ok := vars[def.Name+"_flags"]; ok {
+		def.Args = splitCommand(flags)
+	} else {
+		def.Args = splitCommand(vars["command_args"])
+	}
+	// options of daemon(8): daemon -p $pidfile [-u user] -f [-o log] $procname,
+	// or daemon -P $pidfile -p childpidfile -f -r ... path of a service which
+	// daemon(8) restarts; older scripts start it by start_cmd
+	command := splitCommand(vars["start_cmd"])
+	if vars["procname"] != "" {
+		command = splitCommand(rcCommandArgs(content))
+	}
+	for i, word := range command {
+		switch {
+		case word == "-u" && i+1 < len(command):
+			def.User = command[i+1]
+		case word == "-o" && i+1 < len(command):
+			def.Logging = LogFile
+			def.LogDir = filepath.Dir(command[i+1])
+		case word == "-R" && i+1 < len(command):
+			if seconds, err := strconv.Atoi(command[i+1]); err == nil {
+				def.RestartDelay = time.Duration(seconds) * time.Second
+			}
+		case word == "$command":
+			def.Args = command[i+1:]
+		}
+	}
+	return nil
+}
+
+// The first, unconditional command_args of a rc.d script
+func rcCommandArgs(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, "command_args=") {
+			return strings.Trim(strings.TrimPrefix(line, "command_args="), `"'`)
+		}
+	}
+	return ""
+}
+
+// Key and value of a "Key=Value" line, comments and sections are skipped
+func keyValue(line string) (key, value string, ok bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' || line[0] == ';' || line[0] == '[' {
+		return "", "", false
+	}
+	i := strings.Index(line, "=")
+	if i < 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+}
+
+// Values of the simple shell variable assignments of a script
+func shellVariables(content string) map[string]string {
+	vars := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		if match := shellVarRegexp.FindStringSubmatch(line); match != nil {
+			vars[match[1]] = shellValue(match[2])
+		}
+	}
+	return vars
+}
+
+// Value of a shell variable assignment, without its quotes
+func shellValue(value string) string {
+	if words := splitCommand(value); len(words) == 1 {
+		return words[0]
+	}
+	return strings.Trim(strings.TrimSpace(value), `"'`)
+}
+
+// Names of the units without the ".service" suffix
+func trimUnits(units []string) []string {
+	for i, unit := range units {
+		units[i] = strings.TrimSuffix(unit, ".service")
+	}
+	return units
+}
+
+// Strip the unshare, nsenter, taskset and numactl commands which wrap the executable
+// and keep their settings in the definition
+func parseWrapper(def *Definition, command []string) []string {
+	for len(command) > 0 {
+		switch {
+		case command[0] == "nsenter" && len(command) > 1 && strings.HasPrefix(command[1], "--net="):
+			def.NetworkNamespace, command = strings.TrimPrefix(command[1], "--net="), command[2:]
+		case command[0] == "unshare" && len(command) > 1 && command[1] == "--net":
+			def.PrivateNetwork, command = true, command[2:]
+		case command[0] == "taskset" && len(command) > 2 && command[1] == "-c":
+			def.CPUAffinity, command = command[2], command[3:]
+		case command[0] == "numactl" && len(command) > 1:
+			option := strings.SplitN(strings.TrimPrefix(command[1], "--"), "=", 2)
+			policies := map[string]string{"preferred": NUMAPreferred, "membind": NUMABind,
+				"interleave": NUMAInterleave, "localalloc": NUMALocal}
+			def.NUMAPolicy = policies[option[0]]
+			if len(option) > 1 && option[1] != "all" {
+				def.NUMANodes = option[1]
+			}
+			command = command[2:]
+		default:
+			return command
+		}
+	}
+	return command
+}
+
+// Add the "NAME=value" variable to the environment of the definition
+func parseVariable(def *Definition, variable string) {
+	if i := strings.Index(variable, "="); i > 0 {
+		WithEnvironment(variable[:i], variable[i+1:])(def)
+	}
+}
+
+// Words of a command line, single and double quotes group words and a
+// backslash escapes the next character, except in single quotes
+func splitCommand(command string) []string {
+	return splitWords(command, true)
+}
+
+// Words of a command line, single and double quotes group words, the
+// backslashes are escapes or, e.g. in the paths of Windows, plain characters
+func splitWords(command string, escapes bool) []string {
+	var words []string
+	var word strings.Builder
+	inWord, escaped := false, false
+	var quote rune
+	for _, r := range command {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case escapes && r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
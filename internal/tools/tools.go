@@ -0,0 +1,108 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+// Package tools locates the external tools of the init systems
+// (systemctl, launchctl, service, initctl, ...) for the daemon package
+// and its init system packages.
+package tools
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound appears if a tool of the init system is neither configured
+// nor found in PATH or in the standard directories
+var ErrNotFound = errors.New("Tool of the init system not found")
+
+// notFoundError - the named tool was not found, it matches ErrNotFound
+type notFoundError struct {
+	name string
+}
+
+func (e *notFoundError) Error() string {
+	return "Tool " + e.name + " of the init system not found, set its path by $" + EnvName(e.name)
+}
+
+func (e *notFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// Dirs - directories which are searched after PATH, the PATH of a minimal
+// environment (a unit of NixOS, a cron job) may miss them
+var Dirs = []string{
+	"/run/current-system/sw/bin",
+	"/usr/local/sbin", "/usr/local/bin",
+	"/usr/sbin", "/usr/bin",
+	"/sbin", "/bin",
+}
+
+var paths = struct {
+	sync.RWMutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// Set - path or name of the tool, an empty path restores the lookup
+func Set(name, path string) {
+	paths.Lock()
+	defer paths.Unlock()
+	if path == "" {
+		delete(paths.m, name)
+		return
+	}
+	paths.m[name] = path
+}
+
+// EnvName - environment variable which sets the path of the tool,
+// e.g. DAEMON_SYSTEMCTL
+func EnvName(name string) string {
+	return "DAEMON_" + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// Path - path of the tool: the one which is set by Set or by its
+// environment variable, else the tool in PATH or in Dirs
+func Path(name string) (string, error) {
+	paths.RLock()
+	path, ok := paths.m[name]
+	paths.RUnlock()
+	if !ok {
+		path = os.Getenv(EnvName(name))
+	}
+	if path == "" {
+		path = name
+	}
+	if found, err := exec.LookPath(path); err == nil {
+		return found, nil
+	}
+	if !strings.Contains(path, "/") {
+		for _, dir := range Dirs {
+			if found, err := exec.LookPath(filepath.Join(dir, path)); err == nil {
+				return found, nil
+			}
+		}
+	}
+	return "", &notFoundError{name: name}
+}
+
+// Available - check the tool is found
+func Available(name string) bool {
+	_, err := Path(name)
+	return err == nil
+}
+
+// Command - command which runs the tool, it fails with ErrNotFound
+// if the tool is not found
+func Command(name string, args ...string) *exec.Cmd {
+	path, err := Path(name)
+	if err != nil {
+		cmd := exec.Command(name, args...)
+		cmd.Err = err
+		return cmd
+	}
+	return exec.Command(path, args...)
+}
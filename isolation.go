@@ -0,0 +1,119 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrUnsupportedOption appears if the init system is not able to apply
+// an option of the definition, see UnsupportedOptionError
+var ErrUnsupportedOption = errors.New("Option is not supported by the init system")
+
+// UnsupportedOptionError - the option of the definition can not be applied
+// by the kind of init system, isolation settings are never dropped silently.
+// errors.Is(err, ErrUnsupportedOption) reports such errors.
+type UnsupportedOptionError struct {
+	// Option - JSON name of the field of the definition
+	Option string
+	Kind   Kind
+}
+
+func (e *UnsupportedOptionError) Error() string {
+	return "Option " + e.Option + " is not supported by " + string(e.Kind)
+}
+
+// Is - the error matches ErrUnsupportedOption
+func (e *UnsupportedOptionError) Is(target error) bool {
+	return target == ErrUnsupportedOption
+}
+
+// System call groups of systemd for SystemCallFilter, see "systemd-analyze syscall-filter"
+const (
+	// SyscallSystemService - the calls which are typically needed by system services
+	SyscallSystemService = "@system-service"
+
+	// SyscallBasicIO - reading and writing of open descriptors
+	SyscallBasicIO = "@basic-io"
+
+	// SyscallFileSystem - access to the file system
+	SyscallFileSystem = "@file-system"
+
+	// SyscallNetworkIO - sockets
+	SyscallNetworkIO = "@network-io"
+
+	// SyscallPrivileged - calls which need super-user capabilities
+	SyscallPrivileged = "@privileged"
+
+	// SyscallResources - changes of the resource limits and the scheduling
+	SyscallResources = "@resources"
+
+	// SyscallMount - mounting and unmounting of file systems
+	SyscallMount = "@mount"
+
+	// SyscallDebug - debugging and tracing of processes
+	SyscallDebug = "@debug"
+)
+
+// Check the isolation of the definition can be applied by the kind of
+// init system: systemd supports all of it, System V and upstart scripts
+// run the executable by unshare or nsenter (upstart only as root)
+func checkIsolation(kind Kind, def *Definition) error {
+	if kind == KindSystemD {
+		return nil
+	}
+	if len(def.SystemCallFilter) > 0 {
+		return &UnsupportedOptionError{"system_call_filter", kind}
+	}
+	if def.SystemCallErrorNumber != "" {
+		return &UnsupportedOptionError{"system_call_error_number", kind}
+	}
+	if len(def.RestrictAddressFamilies) > 0 {
+		return &UnsupportedOptionError{"restrict_address_families", kind}
+	}
+	option := ""
+	switch {
+	case def.NetworkNamespace != "":
+		option = "network_namespace"
+	case def.PrivateNetwork:
+		option = "private_network"
+	default:
+		return nil
+	}
+	// upstart changes the user before the exec of nsenter
+	if kind == KindSystemV || (kind == KindUpstart && def.User == "" && def.Group == "") {
+		return nil
+	}
+	return &UnsupportedOptionError{option, kind}
+}
+
+// Command which runs the executable in the network namespace of the service
+// on System V and upstart, it precedes the change of the user
+func namespaceWrapper(kind Kind, def *Definition) List {
+	if kind != KindSystemV && kind != KindUpstart {
+		return nil
+	}
+	switch {
+	case def.NetworkNamespace != "":
+		return List{"nsenter", "--net=" + def.NetworkNamespace}
+	case def.PrivateNetwork:
+		return List{"unshare", "--net"}
+	}
+	return nil
+}
+
+// Allowed and denied system calls and groups of the filter,
+// the denied ones are written with the "~" prefix in the definition
+func systemCallFilter(def *Definition) (allowed, denied List) {
+	for _, call := range def.SystemCallFilter {
+		if strings.HasPrefix(call, "~") {
+			denied = append(denied, strings.TrimPrefix(call, "~"))
+		} else {
+			allowed = append(allowed, call)
+		}
+	}
+	return allowed, denied
+}
@@ -0,0 +1,32 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package launchd
+
+import "testing"
+
+func FuzzParseList(f *testing.F) {
+	for _, test := range listOutputs {
+		f.Add([]byte(test.output), test.label)
+	}
+	f.Fuzz(func(t *testing.T, output []byte, label string) {
+		if running, pid := ParseList(output, label); running && pid == "" {
+			t.Errorf("ParseList(%q, %q) is running without a pid", output, label)
+		}
+	})
+}
+
+func FuzzParsePrint(f *testing.F) {
+	for _, test := range printOutputs {
+		f.Add([]byte(test.output))
+	}
+	f.Fuzz(func(t *testing.T, output []byte) {
+		if running, pid := ParsePrint(output); running && pid == "" {
+			t.Errorf("ParsePrint(%q) is running without a pid", output)
+		}
+	})
+}
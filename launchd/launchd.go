@@ -0,0 +1,438 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+// Package launchd controls jobs of the launchd init system of macOS.
+//
+// It is used by the daemon package on darwin hosts.
+package launchd
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/takama/daemon/internal/tools"
+)
+
+// Dir - standard directory of system daemons
+const Dir = "/Library/LaunchDaemons/"
+
+// AgentDir - standard directory of agents which run in the session of every user
+const AgentDir = "/Library/LaunchAgents/"
+
+// NewsyslogDir - directory of the log rotation rules of newsyslog
+const NewsyslogDir = "/etc/newsyslog.d/"
+
+var (
+	pidRegexp        = regexp.MustCompile(`(?m)^\s*"PID" = ([0-9]+);`)
+	lastStatusRegexp = regexp.MustCompile(`(?m)^\s*"LastExitStatus" = (-?[0-9]+);`)
+	disabledRegexp   = regexp.MustCompile(`<key>Disabled</key>\s*<(true|false)\s*/>`)
+
+	// the keys of the dictionary, not of the nested arrays
+	listPropertyRegexp = regexp.MustCompile(`(?m)^\t"([^"]+)" = ([^({].*);$`)
+
+	// e.g. "com.example.service" => disabled, "true" before macOS 10.15
+	overrideRegexp = regexp.MustCompile(`(?m)^\s*"([^"]+)" => (true|false|disabled|enabled)\s*$`)
+
+	// disabled.plist maps the labels to booleans, overrides.plist of
+	// older releases to dictionaries with the Disabled key
+	overridesDBRegexp = regexp.MustCompile(`<key>([^<]+)</key>\s*(?:<dict>\s*<key>Disabled</key>\s*)?<(true|false)\s*/>`)
+)
+
+// OverridesDir - directory of the database of the disabled overrides
+// which "launchctl disable" and configuration profiles (MDM) set,
+// disabled.plist for the system domain, disabled.<uid>.plist for the users
+const OverridesDir = "/private/var/db/com.apple.xpc.launchd/"
+
+// Job - launchd job
+type Job struct {
+	// Label of the job
+	Label string
+
+	// Agent - the job is an agent which runs in the sessions of the users
+	Agent bool
+
+	// Domain - launchd domain of the session of the agent, e.g. "gui/501",
+	// the agent is loaded by the sessions at login if it is empty
+	Domain string
+
+	// User - the agent belongs to the current user, its property list
+	// is in UserAgentDir and it is loaded at the login of the user only
+	User bool
+}
+
+// UserAgentDir - directory of the agents of the current user, ~/Library/LaunchAgents/
+func UserAgentDir() string {
+	home, _ := os.UserHomeDir()
+	return home + "/Library/LaunchAgents/"
+}
+
+// New - create a job with the given label
+func New(label string) *Job {
+	return &Job{Label: label}
+}
+
+// Path - standard path of the job property list
+func (job *Job) Path() string {
+	switch {
+	case job.User:
+		return UserAgentDir() + job.Label + ".plist"
+	case job.Agent:
+		return AgentDir + job.Label + ".plist"
+	}
+	return Dir + job.Label + ".plist"
+}
+
+// NewsyslogPath - path of the log rotation rules of the job
+func (job *Job) NewsyslogPath() string {
+	return NewsyslogDir + job.Label + ".conf"
+}
+
+// IsInstalled - check the property list exists
+func (job *Job) IsInstalled() bool {
+	_, err := os.Stat(job.Path())
+	return err == nil
+}
+
+// IsEnabled - check the job is loaded at boot (at the login for an agent):
+// a disabled override of its domain wins over the Disabled key of its
+// property list, as for launchd, which does not load disabled jobs
+func (job *Job) IsEnabled() (bool, error) {
+	data, err := ioutil.ReadFile(job.Path())
+	if err != nil {
+		return false, err
+	}
+	if disabled, ok := job.Override(); ok {
+		return !disabled, nil
+	}
+	return !ParseDisabled(data), nil
+}
+
+// Override - disabled override of the job in its domain, which is set by
+// "launchctl disable"/"enable" or by a configuration profile; ok is false
+// if the job has none or its domain is not known
+func (job *Job) Override() (disabled bool, ok bool) {
+	domain := job.overrideDomain()
+	if domain == "" {
+		return false, false
+	}
+	if output, err := tools.Command("launchctl", "print-disabled", domain).Output(); err == nil {
+		disabled, ok = ParseOverrides(output)[job.Label]
+		return disabled, ok
+	}
+	// the database is read if launchctl is not usable, e.g. in a chroot
+	path := OverridesDir + "disabled.plist"
+	if domain != "system" {
+		path = OverridesDir + "disabled." + domain[strings.Index(domain, "/")+1:] + ".plist"
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, false
+	}
+	disabled, ok = ParseOverridesDB(data)[job.Label]
+	return disabled, ok
+}
+
+// Domain of the overrides of the job: the system domain for daemons,
+// the domain of the session for agents
+func (job *Job) overrideDomain() string {
+	if job.Agent {
+		return job.Domain
+	}
+	return "system"
+}
+
+// ParseOverrides - disabled overrides in the output of "launchctl
+// print-disabled <domain>" by the labels of the jobs
+func ParseOverrides(output []byte) map[string]bool {
+	overrides := make(map[string]bool)
+	for _, match := range overrideRegexp.FindAllSubmatch(output, -1) {
+		value := string(match[2])
+		overrides[string(match[1])] = value == "true" || value == "disabled"
+	}
+	return overrides
+}
+
+// ParseOverridesDB - disabled overrides in the property list of the
+// overrides database by the labels of the jobs
+func ParseOverridesDB(data []byte) map[string]bool {
+	overrides := make(map[string]bool)
+	for _, match := range overridesDBRegexp.FindAllSubmatch(data, -1) {
+		overrides[string(match[1])] = string(match[2]) == "true"
+	}
+	return overrides
+}
+
+// ParseDisabled - check the property list of a job sets the Disabled key
+func ParseDisabled(data []byte) bool {
+	match := disabledRegexp.FindSubmatch(data)
+	return match != nil && string(match[1]) == "true"
+}
+
+// Enable - let launchd load the job: the disabled override of its domain
+// is removed (launchctl enable), an agent of all sessions, which has no
+// domain, is enabled by the Disabled key of its property list
+func (job *Job) Enable() error {
+	return job.setDisabled(false)
+}
+
+// Disable - keep launchd from loading the job at boot (at login for an
+// agent) and from loading it at all until it is enabled again
+func (job *Job) Disable() error {
+	return job.setDisabled(true)
+}
+
+// Set the disabled override of the job, or its Disabled key
+func (job *Job) setDisabled(disabled bool) error {
+	if domain := job.overrideDomain(); domain != "" {
+		action := "enable"
+		if disabled {
+			action = "disable"
+		}
+		return tools.Command("launchctl", action, domain+"/"+job.Label).Run()
+	}
+	data, err := ioutil.ReadFile(job.Path())
+	if err != nil {
+		return err
+	}
+	key := "<key>Disabled</key>\n\t<" + strconv.FormatBool(disabled) + "/>"
+	if disabledRegexp.Match(data) {
+		data = disabledRegexp.ReplaceAll(data, []byte(key))
+	} else if i := strings.LastIndex(string(data), "</dict>"); i >= 0 {
+		data = []byte(string(data[:i]) + "\t" + key + "\n" + string(data[i:]))
+	}
+	return ioutil.WriteFile(job.Path(), data, 0644)
+}
+
+// Status - check the job is loaded and return its PID if it is known
+func (job *Job) Status() (running bool, pid string) {
+	state := job.State()
+	return state.Running, state.PID
+}
+
+// State - state of the job including the exit status of its last run
+func (job *Job) State() State {
+	if job.Agent {
+		return job.agentState()
+	}
+	output, err := tools.Command("launchctl", "list", job.Label).Output()
+	if err != nil {
+		return State{}
+	}
+	return ParseJob(output, job.Label)
+}
+
+// ParseList - state of the job in the output of "launchctl list <label>":
+// the job runs if it is loaded and launchd has spawned its process, see
+// ParseJob for the loaded jobs without a process
+func ParseList(output []byte, label string) (running bool, pid string) {
+	state := ParseJob(output, label)
+	return state.PID != "", state.PID
+}
+
+// ParseJob - state of the job in the output of "launchctl list <label>"
+// including the exit status of its last run
+func ParseJob(output []byte, label string) State {
+	if !strings.Contains(string(output), `"Label" = "`+label+`";`) {
+		return State{}
+	}
+	state := State{Running: true}
+	if data := pidRegexp.FindSubmatch(output); len(data) > 1 {
+		state.PID = string(data[1])
+	}
+	if data := lastStatusRegexp.FindSubmatch(output); len(data) > 1 {
+		state.LastExitStatus, _ = strconv.Atoi(string(data[1]))
+	}
+	return state
+}
+
+var (
+	// the first state and pid are the ones of the service, the nested
+	// sections (endpoints, event triggers) come later
+	agentStateRegexp      = regexp.MustCompile(`(?m)^\s*state = (.+)$`)
+	agentPIDRegexp        = regexp.MustCompile(`(?m)^\s*pid = ([0-9]+)$`)
+	agentLastStatusRegexp = regexp.MustCompile(`(?m)^\s*last exit code = (-?[0-9]+)`)
+)
+
+// State of the agent in the domain of the session
+func (job *Job) agentState() State {
+	if job.Domain == "" {
+		return State{}
+	}
+	output, err := tools.Command("launchctl", "print", job.Domain+"/"+job.Label).Output()
+	if err != nil {
+		return State{}
+	}
+	return ParseAgent(output)
+}
+
+// ParsePrint - state of a service in the output of "launchctl print
+// <domain>/<label>", it runs if its state is "running" and its pid is known
+func ParsePrint(output []byte) (running bool, pid string) {
+	state := ParseAgent(output)
+	return state.PID != "", state.PID
+}
+
+// ParseAgent - state of a service in the output of "launchctl print
+// <domain>/<label>" including the exit code of its last run
+func ParseAgent(output []byte) State {
+	var state State
+	if data := agentLastStatusRegexp.FindSubmatch(output); len(data) > 1 {
+		state.LastExitStatus, _ = strconv.Atoi(string(data[1]))
+	}
+	data := agentStateRegexp.FindSubmatch(output)
+	if data == nil || strings.TrimSpace(string(data[1])) != "running" {
+		return state
+	}
+	state.Running = true
+	if data := agentPIDRegexp.FindSubmatch(output); len(data) > 1 {
+		state.PID = string(data[1])
+	}
+	return state
+}
+
+// Print - properties of the job which launchd reports: the top-level keys of
+// "launchctl print <domain>/<label>", e.g. "state", "pid", "last exit code"
+// or "program"; an agent without the domain of a session is queried by
+// "launchctl list <label>", its keys are "PID", "LastExitStatus", ...
+func (job *Job) Print() (map[string]string, error) {
+	domain := job.overrideDomain()
+	if domain == "" {
+		output, err := tools.Command("launchctl", "list", job.Label).Output()
+		if err != nil {
+			return nil, err
+		}
+		return ParseListProperties(output), nil
+	}
+	output, err := tools.Command("launchctl", "print", domain+"/"+job.Label).Output()
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrintProperties(output), nil
+}
+
+// Kill - send the signal (e.g. "SIGSTOP") to the running job by "launchctl
+// kill", an agent without the domain of a session is the one of the current
+// user
+func (job *Job) Kill(signal string) error {
+	domain := job.overrideDomain()
+	if domain == "" {
+		domain = "gui/" + strconv.Itoa(os.Getuid())
+	}
+	return tools.Command("launchctl", "kill", signal, domain+"/"+job.Label).Run()
+}
+
+// ParsePrintProperties - top-level properties in the output of "launchctl
+// print <domain>/<label>", the lines are "key = value", the nested blocks
+// ("key = {" ... "}") are left out
+func ParsePrintProperties(output []byte) map[string]string {
+	values := make(map[string]string)
+	depth := 0
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasSuffix(line, "{"):
+			depth++
+		case line == "}":
+			depth--
+		case depth == 1:
+			if i := strings.Index(line, " = "); i > 0 {
+				values[line[:i]] = line[i+3:]
+			}
+		}
+	}
+	return values
+}
+
+// ParseListProperties - top-level properties in the output of "launchctl
+// list <label>", the lines are "\"Key\" = value;", strings are unquoted
+func ParseListProperties(output []byte) map[string]string {
+	values := make(map[string]string)
+	for _, data := range listPropertyRegexp.FindAllSubmatch(output, -1) {
+		value := string(data[2])
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		values[string(data[1])] = value
+	}
+	return values
+}
+
+// State - state of a job which is reported by States
+type State struct {
+	Running bool
+	PID     string
+
+	// LastExitStatus - exit status of the last run of the job, 0 if it
+	// succeeded or the job has not exited yet, negative for a signal
+	LastExitStatus int
+}
+
+// Failed - the process of the job is not running and its last run failed
+func (state State) Failed() bool {
+	return state.PID == "" && state.LastExitStatus != 0
+}
+
+// States - states of the jobs with the given labels queried by a single
+// launchctl call, a job is running if it is loaded, as for Status
+func States(labels ...string) (map[string]State, error) {
+	states := make(map[string]State, len(labels))
+	if len(labels) == 0 {
+		return states, nil
+	}
+	output, err := tools.Command("launchctl", "list").Output()
+	if err != nil {
+		return nil, err
+	}
+	loaded := ParseStates(output)
+	for _, label := range labels {
+		states[label] = loaded[label]
+	}
+	return states, nil
+}
+
+// ParseStates - states of the loaded jobs in the output of "launchctl list"
+// by their labels, the PID of a job which has no process is empty
+func ParseStates(output []byte) map[string]State {
+	states := make(map[string]State)
+	for _, line := range strings.Split(string(output), "\n") {
+		// PID, last exit status, label
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] == "PID" {
+			continue
+		}
+		state := State{Running: true, PID: fields[0]}
+		if state.PID == "-" {
+			state.PID = ""
+		}
+		state.LastExitStatus, _ = strconv.Atoi(fields[1])
+		states[fields[2]] = state
+	}
+	return states
+}
+
+// Load - load the job, jobs with RunAtLoad are started immediately
+// An agent is bootstrapped into the domain of the session
+func (job *Job) Load() error {
+	if job.Agent {
+		if job.Domain == "" {
+			return nil
+		}
+		return tools.Command("launchctl", "bootstrap", job.Domain, job.Path()).Run()
+	}
+	return tools.Command("launchctl", "load", job.Path()).Run()
+}
+
+// Unload - unload the job, a running job is stopped
+func (job *Job) Unload() error {
+	if job.Agent {
+		if job.Domain == "" {
+			return nil
+		}
+		return tools.Command("launchctl", "bootout", job.Domain+"/"+job.Label).Run()
+	}
+	return tools.Command("launchctl", "unload", job.Path()).Run()
+}
@@ -0,0 +1,237 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package launchd
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Captured output of "launchctl list <label>"
+var listOutputs = []struct {
+	name    string
+	output  string
+	label   string
+	running bool
+	pid     string
+}{
+	{
+		name: "running",
+		output: `{
+	"LimitLoadToSessionType" = "System";
+	"Label" = "com.example.myservice";
+	"OnDemand" = false;
+	"LastExitStatus" = 0;
+	"PID" = 4242;
+	"Program" = "/usr/local/bin/myservice";
+	"ProgramArguments" = (
+		"/usr/local/bin/myservice";
+		"--port";
+		"8080";
+	);
+};
+`,
+		label:   "com.example.myservice",
+		running: true,
+		pid:     "4242",
+	},
+	{
+		name: "loaded without a process",
+		output: `{
+	"LimitLoadToSessionType" = "System";
+	"Label" = "com.example.myservice";
+	"OnDemand" = true;
+	"LastExitStatus" = 19968;
+	"Program" = "/usr/local/bin/myservice";
+	"ProgramArguments" = (
+		"/usr/local/bin/myservice";
+	);
+};
+`,
+		label: "com.example.myservice",
+	},
+	{
+		name: "missing label",
+		output: `{
+	"LimitLoadToSessionType" = "System";
+	"Label" = "com.example.other";
+	"OnDemand" = false;
+	"LastExitStatus" = 0;
+	"PID" = 4243;
+	"Program" = "/usr/local/bin/other";
+};
+`,
+		label: "com.example.myservice",
+	},
+	{
+		name: "label prefix of another job",
+		output: `{
+	"Label" = "com.example.myservice.helper";
+	"PID" = 4244;
+};
+`,
+		label: "com.example.myservice",
+	},
+	{
+		name:   "unknown job",
+		output: "Could not find service \"com.example.myservice\" in domain for port\n",
+		label:  "com.example.myservice",
+	},
+}
+
+func TestParseList(t *testing.T) {
+	for _, test := range listOutputs {
+		t.Run(test.name, func(t *testing.T) {
+			running, pid := ParseList([]byte(test.output), test.label)
+			if running != test.running || pid != test.pid {
+				t.Errorf("ParseList() = %v, %q, want %v, %q", running, pid, test.running, test.pid)
+			}
+		})
+	}
+}
+
+func TestParseJob(t *testing.T) {
+	want := State{Running: true, LastExitStatus: 19968}
+	if got := ParseJob([]byte(listOutputs[1].output), listOutputs[1].label); got != want {
+		t.Errorf("ParseJob() = %#v, want %#v", got, want)
+	}
+	if !want.Failed() {
+		t.Errorf("%#v is not failed", want)
+	}
+}
+
+// Captured output of "launchctl print <domain>/<label>"
+var printOutputs = []struct {
+	name    string
+	output  string
+	running bool
+	pid     string
+	status  int
+}{
+	{
+		name: "running",
+		output: `gui/501/com.example.agent = {
+	active count = 1
+	path = /Users/me/Library/LaunchAgents/com.example.agent.plist
+	type = LaunchAgent
+	state = running
+
+	program = /usr/local/bin/agent
+	arguments = {
+		/usr/local/bin/agent
+	}
+
+	default environment = {
+		PATH => /usr/bin:/bin:/usr/sbin:/sbin
+	}
+
+	domain = gui/501 [100005]
+	asid = 100005
+	minimum runtime = 10
+	exit timeout = 5
+	runs = 1
+	pid = 4242
+	immediate reason = speculative
+	forks = 0
+	execs = 1
+	initialized = 1
+	trampolined = 1
+	started suspended = 0
+	proxy started suspended = 0
+	last exit code = (never exited)
+
+	endpoints = {
+		"com.example.agent.xpc" = {
+			port = 0x1a03
+			active = 1
+			managed = 1
+			reset = 0
+			hide = 0
+			watching = 0
+		}
+	}
+}
+`,
+		running: true,
+		pid:     "4242",
+	},
+	{
+		name: "not running",
+		output: `gui/501/com.example.agent = {
+	active count = 0
+	path = /Users/me/Library/LaunchAgents/com.example.agent.plist
+	type = LaunchAgent
+	state = not running
+
+	program = /usr/local/bin/agent
+	domain = gui/501 [100005]
+	runs = 3
+	last exit code = 78: EX_CONFIG
+}
+`,
+		status: 78,
+	},
+	{
+		name: "spawn scheduled",
+		output: `gui/501/com.example.agent = {
+	active count = 0
+	state = spawn scheduled
+	runs = 4
+	last exit code = 1
+	spawn type = daemon (3)
+	throttle interval = 10
+}
+`,
+		status: 1,
+	},
+	{
+		name: "running without a pid",
+		output: `gui/501/com.example.agent = {
+	active count = 1
+	state = running
+	runs = 1
+}
+`,
+	},
+	{
+		name:   "unknown job",
+		output: "Could not find service \"com.example.agent\" in domain for user gui: 501\n",
+	},
+}
+
+func TestParsePrint(t *testing.T) {
+	for _, test := range printOutputs {
+		t.Run(test.name, func(t *testing.T) {
+			running, pid := ParsePrint([]byte(test.output))
+			if running != test.running || pid != test.pid {
+				t.Errorf("ParsePrint() = %v, %q, want %v, %q", running, pid, test.running, test.pid)
+			}
+			if status := ParseAgent([]byte(test.output)).LastExitStatus; status != test.status {
+				t.Errorf("ParseAgent() last exit status = %d, want %d", status, test.status)
+			}
+		})
+	}
+}
+
+func TestParseStates(t *testing.T) {
+	output := "PID\tStatus\tLabel\n" +
+		"-\t0\tcom.apple.SafariHistoryServiceAgent\n" +
+		"4242\t0\tcom.example.myservice\n" +
+		"-\t78\tcom.example.broken\n" +
+		"312\t-9\tcom.apple.Finder\n" +
+		"\n"
+	want := map[string]State{
+		"com.apple.SafariHistoryServiceAgent": {Running: true},
+		"com.example.myservice":               {Running: true, PID: "4242"},
+		"com.example.broken":                  {Running: true, LastExitStatus: 78},
+		"com.apple.Finder":                    {Running: true, PID: "312", LastExitStatus: -9},
+	}
+	if got := ParseStates([]byte(output)); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseStates() = %#v, want %#v", got, want)
+	}
+	if _, ok := ParseStates([]byte(output))["com.example.unknown"]; ok {
+		t.Errorf("ParseStates() has an unknown job")
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Severity - weight of a lint finding
+type Severity string
+
+// Severities of the lint findings: an error breaks the service, a warning
+// probably does not do what was meant, an info is a matter of style
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// LintFinding - problem of a definition or of its service file with
+// a suggestion how to fix it
+type LintFinding struct {
+	Severity Severity `json:"severity"`
+
+	// Line - line of the rendered service file, 0 if the finding
+	// concerns the definition
+	Line int `json:"line,omitempty"`
+
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+func (f LintFinding) String() string {
+	text := string(f.Severity) + ": "
+	if f.Line > 0 {
+		text += "line " + strconv.Itoa(f.Line) + ": "
+	}
+	text += f.Message
+	if f.Suggestion != "" {
+		text += " — " + f.Suggestion
+	}
+	return text
+}
+
+// Keys of the systemd units which take a single value, a repeated one
+// overrides the previous value
+var singleUnitKeys = map[string]bool{
+	"Description": true, "Type": true, "Restart": true, "RestartSec": true,
+	"User": true, "Group": true, "PIDFile": true, "NotifyAccess": true,
+	"KillMode": true, "KillSignal": true, "TimeoutStopSec": true,
+	"RuntimeMaxSec": true, "WatchdogSec": true, "StandardInput": true,
+	"StandardOutput": true, "StandardError": true,
+}
+
+// Keys of the dependencies of the systemd units, an empty one resets the list
+var dependencyUnitKeys = map[string]bool{
+	"Requires": true, "After": true, "Wants": true, "Before": true,
+}
+
+// Lint - check the definition and the service file which it renders for
+// the given kind of init system, the findings carry a severity and
+// a suggestion, e.g. "Requires= is empty — remove the line or add
+// dependencies". Unlike Render, which fails at the first problem, it
+// reports all problems it finds; no findings mean nothing to improve.
+// The executable is checked on the current host only.
+func Lint(kind Kind, def *Definition) []LintFinding {
+	var findings []LintFinding
+	for _, problem := range checkDefinition(def) {
+		findings = append(findings, LintFinding{Severity: SeverityError, Message: problem,
+			Suggestion: "fix the field of the definition"})
+	}
+	content, err := Render(kind, def)
+	switch err.(type) {
+	case nil:
+	case *DefinitionError, *InvalidNameError:
+		if len(findings) > 0 {
+			// the problems are listed already
+			return findings
+		}
+		return append(findings, renderFinding(kind, err))
+	default:
+		return append(findings, renderFinding(kind, err))
+	}
+	if path, err := serviceExecutable(def); err == nil && kind == HostKind() && !offline() {
+		if problem := checkExecutable(path); problem != "" {
+			findings = append(findings, LintFinding{Severity: SeverityWarning, Message: problem,
+				Suggestion: "install the executable or fix the path, it must be executable (chmod +x)"})
+		}
+	}
+	findings = append(findings, lintServiceFile(kind, content)...)
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Line < findings[j].Line
+	})
+	return findings
+}
+
+// Finding of a definition which can not be rendered
+func renderFinding(kind Kind, err error) LintFinding {
+	finding := LintFinding{Severity: SeverityError, Message: err.Error()}
+	if err == ErrUnsupportedKind {
+		finding.Suggestion = "use one of the kinds which keep services in files, see Kinds"
+		return finding
+	}
+	switch e := err.(type) {
+	case *UnsupportedOptionError:
+		finding.Suggestion = "remove " + e.Option + " from the definition for " + string(kind) +
+			", Capabilities lists the supported options"
+	case *InputError:
+		finding.Suggestion = "fix " + e.Input + " of the definition"
+	case *DefinitionError:
+		finding.Suggestion = "fix the fields of the definition"
+	default:
+		finding.Suggestion = "fix the definition or its template"
+	}
+	return finding
+}
+
+// Findings of the rendered service file: the fields of a custom template
+// which have no value and, in systemd units, the empty and the repeated
+// keys and the executable of ExecStart=
+func lintServiceFile(kind Kind, content string) []LintFinding {
+	var findings []LintFinding
+	seen := make(map[string]int)
+	var starts []int
+	oneshot := false
+	for i, line := range strings.Split(content, "\n") {
+		number := i + 1
+		if strings.Contains(line, "<no value>") {
+			findings = append(findings, LintFinding{Severity: SeverityError, Line: number,
+				Message:    "a field of the template has no value",
+				Suggestion: "check the field names of the template, see TemplateData"})
+		}
+		if kind != KindSystemD {
+			continue
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			// the keys of the sections are independent
+			seen = make(map[string]int)
+			continue
+		}
+		equal := strings.Index(line, "=")
+		if line == "" || strings.HasPrefix(line, "#") || equal < 0 {
+			continue
+		}
+		key, value := line[:equal], strings.TrimSpace(line[equal+1:])
+		switch {
+		case value == "" && dependencyUnitKeys[key]:
+			findings = append(findings, LintFinding{Severity: SeverityInfo, Line: number,
+				Message:    key + "= is empty",
+				Suggestion: "remove the line or add dependencies"})
+		case value == "" && key == "ExecStart":
+			findings = append(findings, LintFinding{Severity: SeverityError, Line: number,
+				Message:    "ExecStart= is empty",
+				Suggestion: "set the path of the executable"})
+		case value == "" && singleUnitKeys[key]:
+			findings = append(findings, LintFinding{Severity: SeverityWarning, Line: number,
+				Message:    key + "= is empty",
+				Suggestion: "remove the line, the default of systemd applies"})
+		}
+		if previous, ok := seen[key]; ok && singleUnitKeys[key] {
+			findings = append(findings, LintFinding{Severity: SeverityWarning, Line: number,
+				Message:    key + "= is set again, the value of line " + strconv.Itoa(previous) + " is overridden",
+				Suggestion: "remove one of the lines"})
+		}
+		seen[key] = number
+		switch key {
+		case "Type":
+			oneshot = value == "oneshot"
+		case "ExecStart":
+			starts = append(starts, number)
+			if executable := execStartPath(value); executable != "" && !absolute(executable) {
+				findings = append(findings, LintFinding{Severity: SeverityError, Line: number,
+					Message:    "ExecStart= path " + strconv.Quote(executable) + " is not absolute",
+					Suggestion: "use the absolute path of the executable"})
+			}
+		}
+	}
+	if len(starts) > 1 && !oneshot {
+		findings = append(findings, LintFinding{Severity: SeverityError, Line: starts[1],
+			Message:    "ExecStart= is set more than once",
+			Suggestion: "only services of Type=oneshot may have several, remove the other lines"})
+	}
+	return findings
+}
+
+// Executable of the command line of ExecStart= without the special
+// prefixes of systemd ("-", "@", ":", "+", "!")
+func execStartPath(command string) string {
+	fields := strings.Fields(strings.TrimLeft(command, "-@:+!"))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
@@ -0,0 +1,45 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// InstanceLock - path of the lock file which guarantees a single running
+// instance of the service, it is kept in the runtime directory of the service
+func InstanceLock(def *Definition) string {
+	if def.RuntimeDir != "" {
+		return filepath.Join(def.RuntimeDir, def.Name+".lock")
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), def.Name, def.Name+".lock")
+	}
+	return "/var/run/" + def.Name + ".lock"
+}
+
+// Lock the instance of the service if the definition requires a single
+// instance, the lock is held until the returned file is closed.
+// It returns ErrAlreadyRunning if another instance holds the lock.
+func (properties *ServiceProperties) lockInstance() (*os.File, error) {
+	if !properties.def.SingleInstance {
+		return nil, nil
+	}
+	path := InstanceLock(&properties.def)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
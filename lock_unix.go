@@ -0,0 +1,25 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package daemon
+
+import (
+	"os"
+	"syscall"
+)
+
+// Take an exclusive lock of the file without waiting,
+// the lock is released by the system when the process exits
+func lockFile(file *os.File) error {
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		if err == syscall.EWOULDBLOCK {
+			return ErrAlreadyRunning
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Take an exclusive lock of the file without waiting,
+// the lock is released by the system when the process exits
+func lockFile(file *os.File) error {
+	var overlapped windows.Overlapped
+	if err := windows.LockFileEx(
+		windows.Handle(file.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+		0, 1, 0, &overlapped,
+	); err != nil {
+		if err == windows.ERROR_LOCK_VIOLATION {
+			return ErrAlreadyRunning
+		}
+		return err
+	}
+	return nil
+}
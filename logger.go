@@ -0,0 +1,26 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"log"
+
+	"github.com/takama/daemon/rcd"
+)
+
+// Logger of the diagnostic messages of the package
+var diagnostics = log.New(ioutil.Discard, "", 0)
+
+// SetLogger - route the diagnostic messages of the package and of its
+// init system packages to the logger, nil discards them (the default),
+// the library never writes to stdout or stderr itself
+func SetLogger(logger *log.Logger) {
+	if logger == nil {
+		logger = log.New(ioutil.Discard, "", 0)
+	}
+	rcd.Logger = logger
+	diagnostics = logger
+}
@@ -0,0 +1,111 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// LogMode - where the output of the service is written
+type LogMode string
+
+// Supported log modes
+const (
+	// LogDefault - the standard way of the init system: the journal for systemd,
+	// files in the log directory for the other init systems
+	LogDefault LogMode = ""
+
+	// LogFile - files in the log directory, for every init system
+	LogFile LogMode = "file"
+
+	// LogJournal - the journal only, without any log files; it is supported
+	// by systemd only, the other init systems keep using files
+	LogJournal LogMode = "journal"
+)
+
+// ErrNoLogs appears if try to read the logs of a service which does not keep them
+var ErrNoLogs = errors.New("Service has no logs which could be read")
+
+// LogReader interface is implemented by daemons which are able to read
+// the logs of the service from the journal or from the log files
+type LogReader interface {
+	// Logs - the last lines of the logs of the service, all lines if lines <= 0
+	Logs(lines int) (string, error)
+}
+
+// Files which the service file of the given kind redirects the output to
+func logFiles(kind Kind, def *Definition) []string {
+	dir := logDir(kind, def)
+	switch kind {
+	case KindSystemD, KindRCD:
+		if def.Logging != LogFile {
+			return nil
+		}
+		if kind == KindRCD {
+			return []string{dir + "/" + def.Name + ".log"}
+		}
+	}
+	return []string{dir + "/" + def.Name + ".log", dir + "/" + def.Name + ".err"}
+}
+
+// Rules of newsyslog which rotate the log files of a launchd service
+func renderNewsyslog(def *Definition) (string, error) {
+	templ, err := template.New("newsyslog").Parse(newsyslogConfig)
+	if err != nil {
+		return "", err
+	}
+	owner := def.User
+	if owner != "" || def.Group != "" {
+		owner += ":" + def.Group
+	}
+	var buf bytes.Buffer
+	if err := templ.Execute(&buf, &struct {
+		Files    List
+		Owner    string
+		Metadata Metadata
+	}{logFiles(KindLaunchd, def), owner, NewMetadata()}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Last lines of the log files of the service, files which were not
+// created yet are skipped
+func readLogs(kind Kind, def *Definition, lines int) (string, error) {
+	files := logFiles(kind, def)
+	if len(files) == 0 {
+		return "", ErrNoLogs
+	}
+	var result []string
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		result = append(result, tail(string(data), lines)...)
+	}
+	return strings.Join(result, "\n"), nil
+}
+
+// Last lines of the text, all lines if lines <= 0
+func tail(text string, lines int) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	list := strings.Split(text, "\n")
+	if lines > 0 && len(list) > lines {
+		list = list[len(list)-lines:]
+	}
+	return list
+}
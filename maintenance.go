@@ -0,0 +1,110 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ErrMaintenance appears if the service is in maintenance, its downtime is intentional
+var ErrMaintenance = errors.New("Service is in maintenance")
+
+// MaintenanceMarker - path of the marker of the maintenance of the service,
+// it keeps the state of the service before the maintenance
+func MaintenanceMarker(def *Definition) string {
+	name := def.Name + ".maintenance"
+	if userScope(def) {
+		dir, _ := os.UserConfigDir()
+		return filepath.Join(dir, "daemon", name)
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), def.Name, name)
+	}
+	return "/var/lib/daemon/" + name
+}
+
+// Maintenance - put the service into maintenance (on) or take it out of it.
+// The service is stopped and marked, a systemd unit is masked as well, so
+// neither Ensure nor a dependency of another unit starts it meanwhile.
+// The end of the maintenance restores the previous state: the mask is
+// removed and a service which ran before is started again.
+func Maintenance(d Daemon, on bool) error {
+	properties, ok := Properties(d)
+	if !ok {
+		return ErrUnsupportedSystem
+	}
+	marker := MaintenanceMarker(&properties.def)
+	if !on {
+		return endMaintenance(d, marker)
+	}
+	if InMaintenance(d) {
+		return nil
+	}
+	status, err := StatusOf(d)
+	if err != nil {
+		return err
+	}
+	state := StatusStopped
+	if status.Running() {
+		state = StatusRunning
+	}
+	if err := os.MkdirAll(filepath.Dir(marker), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(marker, []byte(state+"\n"), 0644); err != nil {
+		return err
+	}
+	if status.Running() {
+		if _, err := d.Stop(); err != nil && err != ErrAlreadyStopped {
+			return err
+		}
+	}
+	if unit, ok := SystemdUnit(d); ok {
+		return unit.Mask()
+	}
+	return nil
+}
+
+// Take the service out of the maintenance, it is started if it ran before
+func endMaintenance(d Daemon, marker string) error {
+	data, err := ioutil.ReadFile(marker)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if unit, ok := SystemdUnit(d); ok {
+		if err := unit.Unmask(); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(marker); err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(data)) != StatusRunning {
+		return nil
+	}
+	if _, err := d.Start(); err != nil && err != ErrAlreadyRunning {
+		return err
+	}
+	return nil
+}
+
+// InMaintenance - check the service is in maintenance, monitors
+// should not restart it then
+func InMaintenance(d Daemon) bool {
+	properties, ok := Properties(d)
+	if !ok {
+		return false
+	}
+	_, err := os.Stat(MaintenanceMarker(&properties.def))
+	return err == nil
+}
@@ -0,0 +1,609 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrAlreadyManaged appears if try to add a service to a manager which already has a service with the same name
+	ErrAlreadyManaged = errors.New("Service is already managed")
+
+	// ErrNotManaged appears if try to use a service which was not added to the manager
+	ErrNotManaged = errors.New("Service is not managed")
+
+	// ErrDependencyCycle appears if the declared order of the services contains a cycle
+	ErrDependencyCycle = errors.New("Services have a dependency cycle")
+
+	// ErrOperationTimeout appears if an operation of the manager does not finish in time
+	ErrOperationTimeout = errors.New("Operation has timed out")
+)
+
+// CycleError - services whose declared order is circular, the first one
+// is repeated at the end, e.g. [a b a]. It matches ErrDependencyCycle by errors.Is.
+type CycleError struct {
+	Services []string
+}
+
+func (e *CycleError) Error() string {
+	return ErrDependencyCycle.Error() + ": " + strings.Join(e.Services, " -> ")
+}
+
+// Is - a CycleError is an ErrDependencyCycle
+func (e *CycleError) Is(target error) bool {
+	return target == ErrDependencyCycle
+}
+
+// OperationError - failures of the services of a parallel operation of the manager.
+// It matches by errors.Is and errors.As every error of the failed services.
+type OperationError struct {
+	// Failures - errors by the names of the failed services
+	Failures map[string]error
+}
+
+// Names of the failed services in sorted order
+func (e *OperationError) names() []string {
+	names := make([]string, 0, len(e.Failures))
+	for name := range e.Failures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e *OperationError) Error() string {
+	names := e.names()
+	problems := make([]string, len(names))
+	for i, name := range names {
+		problems[i] = name + ": " + e.Failures[name].Error()
+	}
+	return "Operation failed: " + strings.Join(problems, "; ")
+}
+
+// Errors - errors of the failed services, in the order of their names
+func (e *OperationError) Errors() []error {
+	names := e.names()
+	errs := make([]error, len(names))
+	for i, name := range names {
+		errs[i] = e.Failures[name]
+	}
+	return errs
+}
+
+// Unwrap - error of the first failed service by name, see Errors for all of them
+func (e *OperationError) Unwrap() error {
+	if errs := e.Errors(); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// Is - an OperationError is any error of the failed services
+func (e *OperationError) Is(target error) bool {
+	for _, err := range e.Errors() {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As - the first error of the failed services by name which matches the target
+func (e *OperationError) As(target interface{}) bool {
+	for _, err := range e.Errors() {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Manager - group of related services which are installed and controlled together.
+//
+// The order which is declared between the services is translated into the
+// directives of the init system of the host (After=/Before= for systemd,
+// LSB headers for System V, start on/stop on for upstart, REQUIRE/BEFORE
+// for rc.d) and every operation is applied to the services in that order.
+// Besides Order the definitions declare the order by After, Before,
+// Dependencies and StopAfter, as far as they refer to managed services:
+// StartAll starts a database before the applications which depend on it
+// and StopAll stops them in the reverse order.
+type Manager struct {
+	definitions []*Definition
+	index       map[string]int
+	// names of the services which must be started before the keyed one
+	after map[string][]string
+	// umbrella group of the services
+	target, targetDescription string
+	// parallel operations: number of workers and the minimal interval
+	// between the starts of the operations
+	workers  int
+	interval time.Duration
+	// time limit of an operation of a single service
+	timeout time.Duration
+	// trace ID of the operations of the services
+	traceID string
+}
+
+// NewManager - create an empty manager
+func NewManager() *Manager {
+	return &Manager{
+		index: make(map[string]int),
+		after: make(map[string][]string),
+	}
+}
+
+// Add - add the service to the manager, the definition is copied
+func (manager *Manager) Add(def *Definition) error {
+	copied := newProperties(def).def
+	copied.Name = strings.Join(strings.Fields(def.Name), "_")
+	if _, ok := manager.index[copied.Name]; ok {
+		return ErrAlreadyManaged
+	}
+	manager.index[copied.Name] = len(manager.definitions)
+	manager.definitions = append(manager.definitions, &copied)
+	return nil
+}
+
+// Order - declare that the service first must be started before the service then,
+// and stopped after it. An order which closes a cycle is refused by *CycleError.
+func (manager *Manager) Order(first, then string) error {
+	if _, ok := manager.index[first]; !ok {
+		return ErrNotManaged
+	}
+	if _, ok := manager.index[then]; !ok {
+		return ErrNotManaged
+	}
+	if first == then {
+		return ErrDependencyCycle
+	}
+	for _, name := range manager.after[then] {
+		if name == first {
+			return nil
+		}
+	}
+	manager.after[then] = append(manager.after[then], first)
+	if _, err := manager.sorted(); err != nil {
+		manager.after[then] = manager.after[then][:len(manager.after[then])-1]
+		return err
+	}
+	return nil
+}
+
+// SetTarget - group the services under an umbrella unit. On systemd the
+// services become part of "<name>.target" which is installed and enabled by
+// InstallAll, so "systemctl start <name>.target" brings the whole group up
+// and "systemctl stop <name>.target" down. On the other init systems the
+// group is controlled by the operations of the manager.
+func (manager *Manager) SetTarget(name, description string) {
+	manager.target = strings.Join(strings.Fields(name), "_")
+	manager.targetDescription = description
+}
+
+// SetWorkers - apply the operations to the services by the given number of
+// concurrent workers. The services which do not depend on each other by the
+// declared order are processed together, the operations start at most once
+// per interval (no limit if it is 0). A failed service does not stop the
+// others of its group, the failures are returned as *OperationError.
+// One worker (the default) processes the services one by one and stops
+// at the first failure.
+func (manager *Manager) SetWorkers(workers int, interval time.Duration) {
+	manager.workers = workers
+	manager.interval = interval
+}
+
+// SetTimeout - time limit of the operation of a single service, 0 means no limit.
+// The init system command of a timed out operation is not interrupted,
+// the service fails with ErrOperationTimeout.
+func (manager *Manager) SetTimeout(timeout time.Duration) {
+	manager.timeout = timeout
+}
+
+// SetTraceID - attach the trace ID to the results, the log messages and the
+// audit records of the operations of all services, see SetAuditRecorder
+func (manager *Manager) SetTraceID(id string) {
+	manager.traceID = id
+}
+
+// Validate - check the declared order of the services has no cycles,
+// a cycle is reported by *CycleError
+func (manager *Manager) Validate() error {
+	_, err := manager.sorted()
+	return err
+}
+
+// Definition - definition of the named service with the declared order applied
+func (manager *Manager) Definition(name string) (*Definition, error) {
+	i, ok := manager.index[name]
+	if !ok {
+		return nil, ErrNotManaged
+	}
+	def := newProperties(manager.definitions[i]).def
+	def.After = append(def.After, manager.after[name]...)
+	if manager.target != "" {
+		def.Target = manager.target
+	}
+	for _, other := range manager.definitions {
+		for _, first := range manager.after[other.Name] {
+			if first == name {
+				def.Before = append(def.Before, other.Name)
+			}
+		}
+	}
+	return &def, nil
+}
+
+// Daemon - daemon of the named service for the current host
+func (manager *Manager) Daemon(name string) (Daemon, error) {
+	def, err := manager.Definition(name)
+	if err != nil {
+		return nil, err
+	}
+	return tracedDaemon(def, manager.traceID)
+}
+
+// InstallAll - install all services in the declared order,
+// and the umbrella target on systemd
+func (manager *Manager) InstallAll() (string, error) {
+	result, err := manager.apply(false, func(d Daemon) (string, error) { return d.Install() })
+	if err != nil || !manager.hasTarget() {
+		return result, err
+	}
+	installAction := message(MessageInstallTarget, manager.target, manager.targetDescription)
+	if err := installTarget(manager.target, manager.targetDescription); err != nil {
+		return result + "\n" + traceResult(manager.traceID, manager.target, installAction, false), err
+	}
+	return result + "\n" + traceResult(manager.traceID, manager.target, installAction, true), nil
+}
+
+// RemoveAll - remove the umbrella target on systemd
+// and all services in the reverse order
+func (manager *Manager) RemoveAll() (string, error) {
+	var results []string
+	if manager.hasTarget() {
+		removeAction := message(MessageRemoveTarget, manager.target, manager.targetDescription)
+		if err := removeTarget(manager.target); err != nil {
+			return traceResult(manager.traceID, manager.target, removeAction, false), err
+		}
+		results = append(results, traceResult(manager.traceID, manager.target, removeAction, true))
+	}
+	result, err := manager.apply(true, Daemon.Remove)
+	return strings.Join(append(results, result), "\n"), err
+}
+
+// Check the umbrella target is installed as a unit of the init system
+func (manager *Manager) hasTarget() bool {
+	return manager.target != "" && hostKind() == KindSystemD
+}
+
+// StartAll - start all services in the declared order
+func (manager *Manager) StartAll() (string, error) {
+	return manager.apply(false, Daemon.Start)
+}
+
+// StopAll - stop all services in the reverse order
+func (manager *Manager) StopAll() (string, error) {
+	return manager.apply(true, Daemon.Stop)
+}
+
+// StatusAll - status of all services. The statuses are queried by a single
+// call of the init system where it is possible (systemd, launchd),
+// otherwise the services are queried concurrently.
+func (manager *Manager) StatusAll() (string, error) {
+	names, err := manager.sorted()
+	if err != nil {
+		return "", err
+	}
+	daemons := make([]Daemon, len(names))
+	for i, name := range names {
+		if daemons[i], err = manager.Daemon(name); err != nil {
+			return "", err
+		}
+	}
+	if len(daemons) > 0 {
+		if querier, ok := daemons[0].(statusQuerier); ok {
+			if ok, err := checkPrivileges(); !ok {
+				return "", err
+			}
+			if statuses, err := querier.queryStatuses(names); err == nil {
+				return manager.collect(names, func(i int) (string, error) {
+					if !daemons[i].(statusQuerier).isInstalled() {
+						return message(MessageStatusUndefined), ErrNotInstalled
+					}
+					return statuses[names[i]], nil
+				})
+			}
+		}
+	}
+
+	type result struct {
+		status string
+		err    error
+	}
+	results := make([]result, len(daemons))
+	var wg sync.WaitGroup
+	for i := range daemons {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i].status, results[i].err = daemons[i].Status()
+		}(i)
+	}
+	wg.Wait()
+	return manager.collect(names, func(i int) (string, error) {
+		return results[i].status, results[i].err
+	})
+}
+
+// Daemons which are able to query the statuses of many services at once
+type statusQuerier interface {
+	isInstalled() bool
+	queryStatuses(names []string) (map[string]string, error)
+}
+
+// Results of the services in the given order up to the first failure
+func (manager *Manager) collect(names []string, result func(i int) (string, error)) (string, error) {
+	var results []string
+	for i, name := range names {
+		status, err := result(i)
+		results = append(results, name+": "+status)
+		if err != nil {
+			return strings.Join(results, "\n"), err
+		}
+	}
+	return strings.Join(results, "\n"), nil
+}
+
+// Apply the operation to every service, it stops at the first failure
+// and returns the results of all services which were processed
+func (manager *Manager) apply(reverse bool, operation func(Daemon) (string, error)) (string, error) {
+	names, err := manager.sorted()
+	if err != nil {
+		return "", err
+	}
+	if manager.workers > 1 {
+		return manager.applyParallel(names, reverse, operation)
+	}
+	var results []string
+	for i := range names {
+		name := names[i]
+		if reverse {
+			name = names[len(names)-1-i]
+		}
+		d, err := manager.Daemon(name)
+		if err != nil {
+			return strings.Join(results, "\n"), err
+		}
+		result, err := manager.run(d, operation)
+		results = append(results, name+": "+result)
+		if err != nil {
+			return strings.Join(results, "\n"), err
+		}
+	}
+	return strings.Join(results, "\n"), nil
+}
+
+// Apply the operation to the services by the pool of workers, group by group
+// of services which do not depend on each other, it stops after the group
+// with failures and returns the results of all services which were processed
+func (manager *Manager) applyParallel(names []string, reverse bool,
+	operation func(Daemon) (string, error)) (string, error) {
+	groups := manager.groups(names)
+	if reverse {
+		for i, j := 0, len(groups)-1; i < j; i, j = i+1, j-1 {
+			groups[i], groups[j] = groups[j], groups[i]
+		}
+	}
+	throttle := newThrottle(manager.interval)
+	var results []string
+	for _, group := range groups {
+		statuses := make([]string, len(group))
+		errs := make([]error, len(group))
+		queue := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < manager.workers && w < len(group); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range queue {
+					d, err := manager.Daemon(group[i])
+					if err != nil {
+						errs[i] = err
+						continue
+					}
+					throttle.wait()
+					statuses[i], errs[i] = manager.run(d, operation)
+				}
+			}()
+		}
+		for i := range group {
+			queue <- i
+		}
+		close(queue)
+		wg.Wait()
+
+		failures := make(map[string]error)
+		for i, name := range group {
+			results = append(results, name+": "+statuses[i])
+			if errs[i] != nil {
+				failures[name] = errs[i]
+			}
+		}
+		if len(failures) > 0 {
+			return strings.Join(results, "\n"), &OperationError{Failures: failures}
+		}
+	}
+	return strings.Join(results, "\n"), nil
+}
+
+// Run the operation of a single service within the timeout of the manager
+func (manager *Manager) run(d Daemon, operation func(Daemon) (string, error)) (string, error) {
+	if manager.timeout <= 0 {
+		return operation(d)
+	}
+	type result struct {
+		status string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		status, err := operation(d)
+		done <- result{status, err}
+	}()
+	select {
+	case r := <-done:
+		return r.status, r.err
+	case <-time.After(manager.timeout):
+		return "", ErrOperationTimeout
+	}
+}
+
+// Groups of the sorted services, the services of a group depend only on
+// the services of the previous groups
+func (manager *Manager) groups(names []string) [][]string {
+	after := manager.dependencies()
+	level := make(map[string]int)
+	var groups [][]string
+	for _, name := range names {
+		for _, first := range after[name] {
+			if level[first]+1 > level[name] {
+				level[name] = level[first] + 1
+			}
+		}
+		for len(groups) <= level[name] {
+			groups = append(groups, nil)
+		}
+		groups[level[name]] = append(groups[level[name]], name)
+	}
+	return groups
+}
+
+// Rate limit of the starts of the operations
+type throttle struct {
+	sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newThrottle(interval time.Duration) *throttle {
+	return &throttle{interval: interval}
+}
+
+// Wait until the next operation may start
+func (t *throttle) wait() {
+	if t.interval <= 0 {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	now := time.Now()
+	if t.next.After(now) {
+		time.Sleep(t.next.Sub(now))
+		now = t.next
+	}
+	t.next = now.Add(t.interval)
+}
+
+// Names of the services which must be started before the keyed one: the
+// declared order and the references of the definitions to managed services
+func (manager *Manager) dependencies() map[string][]string {
+	after := make(map[string][]string, len(manager.definitions))
+	known := make(map[[2]string]bool)
+	add := func(first, then string) {
+		_, managedFirst := manager.index[first]
+		_, managedThen := manager.index[then]
+		if !managedFirst || !managedThen || first == then || known[[2]string{first, then}] {
+			return
+		}
+		known[[2]string{first, then}] = true
+		after[then] = append(after[then], first)
+	}
+	for _, def := range manager.definitions {
+		for _, first := range manager.after[def.Name] {
+			add(first, def.Name)
+		}
+		for _, first := range def.Dependencies {
+			add(first, def.Name)
+		}
+		for _, first := range def.After {
+			add(first, def.Name)
+		}
+		for _, then := range append(copyStrings(def.Before), def.StopAfter...) {
+			add(def.Name, then)
+		}
+	}
+	return after
+}
+
+// Names of the services sorted by the declared order, services without
+// an order between them keep the order in which they were added
+func (manager *Manager) sorted() ([]string, error) {
+	after := manager.dependencies()
+	waiting := make(map[string]int)
+	for _, def := range manager.definitions {
+		waiting[def.Name] = len(after[def.Name])
+	}
+	var names []string
+	done := make(map[string]bool)
+	for len(names) < len(manager.definitions) {
+		progress := false
+		for _, def := range manager.definitions {
+			if done[def.Name] || waiting[def.Name] > 0 {
+				continue
+			}
+			done[def.Name] = true
+			names = append(names, def.Name)
+			progress = true
+			for _, other := range manager.definitions {
+				for _, first := range after[other.Name] {
+					if first == def.Name {
+						waiting[other.Name]--
+					}
+				}
+			}
+			break
+		}
+		if !progress {
+			return nil, &CycleError{Services: findCycle(after, done)}
+		}
+	}
+	return names, nil
+}
+
+// Find a cycle among the services which could not be sorted, by following
+// the services which must be started before until one repeats
+func findCycle(after map[string][]string, done map[string]bool) []string {
+	var name string
+	for then, firsts := range after {
+		if !done[then] && (name == "" || then < name) && len(firsts) > 0 {
+			name = then
+		}
+	}
+	var path []string
+	position := make(map[string]int)
+	for {
+		if i, ok := position[name]; ok {
+			cycle := append(path[i:], name)
+			// the cycle is reported in the start order
+			for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+				cycle[i], cycle[j] = cycle[j], cycle[i]
+			}
+			return cycle
+		}
+		position[name] = len(path)
+		path = append(path, name)
+		for _, first := range after[name] {
+			if !done[first] {
+				name = first
+				break
+			}
+		}
+	}
+}
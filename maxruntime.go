@@ -0,0 +1,62 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrMaxRuntime appears if Run stopped the executable, since it ran for
+// the MaxRuntime of the definition. The process should exit with a failure,
+// so the init system starts it again.
+var ErrMaxRuntime = errors.New("Service has reached its maximum runtime")
+
+// runtimeLimit - stops the executable after the maximum runtime
+type runtimeLimit struct {
+	timer   *time.Timer
+	expired chan struct{}
+	once    sync.Once
+}
+
+// Stop the executable after the maximum runtime of the definition, on
+// systemd the manager stops the service itself (RuntimeMaxSec=)
+func (properties *ServiceProperties) limitRuntime(e Executable) *runtimeLimit {
+	runtime := properties.def.MaxRuntime
+	if runtime <= 0 {
+		return nil
+	}
+	limit := &runtimeLimit{expired: make(chan struct{})}
+	limit.timer = time.AfterFunc(runtime, func() {
+		limit.once.Do(func() { close(limit.expired) })
+		diagnostics.Println("Service", properties.def.Name, "reached its maximum runtime of", runtime)
+		e.Stop()
+	})
+	return limit
+}
+
+// Expired - closed when the maximum runtime has elapsed
+func (limit *runtimeLimit) Expired() <-chan struct{} {
+	if limit == nil {
+		return nil
+	}
+	return limit.expired
+}
+
+// Close - stop the timer, it returns ErrMaxRuntime if the executable
+// was stopped since the maximum runtime has elapsed
+func (limit *runtimeLimit) Close() error {
+	if limit == nil {
+		return nil
+	}
+	limit.timer.Stop()
+	select {
+	case <-limit.expired:
+		return ErrMaxRuntime
+	default:
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Messages which are returned by the daemons, they are the keys of
+// the message catalog and the formats of fmt.Sprintf
+const (
+	MessageInstall               = "Install %s:"
+	MessageInstallPathActivation = "Install path activation of %s:"
+	MessageInstallTarget         = "%s.target: Install %s:"
+	MessageRemove                = "Removing %s:"
+	MessageRemoveTarget          = "%s.target: Removing %s:"
+	MessagePurge                 = "Purging %s:"
+	MessageEnable                = "Enabling %s:"
+	MessageDisable               = "Disabling %s:"
+	MessageStart                 = "Starting %s:"
+	MessageStop                  = "Stopping %s:"
+	MessageRestart               = "Restarting %s:"
+	MessageRestore               = "Restoring %s:"
+	MessageRun                   = "Running %s:"
+	MessageCompleted             = "%s completed."
+	MessageStatusUndefined       = "Status could not defined"
+	MessageStopped               = "Service is stopped"
+	MessageRunning               = "Service is running..."
+	MessageRunningPID            = "Service (pid  %s) is running..."
+	MessageRunningSince          = "Service (pid  %d) is running since %s"
+	MessageStarting              = "Service (pid  %s) is starting..."
+	MessageNotResponding         = "Service (pid  %s) is not responding..."
+	MessageReloading             = "Service (pid  %s) is reloading..."
+	MessageStopping              = "Service (pid  %s) is stopping..."
+	MessagePaused                = "Service (pid  %s) is paused..."
+	MessageFailed                = "Service has failed"
+	MessageGettingStatus         = "Getting status:"
+	MessageStatus                = "Status: %s"
+)
+
+// Translator - translates a message of the catalog (e.g. MessageInstall),
+// the translation must keep the verbs of the format in the same order
+type Translator func(message string) string
+
+var translator = struct {
+	sync.RWMutex
+	translate Translator
+}{}
+
+// SetTranslator - translate the messages of all daemons, nil restores English
+func SetTranslator(translate Translator) {
+	translator.Lock()
+	defer translator.Unlock()
+	translator.translate = translate
+}
+
+// CatalogTranslator - translator which looks the messages up in the catalog,
+// missing messages are kept in English
+func CatalogTranslator(catalog map[string]string) Translator {
+	return func(message string) string {
+		if translation, ok := catalog[message]; ok {
+			return translation
+		}
+		return message
+	}
+}
+
+// Messages - all messages of the catalog, e.g. to check a translation is complete
+func Messages() []string {
+	return []string{
+		MessageInstall, MessageInstallPathActivation, MessageInstallTarget,
+		MessageRemove, MessageRemoveTarget, MessagePurge, MessageEnable, MessageDisable, MessageStart, MessageStop,
+		MessageRestart, MessageRestore, MessageRun, MessageCompleted, MessageStatusUndefined, MessageStopped, MessageRunning,
+		MessageRunningPID, MessageRunningSince, MessageStarting, MessageNotResponding,
+		MessageReloading, MessageStopping, MessagePaused, MessageFailed, MessageGettingStatus, MessageStatus,
+	}
+}
+
+// Translated and formatted message
+func message(format string, args ...interface{}) string {
+	translator.RLock()
+	translate := translator.translate
+	translator.RUnlock()
+	if translate != nil {
+		format = translate(format)
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
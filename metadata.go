@@ -0,0 +1,68 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Version of the package, it is recorded in the generated files
+const Version = "0.11.0"
+
+// Generator of the service files
+const generatedBy = "github.com/takama/daemon"
+
+// Metadata - where and when a service file or a report was generated,
+// for traceability across a fleet of hosts
+type Metadata struct {
+	// GeneratedBy - import path of the package
+	GeneratedBy string `json:"generated_by"`
+
+	// Version of the package
+	Version string `json:"version"`
+
+	// Host - name of the host
+	Host string `json:"host"`
+
+	// OS - operating system and architecture of the host, e.g. "linux/amd64"
+	OS string `json:"os"`
+
+	// Time of generation
+	Time time.Time `json:"time"`
+}
+
+// NewMetadata - metadata of the current host and time
+func NewMetadata() Metadata {
+	host, _ := os.Hostname()
+	return Metadata{
+		GeneratedBy: generatedBy,
+		Version:     Version,
+		Host:        host,
+		OS:          runtime.GOOS + "/" + runtime.GOARCH,
+		Time:        time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// String - one line summary, the default templates write it as a comment
+func (metadata Metadata) String() string {
+	return "Generated by " + metadata.GeneratedBy + " " + metadata.Version +
+		" on " + metadata.Host + " (" + metadata.OS + ") at " + metadata.Time.Format(time.RFC3339)
+}
+
+// StripMetadata - content of a generated file without its metadata comment,
+// so files which were generated on other hosts or at other times can be compared
+func StripMetadata(content string) string {
+	lines := strings.SplitAfter(content, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.Contains(line, "Generated by "+generatedBy+" ") {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "")
+}
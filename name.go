@@ -0,0 +1,107 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidName appears if the name of a service can not be used in the
+// names of its service files and units, see InvalidNameError
+var ErrInvalidName = errors.New("Service name is not valid")
+
+// InvalidNameError - the name of the service can not be used by the init
+// system, a bad name is rejected when the daemon is created instead of
+// failing in systemctl or in the file system.
+// errors.Is(err, ErrInvalidName) reports such errors.
+type InvalidNameError struct {
+	Name   string
+	Reason string
+}
+
+func (e *InvalidNameError) Error() string {
+	return "Service name " + strconv.Quote(e.Name) + " is not valid: " + e.Reason
+}
+
+// Is - the error matches ErrInvalidName
+func (e *InvalidNameError) Is(target error) bool {
+	return target == ErrInvalidName
+}
+
+// Longest name of a service, file names of up to 255 bytes keep room
+// for the suffixes of the service files (".service", ".plist", ".override")
+const maxNameLength = 240
+
+// ValidateName - check the name can be used as the name of a systemd unit,
+// a launchd label, an init script and a Windows service: ASCII letters,
+// digits, '_', '.', '-' and '@', starting with a letter or a digit.
+// New and NewFromDefinition replace the spaces of a name by '_' before.
+func ValidateName(name string) error {
+	switch {
+	case name == "":
+		return &InvalidNameError{Name: name, Reason: "it is empty"}
+	case len(name) > maxNameLength:
+		return &InvalidNameError{Name: name, Reason: "it is longer than " + strconv.Itoa(maxNameLength) + " bytes"}
+	case !alphanumeric(rune(name[0])):
+		return &InvalidNameError{Name: name, Reason: "it must start with a letter or a digit"}
+	}
+	for _, r := range name {
+		if !alphanumeric(r) && r != '_' && r != '.' && r != '-' && r != '@' {
+			return &InvalidNameError{Name: name, Reason: "it contains " + strconv.QuoteRune(r)}
+		}
+	}
+	return nil
+}
+
+// Check the name can be used by the kind of init system: the rc.d
+// variables of the service (<name>_enable, ...) are shell variables
+func checkName(kind Kind, def *Definition) error {
+	if err := ValidateName(def.Name); err != nil {
+		return err
+	}
+	if kind != KindRCD {
+		return nil
+	}
+	for _, r := range def.Name {
+		if !alphanumeric(r) && r != '_' {
+			return &InvalidNameError{Name: def.Name, Reason: "rc.d names contain letters, digits and '_' only"}
+		}
+	}
+	return nil
+}
+
+// Longest description of a service, longer ones are cut
+const maxDescriptionLength = 200
+
+// Quotes and escapes which would end the quoted description of the
+// service files (servname="..." of an init script, description "..."
+// of an upstart job) are replaced
+var descriptionReplacer = strings.NewReplacer(`"`, "'", "`", "'", `\`, "/")
+
+// NormalizeDescription - the description as the service files keep it:
+// a single line without control characters (a line break would end the
+// Description= of a unit and the LSB header) and without double quotes,
+// backquotes and backslashes, which are replaced by single quotes and
+// slashes, at most 200 characters, the name of the service if it is empty
+func NormalizeDescription(description, name string) string {
+	description = strings.Join(strings.FieldsFunc(description, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}), " ")
+	description = descriptionReplacer.Replace(description)
+	if description == "" {
+		return name
+	}
+	if runes := []rune(description); len(runes) > maxDescriptionLength {
+		description = strings.TrimSpace(string(runes[:maxDescriptionLength]))
+	}
+	return description
+}
+
+func alphanumeric(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
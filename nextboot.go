@@ -0,0 +1,79 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// NextBootMarker - path of the marker of a service which is deferred to
+// the next boot, see InstallForNextBoot
+func NextBootMarker(def *Definition) string {
+	name := def.Name + ".nextboot"
+	if userScope(def) {
+		dir, _ := os.UserConfigDir()
+		return filepath.Join(dir, "daemon", name)
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), def.Name, name)
+	}
+	return rooted("/var/lib/daemon/" + name)
+}
+
+// InstallForNextBoot - install the service and enable it at boot, but do not
+// start it before the next boot, e.g. if it requires kernel parameters which
+// apply after a reboot. The service is marked, so Ensure does not start it
+// either until the host was rebooted. In an offline image (see PathPrefix)
+// the service is installed and enabled only, the image boots anyway.
+func InstallForNextBoot(d Daemon, args ...string) (string, error) {
+	properties, ok := Properties(d)
+	if !ok {
+		return "", ErrUnsupportedSystem
+	}
+	if !offline() {
+		// the boot time is known before anything is installed
+		if _, err := bootTime(); err != nil {
+			return "", err
+		}
+	}
+	status, err := InstallAndEnable(d, args...)
+	if err != nil || offline() {
+		return status, err
+	}
+	properties.notice(NoticeRebootRequired, "Reboot the host to start the service", properties.def.Name)
+	marker := NextBootMarker(&properties.def)
+	if err := os.MkdirAll(filepath.Dir(marker), 0755); err != nil {
+		return status, err
+	}
+	// the time of the marker tells the boot it was written in
+	return status, ioutil.WriteFile(marker, []byte(properties.def.Name+"\n"), 0644)
+}
+
+// DeferredToBoot - check the service waits for the next boot: it was
+// installed by InstallForNextBoot and the host has not been rebooted since.
+// The marker of an earlier boot is removed.
+func DeferredToBoot(d Daemon) bool {
+	properties, ok := Properties(d)
+	if !ok {
+		return false
+	}
+	marker := NextBootMarker(&properties.def)
+	info, err := os.Stat(marker)
+	if err != nil {
+		return false
+	}
+	boot, err := bootTime()
+	if err != nil {
+		return true
+	}
+	if info.ModTime().After(boot) {
+		return true
+	}
+	os.Remove(marker)
+	return false
+}
@@ -0,0 +1,183 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Options of systemd.services.<name> which hold the dependencies of the
+// [Unit] and [Install] sections, the other keys go to unitConfig
+var nixosUnitOptions = map[string]string{
+	"Description": "description",
+	"Requires":    "requires",
+	"Wants":       "wants",
+	"After":       "after",
+	"Before":      "before",
+	"PartOf":      "partOf",
+	"OnFailure":   "onFailure",
+	"WantedBy":    "wantedBy",
+	"RequiredBy":  "requiredBy",
+	"Alias":       "aliases",
+}
+
+// Names which are valid Nix identifiers, others are quoted
+var nixIdentifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_'-]*$`)
+
+// nixosEntry - option of the module with its values, in the order of the unit
+type nixosEntry struct {
+	key    string
+	values []string
+}
+
+// nixosSection - options of an attribute set of the module
+type nixosSection struct {
+	entries []nixosEntry
+}
+
+// Add the value to the option, a repeated option becomes a list
+func (section *nixosSection) add(key string, values ...string) {
+	for i := range section.entries {
+		if section.entries[i].key == key {
+			section.entries[i].values = append(section.entries[i].values, values...)
+			return
+		}
+	}
+	section.entries = append(section.entries, nixosEntry{key: key, values: values})
+}
+
+// ExportNixOS - write a NixOS module which declares the service as
+// systemd.services.<name>, for hosts where the units in /etc/systemd/system
+// are generated from the configuration. The module is rendered from the
+// same systemd unit as Install writes: the dependencies become the options
+// of the module (after, wantedBy, ...), the environment becomes the
+// environment attribute set and the other keys of the unit are kept
+// in unitConfig and serviceConfig. It is imported by configuration.nix.
+func ExportNixOS(w io.Writer, def *Definition) error {
+	unit, err := Render(KindSystemD, def)
+	if err != nil {
+		return err
+	}
+
+	var options, unitConfig, serviceConfig nixosSection
+	environment := make(map[string]string)
+	section := ""
+	for _, line := range strings.Split(unit, "\n") {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "[") {
+			section = trimmed
+			continue
+		}
+		key, value, ok := keyValue(line)
+		if !ok || value == "" {
+			continue
+		}
+		if option, ok := nixosUnitOptions[key]; ok && section != "[Service]" {
+			if key == "Description" {
+				options.add(option, value)
+			} else {
+				options.add(option, strings.Fields(value)...)
+			}
+			continue
+		}
+		switch section {
+		case "[Unit]":
+			unitConfig.add(key, value)
+		case "[Service]":
+			if key == "Environment" {
+				for _, variable := range splitCommand(value) {
+					if i := strings.Index(variable, "="); i > 0 {
+						environment[variable[:i]] = strings.Replace(variable[i+1:], "%%", "%", -1)
+					}
+				}
+				continue
+			}
+			serviceConfig.add(key, value)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Managed by %s\n# %s\n", generatedBy, NewMetadata())
+	b.WriteString("{ config, lib, pkgs, ... }:\n\n{\n")
+	fmt.Fprintf(&b, "  systemd.services.%s = {\n", nixAttr(def.Name))
+	for _, entry := range options.entries {
+		if entry.key == "description" {
+			fmt.Fprintf(&b, "    description = %s;\n", nixString(entry.values[0]))
+			continue
+		}
+		fmt.Fprintf(&b, "    %s = %s;\n", entry.key, nixList(unique(entry.values)))
+	}
+	if len(environment) > 0 {
+		names := make([]string, 0, len(environment))
+		for name := range environment {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		b.WriteString("    environment = {\n")
+		for _, name := range names {
+			fmt.Fprintf(&b, "      %s = %s;\n", nixAttr(name), nixString(environment[name]))
+		}
+		b.WriteString("    };\n")
+	}
+	for _, config := range []struct {
+		name    string
+		section nixosSection
+	}{{"unitConfig", unitConfig}, {"serviceConfig", serviceConfig}} {
+		if len(config.section.entries) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "    %s = {\n", config.name)
+		for _, entry := range config.section.entries {
+			value := nixString(entry.values[0])
+			if len(entry.values) > 1 {
+				value = nixList(entry.values)
+			}
+			fmt.Fprintf(&b, "      %s = %s;\n", nixAttr(entry.key), value)
+		}
+		b.WriteString("    };\n")
+	}
+	b.WriteString("  };\n}\n")
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// Name of an attribute, quoted unless it is a Nix identifier
+func nixAttr(name string) string {
+	if nixIdentifierRegexp.MatchString(name) {
+		return name
+	}
+	return nixString(name)
+}
+
+// Nix string literal, the interpolation is escaped
+func nixString(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", `\${`, "\n", `\n`).Replace(value)
+	return `"` + value + `"`
+}
+
+// Nix list of strings
+func nixList(values []string) string {
+	items := make([]string, len(values))
+	for i, value := range values {
+		items[i] = nixString(value)
+	}
+	return "[ " + strings.Join(items, " ") + " ]"
+}
+
+// Values without repetitions, in their order
+func unique(values []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,72 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+// Codes of the post-install notices
+const (
+	// NoticeUserCreated - the account of the service was created
+	NoticeUserCreated = "user-created"
+
+	// NoticeBinaryInstalled - the executable was copied to the install path
+	NoticeBinaryInstalled = "binary-installed"
+
+	// NoticeOpenPort - the port of the service may have to be opened in the firewall
+	NoticeOpenPort = "open-port"
+
+	// NoticeRebootRequired - the host must be rebooted before the service works
+	NoticeRebootRequired = "reboot-required"
+)
+
+// Notice - structured message about what Install did or what is left to the
+// administrator, e.g. to be presented by a graphical installer
+type Notice struct {
+	// Code of the notice, e.g. NoticeOpenPort
+	Code string `json:"code"`
+
+	// Message - explanation for the administrator
+	Message string `json:"message"`
+
+	// Value the notice refers to, e.g. the name of the user or the port
+	Value string `json:"value,omitempty"`
+}
+
+// Noticer interface is implemented by daemons which report
+// the post-install notices of their last Install
+type Noticer interface {
+	// Notices - notices of the last Install
+	Notices() []Notice
+}
+
+// Notices - post-install notices of the last Install of the daemon
+func (properties *ServiceProperties) Notices() []Notice {
+	return append([]Notice(nil), properties.notices...)
+}
+
+// RebootRequired - the last Install requires a reboot of the host
+func (properties *ServiceProperties) RebootRequired() bool {
+	for _, notice := range properties.notices {
+		if notice.Code == NoticeRebootRequired {
+			return true
+		}
+	}
+	return false
+}
+
+// Start collecting the notices of an Install
+func (properties *ServiceProperties) resetNotices() {
+	properties.notices = nil
+}
+
+// Record a notice of the current Install
+func (properties *ServiceProperties) notice(code, message, value string) {
+	properties.notices = append(properties.notices, Notice{code, message, value})
+}
+
+// Record the notices which follow from the definition after a successful Install
+func (properties *ServiceProperties) installNotices() {
+	for _, port := range properties.def.Ports {
+		properties.notice(NoticeOpenPort, "Open port "+port+" in the firewall, if the service is reached from other hosts", port)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import "errors"
+
+var (
+	// ErrAlreadyPaused appears if try to pause a service which is paused
+	ErrAlreadyPaused = errors.New("Service is already paused")
+
+	// ErrNotPaused appears if try to resume a service which is not paused
+	ErrNotPaused = errors.New("Service is not paused")
+)
+
+// Pauser interface is implemented by daemons which are able to freeze the
+// running service and to let it continue, it keeps its memory meanwhile
+type Pauser interface {
+	// Pause - stop the processes of the running service (SIGSTOP), its
+	// status is StatusPaused until Resume
+	Pause() error
+
+	// Resume - let the processes of the paused service continue (SIGCONT)
+	Resume() error
+}
+
+// Pause - freeze the running service of the daemon without losing its state:
+// SIGSTOP is sent to the processes of the systemd unit (systemctl kill), to
+// the launchd job (launchctl kill) and to the process group of the service
+// of the other init systems, the Windows service is paused by the service
+// manager. ErrAlreadyStopped is returned if the service does not run,
+// ErrAlreadyPaused if it is paused.
+func Pause(d Daemon) error {
+	if pauser, ok := d.(Pauser); ok {
+		return pauser.Pause()
+	}
+	return ErrUnsupportedSystem
+}
+
+// Resume - let the paused service of the daemon continue (SIGCONT),
+// ErrNotPaused is returned if it is not paused
+func Resume(d Daemon) error {
+	if pauser, ok := d.(Pauser); ok {
+		return pauser.Resume()
+	}
+	return ErrUnsupportedSystem
+}
+
+// Check the service can be paused (or resumed) by its installation and
+// its status, the message of the status is returned
+func checkPause(installed bool, running func() (string, bool), pause bool) (string, error) {
+	if offline() {
+		return "", ErrOfflineImage
+	}
+	if !installed {
+		return "", ErrNotInstalled
+	}
+	text, ok := running()
+	if !ok {
+		return text, ErrAlreadyStopped
+	}
+	paused := ParseStatus(text).State == StatusPaused
+	switch {
+	case pause && paused:
+		return text, ErrAlreadyPaused
+	case !pause && !paused:
+		return text, ErrNotPaused
+	}
+	return text, nil
+}
+
+// Name of the signal which pauses or resumes a service
+func pauseSignal(pause bool) string {
+	if pause {
+		return "SIGSTOP"
+	}
+	return "SIGCONT"
+}
@@ -0,0 +1,64 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Signals of pauseSignal
+var pauseSignals = map[string]syscall.Signal{
+	"SIGSTOP": syscall.SIGSTOP,
+	"SIGCONT": syscall.SIGCONT,
+}
+
+// Check the process is stopped by a signal: the state in /proc/<pid>/stat
+// on Linux, the one of ps on the other systems
+func processPaused(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	var state string
+	if data, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat"); err == nil {
+		// the name of the command in parentheses may contain spaces
+		if i := strings.LastIndex(string(data), ")"); i >= 0 {
+			state = strings.TrimSpace(string(data[i+1:]))
+		}
+	} else if output, err := exec.Command("ps", "-o", "state=", "-p", strconv.Itoa(pid)).Output(); err == nil {
+		state = strings.TrimSpace(string(output))
+	}
+	return strings.HasPrefix(state, "T")
+}
+
+// Send the signal of pauseSignal to the process group of the service by the
+// status message, to the process only if it is in the group of this process
+func signalService(text, signal string) error {
+	pid := ParseStatus(text).PID
+	if pid <= 0 {
+		return ErrUnsupportedSystem
+	}
+	sig := pauseSignals[signal]
+	if group, err := syscall.Getpgid(pid); err == nil && group != syscall.Getpgrp() {
+		return syscall.Kill(-group, sig)
+	}
+	return syscall.Kill(pid, sig)
+}
+
+// Let the service continue if it is paused, a stopped process would not
+// handle the signal by which the init script stops it
+func resumePaused(text string) {
+	if ParseStatus(text).State == StatusPaused {
+		if err := signalService(text, "SIGCONT"); err != nil {
+			diagnostics.Println("Service could not be resumed before it is stopped:", err)
+		}
+	}
+}
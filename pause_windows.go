@@ -0,0 +1,19 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+// The services of Windows are paused by the service manager, their
+// processes are not stopped by signals
+func processPaused(pid int) bool {
+	return false
+}
+
+// The services of Windows are not signalled
+func signalService(text, signal string) error {
+	return ErrUnsupportedSystem
+}
+
+// The services of Windows are stopped by the service manager
+func resumePaused(text string) {}
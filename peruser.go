@@ -0,0 +1,88 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"strconv"
+
+	"github.com/takama/daemon/autostart"
+	"github.com/takama/daemon/launchd"
+	"github.com/takama/daemon/systemd"
+)
+
+// Directory of the runtime directories of the users which are logged in (linux)
+const userRuntimeDir = "/run/user/"
+
+// Check the init system is able to run an instance of the service per user:
+// a systemd template unit which is started with user@<uid>.service,
+// or a launchd agent
+func checkPerUser(kind Kind, def *Definition) error {
+	if !def.PerUser || kind == KindSystemD || kind == KindLaunchd {
+		return nil
+	}
+	return &UnsupportedOptionError{"per_user", kind}
+}
+
+// Account in the service file, the instances of a per-user service
+// run as their users (the instance of the systemd template is the uid)
+func serviceAccount(kind Kind, def *Definition) (user, group string) {
+	switch {
+	case !def.PerUser:
+		return def.User, def.Group
+	case kind == KindSystemD:
+		return "%i", ""
+	}
+	return "", ""
+}
+
+// Path of the service file of the definition, per-user services have
+// a template unit or an agent, services of the user scope are in the home
+// directory of the user
+func definitionPath(kind Kind, def *Definition) (string, error) {
+	if userScope(def) {
+		switch kind {
+		case KindSystemD:
+			unit := systemd.New(def.Name)
+			unit.User = true
+			return unit.Path(), nil
+		case KindLaunchd:
+			job := launchd.New(def.Name)
+			job.Agent, job.User = true, true
+			return job.Path(), nil
+		case KindAutostart:
+			return autostart.New(def.Name).Path(), nil
+		}
+	}
+	if def.PerUser {
+		switch kind {
+		case KindSystemD:
+			unit := systemd.New(def.Name)
+			unit.Template = true
+			return unit.Path(), nil
+		case KindLaunchd:
+			job := launchd.New(def.Name)
+			job.Agent = true
+			return job.Path(), nil
+		}
+	}
+	return ServicePath(kind, def.Name)
+}
+
+// Uids of the users which are logged in, their runtime directories exist
+// while their user managers are running (linux)
+func sessionUsers() []string {
+	entries, err := ioutil.ReadDir(userRuntimeDir)
+	if err != nil {
+		return nil
+	}
+	var uids []string
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() {
+			uids = append(uids, entry.Name())
+		}
+	}
+	return uids
+}
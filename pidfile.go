@@ -0,0 +1,64 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// servicePIDFile - PID file of the main process which the service file
+// declares (PIDFile= of a systemd unit) and Run writes
+type servicePIDFile struct {
+	path string
+	pid  int
+}
+
+// Path of the PID file which the installed unit declares, empty if the
+// unit has none (a custom template, a service of the users)
+func declaredPIDFile(unitPath string) string {
+	content, err := ioutil.ReadFile(unitPath)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if key, value, ok := keyValue(line); ok && key == "PIDFile" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Write the PID of the process to the PID file which the unit declares,
+// the manager reads the main process of the service from it, so the stop
+// signal of KillMode=process and mixed reaches the process which runs the
+// executable. The file is written on a best effort basis: a service which
+// runs as another user may not write to /var/run.
+func writePIDFile(unitPath string) *servicePIDFile {
+	path := declaredPIDFile(unitPath)
+	if path == "" {
+		return nil
+	}
+	pidFile := &servicePIDFile{path: path, pid: os.Getpid()}
+	if err := ioutil.WriteFile(path, []byte(strconv.Itoa(pidFile.pid)+"\n"), 0644); err != nil {
+		diagnostics.Println("PID file", path, "could not be written:", err)
+		return nil
+	}
+	return pidFile
+}
+
+// Close - remove the PID file, unless another process has replaced it
+func (pidFile *servicePIDFile) Close() error {
+	if pidFile == nil {
+		return nil
+	}
+	content, err := ioutil.ReadFile(pidFile.path)
+	if err != nil || strings.TrimSpace(string(content)) != strconv.Itoa(pidFile.pid) {
+		return nil
+	}
+	return os.Remove(pidFile.path)
+}
@@ -0,0 +1,78 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrOfflineImage appears if a service of an offline image is started,
+// stopped or queried, see SetPathPrefix
+var ErrOfflineImage = errors.New("Service of an offline image can not be controlled")
+
+// Root directory of an offline image, empty for the running system
+var pathPrefix = struct {
+	sync.Mutex
+	root string
+}{}
+
+// SetPathPrefix - install the services into the offline image mounted at
+// root (e.g. /mnt/image) instead of the running system: the service files,
+// the runlevel links, the installed executable and the directories of
+// the services are written under root, the services are enabled by
+// systemctl --root and the accounts are created by useradd --root.
+// The init system is not reloaded and Start, Stop and Status fail with
+// ErrOfflineImage. The ownership of the directories is applied by
+// the first Start on the booted image. An empty root restores the
+// running system.
+func SetPathPrefix(root string) {
+	pathPrefix.Lock()
+	defer pathPrefix.Unlock()
+	if root != "" {
+		root = filepath.Clean(root)
+	}
+	if root == "/" {
+		root = ""
+	}
+	pathPrefix.root = root
+}
+
+// PathPrefix - root directory of the offline image, empty for the running system
+func PathPrefix() string {
+	pathPrefix.Lock()
+	defer pathPrefix.Unlock()
+	return pathPrefix.root
+}
+
+// Path under the root of the offline image
+func rooted(path string) string {
+	return PathPrefix() + path
+}
+
+// Check the services are installed into an offline image
+func offline() bool {
+	return PathPrefix() != ""
+}
+
+// Check the passwd or group file of the image has an entry of the name
+func imageEntry(file, name string) bool {
+	f, err := os.Open(rooted(file))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), name+":") {
+			return true
+		}
+	}
+	return false
+}
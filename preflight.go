@@ -0,0 +1,90 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"net"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// PreflightError - problems which would make the service fail right after start
+type PreflightError struct {
+	Problems []string
+}
+
+func (e *PreflightError) Error() string {
+	return "Pre-flight check failed: " + strings.Join(e.Problems, "; ")
+}
+
+// Preflight - check the executable of the service exists and is executable,
+// and the ports declared by the definition are not bound by another process.
+// It returns a *PreflightError which lists all found problems.
+//
+// Daemons check it before Start if the definition has Preflight set.
+func Preflight(def *Definition) error {
+	var problems []string
+
+	path, err := serviceExecutable(def)
+	if err != nil {
+		problems = append(problems, "executable could not be found: "+err.Error())
+	}
+	if path != "" {
+		if problem := checkExecutable(path); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	for _, port := range def.Ports {
+		if problem := checkPort(port); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &PreflightError{Problems: problems}
+	}
+	return nil
+}
+
+// Check the file exists and may be executed
+func checkExecutable(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "executable " + path + " does not exist"
+	}
+	if info.IsDir() {
+		return "executable " + path + " is a directory"
+	}
+	if runtime.GOOS != "windows" && info.Mode()&0111 == 0 {
+		return "executable " + path + " has no execute permission"
+	}
+	return ""
+}
+
+// Check nobody listens on the port by binding it for a moment,
+// ports are given as "[network/]address", e.g. ":8080" or "udp/:53"
+func checkPort(port string) string {
+	network, address := "tcp", port
+	if i := strings.Index(port, "/"); i >= 0 {
+		network, address = port[:i], port[i+1:]
+	}
+	switch {
+	case strings.HasPrefix(network, "udp"):
+		conn, err := net.ListenPacket(network, address)
+		if err != nil {
+			return "port " + port + " is not available: " + err.Error()
+		}
+		conn.Close()
+	default:
+		listener, err := net.Listen(network, address)
+		if err != nil {
+			return "port " + port + " is not available: " + err.Error()
+		}
+		listener.Close()
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Paths of the drop-ins of the kernel prerequisites on linux
+const (
+	SysctlDir      = "/etc/sysctl.d/"
+	ModulesLoadDir = "/etc/modules-load.d/"
+)
+
+// SysctlPath - path of the sysctl drop-in of the service (linux)
+func SysctlPath(def *Definition) string {
+	return SysctlDir + "99-" + def.Name + ".conf"
+}
+
+// ModulesLoadPath - path of the modules-load drop-in of the service (linux)
+func ModulesLoadPath(def *Definition) string {
+	return ModulesLoadDir + def.Name + ".conf"
+}
+
+// Sysctl settings of the definition as "key = value" lines sorted by the keys
+func sysctlLines(def *Definition) []string {
+	keys := make([]string, 0, len(def.Sysctls))
+	for key := range def.Sysctls {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	lines := make([]string, len(keys))
+	for i, key := range keys {
+		lines[i] = key + " = " + def.Sysctls[key]
+	}
+	return lines
+}
+
+// Render a drop-in of the kernel prerequisites
+func renderDropIn(lines []string) string {
+	return "# Managed by " + generatedBy + "\n# " + NewMetadata().String() + "\n" +
+		strings.Join(lines, "\n") + "\n"
+}
+
+// Drop-ins of the kernel prerequisites which are installed by a bundle (linux)
+func prerequisiteFiles(kind Kind, def *Definition) []bundleFile {
+	if !linuxKind(kind) {
+		return nil
+	}
+	var files []bundleFile
+	if len(def.Sysctls) > 0 {
+		files = append(files, bundleFile{"root" + SysctlPath(def), 0644, renderDropIn(sysctlLines(def))})
+	}
+	if len(def.KernelModules) > 0 {
+		files = append(files, bundleFile{"root" + ModulesLoadPath(def), 0644, renderDropIn(def.KernelModules)})
+	}
+	return files
+}
+
+// Shell commands which apply the kernel prerequisites of a bundle
+func prerequisitesScript(kind Kind, def *Definition) string {
+	var b strings.Builder
+	switch {
+	case linuxKind(kind):
+		if len(def.Sysctls) > 0 {
+			fmt.Fprintf(&b, "sysctl -p %s\n", SysctlPath(def))
+		}
+		for _, module := range def.KernelModules {
+			fmt.Fprintf(&b, "modprobe %s\n", module)
+		}
+	case kind == KindRCD:
+		for _, line := range sysctlLines(def) {
+			setting := strings.Replace(line, " = ", "=", 1)
+			fmt.Fprintf(&b, "sysctl %s\necho \"%s # %s\" >> /etc/sysctl.conf.local\n", setting, setting, def.Name)
+		}
+		for _, module := range def.KernelModules {
+			fmt.Fprintf(&b, "sysrc kld_list+=%s\nkldload -n %s\n", module, module)
+		}
+	}
+	return b.String()
+}
+
+// Shell commands which remove the kernel prerequisites of a bundle from the configuration
+func removePrerequisitesScript(kind Kind, def *Definition) string {
+	if kind != KindRCD {
+		return ""
+	}
+	var b strings.Builder
+	if len(def.Sysctls) > 0 {
+		fmt.Fprintf(&b, "sed -i '' '/ # %s$/d' /etc/sysctl.conf.local\n", def.Name)
+	}
+	for _, module := range def.KernelModules {
+		fmt.Fprintf(&b, "sysrc kld_list-=%s\n", module)
+	}
+	return b.String()
+}
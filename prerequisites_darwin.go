@@ -0,0 +1,14 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+// Kernel parameters and modules are not managed by the service on this system
+func installPrerequisites(def *Definition) error {
+	return nil
+}
+
+func removePrerequisites(def *Definition) error {
+	return nil
+}
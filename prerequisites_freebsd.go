@@ -0,0 +1,80 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// SysctlConf - local sysctl configuration of FreeBSD, the settings of
+// a service are marked by its name
+const SysctlConf = "/etc/sysctl.conf.local"
+
+// Apply the sysctl settings and load the kernel modules of the service,
+// they are kept in sysctl.conf.local and in kld_list of rc.conf
+func installPrerequisites(def *Definition) error {
+	if len(def.Sysctls) > 0 {
+		if err := editSysctlConf(def, sysctlLines(def)); err != nil {
+			return err
+		}
+		for key, value := range def.Sysctls {
+			if err := exec.Command("sysctl", key+"="+value).Run(); err != nil {
+				return err
+			}
+		}
+	}
+	for _, module := range def.KernelModules {
+		if err := exec.Command("sysrc", "kld_list+="+module).Run(); err != nil {
+			return err
+		}
+		// the module may be loaded already
+		exec.Command("kldload", "-n", module).Run()
+	}
+	return nil
+}
+
+// Remove the settings and the modules of the service from the configuration,
+// the applied settings and the loaded modules are kept until the next boot
+func removePrerequisites(def *Definition) error {
+	if len(def.Sysctls) > 0 {
+		if err := editSysctlConf(def, nil); err != nil {
+			return err
+		}
+	}
+	for _, module := range def.KernelModules {
+		if err := exec.Command("sysrc", "kld_list-="+module).Run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replace the marked settings of the service in sysctl.conf.local
+func editSysctlConf(def *Definition, lines []string) error {
+	mark := " # " + def.Name
+	data, err := ioutil.ReadFile(SysctlConf)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var kept []string
+	if len(data) > 0 {
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			if !strings.HasSuffix(line, mark) {
+				kept = append(kept, line)
+			}
+		}
+	}
+	for _, line := range lines {
+		kept = append(kept, strings.Replace(line, " = ", "=", 1)+mark)
+	}
+	content := ""
+	if len(kept) > 0 {
+		content = strings.Join(kept, "\n") + "\n"
+	}
+	return ioutil.WriteFile(SysctlConf, []byte(content), 0644)
+}
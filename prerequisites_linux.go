@@ -0,0 +1,50 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+// Write the sysctl and modules-load drop-ins of the service and apply them,
+// the drop-ins of an offline image are applied when it boots
+func installPrerequisites(def *Definition) error {
+	if len(def.Sysctls) > 0 {
+		if err := ioutil.WriteFile(rooted(SysctlPath(def)), []byte(renderDropIn(sysctlLines(def))), 0644); err != nil {
+			return err
+		}
+		if !offline() {
+			if err := exec.Command("sysctl", "-p", SysctlPath(def)).Run(); err != nil {
+				return err
+			}
+		}
+	}
+	if len(def.KernelModules) > 0 {
+		if err := ioutil.WriteFile(rooted(ModulesLoadPath(def)), []byte(renderDropIn(def.KernelModules)), 0644); err != nil {
+			return err
+		}
+		if !offline() {
+			for _, module := range def.KernelModules {
+				if err := exec.Command("modprobe", module).Run(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Remove the drop-ins of the service, the applied settings and the loaded
+// modules are kept until the next boot
+func removePrerequisites(def *Definition) error {
+	for _, path := range []string{SysctlPath(def), ModulesLoadPath(def)} {
+		if err := os.Remove(rooted(path)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
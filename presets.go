@@ -0,0 +1,164 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Names of the built-in template presets
+const (
+	// PresetMinimal - only the settings which are needed to run the service
+	PresetMinimal = "minimal"
+
+	// PresetHardened - the service is sandboxed (read-only system,
+	// private /tmp and devices, no new privileges)
+	PresetHardened = "hardened"
+
+	// PresetForking - the executable puts itself in the background
+	// and writes the pid file /var/run/<name>.pid
+	PresetForking = "forking-daemon"
+
+	// PresetOneshot - the executable does its work and exits,
+	// the service is considered active afterwards
+	PresetOneshot = "oneshot"
+
+	// PresetNotify - the executable reports its readiness by Ready
+	PresetNotify = "notify"
+
+	// PresetContainer - the service runs in a container: no pid file,
+	// output to the console, always restarted
+	PresetContainer = "container-friendly"
+
+	// PresetContainerClient - the service uses the containers of the Docker
+	// daemon (or Podman, if the definition needs DependencyPodman): it is
+	// started after the daemon and stopped and started again with it
+	PresetContainerClient = "container-client"
+)
+
+// ErrUnknownPreset appears if the definition refers to a preset which does not exist
+var ErrUnknownPreset = errors.New("Unknown template preset")
+
+// Presets of the systemd unit
+var (
+	systemDMinimal = `# Managed by github.com/takama/daemon
+# {{.Metadata}}
+[Unit]
+Description={{.Description}}
+{{if .After}}After={{range $i, $name := .After}}{{if $i}} {{end}}{{$name}}.service{{end}}
+{{end}}
+[Service]
+{{if .User}}User={{.User}}
+{{end}}ExecStart={{.Path}} {{.Args}}
+Restart=on-failure
+` + systemDInstall
+
+	systemDHardened = systemDUnit + `ExecStart={{.Path}} {{.Args}}
+` + systemDOutput + `Restart=on-failure
+NoNewPrivileges=yes
+ProtectSystem=strict
+ProtectHome=yes
+PrivateTmp=yes
+PrivateDevices=yes
+ProtectKernelTunables=yes
+ProtectKernelModules=yes
+ProtectControlGroups=yes
+RestrictSUIDSGID=yes
+LockPersonality=yes
+{{if eq .Logging "file"}}ReadWritePaths={{.LogDir}}
+{{end}}{{if .StateDir}}ReadWritePaths={{.StateDir}}
+{{end}}{{if .RuntimeDir}}ReadWritePaths={{.RuntimeDir}}
+{{end}}` + systemDInstall
+
+	systemDForking = systemDUnit + `Type=forking
+PIDFile=/var/run/{{.Name}}.pid
+GuessMainPID=no
+ExecStart={{.Path}} {{.Args}}
+` + systemDOutput + `Restart=on-failure
+` + systemDInstall
+
+	systemDOneshot = systemDUnit + `Type=oneshot
+RemainAfterExit=yes
+ExecStart={{.Path}} {{.Args}}
+` + systemDOutput + systemDInstall
+
+	systemDNotify = systemDUnit + `Type=notify
+NotifyAccess={{if .Upgrade}}all{{else}}main{{end}}
+ExecStart={{.Path}} {{.Args}}
+` + systemDOutput + `Restart=on-failure
+` + systemDInstall
+
+	systemDContainer = systemDUnit + `ExecStart={{.Path}} {{.Args}}
+StandardOutput=journal+console
+StandardError=journal+console
+KillMode=mixed
+Restart=always
+` + systemDInstall
+
+	systemDContainerClient = strings.Replace(systemDUnit, "{{end}}\n[Service]\n", `{{end}}{{if .BindsTo}}BindsTo={{.BindsTo}}
+PartOf={{.BindsTo}}
+{{end}}
+[Service]
+`, 1) + `ExecStart={{.Path}} {{.Args}}
+` + systemDOutput + `Restart=always
+{{if not .RestartDelay}}RestartSec=5
+{{end}}` + strings.Replace(systemDInstall, "{{if .Target}} {{.Target}}.target{{end}}",
+		"{{if .Target}} {{.Target}}.target{{end}}{{if .BindsTo}} {{.BindsTo}}{{end}}", 1)
+)
+
+// Presets by name and kind of init system, a preset which has no variant
+// for the kind of init system renders the default template
+var presets = map[string]map[Kind]string{
+	PresetMinimal: {
+		KindSystemD: systemDMinimal,
+		KindLaunchd: strings.Replace(propertyList, "    <key>WorkingDirectory</key>\n    <string>/usr/local/var</string>\n", "", 1),
+	},
+	PresetHardened: {KindSystemD: systemDHardened},
+	PresetForking:  {KindSystemD: systemDForking},
+	PresetOneshot: {
+		KindSystemD: systemDOneshot,
+		KindUpstart: strings.Replace(upstatConfig, "\nrespawn\n", "\ntask\n", 1),
+		KindLaunchd: strings.Replace(propertyList, "{{else}}<true/>{{end}}", "{{else}}<false/>{{end}}", 1),
+	},
+	PresetNotify:    {KindSystemD: systemDNotify},
+	PresetContainer: {KindSystemD: systemDContainer},
+	// the default templates of the other init systems are ordered after
+	// the container engine by the needs of the definition
+	PresetContainerClient: {KindSystemD: systemDContainerClient},
+}
+
+// Presets - names of the built-in template presets
+func Presets() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Template of the service file for the definition: the custom template,
+// the preset or the default template of the kind of init system
+func serviceTemplate(kind Kind, def *Definition) (string, error) {
+	text, ok := templates[kind]
+	if !ok {
+		return "", ErrUnsupportedKind
+	}
+	if def.Template != "" {
+		return def.Template, nil
+	}
+	if def.Preset != "" {
+		variants, ok := presets[def.Preset]
+		if !ok {
+			return "", ErrUnknownPreset
+		}
+		if variant, ok := variants[kind]; ok {
+			return variant, nil
+		}
+	}
+	return text, nil
+}
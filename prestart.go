@@ -0,0 +1,21 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+// Check the init system runs the pre-start commands as root, even if the
+// service runs as another user: systemd (ExecStartPre=+), the start of the
+// System V script and the start_precmd of rc.d before daemon(8) drops the
+// privileges; the setuid of upstart applies to the pre-start script as
+// well, launchd and the windows service manager have no such hook
+func checkPreStartCommands(kind Kind, def *Definition) error {
+	if len(def.PreStartCommands) == 0 {
+		return nil
+	}
+	switch kind {
+	case KindSystemD, KindSystemV, KindRCD:
+		return nil
+	}
+	return &UnsupportedOptionError{"pre_start_commands", kind}
+}
@@ -0,0 +1,59 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+// Phase - phase of Install or Start, which is reported to the progress callback
+type Phase string
+
+// Phases of Install and Start
+const (
+	// PhaseRendering - the service file is rendered
+	PhaseRendering Phase = "rendering"
+
+	// PhaseWriting - the service file is written
+	PhaseWriting Phase = "writing"
+
+	// PhaseReloading - the init system rereads its service files
+	PhaseReloading Phase = "reloading"
+
+	// PhaseEnabling - the service is enabled to start at boot
+	PhaseEnabling Phase = "enabling"
+
+	// PhaseStarting - the init system starts the service
+	PhaseStarting Phase = "starting"
+
+	// PhaseWaitingReady - the init system waits until the service reports
+	// its readiness (notify and forking services)
+	PhaseWaitingReady Phase = "waiting-ready"
+)
+
+// ProgressFunc - callback which receives the phases of the service name,
+// it is called synchronously, so it should return quickly (e.g. send
+// the phase to a buffered channel)
+type ProgressFunc func(name string, phase Phase)
+
+// ProgressReporter interface is implemented by daemons which report
+// the phases of Install and Start
+type ProgressReporter interface {
+	// SetProgress - set the callback which receives the phases, nil disables it
+	SetProgress(progress ProgressFunc)
+}
+
+// SetProgress - set the callback which receives the phases of Install and Start
+func (properties *ServiceProperties) SetProgress(progress ProgressFunc) {
+	properties.progressFunc = progress
+}
+
+// Report a phase to the progress callback
+func (properties *ServiceProperties) progress(phase Phase) {
+	if properties.progressFunc != nil {
+		properties.progressFunc(properties.def.Name, phase)
+	}
+}
+
+// The init system waits for the readiness of the service when it starts it
+func waitsReady(def *Definition) bool {
+	return def.Forking || def.Preset == PresetNotify
+}
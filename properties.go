@@ -0,0 +1,217 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+// ServiceProperties - properties of a service which are shared by
+// the daemons of all kinds of init systems
+type ServiceProperties struct {
+	def Definition
+	// notices of the last Install
+	notices []Notice
+	// non-fatal problems of the last operation
+	warnings []Warning
+	// callback which receives the phases of Install and Start
+	progressFunc ProgressFunc
+	// trace ID of the operations, see SetTraceID
+	traceID string
+	// the last mutating operation changed the system
+	changed bool
+}
+
+// Copy the definition, so later changes of the caller do not affect the daemon
+func newProperties(def *Definition) ServiceProperties {
+	properties := ServiceProperties{def: *def}
+	properties.def.Dependencies = copyStrings(def.Dependencies)
+	properties.def.Args = copyStrings(def.Args)
+	properties.def.After = copyStrings(def.After)
+	properties.def.Before = copyStrings(def.Before)
+	properties.def.Aliases = copyStrings(def.Aliases)
+	properties.def.Ports = copyStrings(def.Ports)
+	properties.def.OnFailure = copyStrings(def.OnFailure)
+	properties.def.WatchPaths = copyStrings(def.WatchPaths)
+	properties.def.StopAfter = copyStrings(def.StopAfter)
+	properties.def.RCRequire = copyStrings(def.RCRequire)
+	properties.def.RCKeywords = copyStrings(def.RCKeywords)
+	properties.def.QueueDirectories = copyStrings(def.QueueDirectories)
+	properties.def.StopCommands = copyStrings(def.StopCommands)
+	properties.def.PostStopCommands = copyStrings(def.PostStopCommands)
+	properties.def.PreStartCommands = copyStrings(def.PreStartCommands)
+	properties.def.ConditionCommands = copyStrings(def.ConditionCommands)
+	properties.def.RequiredFiles = copyStrings(def.RequiredFiles)
+	properties.def.UdevRules = copyStrings(def.UdevRules)
+	properties.def.KernelModules = copyStrings(def.KernelModules)
+	properties.def.RestrictAddressFamilies = copyStrings(def.RestrictAddressFamilies)
+	properties.def.SystemCallFilter = copyStrings(def.SystemCallFilter)
+	properties.def.DelegateControllers = copyStrings(def.DelegateControllers)
+	properties.def.Sysctls = copyMap(def.Sysctls)
+	properties.def.Environment = copyMap(def.Environment)
+	if def.Needs != nil {
+		properties.def.Needs = append([]Dependency(nil), def.Needs...)
+	}
+	if def.Paths != nil {
+		properties.def.Paths = append([]PathSpec(nil), def.Paths...)
+	}
+	if def.Watch != nil {
+		properties.def.Watch = append([]PathSpec(nil), def.Watch...)
+	}
+	if def.ConfigFiles != nil {
+		properties.def.ConfigFiles = append([]ConfigFile(nil), def.ConfigFiles...)
+	}
+	if def.Socket != nil {
+		socket := *def.Socket
+		socket.ListenStream = copyStrings(socket.ListenStream)
+		socket.ListenDatagram = copyStrings(socket.ListenDatagram)
+		properties.def.Socket = &socket
+	}
+	if def.Timer != nil {
+		timer := *def.Timer
+		properties.def.Timer = &timer
+	}
+	if def.Registration != nil {
+		registration := *def.Registration
+		registration.Tags = copyStrings(registration.Tags)
+		properties.def.Registration = &registration
+	}
+	return properties
+}
+
+// Properties - properties of the daemon, ok is false if the daemon
+// was not created by this package
+func Properties(d Daemon) (properties *ServiceProperties, ok bool) {
+	holder, ok := d.(interface {
+		serviceProperties() *ServiceProperties
+	})
+	if !ok {
+		return nil, false
+	}
+	return holder.serviceProperties(), true
+}
+
+func (properties *ServiceProperties) serviceProperties() *ServiceProperties {
+	return properties
+}
+
+// Name - name of the service
+func (properties *ServiceProperties) Name() string {
+	return properties.def.Name
+}
+
+// Description - explanation of the service
+func (properties *ServiceProperties) Description() string {
+	return properties.def.Description
+}
+
+// SetDescription - change the explanation of the service,
+// it is used by the following Install, see NormalizeDescription
+func (properties *ServiceProperties) SetDescription(description string) {
+	properties.def.Description = NormalizeDescription(description, properties.def.Name)
+}
+
+// Dependencies - services which are required by the service
+func (properties *ServiceProperties) Dependencies() []string {
+	return copyStrings(properties.def.Dependencies)
+}
+
+// SetDependencies - change the services which are required by the service,
+// they are used by the following Install
+func (properties *ServiceProperties) SetDependencies(dependencies ...string) {
+	properties.def.Dependencies = copyStrings(dependencies)
+}
+
+// Args - default arguments of the executable
+func (properties *ServiceProperties) Args() []string {
+	return copyStrings(properties.def.Args)
+}
+
+// SetArgs - change the default arguments of the executable,
+// arguments given to Install still override them
+func (properties *ServiceProperties) SetArgs(args ...string) {
+	properties.def.Args = copyStrings(args)
+}
+
+// Clone - create a new daemon for the current host with the same definition
+// (template, arguments, directories, etc) under another name, the clone
+// does not share anything with the original daemon
+func (properties *ServiceProperties) Clone(newName string) (Daemon, error) {
+	def := properties.Definition()
+	def.Name = newName
+	return NewFromDefinition(def)
+}
+
+// Definition - copy of the whole definition of the service
+func (properties *ServiceProperties) Definition() *Definition {
+	return properties.definition(nil)
+}
+
+// Definition of the service, arguments given to Install override the defined ones
+func (properties *ServiceProperties) definition(args []string) *Definition {
+	def := newProperties(&properties.def).def
+	if len(args) > 0 {
+		def.Args = copyStrings(args)
+	}
+	return &def
+}
+
+// Pre-flight check before start, if it is enabled by the definition
+func (properties *ServiceProperties) preflight() error {
+	if !properties.def.Preflight {
+		return nil
+	}
+	return Preflight(properties.definition(nil))
+}
+
+// Conflict check before install, if it is enabled by the definition
+func (properties *ServiceProperties) checkConflicts(kind Kind) error {
+	if !properties.def.CheckConflicts {
+		return nil
+	}
+	found, err := conflicts(kind, properties.definition(nil))
+	if err != nil {
+		return err
+	}
+	if len(found) > 0 {
+		return &ConflictError{Conflicts: found}
+	}
+	return nil
+}
+
+// Template of the service file for the given kind of init system
+func (properties *ServiceProperties) template(kind Kind) string {
+	text, err := serviceTemplate(kind, &properties.def)
+	if err != nil {
+		return templates[kind]
+	}
+	return text
+}
+
+// Replace the template of the service file, it must be parsable,
+// an empty one restores the default template
+func (properties *ServiceProperties) setTemplate(text string) error {
+	if text != "" {
+		if err := validateTemplate(text); err != nil {
+			return err
+		}
+	}
+	properties.def.Template = text
+	return nil
+}
+
+func copyStrings(list []string) []string {
+	if list == nil {
+		return nil
+	}
+	return append([]string(nil), list...)
+}
+
+func copyMap(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(values))
+	for key, value := range values {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,57 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"strings"
+	"text/template"
+)
+
+// Functions of the templates of the service files which quote the values
+// for the init system, so a value is kept as it is instead of being
+// interpreted by the shell or the unit parser. The property lists use
+// the html function of the templates, which escapes the XML characters.
+var templateFuncs = template.FuncMap{
+	"shell":       shellQuote,
+	"shellenv":    shellEnvironment,
+	"systemd":     systemdQuote,
+	"systemdexec": systemdExecQuote,
+}
+
+// The value as a single word of the shell: in single quotes, a single
+// quote of the value ends the quotes, is escaped and starts them again
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// The environment as "NAME='value' ..." words of the shell,
+// e.g. for the rc.d variable which is evaluated by rc.subr
+func shellEnvironment(variables []EnvironmentVariable) string {
+	words := make([]string, len(variables))
+	for i, variable := range variables {
+		words[i] = variable.Name + "=" + shellQuote(variable.Value)
+	}
+	return strings.Join(words, " ")
+}
+
+// Escapes of the quoted words of the systemd units, the specifiers
+// are escaped as "%%"
+var systemdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%")
+
+// Escapes of the words of the command lines of the systemd units,
+// the variables are escaped as "$$" as well
+var systemdExecEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$")
+
+// The value as a quoted word of a setting of a systemd unit (Environment=),
+// the settings do not expand the variables, "$" is kept as it is
+func systemdQuote(value string) string {
+	return `"` + systemdEscaper.Replace(value) + `"`
+}
+
+// The value as a quoted word of a command line of a systemd unit
+// (ExecStart=), neither the specifiers nor the variables are expanded
+func systemdExecQuote(value string) string {
+	return `"` + systemdExecEscaper.Replace(value) + `"`
+}
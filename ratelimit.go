@@ -0,0 +1,121 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Default rate of the restarts of a service: a burst of 5, then one per minute
+const (
+	DefaultRestartBurst    = 5
+	DefaultRestartInterval = time.Minute
+)
+
+// ErrRestartRateLimited appears if a service was restarted too often by the
+// package, see SetRestartRateLimit
+var ErrRestartRateLimited = errors.New("Service is restarted too often")
+
+// RestartLimitError - the restart of the service was refused by the rate
+// limiter, errors.Is(err, ErrRestartRateLimited) reports such errors
+type RestartLimitError struct {
+	// Name of the service
+	Name string
+
+	// Retry - time until the next restart is allowed
+	Retry time.Duration
+}
+
+func (e *RestartLimitError) Error() string {
+	retry := e.Retry.Round(time.Millisecond)
+	if retry > time.Second {
+		retry = retry.Round(time.Second)
+	}
+	return "Service " + e.Name + " is restarted too often, retry in " + retry.String()
+}
+
+// Is - the error matches ErrRestartRateLimited
+func (e *RestartLimitError) Is(target error) bool {
+	return target == ErrRestartRateLimited
+}
+
+// restartBucket - token bucket of the restarts of a service
+type restartBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Token buckets of the restarts by the names of the services
+var restartLimit = struct {
+	sync.Mutex
+	burst    int
+	interval time.Duration
+	buckets  map[string]*restartBucket
+}{
+	burst:    DefaultRestartBurst,
+	interval: DefaultRestartInterval,
+	buckets:  make(map[string]*restartBucket),
+}
+
+// SetRestartRateLimit - limit the restarts of every service which the package
+// triggers (Restart, the restarts of Ensure and ApplyDir): burst restarts are
+// allowed at once, then one per interval; a restart beyond the limit fails
+// with *RestartLimitError, so a bad configuration can not make the process
+// restart a service hundreds of times per minute. A burst of 0 disables the
+// limit. The counts of the services are reset.
+func SetRestartRateLimit(burst int, interval time.Duration) {
+	restartLimit.Lock()
+	defer restartLimit.Unlock()
+	restartLimit.burst = burst
+	restartLimit.interval = interval
+	restartLimit.buckets = make(map[string]*restartBucket)
+}
+
+// Take a token of the bucket of the named service, the tokens are refilled
+// one per interval up to the burst
+func allowRestart(name string) error {
+	restartLimit.Lock()
+	defer restartLimit.Unlock()
+	burst, interval := restartLimit.burst, restartLimit.interval
+	if burst <= 0 || interval <= 0 {
+		return nil
+	}
+	now := time.Now()
+	bucket, ok := restartLimit.buckets[name]
+	if !ok {
+		bucket = &restartBucket{tokens: float64(burst), updated: now}
+		restartLimit.buckets[name] = bucket
+	}
+	bucket.tokens += float64(now.Sub(bucket.updated)) / float64(interval)
+	if bucket.tokens > float64(burst) {
+		bucket.tokens = float64(burst)
+	}
+	bucket.updated = now
+	if bucket.tokens < 1 {
+		retry := time.Duration((1 - bucket.tokens) * float64(interval))
+		diagnostics.Println("Restart of", name, "is rate limited, retry in", retry)
+		return &RestartLimitError{Name: name, Retry: retry}
+	}
+	bucket.tokens--
+	return nil
+}
+
+// Restart - stop and start the service of the daemon, a stopped service is
+// started. The restarts are rate limited per service (SetRestartRateLimit),
+// beyond the limit *RestartLimitError is returned and nothing is done.
+func Restart(d Daemon) error {
+	if properties, ok := Properties(d); ok {
+		if err := allowRestart(properties.def.Name); err != nil {
+			return err
+		}
+	}
+	if _, err := d.Stop(); err != nil && err != ErrAlreadyStopped {
+		return err
+	}
+	_, err := d.Start()
+	return err
+}
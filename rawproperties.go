@@ -0,0 +1,53 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import "errors"
+
+// ErrNoProperty appears if the init system does not report the property
+// of the service
+var ErrNoProperty = errors.New("Property is not reported by the init system")
+
+// PropertyReader interface is implemented by daemons whose init system
+// reports the raw properties of the service: "systemctl show" on systemd,
+// "launchctl print" on macOS
+type PropertyReader interface {
+	// Property - raw value of the named property, e.g. "NRestarts" or
+	// "MemoryCurrent" on systemd; ErrNoProperty if it is not reported,
+	// ErrNotInstalled if the service is not installed
+	Property(name string) (string, error)
+
+	// Properties - the raw properties of the service by their names,
+	// ErrNotInstalled if the service is not installed
+	Properties() (map[string]string, error)
+}
+
+// RawProperty - raw value of the named property of the service as the init
+// system reports it, for the fields which Status and StatusOf do not cover;
+// ErrUnsupportedSystem on the init systems without such properties
+func RawProperty(d Daemon, name string) (string, error) {
+	if reader, ok := d.(PropertyReader); ok {
+		return reader.Property(name)
+	}
+	return "", ErrUnsupportedSystem
+}
+
+// RawProperties - the raw properties of the service as the init system
+// reports them, see RawProperty
+func RawProperties(d Daemon) (map[string]string, error) {
+	if reader, ok := d.(PropertyReader); ok {
+		return reader.Properties()
+	}
+	return nil, ErrUnsupportedSystem
+}
+
+// Value of the property in the reported properties
+func propertyValue(values map[string]string, name string) (string, error) {
+	value, ok := values[name]
+	if !ok {
+		return "", ErrNoProperty
+	}
+	return value, nil
+}
@@ -0,0 +1,21 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package rcd
+
+import "testing"
+
+func FuzzParseStatus(f *testing.F) {
+	for _, test := range statusOutputs {
+		f.Add([]byte(test.output), test.service)
+	}
+	f.Fuzz(func(t *testing.T, output []byte, service string) {
+		if running, pid := ParseStatus(output, service); running && pid == "" {
+			t.Errorf("ParseStatus(%q, %q) is running without a pid", output, service)
+		}
+	})
+}
@@ -0,0 +1,154 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+// Package rcd controls services of the FreeBSD rc.d init system.
+//
+// It is used by the daemon package on freebsd hosts and gives access to
+// the rc.conf enablement of a service.
+package rcd
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/takama/daemon/internal/tools"
+)
+
+// Dir - standard directory of local rc.d scripts
+const Dir = "/usr/local/etc/rc.d/"
+
+// RCConf - system configuration which enables services
+const RCConf = "/etc/rc.conf"
+
+// e.g. "myservice is running as pid 42."
+var pidRegexp = regexp.MustCompile(`pid +([0-9]+)`)
+
+// Logger - receives the diagnostic messages of the package,
+// they are discarded by default
+var Logger = log.New(ioutil.Discard, "", 0)
+
+// Script - rc.d script
+type Script struct {
+	// Name of the service
+	Name string
+}
+
+// New - create a rc.d script with the given name
+func New(name string) *Script {
+	return &Script{Name: name}
+}
+
+// Path - standard path of the rc.d script
+func (script *Script) Path() string {
+	return Dir + script.Name
+}
+
+// IsInstalled - check the rc.d script exists
+func (script *Script) IsInstalled() bool {
+	_, err := os.Stat(script.Path())
+	return err == nil
+}
+
+// IsEnabled - check the service is enabled in rc.conf, in rc.conf.local
+// or in the rc.conf.d file of the service, which override rc.conf
+func (script *Script) IsEnabled() (bool, error) {
+	data, err := ioutil.ReadFile(RCConf)
+	if err != nil {
+		Logger.Println("Error opening file:", err)
+		return false, err
+	}
+	enabled, _ := ParseRCConf(data, script.Name)
+	for _, path := range []string{"/etc/rc.conf.local", "/etc/rc.conf.d/" + script.Name} {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if value, ok := ParseRCConf(data, script.Name); ok {
+			enabled = value
+		}
+	}
+	return enabled, nil
+}
+
+// ParseRCConf - enablement of the service in the content of rc.conf,
+// the last <name>_enable assignment counts, as for the shell which reads
+// the file; ok is false if the file does not assign it
+func ParseRCConf(data []byte, name string) (enabled bool, ok bool) {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, name+"_enable=") {
+			continue
+		}
+		value := strings.TrimPrefix(line, name+"_enable=")
+		if i := strings.Index(value, "#"); i >= 0 {
+			value = value[:i]
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		// the values which checkyesno of rc.subr accepts
+		switch strings.ToLower(value) {
+		case "yes", "true", "on", "1":
+			enabled = true
+		default:
+			enabled = false
+		}
+		ok = true
+	}
+	return enabled, ok
+}
+
+// Enable - enable the service in rc.conf
+func (script *Script) Enable() error {
+	return tools.Command("sysrc", script.Name+"_enable=YES").Run()
+}
+
+// Disable - remove the enablement of the service from rc.conf
+func (script *Script) Disable() error {
+	return tools.Command("sysrc", "-x", script.Name+"_enable").Run()
+}
+
+// Command - rc.d command to run, services which are not enabled in rc.conf
+// are controlled by the "one" prefixed commands (onestart, onestop, ...)
+func (script *Script) Command(cmd string) string {
+	if ok, err := script.IsEnabled(); !ok || err != nil {
+		Logger.Println("Service is not enabled, using one" + cmd + " instead")
+		cmd = "one" + cmd
+	}
+	return cmd
+}
+
+// Status - check the service is running and return its PID if it is known
+func (script *Script) Status() (running bool, pid string) {
+	output, err := tools.Command("service", script.Name, script.Command("status")).Output()
+	if err != nil {
+		return false, ""
+	}
+	return ParseStatus(output, script.Name)
+}
+
+// ParseStatus - state of the service in the output of "service <name> status"
+// of rc.subr, e.g. "myservice is running as pid 42." or "myservice is not
+// running."; a service without a pid does not run
+func ParseStatus(output []byte, name string) (running bool, pid string) {
+	text := string(output)
+	if !strings.Contains(text, name) || strings.Contains(text, name+" is not running") {
+		return false, ""
+	}
+	if data := pidRegexp.FindStringSubmatch(text); len(data) > 1 {
+		return true, data[1]
+	}
+	return false, ""
+}
+
+// Start - start the service
+func (script *Script) Start() error {
+	return tools.Command("service", script.Name, script.Command("start")).Run()
+}
+
+// Stop - stop the service
+func (script *Script) Stop() error {
+	return tools.Command("service", script.Name, script.Command("stop")).Run()
+}
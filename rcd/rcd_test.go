@@ -0,0 +1,69 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package rcd
+
+import "testing"
+
+// Captured output of "service <name> status"
+var statusOutputs = []struct {
+	name    string
+	output  string
+	service string
+	running bool
+	pid     string
+}{
+	{
+		name:    "running",
+		output:  "myservice is running as pid 42.\n",
+		service: "myservice",
+		running: true,
+		pid:     "42",
+	},
+	{
+		name:    "several processes",
+		output:  "nginx is running as pid 812 813.\n",
+		service: "nginx",
+		running: true,
+		pid:     "812",
+	},
+	{
+		name:    "not enabled",
+		output:  "Service is not enabled, using onestatus instead\nmyservice is running as pid 42.\n",
+		service: "myservice",
+		running: true,
+		pid:     "42",
+	},
+	{
+		name:    "not running",
+		output:  "myservice is not running.\n",
+		service: "myservice",
+	},
+	{
+		name:    "no pid",
+		output:  "myservice is running.\n",
+		service: "myservice",
+	},
+	{
+		name:    "unknown service",
+		output:  "myservice does not exist in /etc/rc.d or the local startup\ndirectories (/usr/local/etc/rc.d), or is not executable\n",
+		service: "myservice",
+	},
+	{
+		name:    "empty output",
+		output:  "",
+		service: "myservice",
+	},
+}
+
+func TestParseStatus(t *testing.T) {
+	for _, test := range statusOutputs {
+		t.Run(test.name, func(t *testing.T) {
+			running, pid := ParseStatus([]byte(test.output), test.service)
+			if running != test.running || pid != test.pid {
+				t.Errorf("ParseStatus() = %v, %q, want %v, %q", running, pid, test.running, test.pid)
+			}
+		})
+	}
+}
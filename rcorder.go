@@ -0,0 +1,76 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Default REQUIRE of the rc.d scripts: the network is configured and the
+// system logger runs
+var defaultRCRequire = []string{"networking", "syslog"}
+
+// Problems of the rcorder(8) names of the definition, every name is
+// a single word
+func checkRCOrderingProblems(def *Definition) []string {
+	var problems []string
+	for _, field := range []struct {
+		input string
+		names []string
+	}{{"rc_require", def.RCRequire}, {"rc_keywords", def.RCKeywords}} {
+		for _, name := range field.names {
+			if name == "" || strings.ContainsAny(name, "\x00\n\r \t#") {
+				problems = append(problems, field.input+" "+strconv.Quote(name)+" is not a single word")
+			}
+		}
+	}
+	return problems
+}
+
+// Check the init system orders the scripts by rcorder(8), which reads the
+// REQUIRE and KEYWORD lines of the rc.d scripts
+func checkRCOrdering(kind Kind, def *Definition) error {
+	if problems := checkRCOrderingProblems(def); len(problems) > 0 {
+		return &DefinitionError{Problems: problems}
+	}
+	switch {
+	case kind == KindRCD:
+		return nil
+	case len(def.RCRequire) > 0:
+		return &UnsupportedOptionError{"rc_require", kind}
+	case len(def.RCKeywords) > 0:
+		return &UnsupportedOptionError{"rc_keywords", kind}
+	}
+	return nil
+}
+
+// REQUIRE of the rc.d script: the base requirements of the definition
+// (networking and syslog by default), ntpdate if the clock must be
+// synchronized, the dependencies and the services which the service is
+// started after; every name once
+func rcRequire(kind Kind, def *Definition) List {
+	base := def.RCRequire
+	if len(base) == 0 {
+		base = defaultRCRequire
+	}
+	var require List
+	seen := make(map[string]bool)
+	add := func(names ...string) {
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				require = append(require, name)
+			}
+		}
+	}
+	add(base...)
+	if needsTimeSync(def) {
+		add("ntpdate")
+	}
+	add(def.Dependencies...)
+	add(startAfter(kind, def)...)
+	return require
+}
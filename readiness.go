@@ -0,0 +1,124 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Environment of a process whose readiness is reported by the ready file
+const envReadyFile = "DAEMON_READY_FILE"
+
+// HeartbeatInterval - interval in which Run touches the heartbeat file,
+// a service whose heartbeat is older than three intervals is not responding
+var HeartbeatInterval = 10 * time.Second
+
+// ReadyFile - path of the file which Ready creates on the init systems
+// without a readiness protocol (System V, upstart, rc.d, launchd),
+// it is kept in the runtime directory of the service if it is set.
+// The init scripts wait for it when the service uses PresetNotify.
+func ReadyFile(def *Definition) string {
+	return runtimeFile(def, ".ready")
+}
+
+// HeartbeatFile - path of the file whose modification time Run updates
+// while the service runs, see HeartbeatInterval
+func HeartbeatFile(def *Definition) string {
+	return runtimeFile(def, ".heartbeat")
+}
+
+func runtimeFile(def *Definition, suffix string) string {
+	if def.RuntimeDir != "" {
+		return filepath.Join(def.RuntimeDir, def.Name+suffix)
+	}
+	return "/var/run/" + def.Name + suffix
+}
+
+// The executable reports its readiness by Ready
+func reportsReadiness(def *Definition) bool {
+	return def.Preset == PresetNotify
+}
+
+// Ready file which is rendered into the service file, if the service reports its readiness
+func readyFile(kind Kind, def *Definition) string {
+	if kind == KindSystemD || !reportsReadiness(def) {
+		return ""
+	}
+	return ReadyFile(def)
+}
+
+// liveness - ready and heartbeat files of a running service
+type liveness struct {
+	files []string
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// Maintain the ready and the heartbeat files while the service runs,
+// Ready creates the ready file; the heartbeat stops while the executable
+// is not healthy (HealthChecker)
+func (properties *ServiceProperties) startLiveness(e Executable) *liveness {
+	def := &properties.def
+	l := &liveness{files: []string{ReadyFile(def), HeartbeatFile(def)}, done: make(chan struct{})}
+	// a ready file of a previous run is stale
+	os.Remove(ReadyFile(def))
+	os.Setenv(envReadyFile, ReadyFile(def))
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			if healthy(e) {
+				touch(HeartbeatFile(def))
+			}
+			select {
+			case <-l.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return l
+}
+
+// Close - stop the heartbeat and remove the files
+func (l *liveness) Close() {
+	close(l.done)
+	l.wg.Wait()
+	os.Unsetenv(envReadyFile)
+	for _, file := range l.files {
+		os.Remove(file)
+	}
+}
+
+// Status of the service which considers its ready file, if the service
+// reports its readiness, and its heartbeat file, if it is run by Run
+func (properties *ServiceProperties) livenessStatus(running bool, pid string) (string, bool) {
+	def := &properties.def
+	state := StatusRunning
+	if _, err := os.Stat(ReadyFile(def)); err != nil && reportsReadiness(def) {
+		state = StatusStarting
+	} else if info, err := os.Stat(HeartbeatFile(def)); err == nil && time.Since(info.ModTime()) > 3*HeartbeatInterval {
+		state = StatusNotResponding
+	}
+	return statusOf(running, state, pid).result()
+}
+
+// Create the file or update its modification time
+func touch(path string) error {
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err == nil {
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,313 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Service catalogs which keep the registration of a service
+const (
+	// RegistryConsul - the local Consul agent, it checks the health itself
+	RegistryConsul = "consul"
+
+	// RegistryEtcd - etcd by its JSON gateway, the entry is a key with a lease
+	// which is refreshed while the service runs
+	RegistryEtcd = "etcd"
+)
+
+// Default endpoints of the catalogs
+var registryEndpoints = map[string]string{
+	RegistryConsul: "http://127.0.0.1:8500",
+	RegistryEtcd:   "http://127.0.0.1:2379",
+}
+
+// ErrUnknownRegistry appears if the registration refers to a catalog which is not supported
+var ErrUnknownRegistry = errors.New("Unknown service registry")
+
+// Registration - entry of the service in a service catalog, it is added
+// when Run starts the executable and removed when the executable stops
+type Registration struct {
+	// Registry - RegistryConsul or RegistryEtcd
+	Registry string `json:"registry"`
+
+	// Endpoint - URL of the Consul agent or the etcd gateway,
+	// the local default port of the registry if it is empty
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Service - name of the service in the catalog, the name of the daemon by default
+	Service string `json:"service,omitempty"`
+
+	// Address - address of the service, the host name by default
+	Address string `json:"address,omitempty"`
+
+	// Port - port the service listens on
+	Port int `json:"port"`
+
+	// Tags - tags of the entry in the catalog
+	Tags []string `json:"tags,omitempty"`
+
+	// HealthCheck - URL which answers with a 2xx status while the service
+	// is healthy: Consul checks it, the etcd entry expires if it fails
+	HealthCheck string `json:"health_check,omitempty"`
+
+	// Interval - interval of the health check, 10 seconds by default,
+	// the etcd lease lasts three intervals
+	Interval time.Duration `json:"interval,omitempty"`
+
+	// Prefix - prefix of the etcd keys, "/services/" by default,
+	// the key is <prefix><service>/<address>:<port>
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// Default interval of the health check and the refresh of the registration
+const registrationInterval = 10 * time.Second
+
+// Consul removes the services whose health check fails for this time
+const deregisterCriticalAfter = time.Minute
+
+// Check the registry of the definition is supported
+func checkRegistration(def *Definition) error {
+	if def.Registration == nil {
+		return nil
+	}
+	if _, ok := registryEndpoints[def.Registration.Registry]; !ok {
+		return ErrUnknownRegistry
+	}
+	return nil
+}
+
+// registrar - registration of a running service
+type registrar struct {
+	Registration
+	id         string
+	lease      string
+	registered bool
+	client     *http.Client
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// Register the service in the catalog of the definition while it runs,
+// the registration is retried in the background until the catalog is
+// available, the failures are reported by the diagnostics logger
+func (properties *ServiceProperties) register() (*registrar, error) {
+	def := &properties.def
+	if def.Registration == nil {
+		return nil, nil
+	}
+	if err := checkRegistration(def); err != nil {
+		return nil, err
+	}
+	r := &registrar{
+		Registration: *def.Registration,
+		id:           def.Name,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		done:         make(chan struct{}),
+	}
+	if r.Endpoint == "" {
+		r.Endpoint = registryEndpoints[r.Registry]
+	}
+	r.Endpoint = strings.TrimSuffix(r.Endpoint, "/")
+	if r.Service == "" {
+		r.Service = def.Name
+	}
+	if r.Address == "" {
+		r.Address, _ = os.Hostname()
+	}
+	if r.Interval <= 0 {
+		r.Interval = registrationInterval
+	}
+	if r.Prefix == "" {
+		r.Prefix = "/services/"
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.maintain()
+	}()
+	return r, nil
+}
+
+// Close - remove the service from the catalog
+func (r *registrar) Close() {
+	if r == nil {
+		return
+	}
+	close(r.done)
+	r.wg.Wait()
+	if !r.registered {
+		return
+	}
+	if err := r.deregister(); err != nil {
+		diagnostics.Println("Deregistration of", r.Service, "failed:", err)
+	}
+}
+
+// Register the service and keep the registration, until Close
+func (r *registrar) maintain() {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		var err error
+		if r.registered {
+			r.registered, err = r.refresh()
+		} else if err = r.add(); err == nil {
+			r.registered = true
+		}
+		if err != nil {
+			diagnostics.Println("Registration of", r.Service, "failed:", err)
+		}
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Add the entry of the service to the catalog
+func (r *registrar) add() error {
+	if r.Registry == RegistryConsul {
+		service := map[string]interface{}{
+			"ID":      r.id,
+			"Name":    r.Service,
+			"Address": r.Address,
+			"Port":    r.Port,
+			"Tags":    r.Tags,
+		}
+		if r.HealthCheck != "" {
+			service["Check"] = map[string]string{
+				"HTTP":                           r.HealthCheck,
+				"Interval":                       r.Interval.String(),
+				"DeregisterCriticalServiceAfter": deregisterCriticalAfter.String(),
+			}
+		}
+		return r.call(http.MethodPut, "/v1/agent/service/register", service, nil)
+	}
+
+	if !r.healthy() {
+		return errors.New("Health check of " + r.Service + " failed")
+	}
+	var lease struct {
+		ID string `json:"ID"`
+	}
+	ttl := int((3*r.Interval + time.Second - 1) / time.Second)
+	if err := r.call(http.MethodPost, "/v3/lease/grant", map[string]int{"TTL": ttl}, &lease); err != nil {
+		return err
+	}
+	value, err := json.Marshal(map[string]interface{}{
+		"name":    r.Service,
+		"address": r.Address,
+		"port":    r.Port,
+		"tags":    r.Tags,
+	})
+	if err != nil {
+		return err
+	}
+	key := r.Prefix + r.Service + "/" + r.Address + ":" + strconv.Itoa(r.Port)
+	put := map[string]string{
+		"key":   base64.StdEncoding.EncodeToString([]byte(key)),
+		"value": base64.StdEncoding.EncodeToString(value),
+		"lease": lease.ID,
+	}
+	if err := r.call(http.MethodPost, "/v3/kv/put", put, nil); err != nil {
+		return err
+	}
+	r.lease = lease.ID
+	return nil
+}
+
+// Keep the entry of the service, registered is false if it is gone from
+// the catalog (the agent lost it, the lease expired), so it is added again
+func (r *registrar) refresh() (registered bool, err error) {
+	if r.Registry == RegistryConsul {
+		err := r.call(http.MethodGet, "/v1/agent/service/"+url.PathEscape(r.id), nil, nil)
+		if err == errRegistryNotFound {
+			return false, nil
+		}
+		return true, err
+	}
+
+	// the lease expires while the service is not healthy
+	if !r.healthy() {
+		return true, nil
+	}
+	var keepalive struct {
+		Result struct {
+			TTL string `json:"TTL"`
+		} `json:"result"`
+	}
+	if err := r.call(http.MethodPost, "/v3/lease/keepalive", map[string]string{"ID": r.lease}, &keepalive); err != nil {
+		return true, err
+	}
+	if ttl, _ := strconv.Atoi(keepalive.Result.TTL); ttl <= 0 {
+		return false, nil
+	}
+	return true, nil
+}
+
+// Remove the entry of the service from the catalog
+func (r *registrar) deregister() error {
+	if r.Registry == RegistryConsul {
+		return r.call(http.MethodPut, "/v1/agent/service/deregister/"+url.PathEscape(r.id), nil, nil)
+	}
+	return r.call(http.MethodPost, "/v3/lease/revoke", map[string]string{"ID": r.lease}, nil)
+}
+
+// Check the health check of the registration succeeds, if it has one
+func (r *registrar) healthy() bool {
+	if r.HealthCheck == "" {
+		return true
+	}
+	response, err := r.client.Get(r.HealthCheck)
+	if err != nil {
+		return false
+	}
+	response.Body.Close()
+	return response.StatusCode >= 200 && response.StatusCode < 300
+}
+
+// The catalog does not know the requested entry
+var errRegistryNotFound = errors.New("Entry not found in the service registry")
+
+// Send a request to the catalog, the JSON response is decoded into result
+func (r *registrar) call(method, path string, body, result interface{}) error {
+	var content bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&content).Encode(body); err != nil {
+			return err
+		}
+	}
+	request, err := http.NewRequest(method, r.Endpoint+path, &content)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := r.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	switch {
+	case response.StatusCode == http.StatusNotFound:
+		return errRegistryNotFound
+	case response.StatusCode >= 300:
+		return errors.New("Service registry returned " + response.Status)
+	case result != nil:
+		return json.NewDecoder(response.Body).Decode(result)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"github.com/takama/daemon/systemd"
+	"github.com/takama/daemon/upstart"
+)
+
+// ReloadManager - make the init system of the current host reread its
+// service files (systemctl daemon-reload, initctl reload-configuration).
+// Install, Remove and Adopt do it themselves, it is needed after service
+// files were changed by other means. It does nothing on init systems which
+// read the service files when they are used and for an offline image.
+func ReloadManager() error {
+	return reloadManager(hostKind())
+}
+
+// Reload the configuration of the given kind of init system
+func reloadManager(kind Kind) error {
+	if offline() {
+		// the init system of the image reads the files when it boots
+		return nil
+	}
+	switch kind {
+	case KindSystemD:
+		return systemd.DaemonReload()
+	case KindUpstart:
+		return upstart.ReloadConfiguration()
+	}
+	return nil
+}
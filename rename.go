@@ -0,0 +1,83 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+// Rename - move the installed service of the daemon to a new name: the
+// service is installed under the new name from the same definition, it is
+// enabled at boot if the former one was (systemd and rc.d), the former
+// service is removed and the new one runs if the former one did. A failed
+// step restores the former service, so the service exists under exactly one
+// of the names. The directories of the definition are kept, its data is not
+// moved. It returns the daemon of the new name.
+func Rename(d Daemon, newName string) (Daemon, error) {
+	properties, ok := Properties(d)
+	if !ok {
+		return nil, ErrUnsupportedSystem
+	}
+	status, err := StatusOf(d)
+	if err != nil {
+		return nil, err
+	}
+	renamed, err := properties.Clone(newName)
+	if err != nil {
+		return nil, err
+	}
+	enabled := isEnabled(d)
+
+	running := status.Running()
+	if running {
+		if _, err := d.Stop(); err != nil {
+			return nil, err
+		}
+	}
+	// the former service is started again, if it ran, when a step fails
+	restore := func(err error) (Daemon, error) {
+		if running {
+			d.Start()
+		}
+		return nil, err
+	}
+
+	if _, err := renamed.Install(); err != nil {
+		return restore(err)
+	}
+	if err := setEnabled(renamed, enabled); err != nil {
+		renamed.Remove()
+		return restore(err)
+	}
+	// the enablement of the former name is dropped from rc.conf
+	setEnabled(d, false)
+	if _, err := d.Remove(); err != nil {
+		renamed.Remove()
+		setEnabled(d, enabled)
+		return restore(err)
+	}
+
+	if running {
+		if _, err := renamed.Start(); err != nil {
+			return renamed, err
+		}
+	}
+	return renamed, nil
+}
+
+// Check the service of the daemon is started at boot, an installed
+// service is taken for enabled if it is not known
+func isEnabled(d Daemon) bool {
+	enabled, err := IsEnabled(d)
+	return enabled || err != nil
+}
+
+// Enable or disable the service of the daemon at boot where it is possible
+func setEnabled(d Daemon, enabled bool) error {
+	change := Disable
+	if enabled {
+		change = Enable
+	}
+	if err := change(d); err != ErrUnsupportedSystem {
+		return err
+	}
+	return nil
+}
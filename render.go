@@ -0,0 +1,460 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/takama/daemon/autostart"
+	"github.com/takama/daemon/launchd"
+	"github.com/takama/daemon/rcd"
+	"github.com/takama/daemon/systemd"
+	"github.com/takama/daemon/sysv"
+	"github.com/takama/daemon/upstart"
+)
+
+// Kind - kind of init system which runs the service
+type Kind string
+
+// Supported kinds of init systems
+const (
+	KindSystemD Kind = "systemd"
+	KindSystemV Kind = "systemv"
+	KindUpstart Kind = "upstart"
+	KindLaunchd Kind = "launchd"
+	KindRCD     Kind = "rcd"
+	KindWindows Kind = "windows"
+
+	// KindAutostart - XDG autostart entry of the desktop session, the
+	// services of ScopeDesktop; it is no init system of a host
+	KindAutostart Kind = "autostart"
+)
+
+// Kinds - the supported kinds of init systems, windows has no service files
+func Kinds() []Kind {
+	return []Kind{KindSystemD, KindSystemV, KindUpstart, KindLaunchd, KindRCD, KindWindows}
+}
+
+// HostKind - kind of init system of the current host
+func HostKind() Kind {
+	return hostKind()
+}
+
+// DefaultTemplate - default template of the service file for the given kind
+// of init system, on any host, see TemplateData. It returns ErrUnsupportedKind
+// for the kinds which do not keep services in files.
+func DefaultTemplate(kind Kind) (string, error) {
+	text, ok := templates[kind]
+	if !ok {
+		return "", ErrUnsupportedKind
+	}
+	return text, nil
+}
+
+// ErrUnsupportedKind appears if try to render a service file for an unknown kind of init system,
+// or for an init system which does not keep services in files
+var ErrUnsupportedKind = errors.New("Unsupported kind of init system")
+
+// List - list of words which is rendered in templates as a space separated string,
+// it can also be ranged over
+type List []string
+
+// String - the words separated by spaces
+func (list List) String() string {
+	return strings.Join(list, " ")
+}
+
+// TemplateData - data which is available in the templates of service files
+type TemplateData struct {
+	Name             string
+	Description      string
+	Dependencies     List
+	Aliases          List
+	Path             string
+	Args             List
+	Exec             string
+	Environment      []EnvironmentVariable
+	CPUAffinity      string
+	NUMAPolicy       string
+	NUMANodes        string
+	Wrapper          List
+	Namespace        List
+	PrivateNetwork   bool
+	NetworkNamespace string
+	AddressFamilies  List
+	SyscallsAllowed  List
+	SyscallsDenied   List
+	SyscallErrno     string
+	Delegate         bool
+	PerUser          bool
+	UserScope        bool
+	Controllers      List
+	After            List
+	Before           List
+	BindsTo          string
+	User             string
+	Group            string
+	LogDir           string
+	Logging          LogMode
+	StandardInput    string
+	Upgrade          bool
+	TimeSync         bool
+	Forking          bool
+	StopAfter        List
+	StopPriority     string
+	RCRequire        List
+	RCKeywords       List
+	KillSignal       string
+	StopSignal       string
+	FinalKill        bool
+	KillMode         string
+	StopTimeout      int
+	MaxRuntime       int
+	RestartDelay     int
+	RestartSteps     int
+	RestartMaxDelay  int
+	Watchdog         int
+	FirstBoot        bool
+	StopCommands     []string
+	PostStopCommands []string
+	Conditions       []string
+	PreStart         []string
+	OnFailure        List
+	Target           string
+	StateDir         string
+	RuntimeDir       string
+	SocketUser       string
+	SocketGroup      string
+	SocketMode       string
+	StartInterval    int
+	Calendar         []CalendarInterval
+	Sockets          []SocketListener
+	SocketName       string
+	Also             List
+	WatchPaths       List
+	QueueDirectories List
+	RequiredFiles    List
+	ReadyFile        string
+	RuntimeDirs      []RuntimeDirectory
+	Metadata         Metadata
+}
+
+// EffectiveConfiguration - the template of the service file and the data it
+// is executed with, see EffectiveConfig
+type EffectiveConfiguration struct {
+	// Kind - init system of the service file
+	Kind Kind `json:"kind"`
+
+	// CustomTemplate - the template of the definition replaces the default one
+	CustomTemplate bool `json:"custom_template"`
+
+	// Preset - the preset whose variant is the template, empty if the
+	// preset has no variant for the init system
+	Preset string `json:"preset,omitempty"`
+
+	// Template - the template which is executed
+	Template string `json:"template"`
+
+	// Definition - the definition, its host variables are resolved when
+	// the service is installed
+	Definition *Definition `json:"definition"`
+
+	// Data - the data of the template
+	Data *TemplateData `json:"data"`
+}
+
+// Default templates by kind of init system
+var templates = map[Kind]string{
+	KindSystemD: systemDConfig,
+	KindSystemV: systemVConfig,
+	KindUpstart: upstatConfig,
+	KindLaunchd: propertyList,
+	KindRCD:     bsdConfig,
+
+	KindAutostart: autostartConfig,
+}
+
+// TemplateHandler interface is implemented by daemons which render their
+// service file from a template, it allows to customize the template
+type TemplateHandler interface {
+	// GetTemplate - the template of the service file, custom or default one
+	GetTemplate() string
+
+	// SetTemplate - replace the template of the service file,
+	// it is used by the following Install
+	SetTemplate(text string) error
+}
+
+// AsTemplateHandler - template customization of the daemon,
+// ok is false if the daemon does not use templates (windows)
+func AsTemplateHandler(d Daemon) (handler TemplateHandler, ok bool) {
+	handler, ok = d.(TemplateHandler)
+	return
+}
+
+// Render - render the service file of the definition for the given kind of init system,
+// the kind does not have to match the current host, the template of the definition
+// is used instead of the default one if it is set. The host variables (%{ip}, ...)
+// are kept, the file may be meant for another host; they are resolved on the host
+// which installs the service.
+func Render(kind Kind, def *Definition) (string, error) {
+	return render(kind, def, false)
+}
+
+// Service file of the definition as it is installed on this host, with the
+// values of the host variables
+func renderInstalled(kind Kind, def *Definition) (string, error) {
+	return render(kind, def, true)
+}
+
+// Render the service file, the host variables are resolved on install
+func render(kind Kind, def *Definition, install bool) (string, error) {
+	config, err := effectiveConfig(kind, def, install)
+	if err != nil {
+		return "", err
+	}
+
+	templ, err := template.New(string(kind)).Funcs(templateFuncs).Parse(config.Template)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := templ.Execute(&buf, config.Data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// EffectiveConfig - what Render renders the service file of the definition
+// from for the given kind of init system: the template which applies (the
+// custom one, the variant of the preset or the default one), the definition
+// and the data of the template with the defaults of the init system, e.g. to
+// find out why a rendered service file does not contain what the definition
+// asks for
+func EffectiveConfig(kind Kind, def *Definition) (*EffectiveConfiguration, error) {
+	return effectiveConfig(kind, def, false)
+}
+
+// Configuration of the service file, the host variables are resolved on install
+func effectiveConfig(kind Kind, def *Definition, install bool) (*EffectiveConfiguration, error) {
+	text, err := serviceTemplate(kind, def)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateInput(kind, def); err != nil {
+		return nil, err
+	}
+
+	if install {
+		if def, err = expandHostVariables(kind, def); err != nil {
+			return nil, err
+		}
+	} else if problems := checkHostVariableProblems(def); len(problems) > 0 {
+		return nil, &DefinitionError{Problems: problems}
+	}
+
+	path, err := serviceExecutable(def)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validatePath("path", path); err != nil {
+		return nil, err
+	}
+
+	if err := checkNeeds(def); err != nil {
+		return nil, err
+	}
+
+	if err := checkNUMAPolicy(def); err != nil {
+		return nil, err
+	}
+
+	if err := checkKillSignal(def); err != nil {
+		return nil, err
+	}
+
+	if err := checkKillMode(def); err != nil {
+		return nil, err
+	}
+
+	if err := checkStopCommands(kind, def); err != nil {
+		return nil, err
+	}
+
+	if err := checkConditionCommands(kind, def); err != nil {
+		return nil, err
+	}
+
+	if err := checkPreStartCommands(kind, def); err != nil {
+		return nil, err
+	}
+
+	if err := checkRestartDelay(kind, def); err != nil {
+		return nil, err
+	}
+
+	if err := checkStandardInput(kind, def); err != nil {
+		return nil, err
+	}
+
+	if err := checkFirstBoot(kind, def); err != nil {
+		return nil, err
+	}
+
+	if err := checkRCOrdering(kind, def); err != nil {
+		return nil, err
+	}
+
+	if err := checkWatchdog(kind, def); err != nil {
+		return nil, err
+	}
+
+	if err := checkIsolation(kind, def); err != nil {
+		return nil, err
+	}
+
+	if err := checkPerUser(kind, def); err != nil {
+		return nil, err
+	}
+
+	if err := checkScope(kind, def); err != nil {
+		return nil, err
+	}
+
+	if err := checkAliases(kind, def); err != nil {
+		return nil, err
+	}
+
+	if err := checkSections(kind, def); err != nil {
+		return nil, err
+	}
+
+	config := &EffectiveConfiguration{
+		Kind:           kind,
+		CustomTemplate: def.Template != "",
+		Template:       text,
+		Definition:     def,
+		Data:           templateData(kind, def, path),
+	}
+	if !config.CustomTemplate && text != templates[kind] {
+		config.Preset = def.Preset
+	}
+	return config, nil
+}
+
+// Data of the templates of the service files of the definition for the given
+// kind of init system, path is the executable of the service
+func templateData(kind Kind, def *Definition, path string) *TemplateData {
+	allowed, denied := systemCallFilter(def)
+	user, group := serviceAccount(kind, def)
+	return &TemplateData{
+		Name:             def.Name,
+		Description:      NormalizeDescription(def.Description, def.Name),
+		Dependencies:     requiredUnits(kind, def),
+		Aliases:          def.Aliases,
+		Path:             path,
+		Args:             def.Args,
+		Exec:             desktopExec(kind, def, path),
+		Environment:      environment(def),
+		CPUAffinity:      def.CPUAffinity,
+		NUMAPolicy:       def.NUMAPolicy,
+		NUMANodes:        numaNodes(def),
+		Wrapper:          affinityWrapper(kind, def),
+		Namespace:        namespaceWrapper(kind, def),
+		PrivateNetwork:   def.PrivateNetwork,
+		NetworkNamespace: def.NetworkNamespace,
+		AddressFamilies:  def.RestrictAddressFamilies,
+		SyscallsAllowed:  allowed,
+		SyscallsDenied:   denied,
+		SyscallErrno:     def.SystemCallErrorNumber,
+		Delegate:         def.Delegate,
+		Controllers:      def.DelegateControllers,
+		After:            startAfter(kind, def),
+		Before:           shutdownBefore(def),
+		BindsTo:          bindsTo(def),
+		User:             user,
+		Group:            group,
+		PerUser:          def.PerUser,
+		UserScope:        userScope(def),
+		LogDir:           logDir(kind, def),
+		Logging:          def.Logging,
+		StandardInput:    def.StandardInput,
+		Upgrade:          def.Upgrade,
+		TimeSync:         needsTimeSync(def),
+		Forking:          def.Forking,
+		StopAfter:        def.StopAfter,
+		StopPriority:     sysvScript(def).StopPriority,
+		RCRequire:        rcRequire(kind, def),
+		RCKeywords:       def.RCKeywords,
+		KillSignal:       def.KillSignal,
+		StopSignal:       stopSignal(def),
+		FinalKill:        !def.NoFinalKill,
+		KillMode:         def.KillMode,
+		StopTimeout:      seconds(def.StopTimeout),
+		MaxRuntime:       seconds(def.MaxRuntime),
+		RestartDelay:     seconds(def.RestartDelay),
+		RestartSteps:     restartSteps(def),
+		RestartMaxDelay:  seconds(def.RestartMaxDelay),
+		Watchdog:         seconds(def.Watchdog),
+		FirstBoot:        def.FirstBoot,
+		StopCommands:     def.StopCommands,
+		PostStopCommands: def.PostStopCommands,
+		Conditions:       def.ConditionCommands,
+		PreStart:         def.PreStartCommands,
+		OnFailure:        onFailureUnits(def),
+		Target:           def.Target,
+		StateDir:         def.StateDir,
+		RuntimeDir:       def.RuntimeDir,
+		SocketUser:       def.SocketUser,
+		SocketGroup:      def.SocketGroup,
+		SocketMode:       fmt.Sprintf("%04o", socketMode(def).Perm()),
+		StartInterval:    startInterval(def),
+		Calendar:         calendarIntervals(def),
+		Sockets:          socketListeners(def),
+		SocketName:       socketName(def),
+		Also:             alsoUnits(def),
+		WatchPaths:       watchPaths(def, false),
+		QueueDirectories: watchPaths(def, true),
+		RequiredFiles:    def.RequiredFiles,
+		ReadyFile:        readyFile(kind, def),
+		RuntimeDirs:      runtimeDirectories(kind, def),
+		Metadata:         NewMetadata(),
+	}
+}
+
+// Duration in the whole seconds of the service files, rounded up, so a
+// duration under a second is kept instead of dropping the setting
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// ServicePath - standard path of the service file of the named service
+// for the given kind of init system
+func ServicePath(kind Kind, name string) (string, error) {
+	switch kind {
+	case KindSystemD:
+		return systemd.New(name).Path(), nil
+	case KindSystemV:
+		return sysv.New(name).Path(), nil
+	case KindUpstart:
+		return upstart.New(name).Path(), nil
+	case KindLaunchd:
+		return launchd.New(name).Path(), nil
+	case KindRCD:
+		return rcd.New(name).Path(), nil
+	case KindAutostart:
+		return autostart.New(name).Path(), nil
+	}
+	return "", ErrUnsupportedKind
+}
@@ -0,0 +1,344 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Values which break out of the quotes of the service files
+var hostileValues = []string{
+	`x" ; touch /tmp/pwn ; echo "`,
+	`it's $(touch /tmp/pwn) and ` + "`id`",
+	`a&b<c>d`,
+	`%d $HOME ${HOME} \n \`,
+}
+
+// Line of the rendered service file which starts with the prefix
+func renderedLine(t *testing.T, content, prefix string) string {
+	t.Helper()
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), prefix) {
+			return strings.TrimSpace(line)
+		}
+	}
+	t.Fatalf("no line starts with %q in\n%s", prefix, content)
+	return ""
+}
+
+// Output of the shell script, the test is skipped without a shell
+func runShell(t *testing.T, script string) string {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell:", err)
+	}
+	output, err := exec.Command("sh", "-c", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("sh -c %q: %v: %s", script, err, output)
+	}
+	return string(output)
+}
+
+func TestRenderHostileEnvironment(t *testing.T) {
+	for _, value := range hostileValues {
+		def := &Definition{
+			Name:        "web",
+			Path:        "/usr/bin/web",
+			Args:        []string{value},
+			Environment: map[string]string{"VALUE": value},
+		}
+		t.Run(value, func(t *testing.T) {
+			content, err := Render(KindSystemV, def)
+			if err != nil {
+				t.Fatalf("Render(systemv) error = %v", err)
+			}
+			line := renderedLine(t, content, "export VALUE=")
+			if got := runShell(t, line+`; printf %s "$VALUE"`); got != value {
+				t.Errorf("systemv %s exports %q, want %q", line, got, value)
+			}
+
+			content, err = Render(KindUpstart, def)
+			if err != nil {
+				t.Fatalf("Render(upstart) error = %v", err)
+			}
+			if line := renderedLine(t, content, "env VALUE="); line != "env VALUE="+shellQuote(value) {
+				t.Errorf("upstart line = %q, want the quoted value", line)
+			}
+
+			content, err = Render(KindRCD, def)
+			if err != nil {
+				t.Fatalf("Render(rcd) error = %v", err)
+			}
+			line = renderedLine(t, content, `[ -z "$web_env" ]`)
+			// rc.subr evaluates the variable as the words of the env command
+			if got := runShell(t, line+`; eval "env $web_env sh -c 'printf %s \"\$VALUE\"'"`); got != value {
+				t.Errorf("rcd %s passes %q, want %q", line, got, value)
+			}
+
+			content, err = Render(KindSystemD, def)
+			if err != nil {
+				t.Fatalf("Render(systemd) error = %v", err)
+			}
+			line = renderedLine(t, content, "Environment=")
+			words := splitCommand(strings.TrimPrefix(line, "Environment="))
+			if len(words) != 1 || strings.Replace(words[0], "%%", "%", -1) != "VALUE="+value {
+				t.Errorf("systemd line %q is not the single variable VALUE=%q", line, value)
+			}
+
+			content, err = Render(KindLaunchd, def)
+			if err != nil {
+				t.Fatalf("Render(launchd) error = %v", err)
+			}
+			var plist struct {
+				Strings []string `xml:"dict>dict>string"`
+				Args    []string `xml:"dict>array>string"`
+			}
+			if err := xml.Unmarshal([]byte(content), &plist); err != nil {
+				t.Fatalf("launchd property list is not valid: %v", err)
+			}
+			if len(plist.Strings) != 1 || plist.Strings[0] != value {
+				t.Errorf("launchd environment = %q, want %q", plist.Strings, value)
+			}
+			if len(plist.Args) != 2 || plist.Args[1] != value {
+				t.Errorf("launchd arguments = %q, want %q", plist.Args, value)
+			}
+		})
+	}
+}
+
+func TestRenderInvalidEnvironment(t *testing.T) {
+	for _, environment := range []map[string]string{
+		{"A;touch /tmp/pwn": "x"},
+		{"1A": "x"},
+		{"A": "x\nExecStartPre=/bin/false"},
+	} {
+		def := &Definition{Name: "web", Path: "/usr/bin/web", Environment: environment}
+		for _, kind := range []Kind{KindSystemD, KindSystemV, KindUpstart, KindLaunchd, KindRCD} {
+			if _, err := Render(kind, def); !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("Render(%s, %q) error = %v, want ErrInvalidInput", kind, environment, err)
+			}
+		}
+	}
+}
+
+func TestNormalizeDescription(t *testing.T) {
+	tests := []struct {
+		description string
+		want        string
+	}{
+		{"", "web"},
+		{" Web\tServer\n", "Web Server"},
+		{`My "db" $(touch /tmp/x)`, `My 'db' $(touch /tmp/x)`},
+		{"Run `id` & C:\\tmp <now>", `Run 'id' & C:/tmp <now>`},
+		{strings.Repeat("a", 250), strings.Repeat("a", 200)},
+	}
+	for _, test := range tests {
+		if got := NormalizeDescription(test.description, "web"); got != test.want {
+			t.Errorf("NormalizeDescription(%q) = %q, want %q", test.description, got, test.want)
+		}
+	}
+}
+
+func TestRenderHostileDescription(t *testing.T) {
+	description := `My "db" $(touch /tmp/x) ` + "`id`" + ` & 100% \`
+	def := &Definition{Name: "web", Path: "/usr/bin/web", Description: description}
+	want := NormalizeDescription(description, def.Name)
+
+	content, err := Render(KindSystemV, def)
+	if err != nil {
+		t.Fatalf("Render(systemv) error = %v", err)
+	}
+	line := renderedLine(t, content, "servname=")
+	if got := runShell(t, line+`; printf %s "$servname"`); got != want {
+		t.Errorf("systemv %s sets %q, want %q", line, got, want)
+	}
+
+	content, err = Render(KindUpstart, def)
+	if err != nil {
+		t.Fatalf("Render(upstart) error = %v", err)
+	}
+	line = renderedLine(t, content, "description ")
+	if words := splitCommand(strings.TrimPrefix(line, "description")); len(words) != 1 || words[0] != want {
+		t.Errorf("upstart line %q is not the single word %q", line, want)
+	}
+}
+
+func TestRenderFailureUnit(t *testing.T) {
+	def := &Definition{
+		Name:           "web",
+		Path:           "/usr/bin/web",
+		FailureMail:    `"Ops $(touch /tmp/pwn) 100%" <ops@example.com>`,
+		FailureWebhook: "https://hooks.example.com/%41?token=$HOME",
+	}
+	content, err := renderFailureUnit(def)
+	if err != nil {
+		t.Fatalf("renderFailureUnit() error = %v", err)
+	}
+	unescape := strings.NewReplacer("%%", "%", "$$", "$")
+
+	line := renderedLine(t, content, "ExecStart=/usr/bin/curl")
+	words := splitCommand(strings.TrimPrefix(line, "ExecStart="))
+	if webhook := unescape.Replace(words[len(words)-1]); webhook != def.FailureWebhook {
+		t.Errorf("curl posts to %q, want %q", webhook, def.FailureWebhook)
+	}
+
+	line = renderedLine(t, content, "ExecStart=/bin/sh")
+	words = splitCommand(strings.TrimPrefix(line, "ExecStart="))
+	if len(words) != 5 || words[1] != "-c" || words[3] != "sh" || words[4] != "%H" {
+		t.Fatalf("mail command %q is not sh -c <script> sh %%H", line)
+	}
+	// the commands of the script are replaced by functions which print their arguments
+	script := `systemctl() { :; }; mail() { printf '%s|' "$@"; }; set -- host; ` + unescape.Replace(words[2])
+	want := "-s|web failed on host|" + def.FailureMail + "|"
+	if got := runShell(t, script); got != want {
+		t.Errorf("mail is called with %q, want %q", got, want)
+	}
+}
+
+func TestRenderInvalidFailureHooks(t *testing.T) {
+	for _, def := range []*Definition{
+		{Name: "web", Path: "/usr/bin/web", FailureMail: "ops@example.com\r\nBcc: all@example.com"},
+		{Name: "web", Path: "/usr/bin/web", FailureMail: "ops; touch /tmp/pwn"},
+		{Name: "web", Path: "/usr/bin/web", FailureWebhook: "file:///etc/passwd"},
+		{Name: "web", Path: "/usr/bin/web", FailureWebhook: "hooks.example.com/failed"},
+	} {
+		if _, err := Render(KindSystemD, def); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("Render(%q, %q) error = %v, want ErrInvalidInput", def.FailureMail, def.FailureWebhook, err)
+		}
+		if err := NotifyFailure(def, "failed"); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("NotifyFailure(%q, %q) error = %v, want ErrInvalidInput", def.FailureMail, def.FailureWebhook, err)
+		}
+	}
+}
+
+func TestRenderHostVariables(t *testing.T) {
+	def := &Definition{
+		Name:        "web",
+		Path:        "/usr/bin/web",
+		Args:        []string{"--workers=%{cpus}", "--format=%%{level}"},
+		Environment: map[string]string{"WORKERS": "%{cpus}", "FORMAT": "%%{level}"},
+	}
+	cpus := strconv.Itoa(runtime.NumCPU())
+
+	// the service files for another host keep the host variables
+	content, err := Render(KindSystemD, def)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if line := renderedLine(t, content, "ExecStart="); line != "ExecStart=/usr/bin/web --workers=%{cpus} --format=%%{level}" {
+		t.Errorf("Render() line = %q, want the host variables", line)
+	}
+	var nixos bytes.Buffer
+	if err := ExportNixOS(&nixos, def); err != nil {
+		t.Fatalf("ExportNixOS() error = %v", err)
+	}
+	if !strings.Contains(nixos.String(), "--workers=%{cpus}") {
+		t.Errorf("ExportNixOS() resolved the host variables:\n%s", nixos.String())
+	}
+
+	tests := []struct {
+		kind   Kind
+		prefix string
+		want   string
+	}{
+		// systemd reads "%%{" as a literal "%{"
+		{KindSystemD, "ExecStart=", "ExecStart=/usr/bin/web --workers=" + cpus + " --format=%%{level}"},
+		{KindSystemD, "Environment=" + `"FORMAT`, `Environment="FORMAT=%%{level}"`},
+		{KindSystemD, "Environment=" + `"WORKERS`, `Environment="WORKERS=` + cpus + `"`},
+		{KindSystemV, "export FORMAT=", "export FORMAT='%{level}'"},
+		{KindUpstart, "exec ", "exec /usr/bin/web --workers=" + cpus + " --format=%{level} >> /var/log/web.log 2>> /var/log/web.err"},
+	}
+	for _, test := range tests {
+		content, err := renderInstalled(test.kind, def)
+		if err != nil {
+			t.Fatalf("renderInstalled(%s) error = %v", test.kind, err)
+		}
+		if line := renderedLine(t, content, test.prefix); line != test.want {
+			t.Errorf("renderInstalled(%s) line = %q, want %q", test.kind, line, test.want)
+		}
+	}
+
+	def.Args = []string{"--listen=%{address}"}
+	var definitionErr *DefinitionError
+	if _, err := Render(KindSystemD, def); !errors.As(err, &definitionErr) {
+		t.Errorf("Render() of an unknown host variable error = %v, want *DefinitionError", err)
+	}
+}
+
+func TestRenderSubsecondDurations(t *testing.T) {
+	tests := []struct {
+		def  Definition
+		want string
+	}{
+		{Definition{Watchdog: 500 * time.Millisecond}, "WatchdogSec=1"},
+		{Definition{Watchdog: 1500 * time.Millisecond}, "WatchdogSec=2"},
+		{Definition{StopTimeout: 500 * time.Millisecond}, "TimeoutStopSec=1"},
+		{Definition{MaxRuntime: 500 * time.Millisecond}, "RuntimeMaxSec=1"},
+		{Definition{RestartDelay: 500 * time.Millisecond}, "RestartSec=1"},
+		{Definition{RestartDelay: 500 * time.Millisecond, RestartMaxDelay: 1500 * time.Millisecond}, "RestartMaxDelaySec=2"},
+	}
+	for _, test := range tests {
+		def := test.def
+		def.Name, def.Path = "web", "/usr/bin/web"
+		content, err := Render(KindSystemD, &def)
+		if err != nil {
+			t.Fatalf("Render() error = %v", err)
+		}
+		prefix := strings.SplitAfter(test.want, "=")[0]
+		if line := renderedLine(t, content, prefix); line != test.want {
+			t.Errorf("Render() line = %q, want %q", line, test.want)
+		}
+	}
+}
+
+func TestRenderRestartingRCD(t *testing.T) {
+	def := &Definition{Name: "web", Path: "/usr/bin/web", MaxRuntime: time.Hour}
+	content, err := Render(KindRCD, def)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	// rc.subr stops and checks daemon(8), which stops the service with it
+	if line := renderedLine(t, content, "procname="); line != `procname="/usr/sbin/daemon"` {
+		t.Errorf("Render() line = %q, want the procname of daemon(8)", line)
+	}
+	want := `command_args="-P $pidfile -p /var/run/web.child.pid -f -r /usr/bin/web $web_flags"`
+	if line := renderedLine(t, content, "command_args="); line != want {
+		t.Errorf("Render() line = %q, want %q", line, want)
+	}
+	parsed := &Definition{Name: "web"}
+	if err := parseRCD(parsed, content); err != nil {
+		t.Fatalf("parseRCD() error = %v", err)
+	}
+	if parsed.Path != def.Path || len(parsed.RequiredFiles) != 0 {
+		t.Errorf("parseRCD() path = %q, required files = %q, want %q", parsed.Path, parsed.RequiredFiles, def.Path)
+	}
+}
+
+func TestRenderRestartDelayRCD(t *testing.T) {
+	def := &Definition{Name: "web", Path: "/usr/bin/web", RestartDelay: 5 * time.Second}
+	content, err := Render(KindRCD, def)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	want := `command_args="-P $pidfile -p /var/run/web.child.pid -f -r -R 5 /usr/bin/web $web_flags"`
+	if line := renderedLine(t, content, "command_args="); line != want {
+		t.Errorf("Render() line = %q, want %q", line, want)
+	}
+	parsed := &Definition{Name: "web"}
+	if err := parseRCD(parsed, content); err != nil {
+		t.Fatalf("parseRCD() error = %v", err)
+	}
+	if parsed.Path != def.Path || parsed.RestartDelay != def.RestartDelay {
+		t.Errorf("parseRCD() = %q, %v, want %q, %v", parsed.Path, parsed.RestartDelay, def.Path, def.RestartDelay)
+	}
+}
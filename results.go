@@ -0,0 +1,86 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io"
+	"sync"
+)
+
+// ResultFormatter - formats the result of an operation which the daemons
+// return: the action is the translated message of the operation, e.g.
+// "Starting My Service:", ok tells whether the operation succeeded
+type ResultFormatter func(action string, ok bool) string
+
+// DefaultResultFormatter - the action, aligned by tabs, followed by
+// the colored "[  OK  ]" or "[FAILED]"
+func DefaultResultFormatter(action string, ok bool) string {
+	if ok {
+		return action + "\t\t\t\t\t[  \033[32mOK\033[0m  ]"
+	}
+	return action + "\t\t\t\t\t[\033[31mFAILED\033[0m]"
+}
+
+// PlainResultFormatter - the action followed by "[OK]" or "[FAILED]",
+// without alignment and colors, e.g. for logs and pipes
+func PlainResultFormatter(action string, ok bool) string {
+	if ok {
+		return action + " [OK]"
+	}
+	return action + " [FAILED]"
+}
+
+var results = struct {
+	sync.RWMutex
+	format ResultFormatter
+	output io.Writer
+	// writes of the results one by one, the operations of a Manager
+	// with workers format their results concurrently
+	writing sync.Mutex
+}{}
+
+// SetResultFormatter - format the results of all daemons, nil restores
+// DefaultResultFormatter
+func SetResultFormatter(format ResultFormatter) {
+	results.Lock()
+	defer results.Unlock()
+	results.format = format
+}
+
+// SetResultOutput - write the results of all daemons to the writer as well,
+// a line for each one as soon as it is known, e.g. the steps of a Manager
+// operation; nil (the default) writes nothing
+func SetResultOutput(output io.Writer) {
+	results.Lock()
+	defer results.Unlock()
+	results.output = output
+}
+
+// Result of an operation which succeeded
+func succeeded(action string) string {
+	return formatResult(action, true)
+}
+
+// Result of an operation which failed
+func failed(action string) string {
+	return formatResult(action, false)
+}
+
+// Formatted result, it is written to the output of the results
+func formatResult(action string, ok bool) string {
+	results.RLock()
+	format, output := results.format, results.output
+	results.RUnlock()
+	if format == nil {
+		format = DefaultResultFormatter
+	}
+	result := format(action, ok)
+	if output != nil {
+		results.writing.Lock()
+		io.WriteString(output, result+"\n")
+		results.writing.Unlock()
+	}
+	return result
+}
@@ -0,0 +1,45 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The results of the parallel operations of a manager are written to the
+// output of the results one by one, run by "go test -race"
+func TestResultOutputWorkers(t *testing.T) {
+	var output bytes.Buffer
+	SetResultOutput(&output)
+	defer SetResultOutput(nil)
+	SetResultFormatter(PlainResultFormatter)
+	defer SetResultFormatter(nil)
+
+	manager := NewManager()
+	for i := 0; i < 32; i++ {
+		if err := manager.Add(&Definition{Name: "web" + strconv.Itoa(i), Path: "/usr/bin/web"}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	manager.SetWorkers(8, 0)
+	if _, err := manager.apply(false, func(d Daemon) (string, error) {
+		return succeeded("Starting"), nil
+	}); err != nil {
+		t.Fatalf("apply() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) != 32 {
+		t.Fatalf("output has %d lines, want 32:\n%s", len(lines), output.String())
+	}
+	for _, line := range lines {
+		if line != "Starting [OK]" {
+			t.Errorf("output line = %q, want %q", line, "Starting [OK]")
+		}
+	}
+}
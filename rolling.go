@@ -0,0 +1,127 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotReady appears if a restarted service is not ready in time
+var ErrNotReady = errors.New("Service is not ready in time")
+
+// rollingUnit - service, or instance of a per-user service, which
+// RollingRestart restarts as a whole
+type rollingUnit struct {
+	name        string
+	description string
+	restart     func() error
+	status      func() (ServiceStatus, error)
+}
+
+// Daemons whose services run as several instances, which are restarted
+// one by one, e.g. the per-user services of systemd
+type instanceRestarter interface {
+	rollingInstances() ([]rollingUnit, error)
+}
+
+// RollingRestart - restart the services in the declared order, batchSize
+// services (or instances of a per-user service) at once. After every batch
+// it waits up to waitReady until the restarted services run and have
+// reported their readiness, so the others keep serving meanwhile; 0 does
+// not wait. The restart stops at the first batch with failures, which are
+// reported by *OperationError, a service which is not ready in time fails
+// with ErrNotReady. The restarts are rate limited like Restart.
+func (manager *Manager) RollingRestart(batchSize int, waitReady time.Duration) (string, error) {
+	names, err := manager.sorted()
+	if err != nil {
+		return "", err
+	}
+	var units []rollingUnit
+	for _, name := range names {
+		def, err := manager.Definition(name)
+		if err != nil {
+			return "", err
+		}
+		d, err := tracedDaemon(def, manager.traceID)
+		if err != nil {
+			return "", err
+		}
+		instances, err := rollingUnits(def, d)
+		if err != nil {
+			return "", err
+		}
+		units = append(units, instances...)
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	var results []string
+	for start := 0; start < len(units); start += batchSize {
+		batch := units[start:]
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+		errs := make([]error, len(batch))
+		var wg sync.WaitGroup
+		for i := range batch {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if errs[i] = batch[i].restart(); errs[i] == nil {
+					errs[i] = awaitReady(batch[i], waitReady)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		failures := make(map[string]error)
+		for i, unit := range batch {
+			action := message(MessageRestart, unit.description)
+			results = append(results, unit.name+": "+traceResult(manager.traceID, unit.name, action, errs[i] == nil))
+			if errs[i] != nil {
+				failures[unit.name] = errs[i]
+			}
+		}
+		if len(failures) > 0 {
+			return strings.Join(results, "\n"), &OperationError{Failures: failures}
+		}
+	}
+	return strings.Join(results, "\n"), nil
+}
+
+// Units of the daemon which are restarted one by one: the running
+// instances of a per-user service, the service itself otherwise
+func rollingUnits(def *Definition, d Daemon) ([]rollingUnit, error) {
+	if restarter, ok := d.(instanceRestarter); ok && def.PerUser {
+		return restarter.rollingInstances()
+	}
+	return []rollingUnit{{
+		name:        def.Name,
+		description: def.Description,
+		restart:     func() error { return Restart(d) },
+		status:      func() (ServiceStatus, error) { return StatusOf(d) },
+	}}, nil
+}
+
+// Wait until the restarted unit runs and is ready
+func awaitReady(unit rollingUnit, timeout time.Duration) error {
+	if timeout <= 0 {
+		return nil
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := unit.status()
+		if err == nil && status.State == StatusRunning {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return ErrNotReady
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidSchedule appears if the schedule of a timer is not a cron expression
+var ErrInvalidSchedule = errors.New("Invalid schedule of the timer")
+
+// Fields of a cron expression with their ranges and the launchd keys
+var scheduleFields = []struct {
+	key      string
+	min, max int
+	names    []string
+}{
+	{"Minute", 0, 59, nil},
+	{"Hour", 0, 23, nil},
+	{"Day", 1, 31, nil},
+	{"Month", 1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{"Weekday", 0, 7, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// Expressions of the cron macros
+var scheduleMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// schedule - parsed cron expression, the values of every field in ascending
+// order, nil for a field which is "*"
+type schedule [5][]int
+
+// Parse the cron expression: minute, hour, day of month, month and day of
+// week with lists, ranges, steps and the names of months and days, or a macro
+// like @daily
+func parseSchedule(expression string) (schedule, error) {
+	var parsed schedule
+	if macro, ok := scheduleMacros[strings.TrimSpace(expression)]; ok {
+		expression = macro
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != len(scheduleFields) {
+		return parsed, ErrInvalidSchedule
+	}
+	for i, field := range fields {
+		if field == "*" {
+			continue
+		}
+		set := make(map[int]bool)
+		for _, part := range strings.Split(field, ",") {
+			if err := scheduleRange(i, strings.ToLower(part), set); err != nil {
+				return parsed, err
+			}
+		}
+		// Sunday is 0 and 7
+		if i == 4 && set[7] {
+			delete(set, 7)
+			set[0] = true
+		}
+		for value := scheduleFields[i].min; value <= scheduleFields[i].max; value++ {
+			if set[value] {
+				parsed[i] = append(parsed[i], value)
+			}
+		}
+	}
+	return parsed, nil
+}
+
+// Add the values of a part of the field: a value, a range, "*" or
+// one of them with a step
+func scheduleRange(field int, part string, set map[int]bool) error {
+	spec := scheduleFields[field]
+	step := 1
+	if i := strings.Index(part, "/"); i >= 0 {
+		var err error
+		if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+			return ErrInvalidSchedule
+		}
+		part = part[:i]
+	}
+	low, high := spec.min, spec.max
+	if part != "*" {
+		bounds := strings.SplitN(part, "-", 2)
+		var err error
+		if low, err = scheduleValue(field, bounds[0]); err != nil {
+			return err
+		}
+		high = low
+		if len(bounds) == 2 {
+			if high, err = scheduleValue(field, bounds[1]); err != nil {
+				return err
+			}
+		} else if step > 1 {
+			// "5/15" is "5-59/15"
+			high = spec.max
+		}
+	}
+	if low > high {
+		return ErrInvalidSchedule
+	}
+	for value := low; value <= high; value += step {
+		set[value] = true
+	}
+	return nil
+}
+
+// Value of the field, a number or the name of a month or a day
+func scheduleValue(field int, text string) (int, error) {
+	spec := scheduleFields[field]
+	for i, name := range spec.names {
+		if text == name {
+			return i + spec.min, nil
+		}
+	}
+	value, err := strconv.Atoi(text)
+	if err != nil || value < spec.min || value > spec.max {
+		return 0, ErrInvalidSchedule
+	}
+	return value, nil
+}
+
+// The day of month and the day of week are both restricted, the time
+// matches if one of them does (like cron does)
+func (s schedule) eitherDay() bool {
+	return s[2] != nil && s[4] != nil
+}
+
+// Expressions of OnCalendar of a systemd timer, two if the service runs
+// on the days of month or on the days of week
+func (s schedule) onCalendar() []string {
+	if s.eitherDay() {
+		byDay, byWeekday := s, s
+		byDay[4], byWeekday[2] = nil, nil
+		return append(byDay.onCalendar(), byWeekday.onCalendar()...)
+	}
+	calendar := fmt.Sprintf("*-%s-%s %s:%s:00",
+		calendarValues(s[3]), calendarValues(s[2]), calendarValues(s[1]), calendarValues(s[0]))
+	if s[4] != nil {
+		days := make([]string, len(s[4]))
+		for i, day := range s[4] {
+			name := scheduleFields[4].names[day]
+			days[i] = strings.ToUpper(name[:1]) + name[1:]
+		}
+		calendar = strings.Join(days, ",") + " " + calendar
+	}
+	return []string{calendar}
+}
+
+// Values of a field of OnCalendar, two digits each
+func calendarValues(values []int) string {
+	if values == nil {
+		return "*"
+	}
+	texts := make([]string, len(values))
+	for i, value := range values {
+		texts[i] = fmt.Sprintf("%02d", value)
+	}
+	return strings.Join(texts, ",")
+}
+
+// CalendarField - key of a dictionary of StartCalendarInterval of launchd
+// (Minute, Hour, Day, Month or Weekday) with its value
+type CalendarField struct {
+	Key   string
+	Value int
+}
+
+// CalendarInterval - dictionary of StartCalendarInterval of launchd,
+// the keys which are not set match any value
+type CalendarInterval []CalendarField
+
+// Dictionaries of StartCalendarInterval which match the times of the
+// schedule, one for every combination of the restricted fields
+func (s schedule) calendarIntervals() []CalendarInterval {
+	if s.eitherDay() {
+		byDay, byWeekday := s, s
+		byDay[4], byWeekday[2] = nil, nil
+		return append(byDay.calendarIntervals(), byWeekday.calendarIntervals()...)
+	}
+	intervals := []CalendarInterval{{}}
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == nil {
+			continue
+		}
+		var expanded []CalendarInterval
+		for _, interval := range intervals {
+			for _, value := range s[i] {
+				fields := append(CalendarInterval{{scheduleFields[i].key, value}}, interval...)
+				expanded = append(expanded, fields)
+			}
+		}
+		intervals = expanded
+	}
+	return intervals
+}
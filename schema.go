@@ -0,0 +1,211 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefinitionSchemaID - identifier of the JSON schema of the definitions
+const DefinitionSchemaID = "https://github.com/takama/daemon/definition.schema.json"
+
+// Valid names of services, they are used in file names and unit names
+var serviceNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.@-]*$`)
+
+// DefinitionError - problems of a definition found by UnmarshalDefinition
+type DefinitionError struct {
+	Problems []string
+}
+
+func (e *DefinitionError) Error() string {
+	return "Invalid service definition: " + strings.Join(e.Problems, "; ")
+}
+
+// DefinitionSchema - JSON schema (draft 2020-12) of the JSON form of Definition,
+// so infrastructure as code tools are able to validate and generate
+// the definitions which are read by UnmarshalDefinition.
+// Durations are numbers of nanoseconds, file modes are decimal numbers.
+func DefinitionSchema() ([]byte, error) {
+	schema := typeSchema(reflect.TypeOf(Definition{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["$id"] = DefinitionSchemaID
+	schema["title"] = "Service definition"
+	properties := schema["properties"].(map[string]interface{})
+	properties["name"].(map[string]interface{})["pattern"] = serviceNameRegexp.String()
+	properties["logging"].(map[string]interface{})["enum"] = []LogMode{LogDefault, LogFile, LogJournal}
+	properties["preset"].(map[string]interface{})["enum"] = append([]string{""}, Presets()...)
+	properties["numa_policy"].(map[string]interface{})["enum"] = []string{"",
+		NUMADefault, NUMAPreferred, NUMABind, NUMAInterleave, NUMALocal}
+	properties["kill_signal"].(map[string]interface{})["enum"] = []string{"",
+		SignalTerm, SignalInt, SignalQuit, SignalHup, SignalWinch}
+	properties["kill_mode"].(map[string]interface{})["enum"] = []string{"",
+		KillControlGroup, KillMixed, KillProcess}
+	properties["needs"].(map[string]interface{})["items"].(map[string]interface{})["enum"] = CommonDependencies()
+	properties["scope"].(map[string]interface{})["enum"] = []string{"", ScopeSystemBoot, ScopeUserLogin, ScopeDesktop}
+	registration := properties["registration"].(map[string]interface{})["properties"].(map[string]interface{})
+	registration["registry"].(map[string]interface{})["enum"] = []string{RegistryConsul, RegistryEtcd}
+	registration["port"].(map[string]interface{})["maximum"] = 65535
+	properties["stop_priority"].(map[string]interface{})["minimum"] = 0
+	properties["stop_priority"].(map[string]interface{})["maximum"] = 99
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// Schema of a type of the definition, fields without omitempty are required
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	}
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")
+		if tag[0] == "" || tag[0] == "-" {
+			continue
+		}
+		properties[tag[0]] = typeSchema(t.Field(i).Type)
+		if len(tag) == 1 {
+			required = append(required, tag[0])
+		}
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// MarshalDefinition - JSON form of the definition which is described by DefinitionSchema
+func MarshalDefinition(def *Definition) ([]byte, error) {
+	return json.MarshalIndent(def, "", "  ")
+}
+
+// UnmarshalDefinition - read the JSON form of a definition and check it
+// by the rules of DefinitionSchema, unknown fields are rejected.
+// It returns a *DefinitionError which lists all found problems.
+func UnmarshalDefinition(data []byte) (*Definition, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	def := new(Definition)
+	if err := decoder.Decode(def); err != nil {
+		return nil, &DefinitionError{Problems: []string{err.Error()}}
+	}
+	if problems := checkDefinition(def); len(problems) > 0 {
+		return nil, &DefinitionError{Problems: problems}
+	}
+	return def, nil
+}
+
+// Problems of the definition which the JSON decoder does not find
+func checkDefinition(def *Definition) []string {
+	var problems []string
+	if ValidateName(def.Name) != nil {
+		problems = append(problems, "name "+strconv.Quote(def.Name)+" is not a valid service name")
+	}
+	for _, alias := range def.Aliases {
+		if !serviceNameRegexp.MatchString(alias) || strings.Contains(alias, "@") {
+			problems = append(problems, "alias "+strconv.Quote(alias)+" is not a valid service name")
+		}
+	}
+	switch def.Logging {
+	case LogDefault, LogFile, LogJournal:
+	default:
+		problems = append(problems, "logging "+strconv.Quote(string(def.Logging))+" is unknown")
+	}
+	if _, ok := presets[def.Preset]; def.Preset != "" && !ok {
+		problems = append(problems, "preset "+strconv.Quote(def.Preset)+" is unknown")
+	}
+	for _, dependency := range def.Needs {
+		if _, ok := dependencyNames[dependency]; !ok {
+			problems = append(problems, "need "+strconv.Quote(string(dependency))+" is unknown")
+		}
+	}
+	if checkNUMAPolicy(def) != nil {
+		problems = append(problems, "numa_policy "+strconv.Quote(def.NUMAPolicy)+" is unknown")
+	}
+	if checkKillSignal(def) != nil {
+		problems = append(problems, "kill_signal "+strconv.Quote(def.KillSignal)+" is unknown")
+	}
+	if checkKillMode(def) != nil {
+		problems = append(problems, "kill_mode "+strconv.Quote(def.KillMode)+" is unknown")
+	}
+	if err := checkScope(KindSystemD, def); err == ErrUnknownScope {
+		problems = append(problems, "scope "+strconv.Quote(def.Scope)+" is unknown")
+	}
+	if checkRegistration(def) != nil {
+		problems = append(problems, "registry "+strconv.Quote(def.Registration.Registry)+" is unknown")
+	}
+	if def.Registration != nil && (def.Registration.Port < 0 || def.Registration.Port > 65535) {
+		problems = append(problems, "registration port must be between 0 and 65535")
+	}
+	if def.StopTimeout < 0 {
+		problems = append(problems, "stop_timeout must not be negative")
+	}
+	if def.Watchdog < 0 {
+		problems = append(problems, "watchdog must not be negative")
+	}
+	if def.MaxRuntime < 0 {
+		problems = append(problems, "max_runtime must not be negative")
+	}
+	problems = append(problems, checkRestartDelayProblems(def)...)
+	problems = append(problems, checkStandardInputProblems(def)...)
+	problems = append(problems, checkRCOrderingProblems(def)...)
+	problems = append(problems, checkHostVariableProblems(def)...)
+	if def.StopPriority < 0 || def.StopPriority > 99 {
+		problems = append(problems, "stop_priority must be between 0 and 99")
+	}
+	problems = append(problems, checkSectionProblems(def)...)
+	if def.StartInterval < 0 {
+		problems = append(problems, "start_interval must not be negative")
+	}
+	for _, field := range [][2]string{
+		{"path", def.Path},
+		{"install_path", def.InstallPath},
+		{"log_dir", def.LogDir},
+		{"state_dir", def.StateDir},
+		{"runtime_dir", def.RuntimeDir},
+	} {
+		if path := field[1]; path != "" && !absolute(path) {
+			problems = append(problems, field[0]+" "+strconv.Quote(path)+" is not absolute")
+		}
+	}
+	for _, spec := range append(append([]PathSpec{}, def.Paths...), def.Watch...) {
+		if !absolute(spec.Path) {
+			problems = append(problems, "path "+strconv.Quote(spec.Path)+" is not absolute")
+		}
+	}
+	for _, file := range def.ConfigFiles {
+		if !absolute(file.Path) {
+			problems = append(problems, "config file "+strconv.Quote(file.Path)+" is not absolute")
+		}
+	}
+	return problems
+}
+
+// Absolute path on the target host, which is not always the current one
+func absolute(path string) bool {
+	return strings.HasPrefix(path, "/") || filepath.IsAbs(path)
+}
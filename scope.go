@@ -0,0 +1,170 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"os"
+	"strconv"
+)
+
+// Scopes of a service, when it runs and who installs it
+const (
+	// ScopeSystemBoot - the service of the system which starts at boot,
+	// it is installed by root, the default
+	ScopeSystemBoot = "system"
+
+	// ScopeUserLogin - the service of the current user which starts at the
+	// login of the user: a launchd agent in ~/Library/LaunchAgents or a unit
+	// of the systemd user manager (systemctl --user); no root privileges
+	// are required, like "brew services start" without sudo
+	ScopeUserLogin = "user"
+
+	// ScopeDesktop - the helper process of the current user which the desktop
+	// session starts at login: an XDG autostart entry in ~/.config/autostart
+	// (KindAutostart) on linux and FreeBSD, for GUI helpers where a unit of the
+	// systemd user manager is overkill or unavailable; no root privileges
+	ScopeDesktop = "desktop"
+)
+
+// ErrUnknownScope appears if the definition refers to a scope which does not exist
+var ErrUnknownScope = errors.New("Unknown scope")
+
+// ScopeError - the option of the definition is not available in the scope of
+// the user, errors.Is(err, ErrUnsupportedOption) reports such errors
+type ScopeError struct {
+	// Option - JSON name of the field of the definition
+	Option string
+
+	// Scope - ScopeUserLogin or ScopeDesktop
+	Scope string
+}
+
+func (e *ScopeError) Error() string {
+	return "Option " + e.Option + " is not available in the " + e.Scope + " scope"
+}
+
+// Is - the error matches ErrUnsupportedOption
+func (e *ScopeError) Is(target error) bool {
+	return target == ErrUnsupportedOption
+}
+
+// Check the service runs in the scope of the current user,
+// at the login or in the desktop session
+func userScope(def *Definition) bool {
+	return def.Scope == ScopeUserLogin || def.Scope == ScopeDesktop
+}
+
+// Check the scope of the definition: only launchd and systemd have services
+// of the users, the desktop sessions have autostart entries; neither can
+// change the system (accounts, kernel settings)
+func checkScope(kind Kind, def *Definition) error {
+	switch def.Scope {
+	case "", ScopeSystemBoot:
+		return nil
+	case ScopeUserLogin:
+		if kind != KindSystemD && kind != KindLaunchd {
+			return &UnsupportedOptionError{"scope", kind}
+		}
+	case ScopeDesktop:
+		if kind != KindAutostart {
+			return &UnsupportedOptionError{"scope", kind}
+		}
+	default:
+		return ErrUnknownScope
+	}
+	for _, option := range systemOptions(def) {
+		if option.set {
+			return &ScopeError{Option: option.option, Scope: def.Scope}
+		}
+	}
+	return nil
+}
+
+// systemOption - option of the definition which changes the system,
+// it is not available in the user scope
+type systemOption struct {
+	// option - JSON name of the field
+	option string
+	set    bool
+	clear  func()
+}
+
+// Options of the definition which change the system
+func systemOptions(def *Definition) []systemOption {
+	return []systemOption{
+		{"per_user", def.PerUser, func() { def.PerUser = false }},
+		{"user", def.User != "", func() { def.User = "" }},
+		{"group", def.Group != "", func() { def.Group = "" }},
+		{"create_user", def.CreateUser, func() { def.CreateUser = false }},
+		{"udev_rules", len(def.UdevRules) > 0, func() { def.UdevRules = nil }},
+		{"sysctls", len(def.Sysctls) > 0, func() { def.Sysctls = nil }},
+		{"kernel_modules", len(def.KernelModules) > 0, func() { def.KernelModules = nil }},
+		{"on_failure", len(def.OnFailure) > 0, func() { def.OnFailure = nil }},
+		{"install_path", def.InstallPath != "", func() { def.InstallPath = "" }},
+		{"watch", len(def.Watch) > 0, func() { def.Watch = nil }},
+		{"target", def.Target != "", func() { def.Target = "" }},
+	}
+}
+
+// ForScope - variant of the definition for the scope, so one definition
+// gives both the service of the system and the agent of the users which
+// run the same executable: the options which change the system (accounts,
+// udev rules, kernel settings, ...) are dropped from the variants of the
+// scopes of the user (ScopeUserLogin, ScopeDesktop), the rest is shared. The definition itself is not changed.
+func ForScope(def *Definition, scope string) (*Definition, error) {
+	switch scope {
+	case "", ScopeSystemBoot, ScopeUserLogin, ScopeDesktop:
+	default:
+		return nil, ErrUnknownScope
+	}
+	variant := newProperties(def).def
+	variant.Scope = scope
+	if userScope(&variant) {
+		for _, option := range systemOptions(&variant) {
+			if option.set {
+				option.clear()
+			}
+		}
+	}
+	return &variant, nil
+}
+
+// NewForScope - Create a new daemon for the current host from the variant
+// of the definition for the scope (see ForScope)
+func NewForScope(def *Definition, scope string) (Daemon, error) {
+	variant, err := ForScope(def, scope)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromDefinition(variant)
+}
+
+// Check the privileges of an operation, the services of the user scope
+// are controlled by the user
+func (properties *ServiceProperties) checkScopePrivileges() (bool, error) {
+	if userScope(&properties.def) {
+		return true, nil
+	}
+	return checkPrivileges()
+}
+
+// Launchd domain of the session of the current user
+func userDomain() string {
+	return "gui/" + strconv.Itoa(os.Getuid())
+}
+
+// Log directory of a service of the user scope: ~/Library/Logs/<name> on
+// macOS, ~/.local/state/<name> elsewhere ($XDG_STATE_HOME)
+func userLogDir(kind Kind, def *Definition) string {
+	home, _ := os.UserHomeDir()
+	if kind == KindLaunchd {
+		return home + "/Library/Logs/" + def.Name
+	}
+	if state := os.Getenv("XDG_STATE_HOME"); state != "" {
+		return state + "/" + def.Name
+	}
+	return home + "/.local/state/" + def.Name
+}
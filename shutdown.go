@@ -0,0 +1,41 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"strconv"
+
+	"github.com/takama/daemon/sysv"
+)
+
+// Services which are ordered after the service: the declared ones and the
+// ones which are stopped before it at shutdown, since systemd, System V
+// and rc.d stop the services in the reverse order of the start
+func shutdownBefore(def *Definition) List {
+	before := List(copyStrings(def.Before))
+	for _, name := range def.StopAfter {
+		found := false
+		for _, other := range before {
+			found = found || other == name
+		}
+		if !found {
+			before = append(before, name)
+		}
+	}
+	return before
+}
+
+// Init script of the service with the stop priority of the definition
+func sysvScript(def *Definition) *sysv.Script {
+	script := sysv.New(def.Name)
+	script.StopPriority = sysv.StopPriority
+	if def.StopPriority > 0 && def.StopPriority < 100 {
+		script.StopPriority = strconv.Itoa(def.StopPriority)
+		if def.StopPriority < 10 {
+			script.StopPriority = "0" + script.StopPriority
+		}
+	}
+	return script
+}
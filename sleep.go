@@ -0,0 +1,113 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"sync"
+	"time"
+)
+
+// SleepHandler interface may be implemented by an Executable to be notified
+// when the system suspends and resumes, e.g. to reconnect promptly after wake
+type SleepHandler interface {
+	// Sleep - the system is about to suspend, the sleep waits for the return
+	Sleep()
+	// Wake - the system has resumed
+	Wake()
+}
+
+// SleepCheckInterval - interval of the clock checks which notice a wake
+// on systems without logind
+var SleepCheckInterval = 5 * time.Second
+
+// sleepWatcher - source of the sleep and wake notifications of a running service
+type sleepWatcher struct {
+	handler   SleepHandler
+	inhibitor *Inhibitor
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// Notify the executable of the sleep and the wake of the system while
+// the service runs, if it implements SleepHandler.
+//
+// On systemd hosts the service holds a delay lock of the sleep, so Sleep
+// is called before the system suspends (PrepareForSleep of logind).
+// Elsewhere, e.g. on macOS, where the notifications of IOKit are not
+// available without cgo, the wake is noticed by the wall clock which has
+// moved ahead of the monotonic clock, the latter stops while the system
+// sleeps. Then only Wake is called, a few seconds after the resume.
+func (properties *ServiceProperties) watchSleep(e Executable) *sleepWatcher {
+	handler, ok := e.(SleepHandler)
+	if !ok {
+		return nil
+	}
+	name := properties.def.Name
+	watcher := &sleepWatcher{handler: handler, done: make(chan struct{})}
+	// without logind the inhibitor is nil, the clock is watched instead
+	watcher.inhibitor, _ = inhibit(name, "Preparing "+name+" for sleep", "sleep")
+	watcher.wg.Add(1)
+	go func() {
+		defer watcher.wg.Done()
+		if watcher.inhibitor != nil && watcher.watchLogind() {
+			return
+		}
+		watcher.watchClock()
+	}()
+	return watcher
+}
+
+// Forward the announcements of logind, it reports false if the monitor
+// stopped before the watcher was closed
+func (watcher *sleepWatcher) watchLogind() bool {
+	events := watcher.inhibitor.Events()
+	for {
+		select {
+		case <-watcher.done:
+			return true
+		case event, ok := <-events:
+			switch {
+			case !ok:
+				watcher.inhibitor.Close()
+				return false
+			case event == EventSleep:
+				watcher.handler.Sleep()
+				watcher.inhibitor.Release()
+			case event == EventResume:
+				watcher.handler.Wake()
+			}
+		}
+	}
+}
+
+// Notice a wake by the jump of the wall clock against the monotonic one,
+// a step of the wall clock by NTP is taken for a wake as well
+func (watcher *sleepWatcher) watchClock() {
+	ticker := time.NewTicker(SleepCheckInterval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-watcher.done:
+			return
+		case now := <-ticker.C:
+			// Round(0) strips the monotonic reading of the times
+			if now.Round(0).Sub(last.Round(0))-now.Sub(last) > SleepCheckInterval {
+				watcher.handler.Wake()
+			}
+			last = time.Now()
+		}
+	}
+}
+
+// Close - stop the notifications and release the lock of the sleep
+func (watcher *sleepWatcher) Close() {
+	if watcher == nil {
+		return
+	}
+	close(watcher.done)
+	watcher.wg.Wait()
+	watcher.inhibitor.Close()
+}
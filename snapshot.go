@@ -0,0 +1,196 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// SnapshotFile - installed file of a service which Snapshot captured
+type SnapshotFile struct {
+	Path    string      `json:"path"`
+	Mode    os.FileMode `json:"mode"`
+	Content []byte      `json:"content"`
+}
+
+// ServiceSnapshot - state of a managed service when the snapshot was taken
+type ServiceSnapshot struct {
+	Name      string `json:"name"`
+	Installed bool   `json:"installed"`
+
+	// Enabled - the service was started at boot, the init systems which can
+	// not tell it report the installed services as enabled
+	Enabled bool `json:"enabled"`
+
+	Running bool `json:"running"`
+
+	// Files - the service file and the configuration files of the service
+	// which existed
+	Files []SnapshotFile `json:"files,omitempty"`
+}
+
+// Snapshot - state of the managed services which Restore returns to,
+// its JSON form can be kept in a file until the change is done
+type Snapshot struct {
+	Time     time.Time         `json:"time"`
+	Services []ServiceSnapshot `json:"services"`
+}
+
+// Snapshot - capture the state of the managed services: their installed
+// service and configuration files, whether they are enabled and whether
+// they run; taken before a risky change, Restore rolls the services back
+func (manager *Manager) Snapshot() (*Snapshot, error) {
+	names, err := manager.sorted()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{Time: time.Now()}
+	for _, name := range names {
+		d, err := manager.Daemon(name)
+		if err != nil {
+			return nil, err
+		}
+		service, err := snapshotService(name, d)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Services = append(snapshot.Services, service)
+	}
+	return snapshot, nil
+}
+
+// State of the service of the daemon
+func snapshotService(name string, d Daemon) (ServiceSnapshot, error) {
+	service := ServiceSnapshot{Name: name}
+	status, err := StatusOf(d)
+	switch err {
+	case nil:
+	case ErrNotInstalled:
+		return service, nil
+	default:
+		return service, err
+	}
+	service.Installed = true
+	service.Running = status.Running()
+	if service.Enabled, err = IsEnabled(d); err == ErrUnsupportedSystem {
+		service.Enabled = true
+	} else if err != nil {
+		return service, err
+	}
+	for _, path := range serviceFiles(d) {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return service, err
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return service, err
+		}
+		service.Files = append(service.Files, SnapshotFile{Path: path, Mode: info.Mode().Perm(), Content: content})
+	}
+	return service, nil
+}
+
+// Paths of the service file and of the configuration files of the daemon
+func serviceFiles(d Daemon) []string {
+	var paths []string
+	if renderer, ok := d.(Renderer); ok {
+		paths = append(paths, renderer.ServicePath())
+	}
+	if properties, ok := Properties(d); ok {
+		for _, file := range properties.def.ConfigFiles {
+			paths = append(paths, rooted(file.Path))
+		}
+	}
+	return paths
+}
+
+// Restore - return the managed services to the state of the snapshot:
+// services which were not installed are stopped and removed, the others
+// are installed if they are missing, their files are written back as they
+// were, they are enabled or disabled and started, restarted (if their files
+// changed) or stopped. Every service of the snapshot is restored even if
+// others fail, the failures are returned as *OperationError; services
+// which are not in the snapshot are left as they are.
+func (manager *Manager) Restore(snapshot *Snapshot) (string, error) {
+	var results []string
+	failures := make(map[string]error)
+	for _, service := range snapshot.Services {
+		action := message(MessageRestore, service.Name)
+		d, err := manager.Daemon(service.Name)
+		if err == nil {
+			err = restoreService(d, &service)
+		}
+		results = append(results, service.Name+": "+traceResult(manager.traceID, service.Name, action, err == nil))
+		if err != nil {
+			failures[service.Name] = err
+		}
+	}
+	if len(failures) > 0 {
+		return strings.Join(results, "\n"), &OperationError{Failures: failures}
+	}
+	return strings.Join(results, "\n"), nil
+}
+
+// Return the service of the daemon to the captured state
+func restoreService(d Daemon, service *ServiceSnapshot) error {
+	if !service.Installed {
+		if _, err := d.Stop(); err != nil && err != ErrAlreadyStopped && err != ErrNotInstalled {
+			return err
+		}
+		if _, err := d.Remove(); err != nil && err != ErrNotInstalled {
+			return err
+		}
+		return nil
+	}
+	if _, err := d.Install(); err != nil && err != ErrAlreadyInstalled {
+		return err
+	}
+	changed := false
+	for i := range service.Files {
+		file := &service.Files[i]
+		if installed, err := ioutil.ReadFile(file.Path); err == nil && bytes.Equal(installed, file.Content) {
+			continue
+		}
+		if err := writeConfigFile(file.Path, &ConfigFile{Mode: file.Mode}, file.Content); err != nil {
+			return err
+		}
+		changed = true
+	}
+	if changed {
+		if err := ReloadManager(); err != nil {
+			return err
+		}
+	}
+	if enabled, err := IsEnabled(d); err == nil && enabled != service.Enabled {
+		toggle := Disable
+		if service.Enabled {
+			toggle = Enable
+		}
+		if err := toggle(d); err != nil {
+			return err
+		}
+	}
+	if !service.Running {
+		if _, err := d.Stop(); err != nil && err != ErrAlreadyStopped {
+			return err
+		}
+		return nil
+	}
+	if changed {
+		return Restart(d)
+	}
+	if _, err := d.Start(); err != nil && err != ErrAlreadyRunning {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// ErrNoRuntimeDir appears if try to create a socket or a FIFO of a service
+// which has no runtime directory
+var ErrNoRuntimeDir = errors.New("Service has no runtime directory")
+
+// Default permissions of the sockets and FIFOs: the owner and the group
+const defaultSocketMode os.FileMode = 0660
+
+// Permissions of the sockets and FIFOs of the service
+func socketMode(def *Definition) os.FileMode {
+	if def.SocketMode != 0 {
+		return def.SocketMode
+	}
+	return defaultSocketMode
+}
+
+// Apply the ownership and the permissions of the definition to a socket or FIFO
+func applySocketOwner(def *Definition, path string) error {
+	if err := os.Chmod(path, socketMode(def)); err != nil {
+		return err
+	}
+	uid, gid, err := lookupOwner(def.SocketUser, def.SocketGroup)
+	if err != nil {
+		return err
+	}
+	if uid >= 0 || gid >= 0 {
+		return os.Chown(path, uid, gid)
+	}
+	return nil
+}
+
+// Path of a socket or FIFO in the runtime directory of the service
+func runtimePath(def *Definition, name string) (string, error) {
+	if def.RuntimeDir == "" {
+		return "", ErrNoRuntimeDir
+	}
+	if err := os.MkdirAll(def.RuntimeDir, defaultDirMode); err != nil {
+		return "", err
+	}
+	return filepath.Join(def.RuntimeDir, name), nil
+}
+
+// ListenRuntime - listen on the unix socket with the given name in the
+// runtime directory of the service, a socket left by a crashed process is
+// replaced. The socket gets SocketUser, SocketGroup and SocketMode.
+func ListenRuntime(def *Definition, name string) (net.Listener, error) {
+	path, err := runtimePath(def, name)
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := applySocketOwner(def, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// MakeFIFO - create the FIFO (named pipe) with the given name in the
+// runtime directory of the service and return its path, an existing FIFO
+// is kept. The FIFO gets SocketUser, SocketGroup and SocketMode.
+// FIFOs are not supported on Windows.
+func MakeFIFO(def *Definition, name string) (string, error) {
+	path, err := runtimePath(def, name)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+		os.Remove(path)
+		if err := mkfifo(path, socketMode(def)); err != nil {
+			return "", err
+		}
+	}
+	if err := applySocketOwner(def, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
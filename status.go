@@ -0,0 +1,256 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// States of a service which are reported by ServiceStatus
+const (
+	// StatusUndefined - the status could not be determined
+	StatusUndefined = "undefined"
+
+	// StatusStopped - the service is not running
+	StatusStopped = "stopped"
+
+	// StatusRunning - the service is running
+	StatusRunning = "running"
+
+	// StatusStarting - the service runs, but it has not reported readiness yet
+	StatusStarting = "starting"
+
+	// StatusNotResponding - the service runs, but its heartbeat is missing
+	StatusNotResponding = "not-responding"
+
+	// StatusReloading - the service runs and reloads its configuration (systemd)
+	StatusReloading = "reloading"
+
+	// StatusStopping - the service is about to stop, its processes still run
+	StatusStopping = "stopping"
+
+	// StatusFailed - the service is not running, its last run failed: a failed
+	// systemd unit or one which waits for its automatic restart, a launchd job
+	// whose last exit status is not zero
+	StatusFailed = "failed"
+
+	// StatusPaused - the service is paused by the service manager (Windows)
+	// or its main process is stopped by SIGSTOP (Pause)
+	StatusPaused = "paused"
+)
+
+// ServiceStatus - machine-readable status of a service. Its String is the
+// message which Status returns, e.g. "Service (pid  42) is running...",
+// its JSON form is stable:
+//
+//	{"state":"running","pid":42,"running":true,"message":"Service (pid  42) is running..."}
+type ServiceStatus struct {
+	// State - one of the Status* constants
+	State string
+
+	// PID - main process of the service, 0 if it is not known
+	PID int
+}
+
+// StatusOf - status of the daemon as structured data, it is parsed from
+// the message of Status, so it works for translated messages as well
+func StatusOf(d Daemon) (ServiceStatus, error) {
+	text, err := d.Status()
+	if err != nil {
+		return ServiceStatus{State: StatusUndefined}, err
+	}
+	return ParseStatus(text), nil
+}
+
+// Running - check the process of the service exists
+func (status ServiceStatus) Running() bool {
+	switch status.State {
+	case StatusRunning, StatusStarting, StatusNotResponding, StatusReloading, StatusStopping, StatusPaused:
+		return true
+	}
+	return false
+}
+
+// String - the message of the status as Status returns it, translated
+// by the translator of SetTranslator
+func (status ServiceStatus) String() string {
+	return status.format(message)
+}
+
+// MarshalJSON - the state, the PID, whether the service runs and
+// the legacy message of the status
+func (status ServiceStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&serviceStatusJSON{
+		State:   status.State,
+		PID:     status.PID,
+		Running: status.Running(),
+		Message: LegacyStatus(status),
+	})
+}
+
+// UnmarshalJSON - read the status written by MarshalJSON
+func (status *ServiceStatus) UnmarshalJSON(data []byte) error {
+	var value serviceStatusJSON
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	status.State = value.State
+	status.PID = value.PID
+	return nil
+}
+
+// JSON form of the status
+type serviceStatusJSON struct {
+	State   string `json:"state"`
+	PID     int    `json:"pid,omitempty"`
+	Running bool   `json:"running"`
+	Message string `json:"message"`
+}
+
+// LegacyStatus - the status in the English messages of the former versions,
+// e.g. "Service is stopped", regardless of the translator, for tooling which
+// matches these phrases. The states which the former versions did not know
+// are reported as they were: a reloading or a paused service as running,
+// a failed one as stopped and a stopping one by the state of the windows
+// service manager.
+func LegacyStatus(status ServiceStatus) string {
+	switch status.State {
+	case StatusReloading:
+		status.State = StatusRunning
+	case StatusFailed:
+		status.State = StatusStopped
+	case StatusStopping:
+		return fmt.Sprintf(MessageStatus, "SERVICE_STOP_PENDING")
+	case StatusPaused:
+		if status.PID > 0 {
+			status.State = StatusRunning
+		}
+	}
+	return status.format(fmt.Sprintf)
+}
+
+// ParseStatus - structured status of a message which is returned by Status,
+// in English or translated by the current translator. Unknown messages
+// are StatusUndefined.
+func ParseStatus(text string) ServiceStatus {
+	text = strings.TrimSpace(text)
+	for _, pattern := range statusPatterns {
+		for _, format := range []string{message(pattern.message), pattern.message} {
+			match := formatRegexp(format).FindStringSubmatch(text)
+			if match == nil {
+				continue
+			}
+			status := ServiceStatus{State: pattern.state}
+			if pattern.windows {
+				status.State = windowsStates[match[1]]
+				if status.State == "" {
+					status.State = StatusUndefined
+				}
+			} else if len(match) > 1 {
+				status.PID, _ = strconv.Atoi(strings.TrimSpace(match[1]))
+			}
+			return status
+		}
+	}
+	return ServiceStatus{State: StatusUndefined}
+}
+
+// Messages of the states, the first verb of the format is the PID,
+// the message of the windows service manager is its state
+var statusPatterns = []struct {
+	message string
+	state   string
+	windows bool
+}{
+	{MessageStopped, StatusStopped, false},
+	{MessageRunning, StatusRunning, false},
+	{MessageRunningPID, StatusRunning, false},
+	{MessageRunningSince, StatusRunning, false},
+	{MessageStarting, StatusStarting, false},
+	{MessageNotResponding, StatusNotResponding, false},
+	{MessageReloading, StatusReloading, false},
+	{MessageStopping, StatusStopping, false},
+	{MessagePaused, StatusPaused, false},
+	{MessageFailed, StatusFailed, false},
+	{MessageStatusUndefined, StatusUndefined, false},
+	{MessageStatus, "", true},
+}
+
+// States of the windows service manager
+var windowsStates = map[string]string{
+	"SERVICE_STOPPED":          StatusStopped,
+	"SERVICE_START_PENDING":    StatusStarting,
+	"SERVICE_STOP_PENDING":     StatusStopping,
+	"SERVICE_RUNNING":          StatusRunning,
+	"SERVICE_CONTINUE_PENDING": StatusStarting,
+	"SERVICE_PAUSE_PENDING":    StatusPaused,
+	"SERVICE_PAUSED":           StatusPaused,
+}
+
+// Status of a check of the init system, state applies if the service runs
+// and its main process is not stopped by a signal (Pause)
+func statusOf(running bool, state, pid string) ServiceStatus {
+	if !running {
+		return ServiceStatus{State: StatusStopped}
+	}
+	status := ServiceStatus{State: state}
+	status.PID, _ = strconv.Atoi(pid)
+	// a paused service does not beat its heart either
+	if (state == StatusRunning || state == StatusNotResponding) && processPaused(status.PID) {
+		status.State = StatusPaused
+	}
+	return status
+}
+
+// Message of the status and whether the service runs
+func (status ServiceStatus) result() (string, bool) {
+	return status.String(), status.Running()
+}
+
+// Regular expression which matches the formatted message, the verbs
+// are replaced by groups
+func formatRegexp(format string) *regexp.Regexp {
+	pattern := regexp.QuoteMeta(format)
+	pattern = strings.NewReplacer("%s", "(.*)", "%d", "([0-9]+)").Replace(pattern)
+	return regexp.MustCompile("^" + pattern + "$")
+}
+
+// Message of the status by the given formatter
+func (status ServiceStatus) format(format func(string, ...interface{}) string) string {
+	// the messages of the former versions have an empty PID if it is unknown
+	pid := ""
+	if status.PID > 0 {
+		pid = strconv.Itoa(status.PID)
+	}
+	switch status.State {
+	case StatusStopped:
+		return format(MessageStopped)
+	case StatusRunning:
+		if pid == "" {
+			return format(MessageRunning)
+		}
+		return format(MessageRunningPID, pid)
+	case StatusStarting:
+		return format(MessageStarting, pid)
+	case StatusNotResponding:
+		return format(MessageNotResponding, pid)
+	case StatusReloading:
+		return format(MessageReloading, pid)
+	case StatusStopping:
+		return format(MessageStopping, pid)
+	case StatusFailed:
+		return format(MessageFailed)
+	case StatusPaused:
+		if pid == "" {
+			return format(MessageStatus, "SERVICE_PAUSED")
+		}
+		return format(MessagePaused, pid)
+	}
+	return format(MessageStatusUndefined)
+}
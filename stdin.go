@@ -0,0 +1,58 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"strconv"
+	"strings"
+)
+
+// StandardInputSocket - the standard input of the service is the connection
+// of the socket which activates it (StandardInput=socket of systemd)
+const StandardInputSocket = "socket"
+
+// Problems of the standard input of the definition
+func checkStandardInputProblems(def *Definition) []string {
+	input := def.StandardInput
+	if input == "" || input == StandardInputSocket {
+		return nil
+	}
+	switch {
+	case !absolute(input):
+		return []string{"standard_input " + strconv.Quote(input) + " is not absolute"}
+	case strings.ContainsAny(input, "\x00\n\r \t"):
+		return []string{"standard_input " + strconv.Quote(input) + " contains a blank, a line break or a NUL"}
+	}
+	return nil
+}
+
+// Check the init system connects the standard input of the service to
+// a file, a FIFO or a device: systemd (StandardInput=file:), launchd
+// (StandardInPath) and the redirection of the System V script and of
+// the upstart job; daemon(8) of rc.d and the windows service manager
+// attach it to the null device. The socket is passed by systemd only,
+// which requires the socket section to listen on a single address.
+func checkStandardInput(kind Kind, def *Definition) error {
+	if problems := checkStandardInputProblems(def); len(problems) > 0 {
+		return &DefinitionError{Problems: problems}
+	}
+	switch {
+	case def.StandardInput == "":
+		return nil
+	case def.StandardInput == StandardInputSocket:
+		if kind != KindSystemD {
+			return &UnsupportedOptionError{"standard_input", kind}
+		}
+		if def.Socket == nil || len(def.Socket.ListenStream)+len(def.Socket.ListenDatagram) != 1 {
+			return &DefinitionError{Problems: []string{"standard_input socket requires a socket section with a single address"}}
+		}
+		return nil
+	}
+	switch kind {
+	case KindSystemD, KindLaunchd, KindSystemV, KindUpstart:
+		return nil
+	}
+	return &UnsupportedOptionError{"standard_input", kind}
+}
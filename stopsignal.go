@@ -0,0 +1,116 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signals which make a service stop gracefully
+const (
+	// SignalTerm - the default stop signal
+	SignalTerm = "SIGTERM"
+
+	// SignalInt - stop signal of services which stop like on Ctrl+C
+	SignalInt = "SIGINT"
+
+	// SignalQuit - graceful stop of nginx-style services
+	SignalQuit = "SIGQUIT"
+
+	// SignalHup - stop signal of services which stop on a hang-up
+	SignalHup = "SIGHUP"
+
+	// SignalWinch - graceful stop of the Apache HTTP server
+	SignalWinch = "SIGWINCH"
+)
+
+// Kill modes, which processes of a service are stopped
+const (
+	// KillControlGroup - the stop signal and the final kill are sent to all
+	// processes of the service, the default
+	KillControlGroup = "control-group"
+
+	// KillMixed - the stop signal is sent to the main process,
+	// the final kill to all processes of the service
+	KillMixed = "mixed"
+
+	// KillProcess - only the main process is stopped, its children are left
+	KillProcess = "process"
+)
+
+var (
+	// ErrUnknownSignal appears if the definition refers to a stop signal which is not supported
+	ErrUnknownSignal = errors.New("Unknown stop signal")
+
+	// ErrUnknownKillMode appears if the definition refers to a kill mode which does not exist
+	ErrUnknownKillMode = errors.New("Unknown kill mode")
+)
+
+// Check the stop signal of the definition, empty means SIGTERM
+func checkKillSignal(def *Definition) error {
+	switch def.KillSignal {
+	case "", SignalTerm, SignalInt, SignalQuit, SignalHup, SignalWinch:
+		return nil
+	}
+	return ErrUnknownSignal
+}
+
+// Check the kill mode of the definition, empty means KillControlGroup
+func checkKillMode(def *Definition) error {
+	switch def.KillMode {
+	case "", KillControlGroup, KillMixed, KillProcess:
+		return nil
+	}
+	return ErrUnknownKillMode
+}
+
+// Check the init system runs commands at the stop of the service,
+// launchd and the windows service manager only signal it
+func checkStopCommands(kind Kind, def *Definition) error {
+	if kind != KindLaunchd && kind != KindWindows {
+		return nil
+	}
+	if len(def.StopCommands) > 0 {
+		return &UnsupportedOptionError{"stop_commands", kind}
+	}
+	if len(def.PostStopCommands) > 0 {
+		return &UnsupportedOptionError{"post_stop_commands", kind}
+	}
+	return nil
+}
+
+// Name of the stop signal without the SIG prefix, as kill(1),
+// upstart and rc.subr take it
+func stopSignal(def *Definition) string {
+	if def.KillSignal == "" {
+		return strings.TrimPrefix(SignalTerm, "SIG")
+	}
+	return strings.TrimPrefix(def.KillSignal, "SIG")
+}
+
+// Stop signal of a service file, the SIG prefix is optional
+func parseSignal(value string) string {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "" || strings.HasPrefix(value, "SIG") {
+		return value
+	}
+	return "SIG" + value
+}
+
+// Timeout of a service file in seconds or as a duration, e.g. "90s",
+// zero if it could not be parsed
+func parseTimeSpan(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if timeout, err := time.ParseDuration(value); err == nil {
+		return timeout
+	}
+	return 0
+}
@@ -0,0 +1,42 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package systemd
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzParseStatus(f *testing.F) {
+	for _, test := range statusOutputs {
+		f.Add([]byte(test.output))
+	}
+	f.Fuzz(func(t *testing.T, output []byte) {
+		if running, pid := ParseStatus(output); !running && pid != "" {
+			t.Errorf("ParseStatus(%q) has the pid %q which does not run", output, pid)
+		}
+	})
+}
+
+func FuzzParseShow(f *testing.F) {
+	for _, test := range showOutputs {
+		f.Add([]byte(test.output))
+	}
+	f.Fuzz(func(t *testing.T, output []byte) {
+		for name, value := range ParseShow(output) {
+			if name == "" || strings.ContainsAny(name, "=\n") || strings.Contains(value, "\n") {
+				t.Errorf("ParseShow(%q) has the property %q = %q", output, name, value)
+			}
+		}
+		for id, state := range ParseStates(output) {
+			if state.PID != "" && !state.Running {
+				t.Errorf("ParseStates(%q) has the pid %q of %q which does not run", output, state.PID, id)
+			}
+		}
+	})
+}
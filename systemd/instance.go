@@ -0,0 +1,51 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package systemd
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/takama/daemon/internal/tools"
+)
+
+// BusAddress - D-Bus address of the system bus of the systemd instance
+// which the package controls instead of the manager of the host, e.g.
+// "unix:path=/tmp/instance/run/dbus/system_bus_socket" of a throwaway
+// instance of a test; systemctl talks to it by the bus then, not by the
+// private socket of the host manager
+var BusAddress string
+
+// Machine - local container whose manager the package controls
+// (systemctl --machine), e.g. an nspawn container of an image build
+var Machine string
+
+// Remote - check the package controls another instance than the manager
+// of the host, by BusAddress or Machine
+func Remote() bool {
+	return BusAddress != "" || Machine != ""
+}
+
+// Command of a systemd tool (systemctl, journalctl) which addresses the
+// controlled instance, the units under a root directory are handled by
+// the tool itself without any manager
+func command(name string, args ...string) *exec.Cmd {
+	offline := false
+	for _, arg := range args {
+		offline = offline || strings.HasPrefix(arg, "--root=")
+	}
+	if Machine != "" && !offline {
+		args = append([]string{"--machine=" + Machine}, args...)
+	}
+	cmd := tools.Command(name, args...)
+	if name == "systemctl" && escalated(args) {
+		cmd = pkexecCommand(args)
+	}
+	if BusAddress != "" && !offline {
+		cmd.Env = append(os.Environ(), "DBUS_SYSTEM_BUS_ADDRESS="+BusAddress, "SYSTEMCTL_FORCE_BUS=1")
+	}
+	return cmd
+}
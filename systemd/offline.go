@@ -0,0 +1,280 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package systemd
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/takama/daemon/internal/tools"
+)
+
+// OfflineMode - whether the units are enabled without the manager
+type OfflineMode int
+
+// Offline modes
+const (
+	// OfflineAuto - offline if $SYSTEMD_OFFLINE asks for it or if no
+	// manager runs (/run/systemd/system is missing): chroots, image builds
+	OfflineAuto OfflineMode = iota
+
+	// OfflineAlways - never ask the manager
+	OfflineAlways
+
+	// OfflineNever - always ask the manager, systemctl fails if it does not run
+	OfflineNever
+)
+
+// Offline - how units are enabled, OfflineAuto by default. Offline units
+// are enabled and disabled by the symlinks of their [Install] section,
+// which systemctl would create, the manager is not reloaded.
+var Offline = OfflineAuto
+
+// IsOffline - check the units are enabled without the manager,
+// never for another instance (see Remote) unless it is asked for
+func IsOffline() bool {
+	if offline, ok := offlineSetting(); ok {
+		return offline
+	}
+	if Remote() {
+		return false
+	}
+	_, err := os.Stat("/run/systemd/system")
+	return err != nil
+}
+
+// OfflineRequested - check the offline mode is asked for explicitly,
+// by Offline or by $SYSTEMD_OFFLINE, and not detected
+func OfflineRequested() bool {
+	offline, ok := offlineSetting()
+	return ok && offline
+}
+
+// Explicit offline mode, ok is false if it is detected
+func offlineSetting() (offline bool, ok bool) {
+	switch Offline {
+	case OfflineAlways:
+		return true, true
+	case OfflineNever:
+		return false, true
+	}
+	// the values of systemctl itself
+	switch strings.ToLower(os.Getenv("SYSTEMD_OFFLINE")) {
+	case "1", "yes", "true", "on":
+		return true, true
+	case "0", "no", "false", "off":
+		return false, true
+	}
+	return false, false
+}
+
+// Check the units under root are enabled by their symlinks: no manager runs
+// on the host, or systemctl, which would enable them by --root, is missing
+func offlineLinks(root string) bool {
+	if root == "" {
+		return IsOffline()
+	}
+	return !tools.Available("systemctl")
+}
+
+// Enable or disable a unit: by systemctl, by systemctl --root for an
+// offline image, by the symlinks of its [Install] section if the manager
+// does not run or, by FallbackOffline, is not available
+func enablement(root, action, fileName string) error {
+	if !offlineLinks(root) {
+		if root != "" {
+			return command("systemctl", "--root="+root, action, fileName).Run()
+		}
+		_, err := systemctl(action, fileName)
+		if !fallback(err) {
+			return err
+		}
+	}
+	if action == "enable" {
+		return enableLinks(root, fileName)
+	}
+	return disableLinks(root, fileName)
+}
+
+// File of the unit, the template file of an instance
+func unitFile(fileName string) string {
+	if i := strings.Index(fileName, "@"); i >= 0 {
+		return fileName[:i+1] + fileName[strings.LastIndex(fileName, "."):]
+	}
+	return fileName
+}
+
+// Instance of a unit name, empty for other units
+func unitInstance(fileName string) string {
+	i := strings.Index(fileName, "@")
+	if i < 0 {
+		return ""
+	}
+	return fileName[i+1 : strings.LastIndex(fileName, ".")]
+}
+
+// Units of the [Install] section of the unit file which want or require
+// the unit, its aliases and the units which are enabled with it (Also=)
+func installSection(root, fileName string) (wantedBy, requiredBy, aliases, also []string, err error) {
+	file, err := os.Open(root + Dir + unitFile(fileName))
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	defer file.Close()
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			section = line
+			continue
+		}
+		i := strings.Index(line, "=")
+		if section != "[Install]" || i < 0 {
+			continue
+		}
+		values := strings.Fields(line[i+1:])
+		var list *[]string
+		switch strings.TrimSpace(line[:i]) {
+		case "WantedBy":
+			list = &wantedBy
+		case "RequiredBy":
+			list = &requiredBy
+		case "Alias":
+			list = &aliases
+		case "Also":
+			list = &also
+		default:
+			continue
+		}
+		// an empty assignment resets the list
+		if len(values) == 0 {
+			*list = nil
+		}
+		*list = append(*list, values...)
+	}
+	return wantedBy, requiredBy, aliases, also, scanner.Err()
+}
+
+// Create the symlinks of the [Install] section of the unit and of the
+// units of its Also=, an instance is wanted by the instance of a template
+// with the same instance name
+func enableLinks(root, fileName string) error {
+	return withAlso(root, fileName, map[string]bool{}, enableUnitLinks)
+}
+
+// Remove the symlinks of the unit and of the units of its Also=
+func disableLinks(root, fileName string) error {
+	return withAlso(root, fileName, map[string]bool{}, disableUnitLinks)
+}
+
+// Apply the change to the unit and to the units of its Also=, every unit
+// once, as systemctl does
+func withAlso(root, fileName string, seen map[string]bool, change func(root, fileName string) error) error {
+	if seen[fileName] {
+		return nil
+	}
+	seen[fileName] = true
+	if err := change(root, fileName); err != nil {
+		return err
+	}
+	_, _, _, also, err := installSection(root, fileName)
+	if err != nil {
+		return nil
+	}
+	for _, unit := range also {
+		if err := withAlso(root, unit, seen, change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create the symlinks of the [Install] section of the unit
+func enableUnitLinks(root, fileName string) error {
+	wantedBy, requiredBy, aliases, _, err := installSection(root, fileName)
+	if err != nil {
+		return err
+	}
+	target := Dir + unitFile(fileName)
+	instance := unitInstance(fileName)
+	var links []string
+	for _, dirs := range []struct {
+		units  []string
+		suffix string
+	}{{wantedBy, ".wants/"}, {requiredBy, ".requires/"}} {
+		for _, unit := range dirs.units {
+			if instance != "" && strings.Contains(unit, "@.") {
+				unit = strings.Replace(unit, "@.", "@"+instance+".", 1)
+			}
+			links = append(links, root+Dir+unit+dirs.suffix+fileName)
+		}
+	}
+	for _, alias := range aliases {
+		links = append(links, root+Dir+alias)
+	}
+	for _, link := range links {
+		// a link to another file (a former image build, a unit which
+		// moved) is replaced as systemctl does it, a file is kept
+		if current, err := os.Readlink(link); err == nil {
+			if current == target {
+				continue
+			}
+			if err := os.Remove(link); err != nil {
+				return err
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+			return err
+		}
+		if err := os.Symlink(target, link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove the symlinks which want or require the unit and its aliases
+func disableUnitLinks(root, fileName string) error {
+	links, err := enabledLinks(root, fileName)
+	if err != nil {
+		return err
+	}
+	if _, _, aliases, _, err := installSection(root, fileName); err == nil {
+		for _, alias := range aliases {
+			link := root + Dir + alias
+			if target, err := os.Readlink(link); err == nil && filepath.Base(target) == unitFile(fileName) {
+				links = append(links, link)
+			}
+		}
+	}
+	for _, link := range links {
+		if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Symlinks which want or require the unit
+func enabledLinks(root, fileName string) ([]string, error) {
+	var links []string
+	for _, pattern := range []string{"*.wants/", "*.requires/"} {
+		matches, err := filepath.Glob(root + Dir + pattern + fileName)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, matches...)
+	}
+	return links, nil
+}
+
+// Check the unit is wanted or required by another unit
+func linksEnabled(root, fileName string) (bool, error) {
+	links, err := enabledLinks(root, fileName)
+	return len(links) > 0, err
+}
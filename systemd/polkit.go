@@ -0,0 +1,78 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package systemd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/takama/daemon/internal/tools"
+)
+
+// ErrNotAuthorized appears if polkit refused the operation or the user
+// dismissed the authentication dialog
+var ErrNotAuthorized = errors.New("Operation was not authorized by polkit")
+
+// Pkexec - run the systemctl commands which change the system manager
+// (start, stop, enable, daemon-reload, ...) by pkexec when the process is
+// not root: polkit authenticates an administrator by the dialog of the
+// desktop agent and the command runs as root. Queries run unprivileged.
+// Without it systemctl asks the manager over D-Bus, which authorizes the
+// operations of an ordinary user by polkit as well (interactively, if an
+// agent of the session is running).
+var Pkexec bool
+
+// Verbs of systemctl which change the manager or the unit files
+var changingVerbs = map[string]bool{
+	"start": true, "stop": true, "restart": true, "reload": true, "try-restart": true,
+	"kill": true, "reset-failed": true, "enable": true, "disable": true,
+	"mask": true, "unmask": true, "daemon-reload": true, "set-property": true,
+}
+
+// errors of systemctl when polkit refused the operation
+var deniedRegexp = regexp.MustCompile("Access denied|Interactive authentication required|Not authorized")
+
+// Check the systemctl command is run by pkexec: the command changes the
+// system manager and the process is not root
+func escalated(args []string) bool {
+	if !Pkexec || BusAddress != "" || os.Geteuid() == 0 {
+		return false
+	}
+	for _, arg := range args {
+		if arg == "--user" || strings.HasPrefix(arg, "--root=") {
+			return false
+		}
+		if !strings.HasPrefix(arg, "-") {
+			return changingVerbs[arg]
+		}
+	}
+	return false
+}
+
+// Command of systemctl run by pkexec, which needs the absolute path of
+// the program
+func pkexecCommand(args []string) *exec.Cmd {
+	path, err := tools.Path("systemctl")
+	if err != nil {
+		return tools.Command("systemctl", args...)
+	}
+	return tools.Command("pkexec", append([]string{path}, args...)...)
+}
+
+// Error of the command, ErrNotAuthorized if polkit refused it: pkexec
+// exits with 126 if the dialog was dismissed and 127 if the user is not
+// authorized, systemctl reports the denial of the manager
+func authorization(err error, stderr []byte, pkexec bool) error {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code := exitErr.ExitCode()
+		if (pkexec && (code == 126 || code == 127)) || deniedRegexp.Match(stderr) {
+			return ErrNotAuthorized
+		}
+	}
+	return err
+}
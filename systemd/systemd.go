@@ -0,0 +1,779 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+// Package systemd controls services of the systemd init system.
+//
+// It is used by the daemon package on linux hosts and gives access to
+// systemd specific operations (daemon-reload, enable, disable) which are
+// not part of the portable daemon.Daemon interface.
+package systemd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dir - standard directory of system units
+const Dir = "/etc/systemd/system/"
+
+// Roots of the cgroup hierarchy of systemd, the unified (v2) and the legacy (v1) one
+var cgroupRoots = []string{"/sys/fs/cgroup/", "/sys/fs/cgroup/systemd/"}
+
+var (
+	// e.g. "Active: active (running) since ...", "Active: activating (start-pre)"
+	activeRegexp = regexp.MustCompile(`(?m)^\s*Active: ([a-z]+)(?: \(([a-z-]+)\))?`)
+	// e.g. "Main PID: 42 (myservice)", "Main PID: 42 (code=exited, status=1/FAILURE)"
+	pidRegexp = regexp.MustCompile(`(?m)^\s*Main PID: ([0-9]+)( \(code=)?`)
+
+	// errors of systemctl while the manager is not reachable on the bus
+	unreachableRegexp = regexp.MustCompile("Failed to connect to bus|Transport endpoint is not connected|" +
+		"Connection reset by peer|Connection timed out|Broken pipe|Connection refused")
+)
+
+// ReexecTimeout - time systemctl is retried while the manager is not
+// reachable, e.g. while it re-executes itself on daemon-reexec or
+// after a soft-reboot, so the units are not reported as stopped
+var ReexecTimeout = 5 * time.Second
+
+// Run systemctl and return its output, the call is repeated while the
+// manager is not reachable; an UnavailableError tells why the manager
+// could not carry out the command
+func systemctl(args ...string) ([]byte, error) {
+	deadline := time.Now().Add(ReexecTimeout)
+	for {
+		var stderr bytes.Buffer
+		cmd := command("systemctl", args...)
+		cmd.Stderr = &stderr
+		output, err := cmd.Output()
+		if err == nil || !unreachableRegexp.Match(stderr.Bytes()) ||
+			offlineRegexp.Match(stderr.Bytes()) || time.Now().After(deadline) {
+			err = authorization(err, stderr.Bytes(), escalated(args))
+			return output, availability(args, err, stderr.Bytes())
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// Unit - systemd service unit
+type Unit struct {
+	// Name of the service without the ".service" suffix
+	Name string
+
+	// Root - root directory of an offline image (e.g. /mnt/image) which
+	// contains the unit, empty for the running system
+	Root string
+
+	// Template - the unit is the template "<name>@.service", its instances
+	// are "<name>@<instance>.service"
+	Template bool
+
+	// User - the unit belongs to the service manager of the current user
+	// (systemctl --user), its file is in UserDir
+	User bool
+}
+
+// UserDir - directory of the units of the current user,
+// $XDG_CONFIG_HOME/systemd/user/ or ~/.config/systemd/user/
+func UserDir() string {
+	if config := os.Getenv("XDG_CONFIG_HOME"); config != "" {
+		return config + "/systemd/user/"
+	}
+	home, _ := os.UserHomeDir()
+	return home + "/.config/systemd/user/"
+}
+
+// Arguments of systemctl for the manager of the unit
+func (unit *Unit) manager(args ...string) []string {
+	if unit.User {
+		return append([]string{"--user"}, args...)
+	}
+	return args
+}
+
+// New - create a service unit with the given name
+func New(name string) *Unit {
+	return &Unit{Name: name}
+}
+
+// FileName - file name of the unit
+func (unit *Unit) FileName() string {
+	if unit.Template {
+		return unit.Name + "@.service"
+	}
+	return unit.Name + ".service"
+}
+
+// Instance - unit of the instance of the template
+func (unit *Unit) Instance(instance string) *Unit {
+	return &Unit{Name: unit.Name + "@" + instance, Root: unit.Root, User: unit.User}
+}
+
+// Instances - the active instances of the template unit
+func (unit *Unit) Instances() ([]string, error) {
+	output, err := systemctl(unit.manager("list-units", "--plain", "--no-legend",
+		"--state=active", unit.Name+"@*.service")...)
+	if err != nil {
+		return nil, err
+	}
+	var instances []string
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		instance := strings.TrimSuffix(strings.TrimPrefix(fields[0], unit.Name+"@"), ".service")
+		if instance != fields[0] {
+			instances = append(instances, instance)
+		}
+	}
+	return instances, nil
+}
+
+// Path - standard path of the unit file
+func (unit *Unit) Path() string {
+	if unit.User {
+		return UserDir() + unit.FileName()
+	}
+	return unit.Root + Dir + unit.FileName()
+}
+
+// IsInstalled - check the unit file exists
+func (unit *Unit) IsInstalled() bool {
+	_, err := os.Stat(unit.Path())
+	return err == nil
+}
+
+// IsLoaded - check the manager still has the unit although its file may be
+// gone, e.g. deleted by hand: the unit runs, is in a transition or has
+// failed. The units of an offline image and the templates are never loaded.
+func (unit *Unit) IsLoaded() bool {
+	if unit.Root != "" || unit.Template || IsOffline() {
+		return false
+	}
+	values, err := unit.Show("ActiveState")
+	if err != nil {
+		return false
+	}
+	switch values["ActiveState"] {
+	case "", "inactive":
+		return false
+	}
+	return true
+}
+
+// Status - check the unit is running and return its main PID if it is known.
+// The processes of the unit are read from its cgroup, which is kept while
+// the manager re-executes itself, systemctl is executed only for the units
+// of the user and if the cgroup hierarchy of systemd is not available.
+func (unit *Unit) Status() (running bool, pid string) {
+	if running, pid, ok := unit.cgroupStatus(); ok {
+		return running, pid
+	}
+	// systemctl status fails for inactive units, its output tells the state
+	output, _ := systemctl(unit.manager("status", unit.FileName())...)
+	return ParseStatus(output)
+}
+
+// ParseStatus - state of a unit in the output of "systemctl status": the unit
+// runs while it is active, reloading, activating (but not waiting for its
+// automatic restart) or deactivating, as stateOf tells it. The pid is empty
+// if the main PID is not known (yet), e.g. of a forking unit with
+// GuessMainPID=no. A unit whose main process has exited (oneshot services)
+// is not running.
+func ParseStatus(output []byte) (running bool, pid string) {
+	active := activeRegexp.FindSubmatch(output)
+	if active == nil || !activeState(string(active[1]), string(active[2])) {
+		return false, ""
+	}
+	data := pidRegexp.FindSubmatch(output)
+	switch {
+	case data == nil:
+		return true, ""
+	case len(data[2]) > 0:
+		// "Main PID: 402 (code=exited, status=0/SUCCESS)"
+		return false, ""
+	}
+	return true, string(data[1])
+}
+
+// Check the processes of a unit in the active and sub state exist
+func activeState(state, sub string) bool {
+	switch state {
+	case "active", "reloading", "deactivating":
+		return true
+	case "activating":
+		return sub != "auto-restart"
+	}
+	return false
+}
+
+// ControlGroup - cgroup of the unit below the root of the hierarchy, as
+// systemd creates it for a system unit: a service is in system.slice, an
+// instance of a template in the slice of the template, e.g.
+// "system.slice/system-my\x2dapp.slice/my-app@1.service"
+func (unit *Unit) ControlGroup() string {
+	if i := strings.Index(unit.Name, "@"); i > 0 {
+		// "-" separates the parents of a slice in its name
+		slice := "system-" + strings.Replace(unit.Name[:i], "-", `\x2d`, -1) + ".slice"
+		return "system.slice/" + slice + "/" + unit.FileName()
+	}
+	return "system.slice/" + unit.FileName()
+}
+
+// Check the cgroup of the unit or one of its subgroups (Delegate=yes) has
+// any process; ok is false if the cgroup hierarchy is unknown and for the
+// units of the user, whose cgroups are below the manager of the user
+func (unit *Unit) cgroupStatus() (running bool, pid string, ok bool) {
+	if unit.User {
+		return false, "", false
+	}
+	for _, root := range cgroupRoots {
+		if _, err := os.Stat(unit.Root + root + "system.slice"); err != nil {
+			continue
+		}
+		// the cgroup of a stopped unit is removed
+		pids := cgroupProcesses(unit.Root + root + unit.ControlGroup())
+		if len(pids) == 0 {
+			return false, "", true
+		}
+		return true, mainProcess(unit.Root, pids), true
+	}
+	return false, "", false
+}
+
+// Processes of the cgroup and of its subgroups
+func cgroupProcesses(dir string) []string {
+	data, err := ioutil.ReadFile(dir + "/cgroup.procs")
+	if err != nil {
+		return nil
+	}
+	pids := strings.Fields(string(data))
+	entries, _ := ioutil.ReadDir(dir)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			pids = append(pids, cgroupProcesses(dir+"/"+entry.Name())...)
+		}
+	}
+	return pids
+}
+
+// Main process among the processes of a unit: the only one whose parent is
+// the manager (PID 1), empty if it is not known, e.g. while the commands of
+// ExecStartPre run beside it
+func mainProcess(root string, pids []string) string {
+	main := ""
+	for _, pid := range pids {
+		data, err := ioutil.ReadFile(root + "/proc/" + pid + "/stat")
+		if err != nil {
+			continue
+		}
+		// "pid (comm) state ppid ...", the command may contain spaces and parentheses
+		fields := strings.Fields(string(data[bytes.LastIndexByte(data, ')')+1:]))
+		if len(fields) < 2 || fields[1] != "1" {
+			continue
+		}
+		if main != "" {
+			return ""
+		}
+		main = pid
+	}
+	return main
+}
+
+// State - state of a unit which is reported by States
+type State struct {
+	Running bool
+	PID     string
+
+	// ActiveState - e.g. "active", "reloading", "activating", "deactivating",
+	// "failed" or "inactive", empty if the manager could not be asked
+	ActiveState string
+
+	// SubState - e.g. "running", "start-pre", "auto-restart"
+	SubState string
+}
+
+// State - state of the unit for the polls of its status: the main process
+// of a unit whose cgroup has processes is read from the cgroup, and the
+// manager is asked only for the active state, which tells the transitional
+// states and a failed unit whose processes are left; the processes are
+// taken as running if the manager is not reachable. The other units are
+// reported by DetailedState.
+func (unit *Unit) State() State {
+	running, pid, ok := unit.cgroupStatus()
+	if !ok || !running {
+		return unit.DetailedState()
+	}
+	values, err := unit.Show("ActiveState", "SubState")
+	if err != nil || values["ActiveState"] == "" {
+		return State{Running: true, PID: pid}
+	}
+	state := stateOf(values)
+	if state.Running {
+		state.PID = pid
+	}
+	return state
+}
+
+// DetailedState - state of the unit by its active state, which tells the
+// transitional and the failed states; the processes of the unit are checked
+// as Status does if the manager is not reachable
+func (unit *Unit) DetailedState() State {
+	values, err := unit.Show("ActiveState", "SubState", "MainPID")
+	if err != nil || values["ActiveState"] == "" {
+		running, pid := unit.Status()
+		return State{Running: running, PID: pid}
+	}
+	return stateOf(values)
+}
+
+// State of a unit by its properties
+func stateOf(values map[string]string) State {
+	state := State{ActiveState: values["ActiveState"], SubState: values["SubState"]}
+	state.Running = activeState(state.ActiveState, state.SubState)
+	if pid := values["MainPID"]; state.Running && pid != "0" {
+		state.PID = pid
+	}
+	return state
+}
+
+// States - states of the named units (without the ".service" suffix)
+// queried by a single systemctl call, units which are unknown to systemd
+// are reported as not running
+func States(names ...string) (map[string]State, error) {
+	states := make(map[string]State, len(names))
+	if len(names) == 0 {
+		return states, nil
+	}
+	args := []string{"show", "--property=Id,ActiveState,SubState,MainPID"}
+	for _, name := range names {
+		args = append(args, New(name).FileName())
+	}
+	output, err := systemctl(args...)
+	if err != nil {
+		return nil, err
+	}
+	for id, state := range ParseStates(output) {
+		states[id] = state
+	}
+	return states, nil
+}
+
+// ParseStates - states of the units in the output of "systemctl show
+// --property=Id,ActiveState,SubState,MainPID" for several units, by the
+// names of the units without the ".service" suffix
+func ParseStates(output []byte) map[string]State {
+	states := make(map[string]State)
+	// the blocks of the units are separated by empty lines
+	text := strings.Replace(string(output), "\r\n", "\n", -1)
+	for _, block := range strings.Split(text, "\n\n") {
+		values := ParseShow([]byte(block))
+		if id := strings.TrimSuffix(values["Id"], ".service"); id != "" {
+			states[id] = stateOf(values)
+		}
+	}
+	return states
+}
+
+// Show - values of the properties of the unit, see systemctl show
+func (unit *Unit) Show(properties ...string) (map[string]string, error) {
+	args := unit.manager("show", unit.FileName())
+	if len(properties) > 0 {
+		args = append(args, "--property="+strings.Join(properties, ","))
+	}
+	output, err := systemctl(args...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseShow(output), nil
+}
+
+// ParseShow - properties in the output of "systemctl show", the lines
+// are "Name=value", values may contain "="
+func ParseShow(output []byte) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if i := strings.Index(line, "="); i > 0 {
+			values[line[:i]] = line[i+1:]
+		}
+	}
+	return values
+}
+
+// NeedDaemonReload - check the unit file has changed since the manager
+// loaded it, then DaemonReload is required before the unit is (re)started.
+// Units of an offline image or of a host without the manager are loaded
+// when it boots.
+func (unit *Unit) NeedDaemonReload() (bool, error) {
+	if unit.Root != "" || IsOffline() {
+		return false, nil
+	}
+	values, err := unit.Show("NeedDaemonReload")
+	if err != nil {
+		return false, err
+	}
+	return values["NeedDaemonReload"] == "yes", nil
+}
+
+// Start - start the unit
+func (unit *Unit) Start() error {
+	_, err := systemctl(unit.manager("start", unit.FileName())...)
+	return err
+}
+
+// Stop - stop the unit
+func (unit *Unit) Stop() error {
+	_, err := systemctl(unit.manager("stop", unit.FileName())...)
+	return err
+}
+
+// Restart - stop and start the unit, a stopped unit is started
+func (unit *Unit) Restart() error {
+	_, err := systemctl(unit.manager("restart", unit.FileName())...)
+	return err
+}
+
+// Kill - send the signal (e.g. "SIGSTOP") to all processes of the unit
+func (unit *Unit) Kill(signal string) error {
+	_, err := systemctl(unit.manager("kill", "--signal="+signal, unit.FileName())...)
+	return err
+}
+
+// ResetFailed - clear the failed state and the restart counter of the unit,
+// of all instances of a template; a unit whose file was deleted is unloaded then
+func (unit *Unit) ResetFailed() error {
+	name := unit.FileName()
+	if unit.Template {
+		name = unit.Name + "@*.service"
+	}
+	_, err := systemctl(unit.manager("reset-failed", name)...)
+	return err
+}
+
+// Mask - make the unit impossible to start, even as a dependency of another
+// unit, until Unmask; the mask is kept in /run and lasts until the next boot
+func (unit *Unit) Mask() error {
+	_, err := systemctl(unit.manager("mask", "--runtime", unit.FileName())...)
+	return err
+}
+
+// Unmask - allow the masked unit to be started again
+func (unit *Unit) Unmask() error {
+	_, err := systemctl(unit.manager("unmask", "--runtime", unit.FileName())...)
+	return err
+}
+
+// Enable - enable the unit to be started at boot, a unit of the user
+// is started when the manager of the user starts, usually at login
+func (unit *Unit) Enable() error {
+	if unit.User {
+		_, err := systemctl("--user", "enable", unit.FileName())
+		return err
+	}
+	return enablement(unit.Root, "enable", unit.FileName())
+}
+
+// Disable - disable the unit to be started at boot
+func (unit *Unit) Disable() error {
+	if unit.User {
+		_, err := systemctl("--user", "disable", unit.FileName())
+		return err
+	}
+	return enablement(unit.Root, "disable", unit.FileName())
+}
+
+// IsEnabled - check the unit is started at boot
+// (at the login for a unit of the user)
+func (unit *Unit) IsEnabled() (bool, error) {
+	var cmd *exec.Cmd
+	switch {
+	case unit.User:
+		cmd = command("systemctl", "--user", "is-enabled", unit.FileName())
+	case offlineLinks(unit.Root):
+		return linksEnabled(unit.Root, unit.FileName())
+	case unit.Root != "":
+		cmd = command("systemctl", "--root="+unit.Root, "is-enabled", unit.FileName())
+	default:
+		cmd = command("systemctl", "is-enabled", unit.FileName())
+	}
+	// systemctl is-enabled fails for disabled units, its output tells the state
+	output, err := cmd.Output()
+	state := strings.TrimSpace(string(output))
+	if state == "" {
+		return false, err
+	}
+	return state == "enabled" || state == "enabled-runtime", nil
+}
+
+// Journal - the last lines of the journal of the unit, all lines if lines <= 0
+func (unit *Unit) Journal(lines int) (string, error) {
+	option := "--unit"
+	if unit.User {
+		option = "--user-unit"
+	}
+	args := []string{option, unit.FileName(), "--no-pager", "--quiet"}
+	if lines > 0 {
+		args = append(args, "--lines", strconv.Itoa(lines))
+	}
+	output, err := command("journalctl", args...).Output()
+	return string(output), err
+}
+
+// Target - systemd target unit which groups services
+type Target struct {
+	// Name of the target without the ".target" suffix
+	Name string
+
+	// Root - root directory of an offline image (e.g. /mnt/image) which
+	// contains the unit, empty for the running system
+	Root string
+}
+
+// NewTarget - create a target unit with the given name
+func NewTarget(name string) *Target {
+	return &Target{Name: name}
+}
+
+// FileName - file name of the target
+func (target *Target) FileName() string {
+	return target.Name + ".target"
+}
+
+// Path - standard path of the target file
+func (target *Target) Path() string {
+	return target.Root + Dir + target.FileName()
+}
+
+// Start - start the target and the services which are wanted by it
+func (target *Target) Start() error {
+	return command("systemctl", "start", target.FileName()).Run()
+}
+
+// Stop - stop the target and the services which are part of it
+func (target *Target) Stop() error {
+	return command("systemctl", "stop", target.FileName()).Run()
+}
+
+// Enable - enable the target to be started at boot
+func (target *Target) Enable() error {
+	return enablement(target.Root, "enable", target.FileName())
+}
+
+// Disable - disable the target to be started at boot
+func (target *Target) Disable() error {
+	return enablement(target.Root, "disable", target.FileName())
+}
+
+// Types of the activation units
+const (
+	TypeSocket = "socket"
+	TypeTimer  = "timer"
+	TypePath   = "path"
+)
+
+// ActivationUnit - systemd socket, timer or path unit which activates
+// the service of the same name
+type ActivationUnit struct {
+	// Name of the unit without the suffix of its type
+	Name string
+
+	// Type - TypeSocket, TypeTimer or TypePath, the suffix of the unit file
+	Type string
+
+	// Root - root directory of an offline image (e.g. /mnt/image) which
+	// contains the unit, empty for the running system
+	Root string
+
+	// User - the unit belongs to the user manager (systemctl --user)
+	User bool
+}
+
+// NewActivationUnit - create an activation unit of the given type with the given name
+func NewActivationUnit(name, unitType string) *ActivationUnit {
+	return &ActivationUnit{Name: name, Type: unitType}
+}
+
+// FileName - file name of the activation unit
+func (unit *ActivationUnit) FileName() string {
+	return unit.Name + "." + unit.Type
+}
+
+// Path - standard path of the activation unit file
+func (unit *ActivationUnit) Path() string {
+	if unit.User {
+		return UserDir() + unit.FileName()
+	}
+	return unit.Root + Dir + unit.FileName()
+}
+
+// Enable - enable and start the activation unit, in an offline image or
+// without the manager it is only enabled
+func (unit *ActivationUnit) Enable() error {
+	return unit.change("enable")
+}
+
+// Disable - stop and disable the activation unit, in an offline image or
+// without the manager it is only disabled
+func (unit *ActivationUnit) Disable() error {
+	return unit.change("disable")
+}
+
+// Enable or disable the activation unit, it is started or stopped with it
+func (unit *ActivationUnit) change(action string) error {
+	if unit.User {
+		return command("systemctl", "--user", action, "--now", unit.FileName()).Run()
+	}
+	if unit.Root != "" || IsOffline() {
+		return enablement(unit.Root, action, unit.FileName())
+	}
+	return command("systemctl", action, "--now", unit.FileName()).Run()
+}
+
+// PathUnit - systemd path unit which activates the service of the same name
+type PathUnit struct {
+	// Name of the path unit without the ".path" suffix
+	Name string
+
+	// Root - root directory of an offline image (e.g. /mnt/image) which
+	// contains the unit, empty for the running system
+	Root string
+}
+
+// NewPathUnit - create a path unit with the given name
+func NewPathUnit(name string) *PathUnit {
+	return &PathUnit{Name: name}
+}
+
+// Activation unit of the path unit
+func (unit *PathUnit) activation() *ActivationUnit {
+	return &ActivationUnit{Name: unit.Name, Type: TypePath, Root: unit.Root}
+}
+
+// FileName - file name of the path unit
+func (unit *PathUnit) FileName() string {
+	return unit.activation().FileName()
+}
+
+// Path - standard path of the path unit file
+func (unit *PathUnit) Path() string {
+	return unit.activation().Path()
+}
+
+// Enable - enable and start the path unit, in an offline image or without
+// the manager it is only enabled
+func (unit *PathUnit) Enable() error {
+	return unit.activation().Enable()
+}
+
+// Disable - stop and disable the path unit, in an offline image or without
+// the manager it is only disabled
+func (unit *PathUnit) Disable() error {
+	return unit.activation().Disable()
+}
+
+// Priority - syslog priority of a journal entry, lower values are more important
+type Priority int
+
+// Priorities of journal entries
+const (
+	PriorityEmergency Priority = iota
+	PriorityAlert
+	PriorityCritical
+	PriorityError
+	PriorityWarning
+	PriorityNotice
+	PriorityInfo
+	PriorityDebug
+)
+
+// Entry - entry of the journal
+type Entry struct {
+	Time     time.Time
+	Priority Priority
+	PID      string
+	Message  string
+}
+
+// Entries - the last entries of the journal of the unit with the given or
+// a more important priority, all entries if lines <= 0. Messages of the unit
+// itself and of systemd about the unit are included.
+func (unit *Unit) Entries(lines int, priority Priority) ([]Entry, error) {
+	args := []string{"--unit", unit.FileName(), "--no-pager", "--quiet",
+		"--output", "json", "--priority", strconv.Itoa(int(priority))}
+	if lines > 0 {
+		args = append(args, "--lines", strconv.Itoa(lines))
+	}
+	output, err := command("journalctl", args...).Output()
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			return nil, err
+		}
+		var entry Entry
+		if usec, err := strconv.ParseInt(journalField(fields["__REALTIME_TIMESTAMP"]), 10, 64); err == nil {
+			entry.Time = time.Unix(0, usec*int64(time.Microsecond))
+		}
+		if value, err := strconv.Atoi(journalField(fields["PRIORITY"])); err == nil {
+			entry.Priority = Priority(value)
+		}
+		entry.PID = journalField(fields["_PID"])
+		entry.Message = journalField(fields["MESSAGE"])
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Value of a journal field, it is a string or an array of bytes
+// if the value is not valid UTF-8
+func journalField(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	var data []byte
+	var values []int
+	if err := json.Unmarshal(raw, &values); err == nil {
+		for _, value := range values {
+			data = append(data, byte(value))
+		}
+	}
+	return string(data)
+}
+
+// DaemonReload - reload the systemd manager configuration,
+// required after a unit file was created, changed or removed;
+// without the manager (IsOffline) there is nothing to reload, by
+// FallbackOffline neither if the manager is not available
+func DaemonReload() error {
+	if IsOffline() {
+		return nil
+	}
+	_, err := systemctl("daemon-reload")
+	if fallback(err) {
+		// the units are loaded when the manager starts
+		return nil
+	}
+	return err
+}
+
+// UserDaemonReload - reload the configuration of the manager of the current user
+func UserDaemonReload() error {
+	_, err := systemctl("--user", "daemon-reload")
+	return err
+}
@@ -0,0 +1,356 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package systemd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/takama/daemon/internal/tools"
+)
+
+// Captured output of "systemctl status <unit>"
+var statusOutputs = []struct {
+	name    string
+	output  string
+	running bool
+	pid     string
+}{
+	{
+		name: "running",
+		output: `● nginx.service - A high performance web server and a reverse proxy server
+     Loaded: loaded (/lib/systemd/system/nginx.service; enabled; vendor preset: enabled)
+     Active: active (running) since Tue 2023-05-16 10:21:43 UTC; 2 days ago
+       Docs: man:nginx(8)
+   Main PID: 812 (nginx)
+      Tasks: 3 (limit: 4557)
+     Memory: 12.1M
+        CPU: 1.234s
+     CGroup: /system.slice/nginx.service
+             ├─812 "nginx: master process /usr/sbin/nginx -g daemon on; master_process on;"
+             └─813 "nginx: worker process"
+`,
+		running: true,
+		pid:     "812",
+	},
+	{
+		name: "no MainPID",
+		output: `● myservice.service - My Service
+     Loaded: loaded (/etc/systemd/system/myservice.service; enabled; vendor preset: enabled)
+     Active: active (running) since Thu 2023-05-18 09:12:01 UTC; 5min ago
+      Tasks: 2 (limit: 4557)
+     Memory: 3.2M
+     CGroup: /system.slice/myservice.service
+             └─2315 /usr/local/bin/myservice
+`,
+		running: true,
+	},
+	{
+		name: "oneshot exited",
+		output: `● apparmor.service - Load AppArmor profiles
+     Loaded: loaded (/lib/systemd/system/apparmor.service; enabled; vendor preset: enabled)
+     Active: active (exited) since Tue 2023-05-16 10:21:40 UTC; 2 days ago
+       Docs: man:apparmor(7)
+             https://gitlab.com/apparmor/apparmor/wikis/home/
+   Main PID: 402 (code=exited, status=0/SUCCESS)
+        CPU: 52ms
+`,
+	},
+	{
+		name: "activating start-pre",
+		output: `● myservice.service - My Service
+     Loaded: loaded (/etc/systemd/system/myservice.service; enabled; vendor preset: enabled)
+     Active: activating (start-pre) since Thu 2023-05-18 09:12:01 UTC; 1s ago
+Cntrl PID: 2301 (sleep)
+      Tasks: 1 (limit: 4557)
+     CGroup: /system.slice/myservice.service
+             └─2301 /bin/sleep 10
+`,
+		running: true,
+	},
+	{
+		name: "activating start",
+		output: `● myservice.service - My Service
+     Loaded: loaded (/etc/systemd/system/myservice.service; enabled; vendor preset: enabled)
+     Active: activating (start) since Thu 2023-05-18 09:12:11 UTC; 2s ago
+   Main PID: 2310 (myservice)
+      Tasks: 4 (limit: 4557)
+     CGroup: /system.slice/myservice.service
+             └─2310 /usr/local/bin/myservice
+`,
+		running: true,
+		pid:     "2310",
+	},
+	{
+		name: "auto-restart",
+		output: `● myservice.service - My Service
+     Loaded: loaded (/etc/systemd/system/myservice.service; enabled; vendor preset: enabled)
+     Active: activating (auto-restart) (Result: exit-code) since Thu 2023-05-18 09:15:21 UTC; 3s ago
+    Process: 2398 ExecStart=/usr/local/bin/myservice (code=exited, status=1/FAILURE)
+   Main PID: 2398 (code=exited, status=1/FAILURE)
+        CPU: 8ms
+`,
+	},
+	{
+		name: "reloading",
+		output: `● nginx.service - A high performance web server and a reverse proxy server
+     Loaded: loaded (/lib/systemd/system/nginx.service; enabled; vendor preset: enabled)
+     Active: reloading (reload) since Tue 2023-05-16 10:21:43 UTC; 2 days ago
+    Process: 3120 ExecReload=/usr/sbin/nginx -g daemon on; master_process on; -s reload (code=exited, status=0/SUCCESS)
+   Main PID: 812 (nginx)
+`,
+		running: true,
+		pid:     "812",
+	},
+	{
+		name: "deactivating",
+		output: `● myservice.service - My Service
+     Loaded: loaded (/etc/systemd/system/myservice.service; enabled; vendor preset: enabled)
+     Active: deactivating (stop-sigterm) since Thu 2023-05-18 09:20:00 UTC; 1s ago
+   Main PID: 2310 (myservice)
+`,
+		running: true,
+		pid:     "2310",
+	},
+	{
+		name: "inactive",
+		output: `○ myservice.service - My Service
+     Loaded: loaded (/etc/systemd/system/myservice.service; disabled; vendor preset: enabled)
+     Active: inactive (dead)
+`,
+	},
+	{
+		name: "failed",
+		output: `× myservice.service - My Service
+     Loaded: loaded (/etc/systemd/system/myservice.service; enabled; vendor preset: enabled)
+     Active: failed (Result: exit-code) since Thu 2023-05-18 09:15:31 UTC; 10s ago
+    Process: 2398 ExecStart=/usr/local/bin/myservice (code=exited, status=1/FAILURE)
+   Main PID: 2398 (code=exited, status=1/FAILURE)
+`,
+	},
+	{
+		name:   "unknown unit",
+		output: "Unit myservice.service could not be found.\n",
+	},
+	{
+		name:   "empty output",
+		output: "",
+	},
+}
+
+func TestParseStatus(t *testing.T) {
+	for _, test := range statusOutputs {
+		t.Run(test.name, func(t *testing.T) {
+			running, pid := ParseStatus([]byte(test.output))
+			if running != test.running || pid != test.pid {
+				t.Errorf("ParseStatus() = %v, %q, want %v, %q", running, pid, test.running, test.pid)
+			}
+		})
+	}
+}
+
+// Captured output of "systemctl show --property=Id,ActiveState,SubState,MainPID"
+var showOutputs = []struct {
+	name   string
+	output string
+	want   map[string]State
+}{
+	{
+		name:   "running",
+		output: "MainPID=812\nId=nginx.service\nActiveState=active\nSubState=running\n",
+		want:   map[string]State{"nginx": {Running: true, PID: "812", ActiveState: "active", SubState: "running"}},
+	},
+	{
+		name:   "no MainPID",
+		output: "MainPID=0\nId=apparmor.service\nActiveState=active\nSubState=exited\n",
+		want:   map[string]State{"apparmor": {Running: true, ActiveState: "active", SubState: "exited"}},
+	},
+	{
+		name:   "activating",
+		output: "MainPID=0\nId=myservice.service\nActiveState=activating\nSubState=start-pre\n",
+		want:   map[string]State{"myservice": {Running: true, ActiveState: "activating", SubState: "start-pre"}},
+	},
+	{
+		name:   "auto-restart",
+		output: "MainPID=0\nId=myservice.service\nActiveState=activating\nSubState=auto-restart\n",
+		want:   map[string]State{"myservice": {ActiveState: "activating", SubState: "auto-restart"}},
+	},
+	{
+		name:   "reloading",
+		output: "MainPID=812\nId=nginx.service\nActiveState=reloading\nSubState=reload\n",
+		want:   map[string]State{"nginx": {Running: true, PID: "812", ActiveState: "reloading", SubState: "reload"}},
+	},
+	{
+		name: "several units and an unknown one",
+		output: "MainPID=812\r\nId=nginx.service\r\nActiveState=active\r\nSubState=running\r\n\r\n" +
+			"MainPID=0\r\nId=unknown.service\r\nActiveState=inactive\r\nSubState=dead\r\n\r\n" +
+			"MainPID=0\r\nId=myservice.service\r\nActiveState=failed\r\nSubState=failed\r\n",
+		want: map[string]State{
+			"nginx":     {Running: true, PID: "812", ActiveState: "active", SubState: "running"},
+			"unknown":   {ActiveState: "inactive", SubState: "dead"},
+			"myservice": {ActiveState: "failed", SubState: "failed"},
+		},
+	},
+	{
+		name:   "missing Id",
+		output: "MainPID=812\nActiveState=active\nSubState=running\n",
+		want:   map[string]State{},
+	},
+}
+
+func TestParseStates(t *testing.T) {
+	for _, test := range showOutputs {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ParseStates([]byte(test.output)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseStates() = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseShow(t *testing.T) {
+	output := "Id=myservice.service\r\nExecStart={ path=/usr/bin/myservice ; argv[]=/usr/bin/myservice --port=8080 }\nEnvironment=\n=ignored\nnot a property\n"
+	want := map[string]string{
+		"Id":          "myservice.service",
+		"ExecStart":   "{ path=/usr/bin/myservice ; argv[]=/usr/bin/myservice --port=8080 }",
+		"Environment": "",
+	}
+	if got := ParseShow([]byte(output)); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseShow() = %#v, want %#v", got, want)
+	}
+}
+
+func TestControlGroup(t *testing.T) {
+	tests := []struct {
+		unit *Unit
+		want string
+	}{
+		{New("nginx"), "system.slice/nginx.service"},
+		{New("my-app").Instance("1"), `system.slice/system-my\x2dapp.slice/my-app@1.service`},
+	}
+	for _, test := range tests {
+		if got := test.unit.ControlGroup(); got != test.want {
+			t.Errorf("ControlGroup() of %s = %q, want %q", test.unit.Name, got, test.want)
+		}
+	}
+}
+
+func TestCgroupStatus(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	write := func(path, content string) {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the unified hierarchy: a stopped unit, a unit with Delegate=yes whose
+	// processes are in subgroups and an instance with a running ExecStartPre
+	write("sys/fs/cgroup/system.slice/cgroup.procs", "")
+	write("sys/fs/cgroup/system.slice/delegated.service/cgroup.procs", "")
+	write("sys/fs/cgroup/system.slice/delegated.service/payload/cgroup.procs", "4242\n")
+	write("sys/fs/cgroup/system.slice/delegated.service/payload/inner/cgroup.procs", "4243\n")
+	write("sys/fs/cgroup/system.slice/system-my\\x2dapp.slice/my-app@1.service/cgroup.procs", "4300\n4301\n")
+	write("proc/4242/stat", "4242 (my (daemon)) S 1 4242 4242 0 -1")
+	write("proc/4243/stat", "4243 (worker) S 4242 4242 4242 0 -1")
+	write("proc/4300/stat", "4300 (app) S 1 4300 4300 0 -1")
+	write("proc/4301/stat", "4301 (sleep) S 1 4301 4301 0 -1")
+
+	tests := []struct {
+		unit    *Unit
+		running bool
+		pid     string
+		ok      bool
+	}{
+		{&Unit{Name: "stopped", Root: root}, false, "", true},
+		{&Unit{Name: "delegated", Root: root}, true, "4242", true},
+		{(&Unit{Name: "my-app", Root: root}).Instance("1"), true, "", true},
+		{&Unit{Name: "delegated", Root: root, User: true}, false, "", false},
+		{&Unit{Name: "delegated", Root: filepath.Join(root, "missing")}, false, "", false},
+	}
+	for _, test := range tests {
+		running, pid, ok := test.unit.cgroupStatus()
+		if running != test.running || pid != test.pid || ok != test.ok {
+			t.Errorf("cgroupStatus() of %s = %v, %q, %v, want %v, %q, %v", test.unit.Name,
+				running, pid, ok, test.running, test.pid, test.ok)
+		}
+	}
+	// the main process of a running unit is read from its cgroup, the
+	// manager tells the active state; the processes are taken as running
+	// if the manager is not reachable
+	tools.Set("systemctl", filepath.Join(root, "missing"))
+	want := State{Running: true, PID: "4242"}
+	if got := (&Unit{Name: "delegated", Root: root}).State(); got != want {
+		t.Errorf("State() without the manager = %#v, want %#v", got, want)
+	}
+	systemctl := filepath.Join(root, "systemctl")
+	write("systemctl", "#!/bin/sh\ncat "+filepath.Join(root, "show")+"\n")
+	if err := os.Chmod(systemctl, 0755); err != nil {
+		t.Fatal(err)
+	}
+	tools.Set("systemctl", systemctl)
+	defer tools.Set("systemctl", "")
+	for _, want := range []State{
+		{Running: true, PID: "4242", ActiveState: "active", SubState: "running"},
+		{Running: true, PID: "4242", ActiveState: "reloading", SubState: "reload"},
+		{Running: true, PID: "4242", ActiveState: "deactivating", SubState: "stop-sigterm"},
+		// the processes which are left by a failed unit (KillMode=process)
+		{ActiveState: "failed", SubState: "failed"},
+	} {
+		write("show", "ActiveState="+want.ActiveState+"\nSubState="+want.SubState+"\n")
+		if got := (&Unit{Name: "delegated", Root: root}).State(); got != want {
+			t.Errorf("State() = %#v, want %#v", got, want)
+		}
+	}
+}
+
+func TestEnableUnitLinks(t *testing.T) {
+	root, err := ioutil.TempDir("", "offline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	unit := "[Unit]\nDescription=web\n\n[Install]\nWantedBy=multi-user.target\nAlias=www.service\n"
+	if err := os.MkdirAll(root+Dir+"multi-user.target.wants", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(root+Dir+"web.service", []byte(unit), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a link of a former image build to the unit in /lib
+	wants := root + Dir + "multi-user.target.wants/web.service"
+	if err := os.Symlink("/lib/systemd/system/web.service", wants); err != nil {
+		t.Fatal(err)
+	}
+	if err := enableUnitLinks(root, "web.service"); err != nil {
+		t.Fatalf("enableUnitLinks() error = %v", err)
+	}
+	for _, link := range []string{wants, root + Dir + "www.service"} {
+		if target, err := os.Readlink(link); err != nil || target != Dir+"web.service" {
+			t.Errorf("link %s = %q, %v, want %q", link, target, err, Dir+"web.service")
+		}
+	}
+
+	// a file is not replaced by a link
+	alias := root + Dir + "www.service"
+	if err := os.Remove(alias); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(alias, []byte(unit), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := enableUnitLinks(root, "web.service"); err == nil {
+		t.Errorf("enableUnitLinks() over the file %s error = nil", alias)
+	}
+}
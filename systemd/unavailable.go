@@ -0,0 +1,173 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package systemd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// ErrInitUnavailable appears if the manager could not carry out an
+// operation, see UnavailableError
+var ErrInitUnavailable = errors.New("Service manager is not available")
+
+// Reasons why the manager is not available
+const (
+	// ReasonOffline - no manager runs: a chroot, an image build or
+	// a container which was not booted by systemd
+	ReasonOffline = "offline"
+
+	// ReasonNoBus - the manager runs, but it is not reachable over D-Bus
+	// or its private socket
+	ReasonNoBus = "no-bus"
+
+	// ReasonDegraded - the system is degraded, in maintenance (rescue mode)
+	// or stopping, so the manager did not carry out the job
+	ReasonDegraded = "degraded"
+)
+
+// UnavailableError - the manager could not carry out an operation,
+// instead of the exit status of systemctl it tells the reason.
+// errors.Is(err, ErrInitUnavailable) reports such errors.
+type UnavailableError struct {
+	// Reason - ReasonOffline, ReasonNoBus or ReasonDegraded
+	Reason string
+
+	// State - state of the system (systemctl is-system-running), e.g.
+	// "degraded" or "maintenance", empty if it is not known
+	State string
+
+	// Detail - message of systemctl
+	Detail string
+
+	// Err - error of the command, nil if systemctl ignored the request
+	Err error
+}
+
+func (e *UnavailableError) Error() string {
+	text := "Service manager is not available (" + e.Reason
+	if e.State != "" && e.State != e.Reason {
+		text += ", system is " + e.State
+	}
+	text += ")"
+	if e.Detail != "" {
+		text += ": " + e.Detail
+	}
+	return text
+}
+
+// Is - the error matches ErrInitUnavailable
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrInitUnavailable
+}
+
+// Unwrap - error of the command
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// FallbackOffline - enable and disable the units by the symlinks of their
+// [Install] section, as offline, and skip DaemonReload if the manager
+// turns out to be offline or not reachable, instead of failing with
+// ErrInitUnavailable; e.g. for installers which run in chroots as well
+var FallbackOffline bool
+
+// errors of systemctl when no manager runs
+var offlineRegexp = regexp.MustCompile("System has not been booted with systemd|Running in chroot, ignoring")
+
+// States of the system in which the manager does not carry out all jobs
+var degradedStates = map[string]bool{"degraded": true, "maintenance": true, "stopping": true}
+
+// SystemState - state of the system reported by systemctl is-system-running,
+// e.g. "running", "degraded", "maintenance" or "offline"
+func SystemState() (string, error) {
+	// is-system-running fails unless the system is running, its output tells the state
+	output, err := command("systemctl", "is-system-running").Output()
+	state := strings.TrimSpace(string(output))
+	if state == "" {
+		if err == nil {
+			err = ErrInitUnavailable
+		}
+		return "", err
+	}
+	return state, nil
+}
+
+// Available - check the manager can carry out operations, an
+// UnavailableError tells why it can not; a degraded system is available
+func Available() error {
+	if offline, ok := offlineSetting(); ok && offline {
+		return &UnavailableError{Reason: ReasonOffline, Detail: "the offline mode is requested"}
+	}
+	if _, err := os.Stat("/run/systemd/system"); err != nil && !Remote() {
+		return &UnavailableError{Reason: ReasonOffline, Detail: "/run/systemd/system is missing"}
+	}
+	var stderr strings.Builder
+	cmd := command("systemctl", "is-system-running")
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	state := strings.TrimSpace(string(output))
+	switch {
+	case state == "offline" || offlineRegexp.MatchString(stderr.String()):
+		return &UnavailableError{Reason: ReasonOffline, State: state, Detail: firstLine(stderr.String()), Err: err}
+	case state == "" || unreachableRegexp.MatchString(stderr.String()):
+		return &UnavailableError{Reason: ReasonNoBus, Detail: firstLine(stderr.String()), Err: err}
+	case state == "maintenance" || state == "stopping":
+		return &UnavailableError{Reason: ReasonDegraded, State: state}
+	}
+	return nil
+}
+
+// Error of a systemctl command, an UnavailableError if the manager could
+// not carry it out: no manager runs, it is not reachable, or the changing
+// command failed while the system is degraded
+func availability(args []string, err error, stderr []byte) error {
+	detail := firstLine(string(stderr))
+	switch {
+	case offlineRegexp.Match(stderr):
+		return &UnavailableError{Reason: ReasonOffline, Detail: detail, Err: err}
+	case err == nil || err == ErrNotAuthorized:
+		return err
+	case unreachableRegexp.Match(stderr):
+		return &UnavailableError{Reason: ReasonNoBus, Detail: detail, Err: err}
+	}
+	if _, ok := err.(*exec.ExitError); !ok || !changing(args) {
+		return err
+	}
+	if state, _ := SystemState(); degradedStates[state] {
+		return &UnavailableError{Reason: ReasonDegraded, State: state, Detail: detail, Err: err}
+	}
+	return err
+}
+
+// Check the systemctl command changes the manager or the unit files
+func changing(args []string) bool {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			return changingVerbs[arg]
+		}
+	}
+	return false
+}
+
+// Check the operation can fall back to the offline mode (FallbackOffline)
+// after the error
+func fallback(err error) bool {
+	e, ok := err.(*UnavailableError)
+	return ok && FallbackOffline && (e.Reason == ReasonOffline || e.Reason == ReasonNoBus)
+}
+
+// First line of a message which is not empty
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,231 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+// Package sysv controls services of the System V init system.
+//
+// It is used by the daemon package on linux hosts which run neither
+// systemd nor upstart, and gives access to the runlevel links of
+// an init script.
+package sysv
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/takama/daemon/internal/tools"
+)
+
+// Dir - standard directory of init scripts
+const Dir = "/etc/init.d/"
+
+// PIDDir - directory of the pidfiles which are written by the init scripts
+const PIDDir = "/var/run/"
+
+// Default priorities of the runlevel links
+const (
+	StartPriority = "87"
+	StopPriority  = "17"
+)
+
+// Runlevels in which the service is started or stopped
+var (
+	StartRunlevels = []string{"2", "3", "4", "5"}
+	StopRunlevels  = []string{"0", "1", "6"}
+)
+
+// Script - System V init script
+type Script struct {
+	// Name of the service
+	Name string
+
+	// StopPriority - priority of the stop links, by default the package
+	// StopPriority, scripts with higher priorities are stopped later
+	StopPriority string
+
+	// Root - root directory of an offline image (e.g. /mnt/image) which
+	// contains the script and its links, empty for the running system
+	Root string
+
+	// Executable - path of the executable which the script runs as the
+	// process of the pidfile, a pidfile of a process which runs another
+	// executable is stale; empty if the process is a wrapper (e.g. su)
+	Executable string
+}
+
+// New - create an init script with the given name
+func New(name string) *Script {
+	return &Script{Name: name}
+}
+
+// Path - standard path of the init script
+func (script *Script) Path() string {
+	return script.Root + Dir + script.Name
+}
+
+// IsInstalled - check the init script exists
+func (script *Script) IsInstalled() bool {
+	_, err := os.Stat(script.Path())
+	return err == nil
+}
+
+// PIDFile - path of the pidfile of the service
+func (script *Script) PIDFile() string {
+	return PIDDir + script.Name + ".pid"
+}
+
+// Status - check the service is running and return its PID.
+// The PID is read from the pidfile and checked in /proc without
+// executing the init script, a service without a pidfile is stopped.
+func (script *Script) Status() (running bool, pid string) {
+	data, err := ioutil.ReadFile(script.PIDFile())
+	if err != nil {
+		return false, ""
+	}
+	pid = strings.TrimSpace(string(data))
+	if _, err := strconv.Atoi(pid); err != nil {
+		return false, ""
+	}
+	if _, err := os.Stat("/proc/" + pid); err != nil {
+		return false, ""
+	}
+	if !script.runsExecutable(pid) {
+		return false, ""
+	}
+	return true, pid
+}
+
+// Check the process runs the executable of the script, a process whose
+// executable can not be read (e.g. without privileges) is assumed to run it
+func (script *Script) runsExecutable(pid string) bool {
+	if script.Executable == "" {
+		return true
+	}
+	exe, err := os.Readlink("/proc/" + pid + "/exe")
+	if err != nil {
+		return true
+	}
+	// the executable was replaced while the process runs
+	exe = strings.TrimSuffix(exe, " (deleted)")
+	expected := script.Executable
+	if resolved, err := filepath.EvalSymlinks(expected); err == nil {
+		expected = resolved
+	}
+	return exe == expected
+}
+
+// RemoveStalePIDFile - remove the pidfile if its process has exited
+// or runs another executable (the pid was reused), it reports whether
+// the pidfile was removed
+func (script *Script) RemoveStalePIDFile() bool {
+	if _, err := os.Stat(script.PIDFile()); err != nil {
+		return false
+	}
+	if running, _ := script.Status(); running {
+		return false
+	}
+	return os.Remove(script.PIDFile()) == nil
+}
+
+// Start - start the service
+func (script *Script) Start() error {
+	return tools.Command("service", script.Name, "start").Run()
+}
+
+// Stop - stop the service
+func (script *Script) Stop() error {
+	return tools.Command("service", script.Name, "stop").Run()
+}
+
+// Links - paths of the runlevel links of the script on the running system
+func (script *Script) Links() []string {
+	var links []string
+	for _, i := range StartRunlevels {
+		links = append(links, "/etc/rc"+i+".d/S"+StartPriority+script.Name)
+	}
+	for _, i := range StopRunlevels {
+		links = append(links, "/etc/rc"+i+".d/K"+script.stopPriority()+script.Name)
+	}
+	return links
+}
+
+// Priority of the stop links of the script
+func (script *Script) stopPriority() string {
+	if script.StopPriority != "" {
+		return script.StopPriority
+	}
+	return StopPriority
+}
+
+// Link - create the runlevel links, links which can not be created are skipped
+// and their errors are returned, existing links are kept. The links point to
+// the script on the running system, also in an offline image.
+func (script *Script) Link() []error {
+	var errs []error
+	for _, link := range script.Links() {
+		if err := os.Symlink(Dir+script.Name, script.Root+link); err != nil && !os.IsExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Unlink - remove the runlevel links, links which can not be removed are
+// skipped and their errors are returned
+func (script *Script) Unlink() []error {
+	var errs []error
+	for _, link := range script.Links() {
+		if err := os.Remove(script.Root + link); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// IsEnabled - check the service is started in one of the multi-user
+// runlevels: by "chkconfig --list" where chkconfig manages the links,
+// by the start links of the runlevel directories elsewhere and in an
+// offline image
+func (script *Script) IsEnabled() (bool, error) {
+	if tools.Available("chkconfig") && script.Root == "" {
+		output, err := tools.Command("chkconfig", "--list", script.Name).Output()
+		if err != nil {
+			return false, err
+		}
+		return ParseChkconfig(output, script.Name), nil
+	}
+	for _, i := range StartRunlevels {
+		// the links of other tools may have other priorities
+		links, err := filepath.Glob(script.Root + "/etc/rc" + i + ".d/S[0-9][0-9]" + script.Name)
+		if err != nil {
+			return false, err
+		}
+		if len(links) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ParseChkconfig - check the output of "chkconfig --list" turns the service
+// on in one of the multi-user runlevels, e.g.
+// "myservice      0:off   1:off   2:on    3:on    4:on    5:on    6:off"
+func ParseChkconfig(output []byte, name string) bool {
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != name {
+			continue
+		}
+		for _, field := range fields[1:] {
+			for _, i := range StartRunlevels {
+				if field == i+":on" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
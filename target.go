@@ -0,0 +1,78 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bytes"
+	"os"
+	"text/template"
+
+	"github.com/takama/daemon/systemd"
+)
+
+// RenderTarget - render the systemd target which groups services,
+// see Manager.SetTarget
+func RenderTarget(name, description string) (string, error) {
+	templ, err := template.New("target").Parse(targetConfig)
+	if err != nil {
+		return "", err
+	}
+	if description == "" {
+		description = name
+	}
+	var buf bytes.Buffer
+	if err := templ.Execute(&buf, &struct {
+		Name        string
+		Description string
+		Metadata    Metadata
+	}{name, description, NewMetadata()}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Write and enable the systemd target
+func installTarget(name, description string) error {
+	if ok, err := checkPrivileges(); !ok {
+		return err
+	}
+	content, err := RenderTarget(name, description)
+	if err != nil {
+		return err
+	}
+	target := systemd.NewTarget(name)
+	target.Root = PathPrefix()
+	file, err := os.Create(target.Path())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		return err
+	}
+	if err := reloadManager(KindSystemD); err != nil {
+		return err
+	}
+	return target.Enable()
+}
+
+// Disable and remove the systemd target
+func removeTarget(name string) error {
+	if ok, err := checkPrivileges(); !ok {
+		return err
+	}
+	target := systemd.NewTarget(name)
+	target.Root = PathPrefix()
+	if _, err := os.Stat(target.Path()); os.IsNotExist(err) {
+		return nil
+	}
+	if err := target.Disable(); err != nil {
+		return err
+	}
+	if err := os.Remove(target.Path()); err != nil {
+		return err
+	}
+	return reloadManager(KindSystemD)
+}
@@ -0,0 +1,632 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+// Templates are kept out of the platform specific files,
+// so service files can be rendered for any kind of init system on any host
+
+// Sections of the systemd unit which are shared by the default template
+// and the presets
+var (
+	systemDUnit = `# Managed by github.com/takama/daemon
+# {{.Metadata}}
+[Unit]
+Description={{.Description}}
+Requires={{.Dependencies}}
+After={{.Dependencies}}{{range .After}} {{.}}.service{{end}}
+{{if .TimeSync}}Wants=time-sync.target
+After=time-sync.target
+{{end}}{{if .Before}}Before={{range $i, $name := .Before}}{{if $i}} {{end}}{{$name}}.service{{end}}
+{{end}}{{if .OnFailure}}OnFailure={{range $i, $name := .OnFailure}}{{if $i}} {{end}}{{$name}}.service{{end}}
+{{end}}{{if .Target}}PartOf={{.Target}}.target
+{{end}}{{if .PerUser}}After=user@%i.service
+PartOf=user@%i.service
+{{end}}{{if .RestartDelay}}StartLimitIntervalSec=0
+{{end}}{{if .FirstBoot}}ConditionFirstBoot=yes
+{{end}}
+[Service]
+{{if .User}}User={{.User}}
+{{end}}{{if .Group}}Group={{.Group}}
+{{end}}{{range .Environment}}Environment={{systemd .String}}
+{{end}}{{if eq .StandardInput "socket"}}StandardInput=socket
+{{else if .StandardInput}}StandardInput=file:{{.StandardInput}}
+{{end}}{{if .PrivateNetwork}}PrivateNetwork=yes
+{{end}}{{if .NetworkNamespace}}NetworkNamespacePath={{.NetworkNamespace}}
+{{end}}{{if .AddressFamilies}}RestrictAddressFamilies={{.AddressFamilies}}
+{{end}}{{if .SyscallsAllowed}}SystemCallFilter={{.SyscallsAllowed}}
+{{end}}{{if .SyscallsDenied}}SystemCallFilter=~{{.SyscallsDenied}}
+{{end}}{{if .SyscallErrno}}SystemCallErrorNumber={{.SyscallErrno}}
+{{end}}{{if .Delegate}}Delegate={{if .Controllers}}{{.Controllers}}{{else}}yes{{end}}
+{{end}}{{if .KillMode}}KillMode={{.KillMode}}
+{{end}}{{if .KillSignal}}KillSignal={{.KillSignal}}
+{{end}}{{if .StopTimeout}}TimeoutStopSec={{.StopTimeout}}
+{{end}}{{if .MaxRuntime}}RuntimeMaxSec={{.MaxRuntime}}
+{{end}}{{if .Watchdog}}WatchdogSec={{.Watchdog}}
+{{end}}{{if .RestartDelay}}RestartSec={{.RestartDelay}}
+{{end}}{{if .RestartSteps}}RestartSteps={{.RestartSteps}}
+RestartMaxDelaySec={{.RestartMaxDelay}}
+{{end}}{{if not .FinalKill}}SendSIGKILL=no
+{{end}}{{if .CPUAffinity}}CPUAffinity={{.CPUAffinity}}
+{{end}}{{if .NUMAPolicy}}NUMAPolicy={{.NUMAPolicy}}
+{{if and (ne .NUMAPolicy "default") (ne .NUMAPolicy "local")}}NUMAMask={{.NUMANodes}}
+{{end}}{{end}}{{range .Conditions}}ExecCondition={{.}}
+{{end}}{{range .PreStart}}ExecStartPre=+{{.}}
+{{end}}{{range .StopCommands}}ExecStop={{.}}
+{{end}}{{range .PostStopCommands}}ExecStopPost={{.}}
+{{end}}`
+
+	systemDOutput = `{{if eq .Logging "journal"}}StandardOutput=journal
+StandardError=journal
+{{else if eq .Logging "file"}}StandardOutput=append:{{.LogDir}}/{{.Name}}.log
+StandardError=append:{{.LogDir}}/{{.Name}}.err
+{{end}}`
+
+	systemDInstall = `
+[Install]
+WantedBy={{if .PerUser}}user@.service{{else if .UserScope}}default.target{{else}}multi-user.target{{end}}{{if .Target}} {{.Target}}.target{{end}}
+{{if .Aliases}}Alias={{range $i, $name := .Aliases}}{{if $i}} {{end}}{{$name}}.service{{end}}
+{{end}}{{if .Also}}Also={{.Also}}
+{{end}}`
+)
+
+// Default template of the systemd unit
+var systemDConfig = systemDUnit + `{{if .Forking}}Type=forking
+GuessMainPID=no
+{{end}}{{if and (not (or .PerUser .UserScope)) (or .Forking (not .User))}}PIDFile=/var/run/{{.Name}}.pid
+ExecStartPre=/bin/rm -f /var/run/{{.Name}}.pid
+{{end}}ExecStart={{.Path}} {{.Args}}
+` + systemDOutput + `{{if .Upgrade}}NotifyAccess=all
+{{end}}Restart=on-failure
+` + systemDInstall
+
+// Template of the systemd target which groups the services of a manager
+var targetConfig = `# Managed by github.com/takama/daemon
+# {{.Metadata}}
+[Unit]
+Description={{.Description}}
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// Template of the systemd path unit which starts the service when
+// one of the watched paths changes
+var pathUnitConfig = `# Managed by github.com/takama/daemon
+# {{.Metadata}}
+[Unit]
+Description=Activation of {{.Name}} by paths
+
+[Path]
+{{range .Watch}}{{if .Dir}}DirectoryNotEmpty={{.Path}}{{else}}PathChanged={{.Path}}{{end}}
+{{end}}Unit={{.Name}}.service
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// Template of the systemd socket unit which activates a service
+var socketUnitConfig = `# Managed by github.com/takama/daemon
+# {{.Metadata}}
+[Unit]
+Description=Sockets of {{.Name}}
+
+[Socket]
+{{range .Socket.ListenStream}}ListenStream={{.}}
+{{end}}{{range .Socket.ListenDatagram}}ListenDatagram={{.}}
+{{end}}{{if .Socket.IPv6Only}}BindIPv6Only=ipv6-only
+{{end}}{{if .Socket.Name}}FileDescriptorName={{.Socket.Name}}
+{{end}}Service={{.Name}}.service
+
+[Install]
+WantedBy=sockets.target
+`
+
+// Template of the systemd timer unit which starts a service
+var timerUnitConfig = `# Managed by github.com/takama/daemon
+# {{.Metadata}}
+[Unit]
+Description=Timer of {{.Name}}
+
+[Timer]
+{{range .Calendar}}OnCalendar={{.}}
+{{end}}{{if .Interval}}OnActiveSec={{.Interval}}
+OnUnitActiveSec={{.Interval}}
+{{end}}{{if .Timer.Persistent}}Persistent=true
+{{end}}Unit={{.Name}}.service
+
+[Install]
+WantedBy=timers.target
+`
+
+// Template of the cron entry which starts a service by its timer
+// on the init systems without timers
+var cronEntryConfig = `# Managed by github.com/takama/daemon
+# {{.Metadata}}
+SHELL=/bin/sh
+PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin
+{{.Schedule}} root {{.Command}} >/dev/null 2>&1
+`
+
+// Template of the companion systemd unit which sends the failure
+// notifications of a service, %H is the host name which the mail
+// command gets as $1
+var failureUnitConfig = `# Managed by github.com/takama/daemon
+# {{.Metadata}}
+[Unit]
+Description=Failure notification of {{.Name}}
+
+[Service]
+Type=oneshot
+{{if .FailureWebhook}}ExecStart=/usr/bin/curl -fsS -m 30 -d service={{.Name}} -d host=%H -d message=failed {{systemdexec .FailureWebhook}}
+{{end}}{{if .FailureMail}}ExecStart=/bin/sh -c {{systemdexec (printf "systemctl status --no-pager %s.service | mail -s \"%s failed on $1\" %s" .Name .Name (shell .FailureMail))}} sh %H
+{{end}}`
+
+// Default template of the System V init script
+var systemVConfig = `#! /bin/sh
+# Managed by github.com/takama/daemon
+# {{.Metadata}}
+#
+#       /etc/init.d/{{.Name}}
+#
+#       Starts {{.Name}} as a daemon
+#
+# chkconfig: 2345 87 {{.StopPriority}}
+# description: Starts and stops a single {{.Name}} instance on this system
+
+### BEGIN INIT INFO
+# Provides: {{.Name}} 
+# Required-Start: $network $named{{if .TimeSync}} $time{{end}}{{range .After}} {{.}}{{end}}
+# Required-Stop: $network $named{{range .After}} {{.}}{{end}}
+{{if .Before}}# X-Start-Before: {{.Before}}
+# X-Stop-After: {{.Before}}
+{{end}}# Default-Start: 2 3 4 5
+# Default-Stop: 0 1 6
+# Short-Description: This service manages the {{.Description}}.
+# Description: {{.Description}}
+### END INIT INFO
+
+#
+# Source function library, RedHat and LSB (Debian) flavours.
+#
+if [ -f /etc/rc.d/init.d/functions ]; then
+    . /etc/rc.d/init.d/functions
+elif [ -f /lib/lsb/init-functions ]; then
+    . /lib/lsb/init-functions
+fi
+
+# the LSB library has no success and failure helpers
+type success >/dev/null 2>&1 || success() { printf "[  OK  ]"; }
+type failure >/dev/null 2>&1 || failure() { printf "[FAILED]"; }
+
+exec="{{.Path}}"
+servname={{shell .Description}}
+
+proc="{{.Name}}"
+pidfile="/var/run/$proc.pid"
+lockfile="/var/lock/subsys/$proc"
+stdoutlog="{{.LogDir}}/$proc.log"
+stderrlog="{{.LogDir}}/$proc.err"
+
+[ -d $(dirname $lockfile) ] || mkdir -p $(dirname $lockfile)
+
+{{range .Environment}}export {{.Name}}={{shell .Value}}
+{{end}}[ -e /etc/sysconfig/$proc ] && . /etc/sysconfig/$proc
+[ -e /etc/default/$proc ] && . /etc/default/$proc
+
+start() {
+    [ -x $exec ] || exit 5
+{{if .Conditions}}    # the service declines to start on this host, which is not a failure
+{{range .Conditions}}    if ! {{.}} >/dev/null 2>&1; then
+        printf "Skipping %s: the condition is not met\n" "$servname"
+        return 0
+    fi
+{{end}}{{end}}{{range .RuntimeDirs}}
+    mkdir -p {{.Path}} && chmod {{.Mode}} {{.Path}}{{if .Owner}} && chown {{.Owner}} {{.Path}}{{end}}{{end}}{{range .PreStart}}
+    {{.}} || exit 1{{end}}
+
+    if [ -f $pidfile ]; then
+        pid=$(cat $pidfile)
+        # the pidfile is stale if its process has exited or runs another executable
+        if ! [ -d "/proc/$pid" ]{{if not .User}} || [ "$(readlink /proc/$pid/exe | sed 's/ (deleted)$//')" != "$(readlink -f $exec)" ]{{end}}; then
+            rm $pidfile
+            if [ -f $lockfile ]; then
+                rm $lockfile
+            fi
+        fi
+    fi
+
+    if ! [ -f $pidfile ]; then
+        printf "Starting %s:\t" "$servname"
+        echo "$(date)" >> $stdoutlog
+{{if .ReadyFile}}        rm -f {{.ReadyFile}}
+{{end}}{{if .User}}        {{if ne .KillMode "process"}}setsid {{end}}{{range .Namespace}}{{.}} {{end}}su -s /bin/sh {{if .Group}}-g {{.Group}} {{end}}-c "exec {{range .Wrapper}}{{.}} {{end}}$exec {{.Args}}" {{.User}} {{if .StandardInput}}< {{.StandardInput}} {{end}}>> $stdoutlog 2>> $stderrlog{{if not .Forking}} &{{end}}
+{{else}}        {{if ne .KillMode "process"}}setsid {{end}}{{range .Namespace}}{{.}} {{end}}{{range .Wrapper}}{{.}} {{end}}$exec {{.Args}} {{if .StandardInput}}< {{.StandardInput}} {{end}}>> $stdoutlog 2>> $stderrlog{{if not .Forking}} &{{end}}
+{{end}}
+{{if .Forking}}        # the executable puts itself in the background and writes the pid file
+        i=0
+        while [ ! -s $pidfile ] && [ $i -lt 30 ]; do
+            sleep 1
+            i=$((i + 1))
+        done
+        if ! [ -s $pidfile ]; then
+            failure
+            echo
+            printf "$pidfile was not written...\n"
+            exit 1
+        fi
+{{else}}        echo $! > $pidfile
+{{end}}{{if .ReadyFile}}        # the service reports its readiness by the ready file
+        i=0
+        while [ ! -e {{.ReadyFile}} ] && [ $i -lt 30 ]; do
+            sleep 1
+            i=$((i + 1))
+        done
+        if ! [ -e {{.ReadyFile}} ]; then
+            failure
+            echo
+            printf "%s is not ready...\n" "$servname"
+            exit 1
+        fi
+{{end}}        touch $lockfile
+        success
+        echo
+    else
+        # failure
+        echo
+        printf "$pidfile still exists...\n"
+        exit 7
+    fi
+}
+
+stop() {
+    printf "Stopping %s:\t" "$servname"
+    pid=$(cat $pidfile 2>/dev/null)
+    group=$pid
+{{if ne .KillMode "process"}}    # the service leads its process group (setsid), its children are stopped with it
+    [ -n "$pid" ] && [ "$(ps -o pgid= -p $pid | tr -d ' ')" = "$pid" ] && group=-$pid
+{{end}}{{if .StopCommands}}    # the service is asked to stop, the signal stops what is left of it
+{{range .StopCommands}}    {{.}}
+{{end}}    if [ -z "$pid" ] || (kill -0 $group 2>/dev/null && ! kill -{{.StopSignal}} {{if eq .KillMode "mixed"}}$pid{{else}}$group{{end}} 2>/dev/null); then
+{{else}}    if [ -z "$pid" ] || ! kill -{{.StopSignal}} {{if eq .KillMode "mixed"}}$pid{{else}}$group{{end}} 2>/dev/null; then
+{{end}}        failure
+        echo
+        return 1
+    fi
+    # the processes have a few seconds to exit before they are killed
+    i=0
+    while kill -0 $group 2>/dev/null && [ $i -lt {{or .StopTimeout 10}} ]; do
+        sleep 1
+        i=$((i + 1))
+    done
+{{if .FinalKill}}    kill -0 $group 2>/dev/null && kill -KILL $group 2>/dev/null
+{{else}}    if kill -0 $group 2>/dev/null; then
+        failure
+        echo
+        printf "%s is still stopping...\n" "$servname"
+        return 1
+    fi
+{{end}}{{range .PostStopCommands}}    {{.}}
+{{end}}    rm -f $pidfile $lockfile
+    success
+    echo
+}
+
+restart() {
+    stop
+    start
+}
+
+# LSB exit codes: 0 running, 1 dead with a pid file, 2 dead with a lock file, 3 stopped
+service_status() {
+    if [ -f $pidfile ]; then
+        pid=$(cat $pidfile)
+        if [ -n "$pid" ] && kill -0 $pid 2>/dev/null; then
+            echo "$servname (pid $pid) is running..."
+            return 0
+        fi
+        echo "$servname is dead but the pid file exists"
+        return 1
+    fi
+    if [ -f $lockfile ]; then
+        echo "$servname is dead but the lock file exists"
+        return 2
+    fi
+    echo "$servname is stopped"
+    return 3
+}
+
+service_status_q() {
+    service_status >/dev/null 2>&1
+}
+
+case "$1" in
+    start)
+        service_status_q && exit 0
+        $1
+        ;;
+    stop)
+        service_status_q || exit 0
+        $1
+        ;;
+    restart)
+        $1
+        ;;
+    force-reload)
+        # the service has no reload, the configuration is read by a restart
+        restart
+        ;;
+    try-restart|condrestart)
+        service_status_q || exit 0
+        restart
+        ;;
+    status)
+        service_status
+        ;;
+    *)
+        echo "Usage: $0 {start|stop|status|restart|try-restart|force-reload}"
+        exit 2
+esac
+
+exit $?
+`
+
+// Default template of the upstart job
+var upstatConfig = `# {{.Name}} {{.Description}}
+# Managed by github.com/takama/daemon
+# {{.Metadata}}
+
+description     "{{.Description}}"
+author          "Pichu Chen <pichu@tih.tw>"
+
+{{if .After}}start on (runlevel [2345]{{range .After}} and started {{.}}{{end}})
+{{else}}start on runlevel [2345]
+{{end}}{{if or .After .StopAfter}}stop on ({{if .StopAfter}}(runlevel [016]{{range .StopAfter}} and stopped {{.}}{{end}}){{else}}runlevel [016]{{end}}{{range .After}} or stopping {{.}}{{end}})
+{{else}}stop on runlevel [016]
+{{end}}
+respawn
+{{if .Forking}}expect daemon
+{{end}}{{if .KillSignal}}kill signal {{.StopSignal}}
+{{end}}{{if .StopTimeout}}kill timeout {{.StopTimeout}}
+{{else}}#kill timeout 5
+{{end}}{{if or .Conditions .RuntimeDirs .ReadyFile}}
+pre-start script
+{{if .Conditions}}    # the job declines to start on this host, which is not a failure
+{{range .Conditions}}    if ! {{.}} >/dev/null 2>&1; then
+        stop; exit 0
+    fi
+{{end}}{{end}}{{range .RuntimeDirs}}    mkdir -p {{.Path}} && chmod {{.Mode}} {{.Path}}{{if .Owner}} && chown {{.Owner}} {{.Path}}{{end}}
+{{end}}{{if .ReadyFile}}    rm -f {{.ReadyFile}}
+{{end}}end script
+{{end}}{{if .ReadyFile}}
+# the service reports its readiness by the ready file
+post-start script
+    i=0
+    while [ ! -e {{.ReadyFile}} ] && [ $i -lt 30 ]; do
+        sleep 1
+        i=$((i + 1))
+    done
+end script
+{{end}}{{if .StopCommands}}
+pre-stop script
+{{range .StopCommands}}    {{.}}
+{{end}}end script
+{{end}}{{if .PostStopCommands}}
+post-stop script
+{{range .PostStopCommands}}    {{.}}
+{{end}}end script
+{{end}}{{if .User}}
+setuid {{.User}}
+{{end}}{{if .Group}}setgid {{.Group}}
+{{end}}{{range .Environment}}env {{.Name}}={{shell .Value}}
+{{end}}
+exec {{range .Namespace}}{{.}} {{end}}{{range .Wrapper}}{{.}} {{end}}{{.Path}} {{.Args}} {{if .StandardInput}}< {{.StandardInput}} {{end}}>> {{.LogDir}}/{{.Name}}.log 2>> {{.LogDir}}/{{.Name}}.err
+`
+
+// Default template of the launchd property list
+var propertyList = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<!-- Managed by github.com/takama/daemon -->
+<!-- {{.Metadata}} -->
+<plist version="1.0">
+<dict>
+	<key>KeepAlive</key>
+	{{if or .StartInterval .Calendar .Sockets .WatchPaths .QueueDirectories .Forking}}<false/>{{else if .UserScope}}<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>{{else}}<true/>{{end}}
+{{if or .Forking (eq .KillMode "process")}}	<key>AbandonProcessGroup</key>
+	<true/>
+{{end}}{{if .StopTimeout}}	<key>ExitTimeOut</key>
+	<integer>{{.StopTimeout}}</integer>
+{{end}}{{if .RestartDelay}}	<key>ThrottleInterval</key>
+	<integer>{{.RestartDelay}}</integer>
+{{end}}
+	<key>Label</key>
+	<string>{{.Name}}</string>
+	<key>ProgramArguments</key>
+	<array>
+	    <string>{{html .Path}}</string>
+		{{range .Args}}<string>{{html .}}</string>
+		{{end}}
+	</array>
+	<key>RunAtLoad</key>
+	<true/>
+{{if .Environment}}	<key>EnvironmentVariables</key>
+	<dict>
+{{range .Environment}}		<key>{{.Name}}</key>
+		<string>{{html .Value}}</string>
+{{end}}	</dict>
+{{end}}{{if .StartInterval}}	<key>StartInterval</key>
+	<integer>{{.StartInterval}}</integer>
+{{end}}{{if .Calendar}}	<key>StartCalendarInterval</key>
+	<array>
+{{range .Calendar}}		<dict>
+{{range .}}			<key>{{.Key}}</key>
+			<integer>{{.Value}}</integer>
+{{end}}		</dict>
+{{end}}	</array>
+{{end}}{{if .Sockets}}	<key>Sockets</key>
+	<dict>
+		<key>{{.SocketName}}</key>
+		<array>
+{{range .Sockets}}			<dict>
+				<key>SockType</key>
+				<string>{{.Type}}</string>
+{{if .Family}}				<key>SockFamily</key>
+				<string>{{.Family}}</string>
+{{end}}{{if .Path}}				<key>SockPathName</key>
+				<string>{{.Path}}</string>
+{{else}}{{if .Node}}				<key>SockNodeName</key>
+				<string>{{.Node}}</string>
+{{end}}				<key>SockServiceName</key>
+				<string>{{.Service}}</string>
+{{end}}			</dict>
+{{end}}		</array>
+	</dict>
+{{end}}{{if .WatchPaths}}	<key>WatchPaths</key>
+	<array>
+{{range .WatchPaths}}		<string>{{.}}</string>
+{{end}}	</array>
+{{end}}{{if .QueueDirectories}}	<key>QueueDirectories</key>
+	<array>
+{{range .QueueDirectories}}		<string>{{.}}</string>
+{{end}}	</array>
+{{end}}{{if .User}}	<key>UserName</key>
+	<string>{{.User}}</string>
+{{end}}{{if .Group}}	<key>GroupName</key>
+	<string>{{.Group}}</string>
+{{end}}{{if not .UserScope}}    <key>WorkingDirectory</key>
+    <string>/usr/local/var</string>
+{{end}}{{if .StandardInput}}    <key>StandardInPath</key>
+    <string>{{.StandardInput}}</string>
+{{end}}{{if not .PerUser}}    <key>StandardErrorPath</key>
+    <string>{{.LogDir}}/{{.Name}}.err</string>
+    <key>StandardOutPath</key>
+    <string>{{.LogDir}}/{{.Name}}.log</string>
+{{end}}</dict>
+</plist>
+`
+
+// Default template of the FreeBSD rc.d script
+var bsdConfig = `#!/bin/sh
+# Managed by github.com/takama/daemon
+# {{.Metadata}}
+#
+# PROVIDE: {{.Name}}
+# REQUIRE: {{.RCRequire}}
+{{if .Before}}# BEFORE: {{.Before}}
+{{end}}# KEYWORD:{{range .RCKeywords}} {{.}}{{end}}
+
+# Add the following lines to /etc/rc.conf to enable the {{.Name}}:
+#
+# {{.Name}}_enable="YES"
+#
+
+
+. /etc/rc.subr
+
+name="{{.Name}}"
+rcvar="{{.Name}}_enable"
+
+load_rc_config $name
+
+# defaults, they are overridden in rc.conf
+[ -z "${{.Name}}_flags" ] && {{.Name}}_flags="{{.Args}}"
+{{if .Environment}}[ -z "${{.Name}}_env" ] && {{.Name}}_env={{shell (shellenv .Environment)}}
+{{end}}{{if .User}}[ -z "${{.Name}}_user" ] && {{.Name}}_user="{{.User}}"
+{{end}}{{if .CPUAffinity}}[ -z "${{.Name}}_cpuset" ] && {{.Name}}_cpuset="{{.CPUAffinity}}"
+{{end}}[ -z "${{.Name}}_pidfile" ] && {{.Name}}_pidfile="/var/run/{{.Name}}.pid"
+
+pidfile="${{.Name}}_pidfile"
+required_files="{{.Path}}{{range .RequiredFiles}} {{.}}{{end}}"
+{{if .KillSignal}}sig_stop="{{.StopSignal}}"
+{{end}}{{if .Forking}}command="{{.Path}}"
+{{else if or .MaxRuntime .RestartDelay}}# daemon(8) restarts the service, so the pidfile is the one of daemon(8),
+# which stops the service with it, and the service has a pidfile of its own
+procname="/usr/sbin/daemon"
+command="/usr/sbin/daemon"
+command_args="-P $pidfile -p /var/run/{{.Name}}.child.pid -f -r {{if .RestartDelay}}-R {{.RestartDelay}} {{end}}{{if eq .Logging "file"}}-o {{.LogDir}}/{{.Name}}.log {{end}}{{.Path}} ${{.Name}}_flags"
+{{else}}procname="{{.Path}}"
+command="/usr/sbin/daemon"
+command_args="-p $pidfile -f {{if eq .Logging "file"}}-o {{.LogDir}}/{{.Name}}.log {{end}}$procname ${{.Name}}_flags"
+{{end}}{{if not .Forking}}if [ -n "${{.Name}}_user" ]; then
+    command_args="-u ${{.Name}}_user $command_args"
+fi
+# daemon(8) drops the privileges and passes the flags to the service
+unset {{.Name}}_user {{.Name}}_flags
+{{end}}{{if or .RuntimeDirs .ReadyFile .PreStart}}
+start_precmd="{{.Name}}_prestart"
+
+{{.Name}}_prestart()
+{
+{{range .RuntimeDirs}}    mkdir -p {{.Path}} && chmod {{.Mode}} {{.Path}}{{if .Owner}} && chown {{.Owner}} {{.Path}}{{end}}
+{{end}}{{range .PreStart}}    {{.}} || return 1
+{{end}}{{if .ReadyFile}}    rm -f {{.ReadyFile}}
+{{end}}}
+{{end}}{{if or (ne .KillMode "process") .StopCommands .PostStopCommands}}
+{{if ne .KillMode "process"}}# the processes which are left by the service are stopped with it
+{{end}}{{if or .StopCommands .PostStopCommands}}# the stop commands run before the stop signal, the cleanup commands after the stop
+{{end}}stop_precmd="{{.Name}}_group"
+stop_postcmd="{{.Name}}_cleanup"
+
+{{.Name}}_group()
+{
+{{if ne .KillMode "process"}}    {{.Name}}_pgid=$(ps -o pgid= -p $(cat $pidfile) | tr -d ' ')
+    # never the process group of the caller
+    [ "${{.Name}}_pgid" = "$(ps -o pgid= -p $$ | tr -d ' ')" ] && {{.Name}}_pgid=""
+{{end}}{{range .StopCommands}}    {{.}}
+{{end}}    return 0
+}
+
+{{.Name}}_cleanup()
+{
+{{if ne .KillMode "process"}}    [ -n "${{.Name}}_pgid" ] && pkill -{{if .FinalKill}}KILL{{else}}{{.StopSignal}}{{end}} -g ${{.Name}}_pgid
+{{end}}{{range .PostStopCommands}}    {{.}}
+{{end}}    return 0
+}
+{{end}}{{if .ReadyFile}}
+# the service reports its readiness by the ready file
+start_postcmd="{{.Name}}_ready"
+
+{{.Name}}_ready()
+{
+    i=0
+    while [ ! -e {{.ReadyFile}} ] && [ $i -lt 30 ]; do
+        sleep 1
+        i=$((i + 1))
+    done
+}
+{{end}}{{if .Conditions}}
+# the service declines to start on this host, which is not a failure
+case "$1" in
+start|faststart|quietstart|onestart|forcestart)
+{{range .Conditions}}    if ! {{.}} >/dev/null 2>&1; then
+        echo "Skipping ${name}: the condition is not met."
+        exit 0
+    fi
+{{end}}    ;;
+esac
+{{end}}
+run_rc_command "$1"
+`
+
+// Default template of the XDG autostart entry of the desktop scope
+var autostartConfig = `# Managed by github.com/takama/daemon
+# {{.Metadata}}
+[Desktop Entry]
+Type=Application
+Name={{.Name}}
+Comment={{.Description}}
+Exec={{.Exec}}
+Terminal=false
+NoDisplay=true
+X-GNOME-Autostart-enabled=true
+`
+
+// Default template of the newsyslog rules which rotate the logs on macOS
+var newsyslogConfig = `# {{.Metadata}}
+# logfilename [owner:group] mode count size(KB) when flags
+{{range .Files}}{{.}}	{{if $.Owner}}{{$.Owner}}	{{end}}644	7	1024	*	JN
+{{end}}`
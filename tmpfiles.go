@@ -0,0 +1,105 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/takama/daemon/internal/tools"
+)
+
+// TmpfilesDir - directory of the local tmpfiles.d snippets (systemd)
+const TmpfilesDir = "/etc/tmpfiles.d/"
+
+// Directories which are emptied by a reboot, their contents do not survive it
+var volatileDirs = []string{"/run/", "/var/run/", "/tmp/", "/var/lock/"}
+
+// RuntimeDirectory - directory of the service which does not survive a reboot,
+// it is created again before the service starts at boot
+type RuntimeDirectory struct {
+	Path string
+	// Mode - octal permissions, e.g. "0755"
+	Mode string
+	// Owner - argument of chown, empty if the ownership is not changed
+	Owner string
+}
+
+// TmpfilesPath - path of the tmpfiles.d snippet of the service
+func TmpfilesPath(def *Definition) string {
+	return TmpfilesDir + def.Name + ".conf"
+}
+
+// Directories of the service which are located on volatile file systems
+func runtimeDirectories(kind Kind, def *Definition) []RuntimeDirectory {
+	var dirs []RuntimeDirectory
+	for _, spec := range manifest(kind, def) {
+		if spec.Dir && volatile(spec.Path) {
+			dirs = append(dirs, RuntimeDirectory{
+				Path:  spec.Path,
+				Mode:  fmt.Sprintf("%04o", spec.mode().Perm()),
+				Owner: ownerArg(spec.User, spec.Group),
+			})
+		}
+	}
+	return dirs
+}
+
+func volatile(path string) bool {
+	for _, dir := range volatileDirs {
+		if strings.HasPrefix(path+"/", dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// Render the tmpfiles.d snippet which creates the runtime directories at boot
+func renderTmpfiles(dirs []RuntimeDirectory) string {
+	var b strings.Builder
+	b.WriteString("# Managed by " + generatedBy + "\n# " + NewMetadata().String() + "\n")
+	b.WriteString("# Type Path Mode User Group Age\n")
+	for _, dir := range dirs {
+		user, group := "-", "-"
+		if dir.Owner != "" {
+			parts := strings.SplitN(dir.Owner, ":", 2)
+			if parts[0] != "" {
+				user = parts[0]
+			}
+			if len(parts) > 1 {
+				group = parts[1]
+			}
+		}
+		fmt.Fprintf(&b, "d %s %s %s %s -\n", dir.Path, dir.Mode, user, group)
+	}
+	return b.String()
+}
+
+// Write the tmpfiles.d snippet of the service and create its directories,
+// other init systems create them by their scripts
+func installTmpfiles(kind Kind, def *Definition) error {
+	dirs := runtimeDirectories(kind, def)
+	if kind != KindSystemD || len(dirs) == 0 {
+		return nil
+	}
+	if err := ioutil.WriteFile(rooted(TmpfilesPath(def)), []byte(renderTmpfiles(dirs)), 0644); err != nil {
+		return err
+	}
+	// the snippet of an offline image is applied when it boots
+	if offline() {
+		return nil
+	}
+	return tools.Command("systemd-tmpfiles", "--create", TmpfilesPath(def)).Run()
+}
+
+// Remove the tmpfiles.d snippet of the service, the directories are kept
+func removeTmpfiles(def *Definition) error {
+	if err := os.Remove(rooted(TmpfilesPath(def))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
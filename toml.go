@@ -0,0 +1,415 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// tomlParser - TOML document and the position in it. Tables, arrays of
+// tables, dotted keys, inline tables, arrays, strings, integers, floats and
+// booleans are supported; dates are kept as strings.
+type tomlParser struct {
+	src string
+	pos int
+}
+
+// Decode the TOML document into maps, slices and scalars
+func decodeTOML(data []byte) (map[string]interface{}, error) {
+	p := &tomlParser{src: strings.Replace(string(data), "\r\n", "\n", -1)}
+	root := map[string]interface{}{}
+	current := root
+	for {
+		p.skipSpace(true)
+		if p.pos >= len(p.src) {
+			return root, nil
+		}
+		var err error
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], "[["):
+			p.pos += 2
+			current, err = p.arrayTable(root)
+		case p.src[p.pos] == '[':
+			p.pos++
+			current, err = p.table(root)
+		default:
+			err = p.keyValue(current)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := p.endOfLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Error at the current line
+func (p *tomlParser) errorf(message string) error {
+	line := strings.Count(p.src[:p.pos], "\n") + 1
+	return errors.New("TOML line " + strconv.Itoa(line) + ": " + message)
+}
+
+// Skip spaces and comments, and the line ends if newlines is set
+func (p *tomlParser) skipSpace(newlines bool) {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case c == '\n' && newlines:
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Only a comment may follow a key value pair or a table header on its line
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace(false)
+	if p.pos < len(p.src) && p.src[p.pos] != '\n' {
+		return p.errorf("unexpected " + strconv.Quote(string(p.src[p.pos])))
+	}
+	return nil
+}
+
+// Header of a table: [a.b]
+func (p *tomlParser) table(root map[string]interface{}) (map[string]interface{}, error) {
+	path, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	if !p.consume("]") {
+		return nil, p.errorf("] expected")
+	}
+	return p.subTable(root, path)
+}
+
+// Header of an element of an array of tables: [[a.b]]
+func (p *tomlParser) arrayTable(root map[string]interface{}) (map[string]interface{}, error) {
+	path, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	if !p.consume("]]") {
+		return nil, p.errorf("]] expected")
+	}
+	parent, err := p.subTable(root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	name := path[len(path)-1]
+	var array []interface{}
+	switch existing := parent[name].(type) {
+	case nil:
+	case []interface{}:
+		array = existing
+	default:
+		return nil, p.errorf(strconv.Quote(name) + " is not an array of tables")
+	}
+	table := map[string]interface{}{}
+	parent[name] = append(array, table)
+	return table, nil
+}
+
+// Table of the path below the table, the missing tables are created,
+// the last element of an array of tables is used
+func (p *tomlParser) subTable(table map[string]interface{}, path []string) (map[string]interface{}, error) {
+	for _, name := range path {
+		switch existing := table[name].(type) {
+		case nil:
+			created := map[string]interface{}{}
+			table[name] = created
+			table = created
+		case map[string]interface{}:
+			table = existing
+		case []interface{}:
+			last, ok := existing[len(existing)-1].(map[string]interface{})
+			if !ok {
+				return nil, p.errorf(strconv.Quote(name) + " is not a table")
+			}
+			table = last
+		default:
+			return nil, p.errorf(strconv.Quote(name) + " is not a table")
+		}
+	}
+	return table, nil
+}
+
+// Key value pair, the tables of a dotted key are created
+func (p *tomlParser) keyValue(table map[string]interface{}) error {
+	path, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipSpace(false)
+	if !p.consume("=") {
+		return p.errorf("= expected")
+	}
+	p.skipSpace(false)
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	table, err = p.subTable(table, path[:len(path)-1])
+	if err != nil {
+		return err
+	}
+	name := path[len(path)-1]
+	if _, ok := table[name]; ok {
+		return p.errorf("duplicate key " + strconv.Quote(name))
+	}
+	table[name] = value
+	return nil
+}
+
+// Consume the text if it follows
+func (p *tomlParser) consume(text string) bool {
+	if strings.HasPrefix(p.src[p.pos:], text) {
+		p.pos += len(text)
+		return true
+	}
+	return false
+}
+
+// Bare, quoted or dotted key
+func (p *tomlParser) key() ([]string, error) {
+	var path []string
+	for {
+		p.skipSpace(false)
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("key expected")
+		}
+		switch p.src[p.pos] {
+		case '"', '\'':
+			part, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, part)
+		default:
+			start := p.pos
+			for p.pos < len(p.src) && tomlBare(p.src[p.pos]) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, p.errorf("key expected")
+			}
+			path = append(path, p.src[start:p.pos])
+		}
+		p.skipSpace(false)
+		if !p.consume(".") {
+			return path, nil
+		}
+	}
+}
+
+// Check the character may be a part of a bare key
+func tomlBare(c byte) bool {
+	return c == '_' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// Value: string, array, inline table, boolean or number
+func (p *tomlParser) value() (interface{}, error) {
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("value expected")
+	}
+	switch p.src[p.pos] {
+	case '"', '\'':
+		return p.str()
+	case '[':
+		p.pos++
+		return p.array()
+	case '{':
+		p.pos++
+		return p.inlineTable()
+	}
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte(" \t\n,]}#", p.src[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.scalar(p.src[start:p.pos])
+}
+
+// Array of values, it may span lines
+func (p *tomlParser) array() ([]interface{}, error) {
+	values := []interface{}{}
+	for {
+		p.skipSpace(true)
+		if p.consume("]") {
+			return values, nil
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		p.skipSpace(true)
+		if p.consume("]") {
+			return values, nil
+		}
+		if !p.consume(",") {
+			return nil, p.errorf(", or ] expected")
+		}
+	}
+}
+
+// Inline table on a single line
+func (p *tomlParser) inlineTable() (map[string]interface{}, error) {
+	table := map[string]interface{}{}
+	p.skipSpace(false)
+	if p.consume("}") {
+		return table, nil
+	}
+	for {
+		if err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipSpace(false)
+		if p.consume("}") {
+			return table, nil
+		}
+		if !p.consume(",") {
+			return nil, p.errorf(", or } expected")
+		}
+		p.skipSpace(false)
+	}
+}
+
+// Boolean, integer (decimal, hexadecimal, octal, binary) or float,
+// other values (dates and times) are kept as strings
+func (p *tomlParser) scalar(text string) (interface{}, error) {
+	switch text {
+	case "":
+		return nil, p.errorf("value expected")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	digits := strings.Replace(text, "_", "", -1)
+	for prefix, base := range map[string]int{"0x": 16, "0o": 8, "0b": 2} {
+		if strings.HasPrefix(digits, prefix) {
+			value, err := strconv.ParseInt(digits[2:], base, 64)
+			if err != nil {
+				return nil, p.errorf("invalid number " + text)
+			}
+			return value, nil
+		}
+	}
+	if value, err := strconv.ParseInt(digits, 10, 64); err == nil {
+		return value, nil
+	}
+	if value, err := strconv.ParseFloat(digits, 64); err == nil {
+		return value, nil
+	}
+	if text[0] >= '0' && text[0] <= '9' {
+		return text, nil
+	}
+	return nil, p.errorf("invalid value " + strconv.Quote(text))
+}
+
+// Basic or literal string, single or multi-line
+func (p *tomlParser) str() (string, error) {
+	quote := p.src[p.pos : p.pos+1]
+	multiline := strings.HasPrefix(p.src[p.pos:], strings.Repeat(quote, 3))
+	delimiter := quote
+	if multiline {
+		delimiter = strings.Repeat(quote, 3)
+	}
+	p.pos += len(delimiter)
+	// a newline right after the opening delimiter is trimmed
+	if multiline {
+		p.consume("\n")
+	}
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) {
+			return "", p.errorf("unterminated string")
+		}
+		if strings.HasPrefix(p.src[p.pos:], delimiter) {
+			// quotes which precede the closing delimiter belong to the string
+			if multiline && strings.HasPrefix(p.src[p.pos+len(delimiter):], quote) {
+				b.WriteString(quote)
+				p.pos++
+				continue
+			}
+			p.pos += len(delimiter)
+			return b.String(), nil
+		}
+		c := p.src[p.pos]
+		switch {
+		case c == '\n' && !multiline:
+			return "", p.errorf("unterminated string")
+		case c == '\\' && quote == `"`:
+			if err := p.escape(&b, multiline); err != nil {
+				return "", err
+			}
+		default:
+			r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+			b.WriteRune(r)
+			p.pos += size
+		}
+	}
+}
+
+// Escape sequence of a basic string, a backslash at the end of a line
+// of a multi-line string trims the line end and the following spaces
+func (p *tomlParser) escape(b *strings.Builder, multiline bool) error {
+	p.pos++
+	if p.pos >= len(p.src) {
+		return p.errorf("unterminated string")
+	}
+	c := p.src[p.pos]
+	p.pos++
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case 'e':
+		b.WriteByte(0x1b)
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.src) {
+			return p.errorf("invalid escape sequence")
+		}
+		code, err := strconv.ParseUint(p.src[p.pos:p.pos+size], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return p.errorf("invalid escape sequence")
+		}
+		b.WriteRune(rune(code))
+		p.pos += size
+	case ' ', '\t', '\n':
+		if !multiline {
+			return p.errorf("invalid escape sequence")
+		}
+		p.pos--
+		for p.pos < len(p.src) && strings.IndexByte(" \t\n", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+	default:
+		return p.errorf("invalid escape sequence")
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want map[string]interface{}
+	}{
+		{
+			name: "empty document",
+			text: "# nothing but a comment\n\n",
+			want: map[string]interface{}{},
+		},
+		{
+			name: "key value pairs",
+			text: "name = \"web\"\nenabled = true\ndisabled = false\nworkers = 4\nbig = 1_000\nratio = 0.5\nmode = 0o640\nmask = 0x1f\nflags = 0b101\nsince = 1979-05-27T07:32:00Z\n",
+			want: map[string]interface{}{
+				"name":     "web",
+				"enabled":  true,
+				"disabled": false,
+				"workers":  int64(4),
+				"big":      int64(1000),
+				"ratio":    0.5,
+				"mode":     int64(0640),
+				"mask":     int64(0x1f),
+				"flags":    int64(5),
+				"since":    "1979-05-27T07:32:00Z",
+			},
+		},
+		{
+			name: "tables",
+			text: `name = "web"
+
+[environment]
+PORT = "8080"
+
+[limits.files]
+soft = 1024
+`,
+			want: map[string]interface{}{
+				"name":        "web",
+				"environment": map[string]interface{}{"PORT": "8080"},
+				"limits": map[string]interface{}{
+					"files": map[string]interface{}{"soft": int64(1024)},
+				},
+			},
+		},
+		{
+			name: "arrays of tables",
+			text: `[[config_files]]
+path = "/etc/web.conf"
+mode = 0o600
+
+[[config_files]]
+path = "/etc/web.env"
+
+[config_files.owner]
+user = "web"
+`,
+			want: map[string]interface{}{
+				"config_files": []interface{}{
+					map[string]interface{}{"path": "/etc/web.conf", "mode": int64(0600)},
+					map[string]interface{}{
+						"path":  "/etc/web.env",
+						"owner": map[string]interface{}{"user": "web"},
+					},
+				},
+			},
+		},
+		{
+			name: "dotted and quoted keys",
+			text: "limits.nofile = 1024\n\"core dump\" = 'no'\nsite.\"google.com\" = true\n",
+			want: map[string]interface{}{
+				"limits":    map[string]interface{}{"nofile": int64(1024)},
+				"core dump": "no",
+				"site":      map[string]interface{}{"google.com": true},
+			},
+		},
+		{
+			name: "arrays and inline tables",
+			text: "args = [\"--port\", 8080]\nafter = [\n  \"network.target\", # the network\n  \"db\",\n]\nnone = []\nowner = { user = \"web\", group = \"web\" }\nempty = {}\n",
+			want: map[string]interface{}{
+				"args":  []interface{}{"--port", int64(8080)},
+				"after": []interface{}{"network.target", "db"},
+				"none":  []interface{}{},
+				"owner": map[string]interface{}{"user": "web", "group": "web"},
+				"empty": map[string]interface{}{},
+			},
+		},
+		{
+			name: "strings with escapes",
+			text: `basic = "tab\there \"quoted\" \u00e9 \U0001F600"
+literal = 'C:\path\# not a comment'
+multiline = """
+one
+two"""
+folded = """\
+    one \
+    two"""
+raw = '''
+C:\path
+'''
+quotes = """say "hi"""""
+`,
+			want: map[string]interface{}{
+				"basic":     "tab\there \"quoted\" \u00e9 \U0001F600",
+				"literal":   `C:\path\# not a comment`,
+				"multiline": "one\ntwo",
+				"folded":    "one two",
+				"raw":       "C:\\path\n",
+				"quotes":    `say "hi""`,
+			},
+		},
+		{
+			name: "inline comments",
+			text: "# the service\nname = \"web # not a comment\" # the name\n[environment] # the variables\nPORT = \"8080\"\n",
+			want: map[string]interface{}{
+				"name":        "web # not a comment",
+				"environment": map[string]interface{}{"PORT": "8080"},
+			},
+		},
+		{
+			name: "windows line ends",
+			text: "name = \"web\"\r\n[environment]\r\nPORT = \"8080\"\r\n",
+			want: map[string]interface{}{
+				"name":        "web",
+				"environment": map[string]interface{}{"PORT": "8080"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := decodeTOML([]byte(test.text))
+			if err != nil {
+				t.Fatalf("decodeTOML() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("decodeTOML() = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "missing equals sign",
+			text: "name = \"web\"\ndescription \"Web\"\n",
+			want: "TOML line 2: = expected",
+		},
+		{
+			name: "missing value",
+			text: "name =\n",
+			want: "TOML line 1: value expected",
+		},
+		{
+			name: "missing key",
+			text: "name = \"web\"\n= \"Web\"\n",
+			want: "TOML line 2: key expected",
+		},
+		{
+			name: "duplicate key",
+			text: "name = \"web\"\n\nname = \"api\"\n",
+			want: `TOML line 3: duplicate key "name"`,
+		},
+		{
+			name: "trailing text",
+			text: "name = \"web\" server\n",
+			want: `TOML line 1: unexpected "s"`,
+		},
+		{
+			name: "unterminated table header",
+			text: "name = \"web\"\n[environment\nPORT = \"8080\"\n",
+			want: "TOML line 2: ] expected",
+		},
+		{
+			name: "unterminated array of tables header",
+			text: "[[config_files]\npath = \"/etc/web.conf\"\n",
+			want: "TOML line 1: ]] expected",
+		},
+		{
+			name: "table over a value",
+			text: "environment = \"none\"\n[environment]\n",
+			want: `TOML line 2: "environment" is not a table`,
+		},
+		{
+			name: "array of tables over a table",
+			text: "[config_files]\n[[config_files]]\n",
+			want: `TOML line 2: "config_files" is not an array of tables`,
+		},
+		{
+			name: "unterminated string",
+			text: "name = \"web\ndescription = \"Web\"\n",
+			want: "TOML line 1: unterminated string",
+		},
+		{
+			name: "unterminated multiline string",
+			text: "script = \"\"\"\necho\n",
+			want: "TOML line 3: unterminated string",
+		},
+		{
+			name: "invalid escape",
+			text: "name = \"web\"\npath = \"C:\\q\"\n",
+			want: "TOML line 2: invalid escape sequence",
+		},
+		{
+			name: "invalid unicode escape",
+			text: "name = \"\\uZZZZ\"\n",
+			want: "TOML line 1: invalid escape sequence",
+		},
+		{
+			name: "unterminated array",
+			text: "args = [\"a\", \"b\"\nname = \"web\"\n",
+			want: "TOML line 2: , or ] expected",
+		},
+		{
+			name: "unterminated inline table",
+			text: "owner = { user = \"web\"\n",
+			want: "TOML line 1: , or } expected",
+		},
+		{
+			name: "invalid number",
+			text: "mask = 0xZZ\n",
+			want: "TOML line 1: invalid number 0xZZ",
+		},
+		{
+			name: "invalid value",
+			text: "name = web\n",
+			want: `TOML line 1: invalid value "web"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := decodeTOML([]byte(test.text))
+			if err == nil {
+				t.Fatalf("decodeTOML() error = nil, want %q", test.want)
+			}
+			if err.Error() != test.want {
+				t.Errorf("decodeTOML() error = %q, want %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import "github.com/takama/daemon/internal/tools"
+
+// ErrToolNotFound appears if a tool of the init system (systemctl, launchctl,
+// service, initctl, ...) is not found, its path is set by SetToolPath or by
+// its environment variable, e.g. $DAEMON_SYSTEMCTL
+var ErrToolNotFound = tools.ErrNotFound
+
+// SetToolPath - path of the named tool of the init system, e.g.
+// SetToolPath("systemctl", "/run/current-system/sw/bin/systemctl"),
+// an empty path restores the lookup. It takes precedence over the
+// environment variable of the tool, DAEMON_ followed by the upper case
+// name (DAEMON_SYSTEMCTL, DAEMON_SYSTEMD_TMPFILES).
+func SetToolPath(name, path string) {
+	tools.Set(name, path)
+}
+
+// ToolPath - path of the named tool of the init system: the one which is set,
+// else the tool in PATH or in the standard directories (/run/current-system/sw/bin
+// of NixOS, /usr/sbin, /sbin, ...), an error matching ErrToolNotFound otherwise
+func ToolPath(name string) (string, error) {
+	return tools.Path(name)
+}
@@ -0,0 +1,147 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AuditRecord - outcome of an operation of a daemon (install, start, stop,
+// ...) with the trace ID under which it was performed, so the operations
+// of many hosts can be correlated
+type AuditRecord struct {
+	// TraceID - correlation ID of the operation, empty if it was not traced
+	TraceID string
+
+	// Service - name of the service
+	Service string
+
+	// Action - translated message of the operation, e.g. "Starting My Service:"
+	Action string
+
+	// OK - the operation succeeded
+	OK bool
+
+	// Time when the operation finished
+	Time time.Time
+}
+
+// AuditRecorder - receives the record of every operation of the daemons,
+// it is called synchronously, so it should return quickly
+type AuditRecorder func(record *AuditRecord)
+
+var audit = struct {
+	sync.RWMutex
+	recorder AuditRecorder
+}{}
+
+// SetAuditRecorder - record the operations of all daemons, nil (the default)
+// records nothing
+func SetAuditRecorder(recorder AuditRecorder) {
+	audit.Lock()
+	defer audit.Unlock()
+	audit.recorder = recorder
+}
+
+// Tracer interface is implemented by daemons which attach a trace ID to
+// the results, the log messages and the audit records of their operations
+type Tracer interface {
+	// SetTraceID - set the trace ID of the following operations,
+	// empty disables it
+	SetTraceID(id string)
+
+	// TraceID - trace ID of the operations, empty if it is not set
+	TraceID() string
+}
+
+// Key of the trace ID in a context
+type traceKey struct{}
+
+// ContextWithTraceID - context which carries the trace ID, see SetTraceContext
+func ContextWithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceKey{}, id)
+}
+
+// TraceIDFromContext - trace ID which the context carries, empty if none
+func TraceIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(traceKey{}).(string)
+	return id
+}
+
+// NewTraceID - random trace ID of 32 hex digits (the format of W3C Trace
+// Context), or one of the current time if the random source fails
+func NewTraceID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(id)
+}
+
+// SetTraceContext - trace the operations of the daemon by the trace ID of
+// the context, a new one (NewTraceID) if it carries none; the trace ID is
+// returned, so it can be passed to the other hosts of an orchestration.
+// An empty string is returned if the daemon is not a Tracer.
+func SetTraceContext(d Daemon, ctx context.Context) string {
+	tracer, ok := d.(Tracer)
+	if !ok {
+		return ""
+	}
+	id := TraceIDFromContext(ctx)
+	if id == "" {
+		id = NewTraceID()
+	}
+	tracer.SetTraceID(id)
+	return id
+}
+
+// SetTraceID - set the trace ID of the following operations, empty disables it
+func (properties *ServiceProperties) SetTraceID(id string) {
+	properties.traceID = id
+}
+
+// TraceID - trace ID of the operations, empty if it is not set
+func (properties *ServiceProperties) TraceID() string {
+	return properties.traceID
+}
+
+// Result of an operation of the service which succeeded, it is recorded
+// in the history of the service
+func (properties *ServiceProperties) succeeded(action string) string {
+	properties.record(action, true)
+	return traceResult(properties.traceID, properties.def.Name, action, true)
+}
+
+// Result of an operation of the service which failed, it is recorded
+// in the history of the service
+func (properties *ServiceProperties) failed(action string) string {
+	properties.record(action, false)
+	return traceResult(properties.traceID, properties.def.Name, action, false)
+}
+
+// Formatted result of an operation of the service, it is prefixed by the
+// trace ID, logged and recorded if the operation is traced
+func traceResult(id, name, action string, ok bool) string {
+	audit.RLock()
+	recorder := audit.recorder
+	audit.RUnlock()
+	if recorder != nil {
+		recorder(&AuditRecord{TraceID: id, Service: name, Action: action, OK: ok, Time: time.Now()})
+	}
+	if id == "" {
+		return formatResult(action, ok)
+	}
+	outcome := "failed"
+	if ok {
+		outcome = "ok"
+	}
+	diagnostics.Println("trace="+id, "service="+name, action, outcome)
+	return formatResult("["+id+"] "+action, ok)
+}
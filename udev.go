@@ -0,0 +1,74 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// UdevDir - directory of the local udev rules
+const UdevDir = "/etc/udev/rules.d/"
+
+// UdevRulesPath - path of the udev rules file of the service
+func UdevRulesPath(def *Definition) string {
+	return UdevDir + "99-" + def.Name + ".rules"
+}
+
+// Check the service has udev rules on the given kind of init system (linux)
+func hasUdevRules(kind Kind, def *Definition) bool {
+	return linuxKind(kind) && len(def.UdevRules) > 0
+}
+
+// Check the kind of init system runs on linux
+func linuxKind(kind Kind) bool {
+	switch kind {
+	case KindSystemD, KindSystemV, KindUpstart:
+		return true
+	}
+	return false
+}
+
+// Render the udev rules file of the service
+func renderUdevRules(def *Definition) string {
+	return "# Managed by " + generatedBy + "\n# " + NewMetadata().String() + "\n" +
+		strings.Join(def.UdevRules, "\n") + "\n"
+}
+
+// Write the udev rules of the service and make udev apply them
+func installUdevRules(def *Definition) error {
+	if len(def.UdevRules) == 0 {
+		return nil
+	}
+	if err := ioutil.WriteFile(rooted(UdevRulesPath(def)), []byte(renderUdevRules(def)), 0644); err != nil {
+		return err
+	}
+	return reloadUdev()
+}
+
+// Remove the udev rules of the service
+func removeUdevRules(def *Definition) error {
+	if err := os.Remove(rooted(UdevRulesPath(def))); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return reloadUdev()
+}
+
+// Reload the rules and replay the events of the present devices,
+// udev of an offline image reads the rules when it boots
+func reloadUdev() error {
+	if offline() {
+		return nil
+	}
+	if err := exec.Command("udevadm", "control", "--reload-rules").Run(); err != nil {
+		return err
+	}
+	return exec.Command("udevadm", "trigger", "--action=add").Run()
+}
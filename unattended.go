@@ -0,0 +1,189 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"os/user"
+)
+
+// Questions of an install which are answered by InstallOptions
+const (
+	// QuestionInstall - is the service installed
+	QuestionInstall = "install"
+
+	// QuestionOverwrite - is an installed service which differs from the definition replaced
+	QuestionOverwrite = "overwrite"
+
+	// QuestionCreateUser - is the missing account of the service created
+	QuestionCreateUser = "create-user"
+
+	// QuestionEnable - is the service started at boot
+	QuestionEnable = "enable"
+
+	// QuestionStart - is the service started now
+	QuestionStart = "start"
+)
+
+// InstallOptions - answers to the questions of an install, so an unattended
+// install behaves the same whatever it finds on the host. The zero value
+// installs a missing service, keeps an installed one, creates the account
+// if the definition asks for it, enables the service and does not start it.
+type InstallOptions struct {
+	// Overwrite - replace an installed service whose file differs from the
+	// definition, a running service is restarted
+	Overwrite bool `json:"overwrite,omitempty"`
+
+	// Disable - the service is not started at boot, Install enables it
+	// otherwise (see Disable)
+	Disable bool `json:"disable,omitempty"`
+
+	// Start - start the service after the install
+	Start bool `json:"start,omitempty"`
+
+	// NoCreateUser - never create the account of the service,
+	// the install fails if it does not exist
+	NoCreateUser bool `json:"no_create_user,omitempty"`
+}
+
+// Decision - answer to a question of the install and its reason
+type Decision struct {
+	Question string `json:"question"`
+	Answer   bool   `json:"answer"`
+	Reason   string `json:"reason"`
+}
+
+// InstallReport - decisions of an unattended install in the order they were taken
+type InstallReport struct {
+	Decisions []Decision `json:"decisions"`
+
+	// Changed - anything was installed, replaced or started
+	Changed bool `json:"changed"`
+}
+
+// Record the decision
+func (report *InstallReport) decide(question string, answer bool, reason string) {
+	report.Decisions = append(report.Decisions, Decision{Question: question, Answer: answer, Reason: reason})
+}
+
+// InstallUnattended - install the daemon by the given answers instead of
+// the state of the host, e.g. by a provisioning script. The report tells
+// every decision which was taken, also if the install failed.
+func InstallUnattended(d Daemon, options InstallOptions) (*InstallReport, error) {
+	report := &InstallReport{}
+	if properties, ok := Properties(d); ok {
+		if err := decideAccount(report, &properties.def, options); err != nil {
+			return report, err
+		}
+	}
+
+	restart := false
+	_, err := d.Install()
+	switch {
+	case err == nil:
+		report.Changed = true
+		report.decide(QuestionInstall, true, "the service was not installed")
+	case err != ErrAlreadyInstalled:
+		return report, err
+	default:
+		report.decide(QuestionInstall, false, "the service is already installed")
+		if restart, err = overwrite(report, d, options); err != nil {
+			return report, err
+		}
+	}
+
+	if err := decideEnable(report, d, options); err != nil {
+		return report, err
+	}
+
+	switch {
+	case restart:
+		report.decide(QuestionStart, true, "the replaced service was running")
+	case options.Start:
+		report.decide(QuestionStart, true, "Start is set")
+	default:
+		report.decide(QuestionStart, false, "Start is not set")
+		return report, nil
+	}
+	switch _, err := d.Start(); err {
+	case nil:
+		report.Changed = true
+	case ErrAlreadyRunning:
+	default:
+		return report, err
+	}
+	return report, nil
+}
+
+// Create the missing account of the service only if both the definition
+// and the options allow it, the definition of the daemon is changed
+// for the install if they do not
+func decideAccount(report *InstallReport, def *Definition, options InstallOptions) error {
+	if !def.CreateUser || def.User == "" {
+		return nil
+	}
+	if !options.NoCreateUser {
+		report.decide(QuestionCreateUser, true, "the definition asks for the account "+def.User)
+		return nil
+	}
+	report.decide(QuestionCreateUser, false, "NoCreateUser is set")
+	def.CreateUser = false
+	if offline() {
+		return nil
+	}
+	_, err := user.Lookup(def.User)
+	return err
+}
+
+// Replace the installed service if it differs from the definition and
+// Overwrite is set, restart reports the replaced service was running
+func overwrite(report *InstallReport, d Daemon, options InstallOptions) (restart bool, err error) {
+	identical, err := UpToDate(d)
+	switch {
+	case err == ErrUnsupportedSystem:
+		report.decide(QuestionOverwrite, false, "the installed service can not be compared")
+		return false, nil
+	case err != nil:
+		return false, err
+	case identical:
+		report.decide(QuestionOverwrite, false, "the installed service is up to date")
+		return false, nil
+	case !options.Overwrite:
+		report.decide(QuestionOverwrite, false, "the installed service differs, Overwrite is not set")
+		return false, nil
+	}
+	report.decide(QuestionOverwrite, true, "the installed service differs from the definition")
+	if status, err := StatusOf(d); err == nil && status.Running() {
+		if _, err := d.Stop(); err != nil {
+			return false, err
+		}
+		restart = true
+	}
+	if _, err := d.Remove(); err != nil {
+		return restart, err
+	}
+	if _, err := d.Install(); err != nil {
+		return restart, err
+	}
+	report.Changed = true
+	return restart, nil
+}
+
+// Disable the service at boot if the options ask for it, Install enabled it
+func decideEnable(report *InstallReport, d Daemon, options InstallOptions) error {
+	if !options.Disable {
+		report.decide(QuestionEnable, true, "Disable is not set")
+		return nil
+	}
+	switch err := Disable(d); err {
+	case nil:
+		report.decide(QuestionEnable, false, "Disable is set")
+		return nil
+	case ErrOfflineImage:
+		report.decide(QuestionEnable, true, "rc.conf of the offline image is not changed")
+		return nil
+	default:
+		return err
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package upstart
+
+import "testing"
+
+func FuzzParseStatus(f *testing.F) {
+	for _, test := range statusOutputs {
+		f.Add([]byte(test.output), test.job)
+	}
+	f.Fuzz(func(t *testing.T, output []byte, job string) {
+		if running, pid := ParseStatus(output, job); running && pid == "" {
+			t.Errorf("ParseStatus(%q, %q) is running without a pid", output, job)
+		}
+	})
+}
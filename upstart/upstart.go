@@ -0,0 +1,168 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+// Package upstart controls jobs of the upstart init system.
+//
+// It is used by the daemon package on linux hosts which run upstart.
+package upstart
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/takama/daemon/internal/tools"
+)
+
+// Dir - standard directory of job configurations
+const Dir = "/etc/init/"
+
+// e.g. "myservice start/running, process 42", "myservice (instance) stop/waiting"
+var statusRegexp = regexp.MustCompile(`(?m)^(\S+)(?: \(([^)]*)\))? (start|stop)/([a-z-]+)(?:, process ([0-9]+))?`)
+
+// Job - upstart job
+type Job struct {
+	// Name of the job
+	Name string
+
+	// Root - root directory of an offline image (e.g. /mnt/image) which
+	// contains the job, empty for the running system
+	Root string
+}
+
+// New - create a job with the given name
+func New(name string) *Job {
+	return &Job{Name: name}
+}
+
+// Path - standard path of the job configuration
+func (job *Job) Path() string {
+	return job.Root + Dir + job.Name + ".conf"
+}
+
+// IsInstalled - check the job configuration exists
+func (job *Job) IsInstalled() bool {
+	_, err := os.Stat(job.Path())
+	return err == nil
+}
+
+// Status - check the job is running and return its PID if it is known
+func (job *Job) Status() (running bool, pid string) {
+	output, err := tools.Command("initctl", "status", job.Name).Output()
+	if err != nil {
+		return false, ""
+	}
+	return ParseStatus(output, job.Name)
+}
+
+// ParseStatus - state of the job in the output of "status <job>" (initctl):
+// the main process exists from the spawned state until the job is killed,
+// the process of the pre-start state is the one of the pre-start script.
+// A job whose process is not reported does not run.
+func ParseStatus(output []byte, name string) (running bool, pid string) {
+	for _, match := range statusRegexp.FindAllSubmatch(output, -1) {
+		if string(match[1]) != name {
+			continue
+		}
+		switch string(match[4]) {
+		case "spawned", "post-start", "running", "pre-stop", "stopping", "killed":
+			return len(match[5]) > 0, string(match[5])
+		}
+		return false, ""
+	}
+	return false, ""
+}
+
+// OverridePath - path of the override file of the job, its stanzas
+// replace the ones of the job configuration
+func (job *Job) OverridePath() string {
+	return job.Root + Dir + job.Name + ".override"
+}
+
+// IsEnabled - check the job is started by an event at boot: it has a
+// "start on" stanza and no "manual" stanza in its configuration or
+// in its override file
+func (job *Job) IsEnabled() (bool, error) {
+	data, err := ioutil.ReadFile(job.Path())
+	if err != nil {
+		return false, err
+	}
+	startOn, manual := ParseStanzas(data)
+	if override, err := ioutil.ReadFile(job.OverridePath()); err == nil {
+		overrideStartOn, overrideManual := ParseStanzas(override)
+		startOn = startOn || overrideStartOn
+		manual = manual || overrideManual
+	}
+	return startOn && !manual, nil
+}
+
+// ParseStanzas - check a job configuration or override file has
+// a "start on" stanza and a "manual" stanza
+func ParseStanzas(data []byte) (startOn bool, manual bool) {
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 1 && fields[0] == "manual":
+			manual = true
+		case len(fields) > 2 && fields[0] == "start" && fields[1] == "on":
+			startOn = true
+		}
+	}
+	return startOn, manual
+}
+
+// Enable - let the "start on" stanza start the job again, the "manual"
+// stanza is removed from its override file
+func (job *Job) Enable() error {
+	data, err := ioutil.ReadFile(job.OverridePath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "manual" {
+			lines = append(lines, line)
+		}
+	}
+	content := strings.TrimSpace(strings.Join(lines, "\n"))
+	if content == "" {
+		return os.Remove(job.OverridePath())
+	}
+	return ioutil.WriteFile(job.OverridePath(), []byte(content+"\n"), 0644)
+}
+
+// Disable - add the "manual" stanza to the override file of the job,
+// it is started by hand only; the job configuration is not changed
+func (job *Job) Disable() error {
+	data, err := ioutil.ReadFile(job.OverridePath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if _, manual := ParseStanzas(data); manual {
+		return nil
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	return ioutil.WriteFile(job.OverridePath(), append(data, "manual\n"...), 0644)
+}
+
+// Start - start the job
+func (job *Job) Start() error {
+	return tools.Command("initctl", "start", job.Name).Run()
+}
+
+// Stop - stop the job
+func (job *Job) Stop() error {
+	return tools.Command("initctl", "stop", job.Name).Run()
+}
+
+// ReloadConfiguration - make upstart reread the job configurations
+func ReloadConfiguration() error {
+	return tools.Command("initctl", "reload-configuration").Run()
+}
@@ -0,0 +1,74 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package upstart
+
+import "testing"
+
+// Captured output of "initctl status <job>"
+var statusOutputs = []struct {
+	name    string
+	output  string
+	job     string
+	running bool
+	pid     string
+}{
+	{
+		name:    "running",
+		output:  "myservice start/running, process 1234\n",
+		job:     "myservice",
+		running: true,
+		pid:     "1234",
+	},
+	{
+		name:   "pre-start script",
+		output: "myservice start/pre-start, process 1200\n",
+		job:    "myservice",
+	},
+	{
+		name:   "spawned without a process",
+		output: "myservice start/spawned\n",
+		job:    "myservice",
+	},
+	{
+		name:    "killed",
+		output:  "myservice stop/killed, process 1234\n",
+		job:     "myservice",
+		running: true,
+		pid:     "1234",
+	},
+	{
+		name:   "waiting",
+		output: "myservice stop/waiting\n",
+		job:    "myservice",
+	},
+	{
+		name:    "instance",
+		output:  "tty (tty1) start/running, process 1054\ntty (tty2) start/running, process 1061\n",
+		job:     "tty",
+		running: true,
+		pid:     "1054",
+	},
+	{
+		name:   "other job",
+		output: "myservice-helper start/running, process 1300\n",
+		job:    "myservice",
+	},
+	{
+		name:   "unknown job",
+		output: "initctl: Unknown job: myservice\n",
+		job:    "myservice",
+	},
+}
+
+func TestParseStatus(t *testing.T) {
+	for _, test := range statusOutputs {
+		t.Run(test.name, func(t *testing.T) {
+			running, pid := ParseStatus([]byte(test.output), test.job)
+			if running != test.running || pid != test.pid {
+				t.Errorf("ParseStatus() = %v, %q, want %v, %q", running, pid, test.running, test.pid)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import "os"
+
+// Warning - non-fatal problem of an operation, the operation skipped the
+// step and went on, e.g. a runlevel link which could not be created
+type Warning struct {
+	// Message - explanation for the administrator
+	Message string `json:"message"`
+
+	// Path of the file the warning refers to, if any
+	Path string `json:"path,omitempty"`
+}
+
+// Warner interface is implemented by daemons which report the non-fatal
+// problems of their last operation, which succeeded nevertheless
+type Warner interface {
+	// Warnings - warnings of the last Install, Remove, Enable or Disable
+	Warnings() []Warning
+}
+
+// Warnings - warnings of the last operation of the daemon
+func (properties *ServiceProperties) Warnings() []Warning {
+	return append([]Warning(nil), properties.warnings...)
+}
+
+// Start collecting the warnings of an operation
+func (properties *ServiceProperties) resetWarnings() {
+	properties.warnings = nil
+}
+
+// Record the errors of the skipped steps of the current operation as
+// warnings, they are logged as well
+func (properties *ServiceProperties) warn(errs ...error) {
+	for _, err := range errs {
+		warning := Warning{Message: err.Error()}
+		switch err := err.(type) {
+		case *os.LinkError:
+			warning.Path = err.New
+		case *os.PathError:
+			warning.Path = err.Path
+		}
+		diagnostics.Println("Warning of", properties.def.Name+":", err)
+		properties.warnings = append(properties.warnings, warning)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Environment of a service whose watchdog is enabled by systemd
+const (
+	envWatchdogUsec = "WATCHDOG_USEC"
+	envWatchdogPID  = "WATCHDOG_PID"
+)
+
+// HealthChecker interface may be implemented by an Executable to report
+// its liveness: while it runs, Run keeps the watchdog of systemd fed and
+// the heartbeat file (see HeartbeatFile) fresh only as long as Healthy
+// reports true, so a hung service is restarted or reported not responding
+type HealthChecker interface {
+	// Healthy - the service makes progress, it should return quickly
+	Healthy() bool
+}
+
+// Check the init system has a watchdog which restarts a hung service:
+// systemd (WatchdogSec=) only, the other init systems see the heartbeat
+func checkWatchdog(kind Kind, def *Definition) error {
+	if def.Watchdog == 0 || kind == KindSystemD {
+		return nil
+	}
+	return &UnsupportedOptionError{"watchdog", kind}
+}
+
+// The executable reports its health, or it is healthy since it
+// does not check it
+func healthy(e Executable) bool {
+	checker, ok := e.(HealthChecker)
+	return !ok || checker.Healthy()
+}
+
+// watchdogFeeder - keeps the watchdog of systemd fed while the service runs
+type watchdogFeeder struct {
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Feed the watchdog of systemd (WATCHDOG=1) at half of its timeout while
+// the executable is healthy, if systemd enabled the watchdog for this
+// process (WATCHDOG_USEC and WATCHDOG_PID)
+func (properties *ServiceProperties) feedWatchdog(e Executable) *watchdogFeeder {
+	usec, err := strconv.ParseInt(os.Getenv(envWatchdogUsec), 10, 64)
+	if err != nil || usec <= 0 {
+		return nil
+	}
+	if pid := os.Getenv(envWatchdogPID); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return nil
+	}
+	name := properties.def.Name
+	feeder := &watchdogFeeder{done: make(chan struct{})}
+	feeder.wg.Add(1)
+	go func() {
+		defer feeder.wg.Done()
+		ticker := time.NewTicker(time.Duration(usec) * time.Microsecond / 2)
+		defer ticker.Stop()
+		for {
+			if !healthy(e) {
+				diagnostics.Println("Service", name, "is not healthy, the watchdog is not fed")
+			} else if err := notifySystemd("WATCHDOG=1"); err != nil {
+				diagnostics.Println("Watchdog of", name, "can not be fed:", err)
+			}
+			select {
+			case <-feeder.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return feeder
+}
+
+// Close - stop feeding the watchdog
+func (feeder *watchdogFeeder) Close() {
+	if feeder == nil {
+		return
+	}
+	close(feeder.done)
+	feeder.wg.Wait()
+}
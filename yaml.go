@@ -0,0 +1,398 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The YAML of the definition files is the subset which configuration files
+// use: block mappings and sequences, flow sequences, literal and folded block
+// scalars, quoted and plain scalars and comments. Anchors, tags and multiple
+// documents are not supported.
+
+// yamlParser - lines of a YAML document and the current one
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+// Plain scalars which are numbers
+var (
+	yamlIntRegexp   = regexp.MustCompile(`^[-+]?(0|[1-9][0-9]*)$`)
+	yamlOctRegexp   = regexp.MustCompile(`^0o?[0-7]+$`)
+	yamlHexRegexp   = regexp.MustCompile(`^0x[0-9a-fA-F]+$`)
+	yamlFloatRegexp = regexp.MustCompile(`^[-+]?([0-9]+\.[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?$`)
+)
+
+// Decode the YAML document into maps, slices and scalars
+func decodeYAML(data []byte) (interface{}, error) {
+	p := &yamlParser{lines: strings.Split(strings.Replace(string(data), "\r\n", "\n", -1), "\n")}
+	indent, _, ok := p.next()
+	if !ok {
+		return map[string]interface{}{}, nil
+	}
+	value, err := p.block(indent)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, ok := p.next(); ok {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return value, nil
+}
+
+// Error at the current line
+func (p *yamlParser) errorf(message string) error {
+	return errors.New("YAML line " + strconv.Itoa(p.pos+1) + ": " + message)
+}
+
+// Error at the line of the value which was read last, the current line
+// is the one after it
+func (p *yamlParser) valueErrorf(message string) error {
+	return errors.New("YAML line " + strconv.Itoa(p.pos) + ": " + message)
+}
+
+// Indentation and text of the next line with content, the current line
+// is moved to it; empty lines, comments and document markers are skipped
+func (p *yamlParser) next() (indent int, text string, ok bool) {
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		text = strings.TrimSpace(line)
+		if text == "" || text[0] == '#' || text == "---" {
+			continue
+		}
+		return len(line) - len(strings.TrimLeft(line, " ")), text, true
+	}
+	return 0, "", false
+}
+
+// Mapping or sequence which starts at the current line
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	_, text, _ := p.next()
+	if yamlItem(text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+// Check the text is an item of a block sequence
+func yamlItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// Block sequence of the items with the indentation
+func (p *yamlParser) sequence(indent int) ([]interface{}, error) {
+	items := []interface{}{}
+	for {
+		current, text, ok := p.next()
+		if !ok || current < indent || (current == indent && !yamlItem(text)) {
+			return items, nil
+		}
+		if current > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		rest := strings.TrimLeft(text[1:], " ")
+		var item interface{}
+		var err error
+		switch _, _, entry := yamlEntry(rest); {
+		case rest == "" || rest[0] == '#':
+			p.pos++
+			item, err = p.nested(indent, false)
+		case entry || yamlItem(rest):
+			// the item is a block which starts on the line of the dash
+			column := indent + len(text) - len(rest)
+			p.lines[p.pos] = strings.Repeat(" ", column) + rest
+			item, err = p.block(column)
+		default:
+			p.pos++
+			item, err = p.value(rest, indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+}
+
+// Block mapping of the keys with the indentation
+func (p *yamlParser) mapping(indent int) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for {
+		current, text, ok := p.next()
+		if !ok || current < indent {
+			return values, nil
+		}
+		if current > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		key, rest, ok := yamlEntry(text)
+		if !ok {
+			return nil, p.errorf("key expected")
+		}
+		if _, ok := values[key]; ok {
+			return nil, p.errorf("duplicate key " + strconv.Quote(key))
+		}
+		p.pos++
+		var value interface{}
+		var err error
+		if rest == "" || rest[0] == '#' {
+			value, err = p.nested(indent, true)
+		} else {
+			value, err = p.value(rest, indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+}
+
+// Block below a key or a dash, null if there is none; the items of a
+// sequence which is the value of a key may have the indentation of the key
+func (p *yamlParser) nested(indent int, key bool) (interface{}, error) {
+	current, text, ok := p.next()
+	if ok && (current > indent || (key && current == indent && yamlItem(text))) {
+		return p.block(current)
+	}
+	return nil, nil
+}
+
+// Key and value of a "key: value" entry
+func yamlEntry(text string) (key, rest string, ok bool) {
+	if text != "" && (text[0] == '"' || text[0] == '\'') {
+		end := quoteEnd(text)
+		if end < 0 || end+1 >= len(text) || text[end+1] != ':' {
+			return "", "", false
+		}
+		unquoted, err := yamlQuoted(text[:end+1])
+		if err != nil {
+			return "", "", false
+		}
+		rest = text[end+2:]
+		if rest != "" && rest[0] != ' ' {
+			return "", "", false
+		}
+		return unquoted, strings.TrimSpace(rest), true
+	}
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", false
+		}
+		i = len(text) - 1
+	}
+	key = strings.TrimSpace(text[:i])
+	if key == "" || strings.ContainsAny(key[:1], "-[{#") {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(text[i+1:]), true
+}
+
+// Index of the closing quote of the quoted text which starts the string
+func quoteEnd(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case text[i] == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// Text without its trailing comment
+func stripComment(text string) string {
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '"' || text[i] == '\'':
+			if end := quoteEnd(text[i:]); end >= 0 {
+				i += end
+			}
+		case text[i] == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return strings.TrimSpace(text[:i])
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+// Value which follows a key or a dash on the same line
+func (p *yamlParser) value(text string, indent int) (interface{}, error) {
+	text = stripComment(text)
+	switch {
+	case text == "":
+		return nil, nil
+	case text[0] == '|' || text[0] == '>':
+		return p.blockScalar(text, indent)
+	case text[0] == '[':
+		if !strings.HasSuffix(text, "]") {
+			return nil, p.valueErrorf("flow sequences must end on their line")
+		}
+		items := []interface{}{}
+		for _, item := range splitFlow(text[1 : len(text)-1]) {
+			value, err := yamlScalar(item)
+			if err != nil {
+				return nil, p.valueErrorf(err.Error())
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	case text[0] == '{':
+		if !strings.HasSuffix(text, "}") {
+			return nil, p.valueErrorf("flow mappings must end on their line")
+		}
+		values := map[string]interface{}{}
+		for _, entry := range splitFlow(text[1 : len(text)-1]) {
+			key, rest, ok := yamlEntry(entry)
+			if !ok {
+				return nil, p.valueErrorf("key expected")
+			}
+			value, err := yamlScalar(rest)
+			if err != nil {
+				return nil, p.valueErrorf(err.Error())
+			}
+			values[key] = value
+		}
+		return values, nil
+	}
+	value, err := yamlScalar(text)
+	if err != nil {
+		return nil, p.valueErrorf(err.Error())
+	}
+	return value, nil
+}
+
+// Items of a flow collection separated by commas outside of quotes
+func splitFlow(text string) []string {
+	var items []string
+	start := 0
+	for i := 0; i <= len(text); i++ {
+		switch {
+		case i == len(text) || text[i] == ',':
+			if item := strings.TrimSpace(text[start:i]); item != "" {
+				items = append(items, item)
+			}
+			start = i + 1
+		case text[i] == '"' || text[i] == '\'':
+			if end := quoteEnd(text[i:]); end >= 0 {
+				i += end
+			}
+		}
+	}
+	return items
+}
+
+// Literal (|) or folded (>) block scalar of the lines which are indented
+// more than the key, with the chomping indicator - or +
+func (p *yamlParser) blockScalar(header string, indent int) (string, error) {
+	folded, chomp := header[0] == '>', header[1:]
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return "", p.valueErrorf("unsupported block scalar header " + strconv.Quote(header))
+	}
+	var lines []string
+	block := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		current := len(line) - len(strings.TrimLeft(line, " "))
+		if block < 0 {
+			block = current
+		}
+		if current <= indent || current < block {
+			break
+		}
+		lines = append(lines, line[block:])
+	}
+	// the trailing empty lines belong to the chomping
+	content := len(lines)
+	for content > 0 && lines[content-1] == "" {
+		content--
+	}
+	var text string
+	if folded {
+		var b strings.Builder
+		for i, line := range lines[:content] {
+			switch {
+			case i == 0 || (line != "" && lines[i-1] == ""):
+			case line == "":
+				b.WriteString("\n")
+			default:
+				b.WriteString(" ")
+			}
+			b.WriteString(line)
+		}
+		text = b.String()
+	} else {
+		text = strings.Join(lines[:content], "\n")
+	}
+	switch {
+	case chomp == "-" || content == 0:
+	case chomp == "+":
+		text += strings.Repeat("\n", len(lines)-content+1)
+	default:
+		text += "\n"
+	}
+	return text, nil
+}
+
+// Quoted or plain scalar: null, boolean, number or string
+func yamlScalar(text string) (interface{}, error) {
+	if text == "" {
+		return nil, nil
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		if quoteEnd(text) != len(text)-1 {
+			return nil, errors.New("unterminated or trailing text after quoted string")
+		}
+		return yamlQuoted(text)
+	}
+	switch text {
+	case "null", "Null", "NULL", "~":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	switch {
+	case yamlIntRegexp.MatchString(text):
+		return strconv.ParseInt(text, 10, 64)
+	case yamlOctRegexp.MatchString(text):
+		// file modes are written in octal, e.g. 0640
+		return strconv.ParseInt(strings.TrimPrefix(text[1:], "o"), 8, 64)
+	case yamlHexRegexp.MatchString(text):
+		return strconv.ParseInt(text[2:], 16, 64)
+	case yamlFloatRegexp.MatchString(text):
+		value, err := strconv.ParseFloat(text, 64)
+		if err == nil && value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+			return int64(value), nil
+		}
+		return value, err
+	}
+	return text, nil
+}
+
+// Content of a double or single quoted string
+func yamlQuoted(text string) (string, error) {
+	if text[0] == '\'' {
+		return strings.Replace(text[1:len(text)-1], "''", "'", -1), nil
+	}
+	value, err := strconv.Unquote(text)
+	if err != nil {
+		return "", errors.New("invalid double quoted string " + text)
+	}
+	return value, nil
+}
@@ -0,0 +1,251 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want interface{}
+	}{
+		{
+			name: "empty document",
+			text: "# nothing but a comment\n---\n",
+			want: map[string]interface{}{},
+		},
+		{
+			name: "block mapping",
+			text: "name: web\ndescription: Web Server\nenabled: true\nworkers: 4\nratio: 0.5\nmode: 0640\nmask: 0x1f\nmissing: ~\nempty:\n",
+			want: map[string]interface{}{
+				"name":        "web",
+				"description": "Web Server",
+				"enabled":     true,
+				"workers":     int64(4),
+				"ratio":       0.5,
+				"mode":        int64(0640),
+				"mask":        int64(0x1f),
+				"missing":     nil,
+				"empty":       nil,
+			},
+		},
+		{
+			name: "nested block mappings and sequences",
+			text: `name: web
+environment:
+  PORT: "8080"
+  HOST: localhost
+args:
+  - --port
+  - 8080
+after:
+- network.target
+- db
+`,
+			want: map[string]interface{}{
+				"name":        "web",
+				"environment": map[string]interface{}{"PORT": "8080", "HOST": "localhost"},
+				"args":        []interface{}{"--port", int64(8080)},
+				"after":       []interface{}{"network.target", "db"},
+			},
+		},
+		{
+			name: "sequence of mappings",
+			text: `config_files:
+  - path: /etc/web.conf
+    mode: 0600
+  - path: /etc/web.env
+    content: |
+      A=1
+`,
+			want: map[string]interface{}{
+				"config_files": []interface{}{
+					map[string]interface{}{"path": "/etc/web.conf", "mode": int64(0600)},
+					map[string]interface{}{"path": "/etc/web.env", "content": "A=1\n"},
+				},
+			},
+		},
+		{
+			name: "nested sequences",
+			text: "matrix:\n  - - 1\n    - 2\n  -\n    - 3\n",
+			want: map[string]interface{}{
+				"matrix": []interface{}{
+					[]interface{}{int64(1), int64(2)},
+					[]interface{}{int64(3)},
+				},
+			},
+		},
+		{
+			name: "top level sequence",
+			text: "- a\n- b\n",
+			want: []interface{}{"a", "b"},
+		},
+		{
+			name: "flow sequences and mappings",
+			text: "ports: [80, \"443\", 'a, b']\nlimits: {nofile: 1024, \"core dump\": 'no'}\nnone: []\n",
+			want: map[string]interface{}{
+				"ports":  []interface{}{int64(80), "443", "a, b"},
+				"limits": map[string]interface{}{"nofile": int64(1024), "core dump": "no"},
+				"none":   []interface{}{},
+			},
+		},
+		{
+			name: "literal block scalars",
+			text: "clip: |\n  one\n    two\n\n  three\n\nstrip: |-\n  text\nkeep: |+\n  text\n\n\nlast: end\n",
+			want: map[string]interface{}{
+				"clip":  "one\n  two\n\nthree\n",
+				"strip": "text",
+				"keep":  "text\n\n\n",
+				"last":  "end",
+			},
+		},
+		{
+			name: "folded block scalars",
+			text: "description: >\n  A long\n  description\n\n  of the service\nshort: >-\n  one\n  line\n",
+			want: map[string]interface{}{
+				"description": "A long description\nof the service\n",
+				"short":       "one line",
+			},
+		},
+		{
+			name: "quoted scalars with escapes",
+			text: `double: "tab\there \"quoted\" \u00e9"
+single: 'it''s # not a comment'
+number: "42"
+boolean: 'true'
+"quoted key": value
+'single key': value
+`,
+			want: map[string]interface{}{
+				"double":     "tab\there \"quoted\" \u00e9",
+				"single":     "it's # not a comment",
+				"number":     "42",
+				"boolean":    "true",
+				"quoted key": "value",
+				"single key": "value",
+			},
+		},
+		{
+			name: "inline comments",
+			text: `# the service
+name: web # the name
+url: http://host/#anchor
+tags: [a, b] # flow
+list: # the items
+  - one # first
+  - "two # second" # quoted
+`,
+			want: map[string]interface{}{
+				"name": "web",
+				"url":  "http://host/#anchor",
+				"tags": []interface{}{"a", "b"},
+				"list": []interface{}{"one", "two # second"},
+			},
+		},
+		{
+			name: "windows line ends",
+			text: "name: web\r\nargs:\r\n  - a\r\n",
+			want: map[string]interface{}{
+				"name": "web",
+				"args": []interface{}{"a"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := decodeYAML([]byte(test.text))
+			if err != nil {
+				t.Fatalf("decodeYAML() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("decodeYAML() = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "unexpected indentation",
+			text: "name: web\n  description: Web\n",
+			want: "YAML line 2: unexpected indentation",
+		},
+		{
+			name: "indented item",
+			text: "args:\n  - a\n    - b\n",
+			want: "YAML line 3: unexpected indentation",
+		},
+		{
+			name: "missing key",
+			text: "name: web\njust text\n",
+			want: "YAML line 2: key expected",
+		},
+		{
+			name: "duplicate key",
+			text: "name: web\n\nname: api\n",
+			want: `YAML line 3: duplicate key "name"`,
+		},
+		{
+			name: "unterminated flow sequence",
+			text: "ports: [80,\n  443]\n",
+			want: "YAML line 1: flow sequences must end on their line",
+		},
+		{
+			name: "unterminated flow mapping",
+			text: "name: web\nlimits: {nofile: 1024\n",
+			want: "YAML line 2: flow mappings must end on their line",
+		},
+		{
+			name: "flow mapping without key",
+			text: "limits: {1024}\n",
+			want: "YAML line 1: key expected",
+		},
+		{
+			name: "unterminated quoted string",
+			text: "name: \"web\n",
+			want: "YAML line 1: unterminated or trailing text after quoted string",
+		},
+		{
+			name: "trailing text after quoted string",
+			text: "name: 'web' server\n",
+			want: "YAML line 1: unterminated or trailing text after quoted string",
+		},
+		{
+			name: "invalid escape",
+			text: "name: web\npath: \"C:\\q\"\n",
+			want: `YAML line 2: invalid double quoted string "C:\q"`,
+		},
+		{
+			name: "unsupported block scalar header",
+			text: "script: |2\n  echo\n",
+			want: `YAML line 1: unsupported block scalar header "|2"`,
+		},
+		{
+			name: "less indented continuation",
+			text: "  name: web\nargs: [a]\n",
+			want: "YAML line 2: unexpected indentation",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := decodeYAML([]byte(test.text))
+			if err == nil {
+				t.Fatalf("decodeYAML() error = nil, want %q", test.want)
+			}
+			if err.Error() != test.want {
+				t.Errorf("decodeYAML() error = %q, want %q", err, test.want)
+			}
+		})
+	}
+}